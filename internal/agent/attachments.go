@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// maxImageBytes caps an image sent inline to a vision backend.
+const maxImageBytes = 20 << 20
+
+// Attachment is a file that came with a message, stored on local disk.
+type Attachment struct {
+	Kind     string `json:"kind"` // "image" or "document"
+	Path     string `json:"path"` // absolute path, readable by tools
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// encodedImage is an image attachment ready for a backend request.
+type encodedImage struct {
+	Path     string
+	MIMEType string
+	Data     string // base64
+}
+
+// hasImage reports whether attachments include an image.
+func hasImage(attachments []Attachment) bool {
+	for _, a := range attachments {
+		if a.Kind == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// turnImages reads the image attachments of the turn in ctx. Files that
+// cannot be read are skipped; the prompt still names their path.
+func turnImages(ctx context.Context) []encodedImage {
+	t := TurnFromContext(ctx)
+	if t == nil {
+		return nil
+	}
+	var images []encodedImage
+	for _, a := range t.Message.Attachments {
+		if a.Kind != "image" {
+			continue
+		}
+		info, err := os.Stat(a.Path)
+		if err != nil || info.Size() > maxImageBytes {
+			continue
+		}
+		data, err := os.ReadFile(a.Path)
+		if err != nil {
+			continue
+		}
+		mimeType := a.MIMEType
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(filepath.Ext(a.Path))
+		}
+		if mimeType == "" {
+			mimeType = "image/jpeg"
+		}
+		images = append(images, encodedImage{Path: a.Path, MIMEType: mimeType, Data: base64.StdEncoding.EncodeToString(data)})
+	}
+	notePromptImages(ctx, images)
+	return images
+}
+
+// notePromptImages records which images went to the backend as image content.
+func notePromptImages(ctx context.Context, images []encodedImage) {
+	t := TurnFromContext(ctx)
+	if t == nil || len(images) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prompt != nil {
+		t.prompt.Images = paths
+	}
+}
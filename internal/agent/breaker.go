@@ -0,0 +1,87 @@
+package agent
+
+import "time"
+
+// BreakerState is the circuit breaker state of a registry backend.
+type BreakerState string
+
+const (
+	// BreakerClosed: backend is healthy and takes traffic.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen: backend failed and is skipped until its backoff expires.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen: backoff expired; probes and a single trial prompt
+	// decide whether the breaker closes again or reopens with a longer backoff.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// circuitBreaker tracks failures of one backend. Each consecutive trip doubles
+// the open duration, starting at base and capped at max.
+type circuitBreaker struct {
+	state      BreakerState
+	trips      int // consecutive trips without a success in between
+	openUntil  time.Time
+	trialUntil time.Time // half-open: a trial prompt holds the slot until it reports back or this passes
+}
+
+// allow reports whether the backend may take traffic, moving an expired open
+// breaker to half-open.
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	switch cb.state {
+	case BreakerOpen:
+		if now.Before(cb.openUntil) {
+			return false
+		}
+		cb.state = BreakerHalfOpen
+		return true
+	default:
+		return true
+	}
+}
+
+// acquire reports whether a prompt may start now. A half-open breaker admits
+// one trial prompt at a time; the trial holds the slot until success, trip or
+// release, or until ttl passes without a verdict.
+func (cb *circuitBreaker) acquire(now time.Time, ttl time.Duration) bool {
+	if !cb.allow(now) {
+		return false
+	}
+	if cb.state != BreakerHalfOpen {
+		return true
+	}
+	if now.Before(cb.trialUntil) {
+		return false
+	}
+	cb.trialUntil = now.Add(ttl)
+	return true
+}
+
+// release frees the trial slot of a prompt that ended without a verdict on the
+// backend (e.g. canceled by the caller).
+func (cb *circuitBreaker) release() {
+	cb.trialUntil = time.Time{}
+}
+
+// success closes the breaker and resets the backoff.
+func (cb *circuitBreaker) success() {
+	cb.state = BreakerClosed
+	cb.trips = 0
+	cb.openUntil = time.Time{}
+	cb.trialUntil = time.Time{}
+}
+
+// trip opens the breaker and returns how long it stays open.
+func (cb *circuitBreaker) trip(now time.Time, base, max time.Duration) time.Duration {
+	cb.trips++
+	backoff := base
+	for i := 1; i < cb.trips && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max && max >= base {
+		backoff = max
+	}
+	cb.state = BreakerOpen
+	cb.openUntil = now.Add(backoff)
+	cb.trialUntil = time.Time{}
+	return backoff
+}
@@ -1,6 +1,10 @@
 package agent
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // BackendLabeler exposes a human-readable backend label shown in response footers.
 // Example: "pi/codex".
@@ -14,6 +18,56 @@ type ModelSwitcher interface {
 	Model() string
 }
 
+// ConcurrencyLimiter is implemented by backends that can only run a limited number
+// of prompts at once (example: a single pi rpc process). 0 means unlimited.
+type ConcurrencyLimiter interface {
+	MaxConcurrentPrompts() int
+}
+
+// ModelLister is implemented by backends that can enumerate the models they serve.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// HealthChecker is implemented by backends that can probe their upstream
+// (example: pinging a local model server). Backends without it fall back to
+// the name-based checks in checkHealth.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// VisionCapable is implemented by backends that can receive image attachments
+// as image content. Other backends only see the local path in the prompt.
+type VisionCapable interface {
+	SupportsVision() bool
+}
+
+// SteerMode selects how a message reaches a turn that is already running.
+type SteerMode string
+
+const (
+	SteerOff       SteerMode = ""
+	SteerInterrupt SteerMode = "steer"     // delivered after the current tool call, remaining tool calls are skipped
+	SteerFollowUp  SteerMode = "follow_up" // delivered once the agent would otherwise stop
+)
+
+// ErrNotSteerable is returned by Steer when the turn is not running on the backend.
+var ErrNotSteerable = errors.New("no running turn to steer")
+
+// Steerer is implemented by backends that accept more user input while a turn
+// is running (example: the pi rpc steer and follow_up commands). Steer returns
+// nil only once the backend accepted the message into the turn; on any error
+// the caller queues the message as usual.
+type Steerer interface {
+	Steer(ctx context.Context, turnID string, mode SteerMode, message string) error
+}
+
+// CrashLoopNotifier is implemented by backends running a supervised process.
+// The registry uses it to open the backend's breaker when the process keeps crashing.
+type CrashLoopNotifier interface {
+	SetCrashLoopHandler(fn func(reason string))
+}
+
 type ModelStatus struct {
 	Backend        string
 	Model          string
@@ -67,3 +121,32 @@ func modelStatus(defaultBackend string, a Agent) ModelStatus {
 	}
 	return ModelStatus{Backend: defaultBackend, Model: currentModel(a), Source: "runtime"}
 }
+
+func processStatus(a Agent) (ProcessStatus, bool) {
+	r, ok := a.(ProcessStatusReporter)
+	if !ok {
+		return ProcessStatus{}, false
+	}
+	return r.ProcessStatus()
+}
+
+func supportsVision(a Agent) bool {
+	v, ok := a.(VisionCapable)
+	return ok && v.SupportsVision()
+}
+
+func maxConcurrentPrompts(a Agent) int {
+	cl, ok := a.(ConcurrencyLimiter)
+	if !ok {
+		return 0
+	}
+	return cl.MaxConcurrentPrompts()
+}
+
+func listModels(ctx context.Context, a Agent) ([]string, error) {
+	ml, ok := a.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("active backend does not support model listing")
+	}
+	return ml.ListModels(ctx)
+}
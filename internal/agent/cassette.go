@@ -0,0 +1,310 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"visor/internal/observability"
+)
+
+type CassetteMode string
+
+const (
+	CassetteRecord CassetteMode = "record" // wrap a live backend and append every exchange
+	CassetteReplay CassetteMode = "replay" // serve recorded exchanges, no backend needed
+)
+
+// CassetteEntry is one recorded prompt exchange.
+type CassetteEntry struct {
+	Prompt    string     `json:"prompt"`
+	Response  string     `json:"response"`
+	Error     string     `json:"error,omitempty"`
+	ErrorKind ErrorKind  `json:"error_kind,omitempty"`
+	Deltas    []string   `json:"deltas,omitempty"`     // streamed progress, in order
+	Usage     []Usage    `json:"usage,omitempty"`      // usage reported during the call
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"` // tools the backend ran, replayed against the toolbox
+}
+
+// CassetteConfig configures a CassetteAgent.
+type CassetteConfig struct {
+	Path  string
+	Mode  CassetteMode
+	Inner Agent // backend being recorded; unused in replay mode
+	Exact bool  // replay: match prompts byte for byte instead of normalized
+}
+
+// CassetteAgent records prompt/response exchanges of another backend to a
+// jsonl file, or replays them, for deterministic end-to-end tests.
+type CassetteAgent struct {
+	path  string
+	mode  CassetteMode
+	inner Agent
+	exact bool
+
+	mu      sync.Mutex
+	entries []CassetteEntry
+	used    []bool
+	log     *observability.Logger
+}
+
+func NewCassetteAgent(cfg CassetteConfig) (*CassetteAgent, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("cassette: path is required")
+	}
+	c := &CassetteAgent{
+		path:  cfg.Path,
+		mode:  cfg.Mode,
+		inner: cfg.Inner,
+		exact: cfg.Exact,
+		log:   observability.Component("agent.cassette"),
+	}
+	switch cfg.Mode {
+	case CassetteRecord:
+		if cfg.Inner == nil {
+			return nil, fmt.Errorf("cassette: record mode needs a backend to record")
+		}
+		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+			return nil, fmt.Errorf("cassette: mkdir: %w", err)
+		}
+	case CassetteReplay:
+		entries, err := LoadCassette(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		c.entries = entries
+		c.used = make([]bool, len(entries))
+		c.log.Info(nil, "cassette loaded", "path", cfg.Path, "entries", len(entries))
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q (record, replay)", cfg.Mode)
+	}
+	return c, nil
+}
+
+// LoadCassette reads all entries of a cassette file.
+func LoadCassette(path string) ([]CassetteEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: open: %w", err)
+	}
+	defer f.Close()
+
+	var entries []CassetteEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		var e CassetteEntry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			return nil, fmt.Errorf("cassette: %s line %d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cassette: read: %w", err)
+	}
+	return entries, nil
+}
+
+func (c *CassetteAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	if c.mode == CassetteRecord {
+		return c.record(ctx, prompt)
+	}
+	return c.replay(ctx, prompt)
+}
+
+func (c *CassetteAgent) record(ctx context.Context, prompt string) (string, error) {
+	entry := CassetteEntry{Prompt: prompt}
+
+	// run the backend on a child turn so usage and tool calls of this call can
+	// be captured; usage is passed on to the caller's turn afterwards.
+	parentCtx := ctx
+	child := &Turn{}
+	if parent := TurnFromContext(ctx); parent != nil {
+		child = &Turn{ID: parent.ID, Message: parent.Message, history: parent.history, toolbox: parent.toolbox}
+	}
+	var recMu sync.Mutex
+	if inner := child.toolbox; inner != nil {
+		child.toolbox = toolboxFunc{tools: inner.Tools, call: func(ctx context.Context, call ToolCall) (string, error) {
+			recMu.Lock()
+			entry.ToolCalls = append(entry.ToolCalls, call)
+			recMu.Unlock()
+			return inner.Call(ctx, call)
+		}}
+	}
+	ctx = withTurn(ctx, child)
+	outer := progressReporterFrom(ctx)
+	ctx = withProgressReporter(ctx, func(delta string) {
+		recMu.Lock()
+		entry.Deltas = append(entry.Deltas, delta)
+		recMu.Unlock()
+		if outer != nil {
+			outer(delta)
+		}
+	})
+	outerReset := ctx.Value(progressResetKey{})
+	ctx = withProgressReset(ctx, func() {
+		recMu.Lock()
+		entry.Deltas = nil
+		recMu.Unlock()
+		if fn, ok := outerReset.(func()); ok && fn != nil {
+			fn()
+		}
+	})
+
+	resp, err := c.inner.SendPrompt(ctx, prompt)
+
+	recMu.Lock()
+	defer recMu.Unlock()
+	entry.Response = resp
+	entry.Usage = child.Usage()
+	for _, u := range entry.Usage {
+		reportUsage(parentCtx, u)
+	}
+	if route, ok := child.Route(); ok {
+		setRoute(parentCtx, route)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		var pe *ProviderError
+		if errors.As(err, &pe) {
+			entry.ErrorKind = pe.Kind
+		}
+	}
+	if writeErr := c.append(entry); writeErr != nil {
+		c.log.Error(ctx, "cassette write failed", "path", c.path, "error", writeErr.Error())
+	}
+	return resp, err
+}
+
+func (c *CassetteAgent) append(e CassetteEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode entry: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *CassetteAgent) replay(ctx context.Context, prompt string) (string, error) {
+	entry, ok := c.match(prompt)
+	if !ok {
+		c.log.Warn(ctx, "cassette miss", "path", c.path, "prompt", truncateForLog(prompt, 120))
+		return "", fmt.Errorf("cassette: no recording for prompt %q", truncateForLog(prompt, 80))
+	}
+	if tb := toolboxFromContext(ctx); tb != nil {
+		for _, call := range entry.ToolCalls {
+			runToolCall(ctx, tb, "cassette", call)
+		}
+	}
+	for _, d := range entry.Deltas {
+		reportProgress(ctx, d)
+	}
+	for _, u := range entry.Usage {
+		reportUsage(ctx, u)
+	}
+	if entry.Error != "" {
+		if entry.ErrorKind != "" {
+			return entry.Response, &ProviderError{Kind: entry.ErrorKind, Backend: "cassette", Message: entry.Error}
+		}
+		return entry.Response, errors.New(entry.Error)
+	}
+	return entry.Response, nil
+}
+
+// match returns the first unused entry for prompt: exact matches first, then
+// normalized ones. Once every match was served the last one is repeated.
+func (c *CassetteAgent) match(prompt string) (CassetteEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	matchers := []func(string) bool{func(p string) bool { return p == prompt }}
+	if !c.exact {
+		norm := normalizePrompt(prompt)
+		matchers = append(matchers, func(p string) bool { return normalizePrompt(p) == norm })
+	}
+	for _, matches := range matchers {
+		last := -1
+		for i, e := range c.entries {
+			if !matches(e.Prompt) {
+				continue
+			}
+			if !c.used[i] {
+				c.used[i] = true
+				return e, true
+			}
+			last = i
+		}
+		if last >= 0 {
+			return c.entries[last], true
+		}
+	}
+	return CassetteEntry{}, false
+}
+
+var (
+	cassetteTimestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[t ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:z|[+-]\d{2}:?\d{2})?)?`)
+	cassetteClockPattern     = regexp.MustCompile(`\b\d{1,2}:\d{2}(?::\d{2})?\b`)
+	cassetteUUIDPattern      = regexp.MustCompile(`\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// normalizePrompt makes prompts comparable across runs: case, whitespace,
+// dates, times and uuids are ignored.
+func normalizePrompt(p string) string {
+	p = strings.ToLower(p)
+	p = cassetteUUIDPattern.ReplaceAllString(p, "<id>")
+	p = cassetteTimestampPattern.ReplaceAllString(p, "<time>")
+	p = cassetteClockPattern.ReplaceAllString(p, "<time>")
+	return strings.Join(strings.Fields(p), " ")
+}
+
+func truncateForLog(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
+
+func (c *CassetteAgent) BackendLabel() string {
+	if c.mode == CassetteRecord {
+		return "cassette/" + backendLabel("record", c.inner)
+	}
+	return "cassette"
+}
+
+func (c *CassetteAgent) Close() error {
+	if c.inner != nil {
+		return c.inner.Close()
+	}
+	return nil
+}
+
+// toolboxFunc adapts functions to Toolbox.
+type toolboxFunc struct {
+	tools func() []Tool
+	call  func(ctx context.Context, call ToolCall) (string, error)
+}
+
+func (f toolboxFunc) Tools() []Tool { return f.tools() }
+func (f toolboxFunc) Call(ctx context.Context, call ToolCall) (string, error) {
+	return f.call(ctx, call)
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scriptedAgent streams a reply, reports usage and runs one tool call.
+type scriptedAgent struct{}
+
+func (scriptedAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	if prompt == "fail" {
+		return "", &ProviderError{Kind: ErrRateLimited, Backend: "scripted", Message: "slow down"}
+	}
+	if tb := toolboxFromContext(ctx); tb != nil {
+		runToolCall(ctx, tb, "scripted", ToolCall{ID: "c1", Name: "schedule_list"})
+	}
+	reportProgress(ctx, "re: ")
+	reportProgress(ctx, prompt)
+	reportUsage(ctx, Usage{Backend: "scripted", Model: "s-1", InputTokens: 12, OutputTokens: 3})
+	return "re: " + prompt, nil
+}
+
+func (scriptedAgent) Close() error { return nil }
+
+func TestCassetteAgent_RecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "run.jsonl")
+	rec, err := NewCassetteAgent(CassetteConfig{Path: path, Mode: CassetteRecord, Inner: scriptedAgent{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recTools := &fakeToolbox{}
+	recTurn := &Turn{Message: Message{ChatID: 1}, toolbox: recTools}
+	var recDeltas []string
+	ctx := withProgressReporter(withTurn(context.Background(), recTurn), func(d string) { recDeltas = append(recDeltas, d) })
+	if resp, err := rec.SendPrompt(ctx, "Plan for 2026-03-01 at 09:30"); err != nil || resp != "re: Plan for 2026-03-01 at 09:30" {
+		t.Fatalf("record resp=%q err=%v", resp, err)
+	}
+	if _, err := rec.SendPrompt(context.Background(), "fail"); err == nil {
+		t.Fatal("expected recorded error")
+	}
+	if strings.Join(recDeltas, "") != "re: Plan for 2026-03-01 at 09:30" || len(recTurn.Usage()) != 1 || len(recTools.calls) != 1 {
+		t.Fatalf("recording hid deltas=%v usage=%v calls=%v from the caller", recDeltas, recTurn.Usage(), recTools.calls)
+	}
+
+	entries, err := LoadCassette(path)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("entries=%+v err=%v", entries, err)
+	}
+	if e := entries[0]; len(e.Deltas) != 2 || len(e.Usage) != 1 || len(e.ToolCalls) != 1 || e.ToolCalls[0].Name != "schedule_list" {
+		t.Fatalf("entry=%+v", e)
+	}
+
+	play, err := NewCassetteAgent(CassetteConfig{Path: path, Mode: CassetteReplay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := &fakeToolbox{}
+	turn := &Turn{Message: Message{ChatID: 1}, toolbox: tools}
+	var deltas []string
+	ctx = withProgressReporter(withTurn(context.Background(), turn), func(d string) { deltas = append(deltas, d) })
+
+	// dates, times, case and whitespace differ: normalized match
+	resp, err := play.SendPrompt(ctx, "plan for  2026-10-17 at 14:05")
+	if err != nil || resp != "re: Plan for 2026-03-01 at 09:30" {
+		t.Fatalf("replay resp=%q err=%v", resp, err)
+	}
+	if len(deltas) != 2 || len(turn.Usage()) != 1 || turn.Usage()[0].Model != "s-1" || len(tools.calls) != 1 {
+		t.Fatalf("replay deltas=%v usage=%v calls=%v", deltas, turn.Usage(), tools.calls)
+	}
+
+	_, err = play.SendPrompt(context.Background(), "fail")
+	var pe *ProviderError
+	if !errors.As(err, &pe) || pe.Kind != ErrRateLimited {
+		t.Fatalf("replayed error=%v, want rate limited", err)
+	}
+	if _, err := play.SendPrompt(context.Background(), "never recorded"); err == nil || !strings.Contains(err.Error(), "no recording") {
+		t.Fatalf("miss err=%v", err)
+	}
+
+	exact, _ := NewCassetteAgent(CassetteConfig{Path: path, Mode: CassetteReplay, Exact: true})
+	if _, err := exact.SendPrompt(context.Background(), "plan for 2026-10-17 at 14:05"); err == nil {
+		t.Fatal("exact mode matched a normalized prompt")
+	}
+}
+
+func TestCassetteAgent_RepeatsLastMatchOnceConsumed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	rec, _ := NewCassetteAgent(CassetteConfig{Path: path, Mode: CassetteRecord, Inner: &EchoAgent{}})
+	_, _ = rec.SendPrompt(context.Background(), "hi")
+
+	play, _ := NewCassetteAgent(CassetteConfig{Path: path, Mode: CassetteReplay})
+	for i := 0; i < 2; i++ {
+		if resp, err := play.SendPrompt(context.Background(), "hi"); err != nil || resp != "echo: hi" {
+			t.Fatalf("replay %d resp=%q err=%v", i, resp, err)
+		}
+	}
+}
+
+func TestNewCassetteAgent_Validation(t *testing.T) {
+	if _, err := NewCassetteAgent(CassetteConfig{Path: filepath.Join(t.TempDir(), "x.jsonl"), Mode: CassetteRecord}); err == nil {
+		t.Fatal("expected error for record mode without backend")
+	}
+	if _, err := NewCassetteAgent(CassetteConfig{Path: filepath.Join(t.TempDir(), "missing.jsonl"), Mode: CassetteReplay}); err == nil {
+		t.Fatal("expected error for missing cassette")
+	}
+	if _, err := NewCassetteAgent(CassetteConfig{Path: "x", Mode: "rewind"}); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies backend failures so the registry can decide between
+// failover, backoff and surfacing the error to the user.
+type ErrorKind string
+
+const (
+	ErrRateLimited     ErrorKind = "rate limited"     // 429; RetryAfter set when the upstream sent a hint
+	ErrQuotaExhausted  ErrorKind = "quota exhausted"  // billing/daily quota; won't recover soon
+	ErrUnavailable     ErrorKind = "unavailable"      // 5xx, overloaded, unreachable
+	ErrAuth            ErrorKind = "auth failed"      // 401/403, missing or revoked key
+	ErrTimeout         ErrorKind = "timeout"          // backend did not answer in time
+	ErrProcessCrash    ErrorKind = "process crash"    // cli backend exited or closed its pipes
+	ErrBadRequest      ErrorKind = "bad request"      // the request itself is wrong (unknown model, too long)
+	ErrContentFiltered ErrorKind = "content filtered" // provider refused the content
+)
+
+// ProviderError is a classified backend failure. Backends wrap upstream and
+// process errors into it; Err keeps the cause for errors.Is/As.
+type ProviderError struct {
+	Kind       ErrorKind
+	Backend    string
+	StatusCode int           // http status, zero for non-http backends
+	Message    string        // upstream message
+	RetryAfter time.Duration // zero when the upstream gave no hint
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Backend, e.Kind)
+	if e.StatusCode > 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	switch {
+	case e.Message != "":
+		msg += ": " + e.Message
+	case e.Err != nil:
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// httpStatusError classifies a non-2xx http response. message is the (already
+// read) upstream message; code is the provider's machine-readable error code, if any.
+func httpStatusError(backend string, resp *http.Response, message, code string) *ProviderError {
+	pe := &ProviderError{Backend: backend, StatusCode: resp.StatusCode, Message: message}
+	lowerCode := strings.ToLower(code + " " + message)
+	switch {
+	case strings.Contains(lowerCode, "content_filter") || strings.Contains(lowerCode, "content_policy"):
+		pe.Kind = ErrContentFiltered
+	case strings.Contains(lowerCode, "insufficient_quota") || strings.Contains(lowerCode, "quota"):
+		pe.Kind = ErrQuotaExhausted
+	case resp.StatusCode == http.StatusTooManyRequests:
+		pe.Kind = ErrRateLimited
+		pe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		pe.Kind = ErrAuth
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		pe.Kind = ErrTimeout
+	case resp.StatusCode >= 500:
+		pe.Kind = ErrUnavailable
+		pe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	default:
+		pe.Kind = ErrBadRequest
+	}
+	return pe
+}
+
+// parseRetryAfter accepts delay-seconds or an http date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// requestError classifies a transport failure: deadline → timeout, everything
+// else (refused, dns, reset) → unavailable. Caller cancellation is returned as is.
+func requestError(backend string, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%s: request failed: %w", backend, err)
+	}
+	kind := ErrUnavailable
+	if errors.Is(err, context.DeadlineExceeded) {
+		kind = ErrTimeout
+	}
+	return &ProviderError{Kind: kind, Backend: backend, Err: err}
+}
+
+// ClassifyError returns the kind of a backend error: the ProviderError kind
+// when typed, context.DeadlineExceeded as timeout, and otherwise the legacy
+// substring match for backends that still return plain errors. Empty when unknown.
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return legacyKind(err.Error())
+}
+
+func legacyKind(msg string) ErrorKind {
+	msg = strings.ToLower(msg)
+	for _, p := range legacyErrorPatterns {
+		if strings.Contains(msg, p.pattern) {
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// cliError wraps a failure of a cli backend. CLIs only report text, so the
+// message is matched against the legacy patterns first and def applies otherwise.
+func cliError(backend string, def ErrorKind, message string, err error) *ProviderError {
+	kind := def
+	if k := legacyKind(message); k != "" {
+		kind = k
+	}
+	return &ProviderError{Kind: kind, Backend: backend, Message: message, Err: err}
+}
+
+// legacyErrorPatterns classifies untyped errors; first match wins.
+var legacyErrorPatterns = []struct {
+	pattern string
+	kind    ErrorKind
+}{
+	{"quota", ErrQuotaExhausted},
+	{"resource_exhausted", ErrQuotaExhausted},
+	{"rate limit", ErrRateLimited},
+	{"rate_limit", ErrRateLimited},
+	{"ratelimit", ErrRateLimited},
+	{"429", ErrRateLimited},
+	{"too many requests", ErrRateLimited},
+	{"throttl", ErrRateLimited},
+	{"overloaded", ErrUnavailable},
+	{"server_overloaded", ErrUnavailable},
+	{"capacity", ErrUnavailable},
+}
+
+// retryAfter returns the upstream retry hint of a typed error, or zero.
+func retryAfter(err error) time.Duration {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.RetryAfter
+	}
+	return 0
+}
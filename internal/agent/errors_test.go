@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHTTPStatusErrorKinds(t *testing.T) {
+	tests := []struct {
+		status  int
+		message string
+		code    string
+		want    ErrorKind
+	}{
+		{429, "slow down", "rate_limit_exceeded", ErrRateLimited},
+		{429, "You exceeded your current quota", "insufficient_quota", ErrQuotaExhausted},
+		{401, "invalid api key", "", ErrAuth},
+		{403, "forbidden", "", ErrAuth},
+		{504, "gateway timeout", "", ErrTimeout},
+		{503, "overloaded", "", ErrUnavailable},
+		{400, "unknown model", "model_not_found", ErrBadRequest},
+		{400, "prompt was filtered", "content_filter", ErrContentFiltered},
+	}
+	for _, tc := range tests {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+		if got := httpStatusError("openai", resp, tc.message, tc.code).Kind; got != tc.want {
+			t.Errorf("status %d %q: kind=%q want %q", tc.status, tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := parseRetryAfter("12", now); got != 12*time.Second {
+		t.Fatalf("seconds=%s", got)
+	}
+	if got := parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now); got != time.Minute {
+		t.Fatalf("http date=%s", got)
+	}
+	if got := parseRetryAfter("soon", now); got != 0 {
+		t.Fatalf("garbage=%s", got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	typed := fmt.Errorf("wrapped: %w", &ProviderError{Kind: ErrAuth, Backend: "openai", Message: "rate limit mentioned in a 401 body"})
+	if got := ClassifyError(typed); got != ErrAuth {
+		t.Fatalf("typed error classified as %q, want auth (no substring fallback)", got)
+	}
+	if got := ClassifyError(fmt.Errorf("x: %w", context.DeadlineExceeded)); got != ErrTimeout {
+		t.Fatalf("deadline=%q", got)
+	}
+	if got := ClassifyError(errors.New("upstream quota exhausted")); got != ErrQuotaExhausted {
+		t.Fatalf("legacy quota=%q", got)
+	}
+	if got := ClassifyError(errors.New("connection refused")); got != "" {
+		t.Fatalf("unknown=%q", got)
+	}
+	if got := cliError("exec", ErrProcessCrash, "exit status 1: 429 too many requests", nil).Kind; got != ErrRateLimited {
+		t.Fatalf("cli stderr=%q", got)
+	}
+}
+
+func TestRequestErrorKeepsCancellation(t *testing.T) {
+	if err := requestError("ollama", context.Canceled); ClassifyError(err) != "" || !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled=%v", err)
+	}
+	if err := requestError("ollama", errors.New("dial tcp: connection refused")); ClassifyError(err) != ErrUnavailable {
+		t.Fatalf("refused=%v", err)
+	}
+}
@@ -0,0 +1,579 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"visor/internal/observability"
+)
+
+const (
+	execModeArgv  = "argv"  // one process per prompt, prompt passed as an argument
+	execModeStdin = "stdin" // one process per prompt, prompt written to stdin
+	execModeJSONL = "jsonl" // persistent process speaking json-lines (ProcessManager)
+
+	execPromptPlaceholder = "{prompt}"
+	defaultExecRequest    = `{"prompt":{prompt}}`
+)
+
+// ExecResponseRule describes how the reply is extracted from the CLI output.
+type ExecResponseRule struct {
+	Format     string `toml:"format"`      // text (default) | json | regex; jsonl mode always parses json lines
+	Field      string `toml:"field"`       // json/jsonl: dot path of the reply text (e.g. "result.text", "choices.0.text")
+	Pattern    string `toml:"pattern"`     // regex: first capture group (or whole match) is the reply
+	DeltaField string `toml:"delta_field"` // jsonl: dot path of streamed text chunks
+	DoneField  string `toml:"done_field"`  // jsonl: dot path that is true on the last line of a reply
+}
+
+// ExecBackendConfig defines a generic CLI backend (see docs/config-reference.md).
+type ExecBackendConfig struct {
+	Name            string           `toml:"-"`
+	Command         string           `toml:"command"`
+	Args            []string         `toml:"args"`              // "{prompt}" is replaced in argv mode
+	Mode            string           `toml:"mode"`              // argv | stdin | jsonl
+	Request         string           `toml:"request"`           // jsonl: request line, "{prompt}" becomes a json string
+	Timeout         int              `toml:"timeout"`           // seconds per prompt (0 = no limit)
+	RestartDelay    int              `toml:"restart_delay"`     // jsonl: seconds before respawning a dead process (default 3), doubles per crash
+	MaxRestartDelay int              `toml:"max_restart_delay"` // jsonl: cap of the restart delay in seconds (default 300)
+	PeriodicRestart int              `toml:"periodic_restart"`  // jsonl: seconds between forced restarts (0 = disabled)
+	LimitMemoryMB   int              `toml:"limit_memory_mb"`   // address space rlimit (0 = unlimited)
+	LimitCPUSeconds int              `toml:"limit_cpu_seconds"` // cpu time rlimit (0 = unlimited)
+	LimitOpenFiles  int              `toml:"limit_open_files"`  // open files rlimit (0 = unlimited)
+	Response        ExecResponseRule `toml:"response"`
+}
+
+type execBackendsFile struct {
+	Backends map[string]ExecBackendConfig `toml:"backends"`
+}
+
+// LoadExecBackends reads [backends.<name>] tables from a TOML file.
+// A missing file yields no backends.
+func LoadExecBackends(path string) (map[string]ExecBackendConfig, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var file execBackendsFile
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	out := make(map[string]ExecBackendConfig, len(file.Backends))
+	for name, cfg := range file.Backends {
+		cfg.Name = name
+		if err := cfg.validate(); err != nil {
+			return nil, fmt.Errorf("exec backend %s: %w", name, err)
+		}
+		out[name] = cfg
+	}
+	return out, nil
+}
+
+// ExecBackendFromEnv builds the "exec" backend from EXEC_* variables.
+// ok is false when EXEC_COMMAND is not set.
+func ExecBackendFromEnv() (cfg ExecBackendConfig, ok bool, err error) {
+	command := strings.TrimSpace(os.Getenv("EXEC_COMMAND"))
+	if command == "" {
+		return ExecBackendConfig{}, false, nil
+	}
+	cfg = ExecBackendConfig{
+		Name:    "exec",
+		Command: command,
+		Args:    strings.Fields(os.Getenv("EXEC_ARGS")),
+		Mode:    strings.TrimSpace(os.Getenv("EXEC_MODE")),
+		Request: os.Getenv("EXEC_REQUEST"),
+		Response: ExecResponseRule{
+			Format:     strings.TrimSpace(os.Getenv("EXEC_RESPONSE_FORMAT")),
+			Field:      strings.TrimSpace(os.Getenv("EXEC_RESPONSE_FIELD")),
+			Pattern:    os.Getenv("EXEC_RESPONSE_PATTERN"),
+			DeltaField: strings.TrimSpace(os.Getenv("EXEC_RESPONSE_DELTA_FIELD")),
+			DoneField:  strings.TrimSpace(os.Getenv("EXEC_RESPONSE_DONE_FIELD")),
+		},
+	}
+	if v := strings.TrimSpace(os.Getenv("EXEC_TIMEOUT_SECONDS")); v != "" {
+		n, convErr := strconv.Atoi(v)
+		if convErr != nil || n < 0 {
+			return ExecBackendConfig{}, false, fmt.Errorf("EXEC_TIMEOUT_SECONDS must be a non-negative number")
+		}
+		cfg.Timeout = n
+	}
+	if err := cfg.validate(); err != nil {
+		return ExecBackendConfig{}, false, fmt.Errorf("exec backend from env: %w", err)
+	}
+	return cfg, true, nil
+}
+
+func (c *ExecBackendConfig) validate() error {
+	if strings.TrimSpace(c.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if c.Mode == "" {
+		c.Mode = execModeArgv
+	}
+	switch c.Mode {
+	case execModeArgv, execModeStdin:
+	case execModeJSONL:
+		if c.Request == "" {
+			c.Request = defaultExecRequest
+		}
+		if !strings.Contains(c.Request, execPromptPlaceholder) {
+			return fmt.Errorf("request template must contain %s", execPromptPlaceholder)
+		}
+		if c.Response.Field == "" && c.Response.DeltaField == "" {
+			return fmt.Errorf("jsonl mode needs response.field or response.delta_field")
+		}
+		if c.Response.Field == "" && c.Response.DoneField == "" {
+			// without either, no line ever ends the reply and the prompt blocks until the process exits
+			return fmt.Errorf("jsonl mode with only response.delta_field needs response.done_field")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q (want argv, stdin or jsonl)", c.Mode)
+	}
+	if c.Response.Format == "" {
+		c.Response.Format = "text"
+	}
+	switch c.Response.Format {
+	case "text":
+	case "json":
+		if c.Response.Field == "" {
+			return fmt.Errorf("response.format json needs response.field")
+		}
+	case "regex":
+		if _, err := regexp.Compile(c.Response.Pattern); err != nil || c.Response.Pattern == "" {
+			return fmt.Errorf("response.format regex needs a valid response.pattern")
+		}
+	default:
+		return fmt.Errorf("unknown response.format %q (want text, json or regex)", c.Response.Format)
+	}
+	if c.RestartDelay == 0 {
+		c.RestartDelay = 3
+	}
+	return nil
+}
+
+func (c ExecBackendConfig) processConfig() ProcessConfig {
+	return ProcessConfig{
+		Command:         c.Command,
+		Args:            c.Args,
+		RestartDelay:    time.Duration(c.RestartDelay) * time.Second,
+		MaxRestartDelay: time.Duration(c.MaxRestartDelay) * time.Second,
+		PeriodicRestart: time.Duration(c.PeriodicRestart) * time.Second,
+		PromptTimeout:   time.Duration(c.Timeout) * time.Second,
+		Limits:          ResourceLimits{MemoryMB: c.LimitMemoryMB, CPUSeconds: c.LimitCPUSeconds, OpenFiles: c.LimitOpenFiles},
+	}
+}
+
+// ExecAgent runs an arbitrary agent CLI described by an ExecBackendConfig.
+type ExecAgent struct {
+	cfg     ExecBackendConfig
+	procCfg ProcessConfig
+	pattern *regexp.Regexp
+	pm      *ProcessManager // jsonl mode only
+	pmMu    sync.Mutex
+	onCrash func(reason string) // guarded by pmMu
+	mu      sync.Mutex          // serialize prompts over the shared jsonl process
+	log     *observability.Logger
+}
+
+func NewExecAgent(cfg ExecBackendConfig) (*ExecAgent, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	e := &ExecAgent{
+		cfg:     cfg,
+		procCfg: cfg.processConfig(),
+		log:     observability.Component("agent.exec"),
+	}
+	e.procCfg.OnCrashLoop = e.crashLooped
+	if cfg.Response.Format == "regex" {
+		e.pattern = regexp.MustCompile(cfg.Response.Pattern)
+	}
+	return e, nil
+}
+
+// Start spawns the persistent process in jsonl mode; one-shot modes start lazily per prompt.
+func (e *ExecAgent) Start() error {
+	if e.cfg.Mode != execModeJSONL {
+		return nil
+	}
+	_, err := e.ensureProcess()
+	return err
+}
+
+func (e *ExecAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	ctx, span := observability.StartSpan(ctx, "agent.exec.send_prompt")
+	defer span.End()
+
+	if e.procCfg.PromptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.procCfg.PromptTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	var (
+		resp string
+		err  error
+	)
+	if e.cfg.Mode == execModeJSONL {
+		resp, err = e.sendJSONL(ctx, prompt)
+	} else {
+		resp, err = e.runOnce(ctx, prompt)
+	}
+	if err != nil {
+		return resp, err
+	}
+	e.log.Info(ctx, "exec prompt completed", "backend", e.cfg.Name, "mode", e.cfg.Mode, "duration_ms", time.Since(start).Milliseconds(), "response_chars", len(resp))
+	return resp, nil
+}
+
+// runOnce spawns the command for a single prompt (argv / stdin modes).
+func (e *ExecAgent) runOnce(ctx context.Context, prompt string) (string, error) {
+	args := make([]string, 0, len(e.cfg.Args)+1)
+	substituted := false
+	afterDashes := false // a "--" ends option parsing, later args are taken literally
+	for _, a := range e.cfg.Args {
+		if e.cfg.Mode == execModeArgv && strings.Contains(a, execPromptPlaceholder) {
+			a = strings.ReplaceAll(a, execPromptPlaceholder, prompt)
+			substituted = true
+		}
+		if a == "--" {
+			afterDashes = true
+		}
+		args = append(args, a)
+	}
+	if e.cfg.Mode == execModeArgv && !substituted {
+		// an appended prompt starting with "-" would be parsed as an option
+		if strings.HasPrefix(prompt, "-") && !afterDashes {
+			args = append(args, "--")
+		}
+		args = append(args, prompt)
+	}
+
+	name := e.cfg.Command
+	if !e.procCfg.Limits.empty() {
+		name, args = withResourceLimits(e.procCfg.Limits, name, args)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	if e.cfg.Mode == execModeStdin {
+		cmd.Stdin = strings.NewReader(prompt)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second // don't wait on grandchildren holding stderr after a kill
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("%s: stdout pipe: %w", e.cfg.Name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", &ProviderError{Kind: ErrProcessCrash, Backend: e.cfg.Name, Message: "start: " + err.Error(), Err: err}
+	}
+
+	// grandchildren may keep stdout open after the command is killed; unblock the reader
+	stopClose := context.AfterFunc(ctx, func() { _ = stdout.Close() })
+	defer stopClose()
+
+	// plain-text output is streamed line by line; structured output only makes sense once complete
+	var out strings.Builder
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text() + "\n"
+		out.WriteString(line)
+		if e.cfg.Response.Format == "text" {
+			reportProgress(ctx, line)
+		}
+	}
+	waitErr := cmd.Wait()
+	if ctx.Err() != nil {
+		return strings.TrimSpace(out.String()), execAbortError(ctx, e.cfg.Name)
+	}
+	if waitErr != nil {
+		return "", cliError(e.cfg.Name, ErrProcessCrash, waitErr.Error()+": "+truncateLine(strings.TrimSpace(stderr.String()), 300), waitErr)
+	}
+	return e.extract(out.String())
+}
+
+func (e *ExecAgent) extract(output string) (string, error) {
+	switch e.cfg.Response.Format {
+	case "json":
+		var v any
+		if err := json.Unmarshal([]byte(output), &v); err != nil {
+			return "", fmt.Errorf("%s: output is not json: %w", e.cfg.Name, err)
+		}
+		text, ok := jsonPathString(v, e.cfg.Response.Field)
+		if !ok {
+			return "", fmt.Errorf("%s: response field %q missing", e.cfg.Name, e.cfg.Response.Field)
+		}
+		return strings.TrimSpace(text), nil
+	case "regex":
+		m := e.pattern.FindStringSubmatch(output)
+		if m == nil {
+			return "", fmt.Errorf("%s: response pattern did not match", e.cfg.Name)
+		}
+		if len(m) > 1 {
+			return strings.TrimSpace(m[1]), nil
+		}
+		return strings.TrimSpace(m[0]), nil
+	default:
+		return strings.TrimSpace(output), nil
+	}
+}
+
+// sendJSONL writes one request line and reads json lines until the reply is complete.
+func (e *ExecAgent) sendJSONL(ctx context.Context, prompt string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pm, err := e.ensureProcess()
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("%s: prompt not sent: %w", e.cfg.Name, err)
+	}
+
+	encoded, err := json.Marshal(prompt)
+	if err != nil {
+		return "", fmt.Errorf("%s: encode prompt: %w", e.cfg.Name, err)
+	}
+	line := strings.ReplaceAll(e.cfg.Request, execPromptPlaceholder, string(encoded))
+	stdin := pm.Stdin()
+	if stdin == nil {
+		return "", &ProviderError{Kind: ErrProcessCrash, Backend: e.cfg.Name, Message: "process not running"}
+	}
+	if _, err := fmt.Fprintf(stdin, "%s\n", line); err != nil {
+		return "", &ProviderError{Kind: ErrProcessCrash, Backend: e.cfg.Name, Message: "write stdin: " + err.Error(), Err: err}
+	}
+
+	// the protocol has no abort command; a restart discards the half-finished reply
+	stopRestart := context.AfterFunc(ctx, func() {
+		e.log.Warn(nil, "exec prompt aborting, restarting process", "backend", e.cfg.Name, "reason", ctx.Err().Error())
+		if err := pm.Restart(); err != nil {
+			e.log.Error(nil, "exec restart after abort failed", "backend", e.cfg.Name, "error", err.Error())
+		}
+	})
+	defer stopRestart()
+
+	scanner := pm.Scanner()
+	if scanner == nil {
+		return "", fmt.Errorf("%s: scanner not available", e.cfg.Name)
+	}
+
+	rule := e.cfg.Response
+	var streamed strings.Builder
+	for {
+		if !scanner.Scan() {
+			if ctx.Err() != nil {
+				return streamed.String(), execAbortError(ctx, e.cfg.Name)
+			}
+			if err := scanner.Err(); err != nil {
+				return streamed.String(), &ProviderError{Kind: ErrProcessCrash, Backend: e.cfg.Name, Message: withExitDetail("read stdout: "+err.Error(), pm), Err: err}
+			}
+			return streamed.String(), &ProviderError{Kind: ErrProcessCrash, Backend: e.cfg.Name, Message: withExitDetail("process closed stdout", pm)}
+		}
+
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal([]byte(raw), &v); err != nil {
+			e.log.Debug(ctx, "exec: skip non-json line", "backend", e.cfg.Name, "line_preview", truncateLine(raw, 120))
+			continue
+		}
+
+		if rule.DeltaField != "" {
+			if delta, ok := jsonPathString(v, rule.DeltaField); ok && delta != "" {
+				streamed.WriteString(delta)
+				reportProgress(ctx, delta)
+			}
+		}
+		final, hasFinal := "", false
+		if rule.Field != "" {
+			final, hasFinal = jsonPathString(v, rule.Field)
+		}
+
+		done := hasFinal
+		if rule.DoneField != "" {
+			doneVal, _ := jsonPath(v, rule.DoneField)
+			done = truthy(doneVal)
+		}
+		if !done {
+			continue
+		}
+		if hasFinal && final != "" {
+			return strings.TrimSpace(final), nil
+		}
+		return strings.TrimSpace(streamed.String()), nil
+	}
+}
+
+func (e *ExecAgent) ensureProcess() (*ProcessManager, error) {
+	e.pmMu.Lock()
+	defer e.pmMu.Unlock()
+	if e.pm != nil {
+		return e.pm, nil
+	}
+	pm := NewProcessManager(e.procCfg)
+	if err := pm.Start(); err != nil {
+		return nil, &ProviderError{Kind: ErrProcessCrash, Backend: e.cfg.Name, Message: "start process: " + err.Error(), Err: err}
+	}
+	e.pm = pm
+	return pm, nil
+}
+
+// HealthCheck verifies the configured command is on PATH and, in jsonl mode,
+// that its process is not crash-looping.
+func (e *ExecAgent) HealthCheck(context.Context) error {
+	if _, err := exec.LookPath(e.cfg.Command); err != nil {
+		return fmt.Errorf("%s CLI not found on PATH", e.cfg.Command)
+	}
+	e.pmMu.Lock()
+	pm := e.pm
+	e.pmMu.Unlock()
+	if pm != nil {
+		if looping, reason := pm.CrashLoop(); looping {
+			return fmt.Errorf("%s process crash loop: %s", e.cfg.Name, reason)
+		}
+	}
+	return nil
+}
+
+// SetCrashLoopHandler registers fn to be told when the jsonl process crash-loops.
+func (e *ExecAgent) SetCrashLoopHandler(fn func(reason string)) {
+	e.pmMu.Lock()
+	defer e.pmMu.Unlock()
+	e.onCrash = fn
+}
+
+func (e *ExecAgent) crashLooped(reason string) {
+	e.pmMu.Lock()
+	fn := e.onCrash
+	e.pmMu.Unlock()
+	if fn != nil {
+		fn(reason)
+	}
+}
+
+// ProcessStatus reports the jsonl process; ok is false in one-shot modes and
+// before the process was started.
+func (e *ExecAgent) ProcessStatus() (ProcessStatus, bool) {
+	e.pmMu.Lock()
+	pm := e.pm
+	e.pmMu.Unlock()
+	if pm == nil {
+		return ProcessStatus{}, false
+	}
+	return pm.Status(), true
+}
+
+// MaxConcurrentPrompts limits jsonl mode to its single process; one-shot modes are unlimited.
+func (e *ExecAgent) MaxConcurrentPrompts() int {
+	if e.cfg.Mode == execModeJSONL {
+		return 1
+	}
+	return 0
+}
+
+func (e *ExecAgent) BackendLabel() string { return e.cfg.Name }
+
+func (e *ExecAgent) Close() error {
+	e.pmMu.Lock()
+	defer e.pmMu.Unlock()
+	if e.pm == nil {
+		return nil
+	}
+	err := e.pm.Stop()
+	e.pm = nil
+	return err
+}
+
+func execAbortError(ctx context.Context, name string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &ProviderError{Kind: ErrTimeout, Backend: name, Message: "no response before deadline", Err: ctx.Err()}
+	}
+	return fmt.Errorf("%s: prompt aborted: %w", name, ctx.Err())
+}
+
+// jsonPath resolves a dot path ("a.b.0.c") in decoded json.
+func jsonPath(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	cur := v
+	for _, part := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func jsonPathString(v any, path string) (string, bool) {
+	val, ok := jsonPath(v, path)
+	if !ok || val == nil {
+		return "", false
+	}
+	if s, isString := val.(string); isString {
+		return s, true
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return t != "" && t != "false" && t != "0"
+	case float64:
+		return t != 0
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// ExecBackendNames returns configured backend names, sorted (for logs and errors).
+func ExecBackendNames(backends map[string]ExecBackendConfig) []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecAgent_ArgvText(t *testing.T) {
+	a, err := NewExecAgent(ExecBackendConfig{
+		Name:    "sh",
+		Command: "sh",
+		Args:    []string{"-c", `echo "reply: $1"`, "sh", "{prompt}"},
+	})
+	if err != nil {
+		t.Fatalf("NewExecAgent: %v", err)
+	}
+	var streamed strings.Builder
+	ctx := withProgressReporter(context.Background(), func(d string) { streamed.WriteString(d) })
+	resp, err := a.SendPrompt(ctx, "hello world")
+	if err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if resp != "reply: hello world" {
+		t.Fatalf("resp=%q", resp)
+	}
+	if streamed.String() != "reply: hello world\n" {
+		t.Fatalf("streamed=%q", streamed.String())
+	}
+}
+
+func TestExecAgent_ArgvPromptIsPassedUnchanged(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-c", `echo "[$*]"`, "sh", "{prompt}"}, "[--help]"},
+		{[]string{"-c", `echo "[$*]"`, "sh"}, "[-- --help]"}, // appended after "--"
+		{[]string{"-c", `echo "[$*]"`, "sh", "--"}, "[-- --help]"},
+		{[]string{"-c", `echo "[$*]"`, "sh", "--", "{prompt}"}, "[-- --help]"},
+		{[]string{"-c", `echo "[$*]"`, "sh", "--message={prompt}"}, "[--message=--help]"},
+	} {
+		a, err := NewExecAgent(ExecBackendConfig{Name: "sh", Command: "sh", Args: tc.args})
+		if err != nil {
+			t.Fatalf("NewExecAgent: %v", err)
+		}
+		resp, err := a.SendPrompt(context.Background(), "--help")
+		if err != nil {
+			t.Fatalf("%v: %v", tc.args, err)
+		}
+		if resp != tc.want {
+			t.Fatalf("%v: resp=%q want %q", tc.args, resp, tc.want)
+		}
+	}
+}
+
+func TestExecAgent_StdinJSONField(t *testing.T) {
+	a, err := NewExecAgent(ExecBackendConfig{
+		Name:     "json-cli",
+		Command:  "sh",
+		Args:     []string{"-c", `read p; printf '{"result":{"text":"got %s"}}' "$p"`},
+		Mode:     "stdin",
+		Response: ExecResponseRule{Format: "json", Field: "result.text"},
+	})
+	if err != nil {
+		t.Fatalf("NewExecAgent: %v", err)
+	}
+	resp, err := a.SendPrompt(context.Background(), "ping")
+	if err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if resp != "got ping" {
+		t.Fatalf("resp=%q", resp)
+	}
+}
+
+func TestExecAgent_RegexAndFailure(t *testing.T) {
+	a, _ := NewExecAgent(ExecBackendConfig{
+		Name:     "regex",
+		Command:  "sh",
+		Args:     []string{"-c", `echo "noise"; echo "ANSWER: 42"`},
+		Response: ExecResponseRule{Format: "regex", Pattern: `ANSWER: (\d+)`},
+	})
+	if resp, err := a.SendPrompt(context.Background(), "q"); err != nil || resp != "42" {
+		t.Fatalf("resp=%q err=%v", resp, err)
+	}
+
+	failing, _ := NewExecAgent(ExecBackendConfig{Name: "fail", Command: "sh", Args: []string{"-c", "echo boom >&2; exit 3"}})
+	_, err := failing.SendPrompt(context.Background(), "q")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err=%v want stderr in error", err)
+	}
+}
+
+func TestExecAgent_TimeoutKillsOneShot(t *testing.T) {
+	a, _ := NewExecAgent(ExecBackendConfig{Name: "slow", Command: "sh", Args: []string{"-c", "sleep 5", "sh", "{prompt}"}, Timeout: 1})
+	a.procCfg.PromptTimeout = 50 * time.Millisecond
+	_, err := a.SendPrompt(context.Background(), "q")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v want deadline exceeded", err)
+	}
+}
+
+func TestExecAgent_JSONLStreamsUntilDone(t *testing.T) {
+	script := `while read line; do
+  echo 'not json'
+  echo '{"type":"delta","text":"hel"}'
+  echo '{"type":"delta","text":"lo"}'
+  echo '{"type":"end","done":true}'
+done`
+	a, err := NewExecAgent(ExecBackendConfig{
+		Name:     "rpc",
+		Command:  "sh",
+		Args:     []string{"-c", script},
+		Mode:     "jsonl",
+		Response: ExecResponseRule{DeltaField: "text", DoneField: "done"},
+	})
+	if err != nil {
+		t.Fatalf("NewExecAgent: %v", err)
+	}
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+
+	var deltas []string
+	ctx := withProgressReporter(context.Background(), func(d string) { deltas = append(deltas, d) })
+	for i := 0; i < 2; i++ {
+		resp, err := a.SendPrompt(ctx, "hi")
+		if err != nil {
+			t.Fatalf("prompt %d: %v", i, err)
+		}
+		if resp != "hello" {
+			t.Fatalf("prompt %d resp=%q", i, resp)
+		}
+	}
+	if len(deltas) != 4 {
+		t.Fatalf("deltas=%v", deltas)
+	}
+	if a.MaxConcurrentPrompts() != 1 {
+		t.Fatal("jsonl backend must be limited to one prompt at a time")
+	}
+}
+
+func TestLoadExecBackends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exec-backends.toml")
+	content := `
+[backends.aider]
+command = "aider"
+args = ["--message", "{prompt}", "--yes"]
+timeout = 600
+
+[backends.rpc]
+command = "mycli"
+mode = "jsonl"
+request = '{"type":"prompt","text":{prompt}}'
+
+[backends.rpc.response]
+field = "result"
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backends, err := LoadExecBackends(path)
+	if err != nil {
+		t.Fatalf("LoadExecBackends: %v", err)
+	}
+	if got := strings.Join(ExecBackendNames(backends), ","); got != "aider,rpc" {
+		t.Fatalf("names=%s", got)
+	}
+	aider := backends["aider"]
+	if aider.Mode != "argv" || aider.Response.Format != "text" || aider.processConfig().PromptTimeout != 10*time.Minute {
+		t.Fatalf("aider defaults not applied: %+v", aider)
+	}
+	if backends["rpc"].processConfig().RestartDelay != 3*time.Second {
+		t.Fatalf("rpc restart delay=%v", backends["rpc"].processConfig().RestartDelay)
+	}
+
+	if missing, err := LoadExecBackends(filepath.Join(t.TempDir(), "nope.toml")); err != nil || missing != nil {
+		t.Fatalf("missing file: backends=%v err=%v", missing, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.toml")
+	_ = os.WriteFile(bad, []byte("[backends.x]\ncommand = \"x\"\nmode = \"jsonl\"\n"), 0o644)
+	if _, err := LoadExecBackends(bad); err == nil || !strings.Contains(err.Error(), "response.field") {
+		t.Fatalf("err=%v want jsonl response validation error", err)
+	}
+	_ = os.WriteFile(bad, []byte("[backends.x]\ncommand = \"x\"\nmode = \"jsonl\"\n\n[backends.x.response]\ndelta_field = \"delta\"\n"), 0o644)
+	if _, err := LoadExecBackends(bad); err == nil || !strings.Contains(err.Error(), "response.done_field") {
+		t.Fatalf("err=%v, a reply with only delta_field would never end", err)
+	}
+}
+
+func TestExecBackendFromEnv(t *testing.T) {
+	t.Setenv("EXEC_COMMAND", "")
+	if _, ok, err := ExecBackendFromEnv(); ok || err != nil {
+		t.Fatalf("ok=%v err=%v want unset", ok, err)
+	}
+	t.Setenv("EXEC_COMMAND", "llm")
+	t.Setenv("EXEC_ARGS", "-m gpt-4o")
+	t.Setenv("EXEC_MODE", "stdin")
+	cfg, ok, err := ExecBackendFromEnv()
+	if err != nil || !ok {
+		t.Fatalf("ok=%v err=%v", ok, err)
+	}
+	if cfg.Name != "exec" || cfg.Mode != "stdin" || strings.Join(cfg.Args, " ") != "-m gpt-4o" {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+}
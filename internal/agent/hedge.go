@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	minHedgeSamples = 20                     // first-token samples before the delay follows the histogram
+	minHedgeDelay   = 250 * time.Millisecond // lower bound of the automatic delay
+	histogramAgeAt  = 200                    // halve the counts at this many samples
+)
+
+// HedgePolicy races a second backend when the first has not produced a token
+// within the hedge delay. The delay is the p95 first-token latency of the
+// backend once enough samples exist, capped at Delay; until then Delay is used.
+type HedgePolicy struct {
+	Delay time.Duration // 0 disables hedging
+	Chats []int64       // chats to hedge; empty hedges every chat
+}
+
+// latencyBuckets are the upper bounds of the first-token histogram buckets.
+var latencyBuckets = []time.Duration{
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second,
+	3 * time.Second, 5 * time.Second, 8 * time.Second, 13 * time.Second,
+	20 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute,
+}
+
+// latencyHistogram counts latencies in exponential buckets. Counts are halved
+// once they reach histogramAgeAt so recent traffic dominates.
+type latencyHistogram struct {
+	counts [13]int // len(latencyBuckets) + overflow
+	total  int
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.total++
+	if h.total >= histogramAgeAt {
+		h.total = 0
+		for j := range h.counts {
+			h.counts[j] /= 2
+			h.total += h.counts[j]
+		}
+	}
+}
+
+// quantile returns the upper bound of the bucket holding quantile q, or 0
+// without samples.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := q * float64(h.total)
+	seen := 0
+	for i, n := range h.counts {
+		seen += n
+		if float64(seen) >= target && n > 0 {
+			if i == len(latencyBuckets) {
+				return 2 * latencyBuckets[len(latencyBuckets)-1]
+			}
+			return latencyBuckets[i]
+		}
+	}
+	return 2 * latencyBuckets[len(latencyBuckets)-1]
+}
+
+// SetHedging configures request hedging; a zero policy disables it.
+func (r *Registry) SetHedging(p HedgePolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hedge = p
+}
+
+// hedgeDelayLocked returns how long to wait for b's first token, or 0 when
+// the turn in ctx is not hedged. Must hold mu.
+func (r *Registry) hedgeDelayLocked(ctx context.Context, b *Backend) time.Duration {
+	if r.hedge.Delay <= 0 {
+		return 0
+	}
+	turn := TurnFromContext(ctx)
+	if turn == nil {
+		return 0
+	}
+	switch turn.Message.Type {
+	case "text", "voice", "photo", "document":
+	default:
+		return 0 // background prompts are not latency-sensitive
+	}
+	if len(r.hedge.Chats) > 0 {
+		found := false
+		for _, id := range r.hedge.Chats {
+			if id == turn.Message.ChatID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	if b.firstToken.total < minHedgeSamples {
+		return r.hedge.Delay
+	}
+	d := b.firstToken.quantile(0.95)
+	if d > r.hedge.Delay {
+		d = r.hedge.Delay
+	}
+	if d < minHedgeDelay {
+		d = minHedgeDelay
+	}
+	return d
+}
+
+// hedgeTargetLocked returns the highest-priority backend other than primary
+// that admits a prompt. Must hold mu.
+func (r *Registry) hedgeTargetLocked(ctx context.Context, primary *Backend) *Backend {
+	now := time.Now()
+	for _, b := range r.backends {
+		if b != primary && r.acquireLocked(ctx, b, now) {
+			return b
+		}
+	}
+	return nil
+}
+
+type hedgeAttempt struct {
+	b    *Backend
+	ctx  context.Context
+	resp string
+	err  error
+}
+
+// sendHedged sends prompt to primary and, when the turn is hedged and no token
+// arrived within the hedge delay, also to the next available backend. The first
+// successful answer wins and the other attempt is canceled (pi aborts its turn
+// and keeps the session). It returns the backend that answered; when both
+// attempts fail the primary's error is returned.
+func (r *Registry) sendHedged(ctx context.Context, primary *Backend, prompt string) (string, *Backend, error) {
+	r.mu.Lock()
+	delay := r.hedgeDelayLocked(ctx, primary)
+	r.mu.Unlock()
+	if delay <= 0 {
+		resp, err := r.sendTo(ctx, primary, prompt)
+		return resp, primary, err
+	}
+
+	// the first attempt that streams owns the live preview; the other's deltas are dropped
+	outer := progressReporterFrom(ctx)
+	var streamMu sync.Mutex
+	var owner *Backend
+	firstToken := make(chan struct{})
+	var firstOnce sync.Once
+	forward := func(b *Backend) ProgressReporter {
+		return func(delta string) {
+			if b == primary {
+				firstOnce.Do(func() { close(firstToken) })
+			}
+			streamMu.Lock()
+			if owner == nil {
+				owner = b
+			}
+			mine := owner == b
+			streamMu.Unlock()
+			if mine && outer != nil {
+				outer(delta)
+			}
+		}
+	}
+
+	// a reset only clears the preview when it comes from the owner
+	outerReset := ctx.Value(progressResetKey{})
+	reset := func(b *Backend) func() {
+		return func() {
+			streamMu.Lock()
+			mine := owner == b
+			streamMu.Unlock()
+			if fn, ok := outerReset.(func()); ok && mine && fn != nil {
+				fn()
+			}
+		}
+	}
+
+	results := make(chan hedgeAttempt, 2)
+	run := func(actx context.Context, b *Backend) {
+		resp, err := r.sendTo(actx, b, prompt)
+		results <- hedgeAttempt{b: b, ctx: actx, resp: resp, err: err}
+	}
+
+	pctx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	go run(withProgressReset(withProgressReporter(pctx, forward(primary)), reset(primary)), primary)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case a := <-results:
+		return a.resp, primary, a.err
+	case <-firstToken:
+		a := <-results
+		return a.resp, primary, a.err
+	case <-timer.C:
+	}
+
+	r.mu.Lock()
+	second := r.hedgeTargetLocked(ctx, primary)
+	r.mu.Unlock()
+	if second == nil {
+		a := <-results
+		return a.resp, primary, a.err
+	}
+	r.log.Info(ctx, "hedging slow backend", "backend", primary.Name, "hedge", second.Name, "delay_ms", delay.Milliseconds())
+
+	// the hedge runs without tools so actions are never executed twice
+	hctx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	var hedgeTurn *Turn
+	if turn := TurnFromContext(ctx); turn != nil {
+		hedgeTurn = &Turn{ID: turn.ID, Message: turn.Message, history: turn.history}
+		hctx = withTurn(hctx, hedgeTurn)
+	}
+	go run(withProgressReset(withProgressReporter(hctx, forward(second)), reset(second)), second)
+
+	// the hedge's tokens are spent whichever side wins, so its usage is always reported
+	hedgeDone := false
+	reportHedgeUsage := func() {
+		hedgeDone = true
+		if hedgeTurn == nil {
+			return
+		}
+		for _, u := range hedgeTurn.Usage() {
+			reportUsage(ctx, u)
+		}
+	}
+
+	var primaryResult *hedgeAttempt
+	for pending := 2; pending > 0; pending-- {
+		a := <-results
+		if a.b == second {
+			reportHedgeUsage()
+		}
+		if a.err == nil {
+			r.log.Info(ctx, "hedged prompt answered", "winner", a.b.Name, "primary", primary.Name)
+			if a.b == second && primaryResult != nil {
+				r.noteFailure(primaryResult.ctx, primary, primaryResult.err)
+			}
+			if !hedgeDone {
+				// wait for the canceled hedge to hand back what it used so far
+				cancelHedge()
+				<-results
+				reportHedgeUsage()
+			}
+			return a.resp, a.b, nil
+		}
+		if a.b == primary {
+			a := a
+			primaryResult = &a
+			continue
+		}
+		r.noteFailure(a.ctx, a.b, a.err)
+	}
+	return primaryResult.resp, primary, primaryResult.err
+}
+
+// noteFailure opens b's breaker when err is a backend-side failure.
+func (r *Registry) noteFailure(ctx context.Context, b *Backend, err error) {
+	policy := r.policyFor(ctx, err)
+	if !policy.failover {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordFailureLocked(ctx, b, err.Error(), policy.minOpen)
+	r.selectActiveLocked(ctx)
+}
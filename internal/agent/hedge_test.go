@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stallAgent streams nothing until ctx is canceled or release is closed.
+type stallAgent struct {
+	release  chan struct{}
+	canceled atomic.Bool
+}
+
+func (s *stallAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	select {
+	case <-ctx.Done():
+		s.canceled.Store(true)
+		return "", ctx.Err()
+	case <-s.release:
+		return "slow: " + prompt, nil
+	}
+}
+func (s *stallAgent) Close() error { return nil }
+
+// streamingAgent reports a token right away and answers after delay.
+type streamingAgent struct{ delay time.Duration }
+
+func (s *streamingAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	reportProgress(ctx, "…")
+	time.Sleep(s.delay)
+	return "streamed: " + prompt, nil
+}
+func (s *streamingAgent) Close() error { return nil }
+
+func hedgedRegistry(t *testing.T, primary Agent, policy HedgePolicy) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	r.Register("primary", primary, 0)
+	r.Register("second", &namedAgent{name: "second"}, 1)
+	r.HealthCheckAll(context.Background())
+	r.SetHedging(policy)
+	return r
+}
+
+func TestRegistryHedgesSlowPrimary(t *testing.T) {
+	slow := &stallAgent{release: make(chan struct{})}
+	defer close(slow.release)
+	r := hedgedRegistry(t, slow, HedgePolicy{Delay: 20 * time.Millisecond})
+
+	resp, turn := sendRouted(t, r, Message{ChatID: 1, Type: "text", Content: "hi"}, "hi")
+	if resp != "second: hi" {
+		t.Fatalf("response=%q want the hedge answer", resp)
+	}
+	if route, ok := turn.Route(); !ok || !route.Hedged || route.Backend != "second" || route.Rule != "" {
+		t.Fatalf("route=%+v ok=%v", route, ok)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !slow.canceled.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("losing primary was not canceled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, st := range r.Status() {
+		if st.Name == "primary" && st.State != BreakerClosed {
+			t.Fatalf("canceled loser must not open the breaker, state=%s", st.State)
+		}
+	}
+	if r.Active() != "primary" {
+		t.Fatalf("hedging must not change the active backend, got %q", r.Active())
+	}
+}
+
+// spendingAgent reports usage, then holds the prompt until ctx is canceled.
+type spendingAgent struct{ started chan struct{} }
+
+func (s *spendingAgent) SendPrompt(ctx context.Context, _ string) (string, error) {
+	reportUsage(ctx, Usage{Backend: "second", InputTokens: 40, OutputTokens: 3})
+	close(s.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+func (s *spendingAgent) Close() error { return nil }
+
+func TestRegistryReportsHedgeUsageWhenPrimaryWins(t *testing.T) {
+	slow := &stallAgent{release: make(chan struct{})}
+	hedge := &spendingAgent{started: make(chan struct{})}
+	r := NewRegistry()
+	r.Register("primary", slow, 0)
+	r.Register("second", hedge, 1)
+	r.HealthCheckAll(context.Background())
+	r.SetHedging(HedgePolicy{Delay: 20 * time.Millisecond})
+
+	go func() {
+		<-hedge.started
+		close(slow.release)
+	}()
+	resp, turn := sendRouted(t, r, Message{ChatID: 1, Type: "text", Content: "hi"}, "hi")
+	if resp != "slow: hi" {
+		t.Fatalf("response=%q want the primary", resp)
+	}
+	if got := turn.Usage(); len(got) != 1 || got[0].Backend != "second" || got[0].InputTokens != 40 {
+		t.Fatalf("usage=%+v, the canceled hedge's tokens must be reported", got)
+	}
+}
+
+func TestRegistryDoesNotHedgeStreamingPrimary(t *testing.T) {
+	r := hedgedRegistry(t, &streamingAgent{delay: 60 * time.Millisecond}, HedgePolicy{Delay: 20 * time.Millisecond})
+
+	resp, turn := sendRouted(t, r, Message{ChatID: 1, Type: "text", Content: "hi"}, "hi")
+	if resp != "streamed: hi" {
+		t.Fatalf("response=%q", resp)
+	}
+	if route, ok := turn.Route(); ok {
+		t.Fatalf("unexpected route %+v", route)
+	}
+	for _, st := range r.Status() {
+		if st.Name == "primary" && st.FirstTokenSamples != 1 {
+			t.Fatalf("first-token samples=%d want 1", st.FirstTokenSamples)
+		}
+	}
+}
+
+func TestRegistryHedgesOnlyConfiguredChatsAndTypes(t *testing.T) {
+	slow := &stallAgent{release: make(chan struct{})}
+	r := hedgedRegistry(t, slow, HedgePolicy{Delay: 10 * time.Millisecond, Chats: []int64{7}})
+
+	for _, msg := range []Message{
+		{ChatID: 8, Type: "text", Content: "hi"},
+		{ChatID: 7, Type: "scheduled", Content: "hi"},
+	} {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			slow.release <- struct{}{}
+		}()
+		resp, turn := sendRouted(t, r, msg, "hi")
+		if resp != "slow: hi" {
+			t.Fatalf("%+v: response=%q want the primary", msg, resp)
+		}
+		if _, ok := turn.Route(); ok {
+			t.Fatalf("%+v: unexpected hedge", msg)
+		}
+	}
+}
+
+func TestLatencyHistogramQuantileAndAging(t *testing.T) {
+	var h latencyHistogram
+	if h.quantile(0.95) != 0 {
+		t.Fatal("empty histogram must report 0")
+	}
+	for i := 0; i < 90; i++ {
+		h.observe(400 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(6 * time.Second)
+	}
+	if got := h.quantile(0.5); got != 500*time.Millisecond {
+		t.Fatalf("p50=%v", got)
+	}
+	if got := h.quantile(0.95); got != 8*time.Second {
+		t.Fatalf("p95=%v", got)
+	}
+	for i := 0; i < 100; i++ {
+		h.observe(10 * time.Minute)
+	}
+	if h.total != histogramAgeAt/2 {
+		t.Fatalf("total=%d, counts were not aged", h.total)
+	}
+	if got := h.quantile(0.95); got != 4*time.Minute {
+		t.Fatalf("p95 after aging=%v want overflow bound", got)
+	}
+}
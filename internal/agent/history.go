@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"visor/internal/observability"
+)
+
+// HistoryMessage is one entry of the message list handed to stateless backends.
+type HistoryMessage struct {
+	Role    string // "system", "user" or "assistant"
+	Content string
+}
+
+type historyTurn struct {
+	User      string    `json:"user"`
+	Assistant string    `json:"assistant"`
+	At        time.Time `json:"at"`
+}
+
+type chatHistory struct {
+	Summary string        `json:"summary,omitempty"` // latest pi handoff summary
+	Turns   []historyTurn `json:"turns"`             // oldest first
+}
+
+// History keeps the last user/assistant turns of every chat so backends without
+// a session of their own (openai, ollama) see the conversation, and a failover
+// away from pi keeps its context. It also holds the pi handoff summary.
+type History struct {
+	mu        sync.Mutex
+	chats     map[int64]*chatHistory
+	maxTurns  int
+	maxTokens int
+	storePath string // empty keeps the history in memory only
+	log       *observability.Logger
+}
+
+// NewHistory creates a history keeping maxTurns turns per chat within roughly
+// maxTokens tokens. With a dir it is persisted to dir/history.json.
+func NewHistory(dir string, maxTurns, maxTokens int) (*History, error) {
+	h := &History{
+		chats:     map[int64]*chatHistory{},
+		maxTurns:  maxTurns,
+		maxTokens: maxTokens,
+		log:       observability.Component("agent.history"),
+	}
+	if dir == "" {
+		return h, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir history dir: %w", err)
+	}
+	h.storePath = filepath.Join(dir, "history.json")
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Messages returns the summary (as a system message) and the most recent turns
+// of chatID that fit the token budget, oldest first.
+func (h *History) Messages(chatID int64) []HistoryMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.chats[chatID]
+	if c == nil {
+		return nil
+	}
+
+	budget := h.maxTokens
+	var summary []HistoryMessage
+	if c.Summary != "" {
+		summary = []HistoryMessage{{Role: "system", Content: c.Summary}}
+		budget -= estimateTokens(c.Summary)
+	}
+	first := len(c.Turns)
+	for first > 0 {
+		cost := estimateTokens(c.Turns[first-1].User) + estimateTokens(c.Turns[first-1].Assistant)
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		first--
+	}
+
+	messages := summary
+	for _, t := range c.Turns[first:] {
+		messages = append(messages, HistoryMessage{Role: "user", Content: t.User}, HistoryMessage{Role: "assistant", Content: t.Assistant})
+	}
+	return messages
+}
+
+// Append records a finished turn and drops turns beyond the turn limit or the
+// token budget.
+func (h *History) Append(chatID int64, user, assistant string) error {
+	if h.maxTurns <= 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.chatLocked(chatID)
+	c.Turns = append(c.Turns, historyTurn{User: user, Assistant: assistant, At: time.Now().UTC()})
+	if len(c.Turns) > h.maxTurns {
+		c.Turns = c.Turns[len(c.Turns)-h.maxTurns:]
+	}
+	tokens := 0
+	for i := len(c.Turns) - 1; i >= 0; i-- {
+		tokens += estimateTokens(c.Turns[i].User) + estimateTokens(c.Turns[i].Assistant)
+		if tokens > h.maxTokens && i < len(c.Turns)-1 {
+			c.Turns = c.Turns[i+1:]
+			break
+		}
+	}
+	return h.saveLocked()
+}
+
+// SetSummary stores a handoff summary for chatID. It replaces the previous one
+// and is sent ahead of the remaining turns.
+func (h *History) SetSummary(chatID int64, summary string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.chatLocked(chatID).Summary = summary
+	return h.saveLocked()
+}
+
+func (h *History) chatLocked(chatID int64) *chatHistory {
+	c := h.chats[chatID]
+	if c == nil {
+		c = &chatHistory{}
+		h.chats[chatID] = c
+	}
+	return c
+}
+
+func (h *History) load() error {
+	data, err := os.ReadFile(h.storePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read history: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, &h.chats); err != nil {
+		return fmt.Errorf("decode history: %w", err)
+	}
+	h.log.Info(context.Background(), "conversation history loaded", "chats", len(h.chats), "store_path", h.storePath)
+	return nil
+}
+
+// saveLocked rewrites the history atomically (tmp file + rename). Must hold mu.
+func (h *History) saveLocked() error {
+	if h.storePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(h.chats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode history: %w", err)
+	}
+	tmp := h.storePath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+	if err := os.Rename(tmp, h.storePath); err != nil {
+		return fmt.Errorf("replace history: %w", err)
+	}
+	return nil
+}
+
+// estimateTokens approximates the token count of s (about 4 bytes per token).
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// historyFromContext returns the prior conversation of the turn in ctx, or nil.
+func historyFromContext(ctx context.Context) []HistoryMessage {
+	t := TurnFromContext(ctx)
+	if t == nil || t.history == nil {
+		return nil
+	}
+	return t.history.Messages(t.Message.ChatID)
+}
+
+// setHandoffSummary stores a pi handoff summary for the chat of the turn in ctx.
+func setHandoffSummary(ctx context.Context, summary string) error {
+	t := TurnFromContext(ctx)
+	if t == nil || t.history == nil {
+		return nil
+	}
+	return t.history.SetSummary(t.Message.ChatID, summary)
+}
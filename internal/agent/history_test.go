@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistory_KeepsLastTurnsWithinTokenBudget(t *testing.T) {
+	h, err := NewHistory("", 3, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"one", "two", "three", "four"} {
+		if err := h.Append(1, q, "re "+q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := h.Messages(1)
+	if len(msgs) != 6 || msgs[0].Content != "two" || msgs[1].Role != "assistant" || msgs[5].Content != "re four" {
+		t.Fatalf("messages = %+v, want the last 3 turns", msgs)
+	}
+	if got := h.Messages(2); got != nil {
+		t.Fatalf("other chat = %+v, want nil", got)
+	}
+
+	// 40 bytes ≈ 10 tokens per side; a 45 token budget fits two turns
+	small, _ := NewHistory("", 10, 45)
+	long := strings.Repeat("x", 40)
+	for i := 0; i < 4; i++ {
+		_ = small.Append(1, long, long)
+	}
+	if got := len(small.Messages(1)); got != 4 {
+		t.Fatalf("messages = %d, want 2 turns within the token budget", got)
+	}
+}
+
+func TestHistory_SummaryFirstAndPersisted(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHistory(dir, 5, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = h.Append(7, "hi", "hello")
+	if err := h.SetSummary(7, "[handoff] user plans a trip"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewHistory(dir, 5, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := reloaded.Messages(7)
+	if len(msgs) != 3 || msgs[0].Role != "system" || msgs[0].Content != "[handoff] user plans a trip" || msgs[1].Content != "hi" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+}
+
+// historyRecorder captures the history a stateless backend would receive.
+type historyRecorder struct {
+	mu   sync.Mutex
+	seen [][]HistoryMessage
+}
+
+func (h *historyRecorder) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seen = append(h.seen, historyFromContext(ctx))
+	return "re " + prompt, nil
+}
+
+func (h *historyRecorder) Close() error { return nil }
+
+func TestQueuedAgent_HistorySurvivesFailover(t *testing.T) {
+	history, _ := NewHistory("", 10, 1000)
+	_ = history.SetSummary(1, "[handoff context] earlier pi session")
+	_ = history.Append(1, "first", "re first")
+
+	fallback := &historyRecorder{}
+	reg := NewRegistry()
+	reg.Register("primary", &failAgent{err: &ProviderError{Kind: ErrProcessCrash, Backend: "primary", Message: "exited"}}, 0)
+	reg.Register("fallback", fallback, 1)
+	reg.HealthCheckAll(context.Background())
+
+	done := make(chan struct{}, 2)
+	qa := NewQueuedAgent(reg, "registry", func(context.Context, int64, string, error, time.Duration) { done <- struct{}{} })
+	qa.SetHistory(history)
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "second", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "third", Type: "text"})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for replies")
+		}
+	}
+
+	fallback.mu.Lock()
+	defer fallback.mu.Unlock()
+	if len(fallback.seen) != 2 {
+		t.Fatalf("fallback calls = %d, want 2", len(fallback.seen))
+	}
+	first := fallback.seen[0]
+	if len(first) != 3 || first[0].Role != "system" || first[1].Content != "first" {
+		t.Fatalf("failover history = %+v, want summary + first turn", first)
+	}
+	if second := fallback.seen[1]; len(second) != 5 || second[3].Content != "second" || second[4].Content != "re second" {
+		t.Fatalf("next turn history = %+v, want the failed-over turn recorded", second)
+	}
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"visor/internal/observability"
+)
+
+const defaultJournalMaxAttempts = 3
+
+// JournalEntry is a queued message persisted on disk until its reply is handled.
+type JournalEntry struct {
+	ID         string    `json:"id"`
+	Message    Message   `json:"message"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	Attempts   int       `json:"attempts"`
+}
+
+type deadLetter struct {
+	JournalEntry
+	DeadLetteredAt time.Time `json:"dead_lettered_at"`
+	Reason         string    `json:"reason"`
+}
+
+// Journal persists the agent queue so pending and in-flight messages survive
+// restarts (self-evolution exit 42, crashes). Every processing start counts as an
+// attempt; entries that keep failing are moved to a dead-letter file on replay.
+type Journal struct {
+	mu          sync.Mutex
+	entries     map[string]JournalEntry
+	storePath   string
+	deadPath    string
+	maxAttempts int
+	log         *observability.Logger
+}
+
+func NewJournal(dir string, maxAttempts int) (*Journal, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("journal dir is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir journal dir: %w", err)
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultJournalMaxAttempts
+	}
+
+	j := &Journal{
+		entries:     map[string]JournalEntry{},
+		storePath:   filepath.Join(dir, "pending.json"),
+		deadPath:    filepath.Join(dir, "dead-letter.jsonl"),
+		maxAttempts: maxAttempts,
+		log:         observability.Component("agent.journal"),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Add journals a new message and returns its entry id.
+func (j *Journal) Add(msg Message) (string, error) {
+	entry := JournalEntry{
+		ID:         uuid.NewString(),
+		Message:    msg,
+		EnqueuedAt: time.Now().UTC(),
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[entry.ID] = entry
+	if err := j.saveLocked(); err != nil {
+		delete(j.entries, entry.ID)
+		return "", err
+	}
+	return entry.ID, nil
+}
+
+// MarkAttempt records that processing of an entry has started.
+func (j *Journal) MarkAttempt(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.entries[id]
+	if !ok {
+		return nil
+	}
+	entry.Attempts++
+	j.entries[id] = entry
+	return j.saveLocked()
+}
+
+// Remove drops entries whose processing finished (or that were canceled).
+func (j *Journal) Remove(ids ...string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changed := false
+	for _, id := range ids {
+		if _, ok := j.entries[id]; ok {
+			delete(j.entries, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return j.saveLocked()
+}
+
+// Pending returns all journaled entries, oldest first.
+func (j *Journal) Pending() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sortedLocked()
+}
+
+// MaxAttempts is the attempt count after which an entry is dead-lettered.
+func (j *Journal) MaxAttempts() int {
+	return j.maxAttempts
+}
+
+// DeadLetter appends an entry to the dead-letter file and removes it from the journal.
+func (j *Journal) DeadLetter(entry JournalEntry, reason string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := json.Marshal(deadLetter{JournalEntry: entry, DeadLetteredAt: time.Now().UTC(), Reason: reason})
+	if err != nil {
+		return fmt.Errorf("encode dead letter: %w", err)
+	}
+	f, err := os.OpenFile(j.deadPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open dead-letter file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write dead-letter file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close dead-letter file: %w", err)
+	}
+
+	delete(j.entries, entry.ID)
+	j.log.Warn(context.Background(), "queue entry dead-lettered", "id", entry.ID, "chat_id", entry.Message.ChatID, "attempts", entry.Attempts, "reason", reason)
+	return j.saveLocked()
+}
+
+func (j *Journal) load() error {
+	data, err := os.ReadFile(j.storePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read journal: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var entries []JournalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("decode journal: %w", err)
+	}
+	for _, e := range entries {
+		j.entries[e.ID] = e
+	}
+	j.log.Info(context.Background(), "queue journal loaded", "count", len(entries), "store_path", j.storePath)
+	return nil
+}
+
+func (j *Journal) sortedLocked() []JournalEntry {
+	list := make([]JournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].EnqueuedAt.Before(list[b].EnqueuedAt)
+	})
+	return list
+}
+
+// saveLocked rewrites the journal atomically (tmp file + rename). Must hold mu.
+func (j *Journal) saveLocked() error {
+	data, err := json.MarshalIndent(j.sortedLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode journal: %w", err)
+	}
+	tmp := j.storePath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.storePath); err != nil {
+		return fmt.Errorf("replace journal: %w", err)
+	}
+	return nil
+}
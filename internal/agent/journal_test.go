@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournal_PersistsAcrossReload(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJournal(dir, 2)
+	if err != nil {
+		t.Fatalf("NewJournal: %v", err)
+	}
+
+	first, err := j.Add(Message{ChatID: 1, Content: "first", Type: "text"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := j.Add(Message{ChatID: 1, Content: "second", Type: "scheduled"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := j.MarkAttempt(first); err != nil {
+		t.Fatalf("MarkAttempt: %v", err)
+	}
+
+	reloaded, err := NewJournal(dir, 2)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	pending := reloaded.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("pending=%d want 2", len(pending))
+	}
+	if pending[0].Message.Content != "first" || pending[0].Attempts != 1 {
+		t.Fatalf("pending[0]=%+v want first with 1 attempt", pending[0])
+	}
+	if pending[1].Message.Type != "scheduled" {
+		t.Fatalf("pending[1].type=%q want scheduled", pending[1].Message.Type)
+	}
+
+	if err := reloaded.Remove(first); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got := len(reloaded.Pending()); got != 1 {
+		t.Fatalf("pending after remove=%d want 1", got)
+	}
+}
+
+func TestJournal_DeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJournal(dir, 1)
+	if err != nil {
+		t.Fatalf("NewJournal: %v", err)
+	}
+	id, _ := j.Add(Message{ChatID: 7, Content: "poison", Type: "text"})
+	_ = j.MarkAttempt(id)
+
+	entry := j.Pending()[0]
+	if err := j.DeadLetter(entry, "too many attempts"); err != nil {
+		t.Fatalf("DeadLetter: %v", err)
+	}
+	if len(j.Pending()) != 0 {
+		t.Fatal("dead-lettered entry should leave the journal")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "dead-letter.jsonl"))
+	if err != nil {
+		t.Fatalf("read dead-letter: %v", err)
+	}
+	if !strings.Contains(string(data), `"content":"poison"`) || !strings.Contains(string(data), "too many attempts") {
+		t.Fatalf("dead-letter content=%s", data)
+	}
+}
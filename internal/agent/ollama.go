@@ -0,0 +1,354 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"visor/internal/observability"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaConfig configures the native Ollama backend.
+type OllamaConfig struct {
+	BaseURL        string // e.g. http://localhost:11434
+	Model          string // default model, overridden by the persisted model state
+	SystemPrompt   string
+	Tools          bool // advertise visor actions as functions (needs a model with tool support)
+	Vision         bool // send image attachments in the message images (needs a vision model, e.g. llava)
+	HTTPClient     *http.Client
+	ModelStatePath string
+}
+
+// OllamaAgent implements Agent against Ollama's /api/chat endpoint (ndjson streaming).
+type OllamaAgent struct {
+	baseURL        string
+	systemPrompt   string
+	tools          bool
+	vision         bool
+	client         *http.Client
+	mu             sync.Mutex
+	model          string
+	modelSource    string
+	modelStatePath string
+	lastUsage      Usage
+	log            *observability.Logger
+}
+
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []ollamaChatMessage `json:"messages"`
+	Tools    []openAITool        `json:"tools,omitempty"`
+	Stream   bool                `json:"stream"`
+}
+
+// ollamaChatMessage differs from openai in tool calls: arguments are a json
+// object and calls carry no id.
+type ollamaChatMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"` // base64
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatChunk struct {
+	Model           string            `json:"model"`
+	Message         ollamaChatMessage `json:"message"`
+	Done            bool              `json:"done"`
+	Error           string            `json:"error,omitempty"`
+	PromptEvalCount int               `json:"prompt_eval_count,omitempty"`
+	EvalCount       int               `json:"eval_count,omitempty"`
+}
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+func NewOllamaAgent(cfg OllamaConfig) *OllamaAgent {
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	log := observability.Component("agent.ollama")
+	model, source := strings.TrimSpace(cfg.Model), "config"
+	stateModel, _, err := loadCurrentModel(cfg.ModelStatePath)
+	if err != nil {
+		log.Warn(nil, "load current model failed", "path", cfg.ModelStatePath, "error", err.Error())
+	}
+	if stateModel != "" {
+		model, source = stateModel, "state-file"
+	}
+
+	return &OllamaAgent{
+		baseURL:        baseURL,
+		systemPrompt:   cfg.SystemPrompt,
+		tools:          cfg.Tools,
+		vision:         cfg.Vision,
+		client:         client,
+		model:          model,
+		modelSource:    source,
+		modelStatePath: cfg.ModelStatePath,
+		log:            log,
+	}
+}
+
+func (o *OllamaAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	model := o.Model()
+	if model == "" {
+		return "", fmt.Errorf("ollama: no model configured")
+	}
+
+	ctx, span := observability.StartSpan(ctx, "agent.ollama.send_prompt")
+	defer span.End()
+
+	history := historyFromContext(ctx)
+	notePromptHistory(ctx, history)
+	var messages []ollamaChatMessage
+	for _, m := range chatMessages(o.systemPrompt, history, prompt) {
+		messages = append(messages, ollamaChatMessage{Role: m.Role, Content: m.Content})
+	}
+	if o.vision {
+		for _, img := range turnImages(ctx) {
+			messages[len(messages)-1].Images = append(messages[len(messages)-1].Images, img.Data)
+		}
+	}
+	var tb Toolbox
+	if o.tools {
+		tb = toolboxFromContext(ctx)
+	}
+
+	start := time.Now()
+	for round := 0; ; round++ {
+		var tools []openAITool
+		if tb != nil && round < maxToolRounds {
+			tools = toolDefinitions(tb.Tools())
+		}
+		reply, usage, err := o.chat(ctx, model, messages, tools)
+		if err != nil {
+			return reply.Content, err
+		}
+		if len(reply.ToolCalls) == 0 {
+			o.log.Info(ctx, "ollama prompt completed", "model", model, "duration_ms", time.Since(start).Milliseconds(), "input_tokens", usage.InputTokens, "output_tokens", usage.OutputTokens, "tool_rounds", round)
+			return reply.Content, nil
+		}
+
+		// run the requested tools and hand the results back in the same turn
+		messages = append(messages, reply)
+		for _, c := range reply.ToolCalls {
+			result := runToolCall(ctx, tb, "ollama", ToolCall{Name: c.Function.Name, Arguments: c.Function.Arguments})
+			messages = append(messages, ollamaChatMessage{Role: "tool", Content: result, ToolName: c.Function.Name})
+		}
+	}
+}
+
+// chat runs one streamed /api/chat request and returns the assembled assistant
+// message.
+func (o *OllamaAgent) chat(ctx context.Context, model string, messages []ollamaChatMessage, tools []openAITool) (ollamaChatMessage, Usage, error) {
+	reply := ollamaChatMessage{Role: "assistant"}
+	body, err := json.Marshal(ollamaChatRequest{Model: model, Messages: messages, Tools: tools, Stream: true})
+	if err != nil {
+		return reply, Usage{}, fmt.Errorf("ollama: encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return reply, Usage{}, fmt.Errorf("ollama: build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return reply, Usage{}, requestError("ollama", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return reply, Usage{}, ollamaStatusError(resp)
+	}
+
+	var out strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChatChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			o.log.Debug(ctx, "ollama: skip unparseable stream chunk", "error", err.Error())
+			continue
+		}
+		if chunk.Error != "" {
+			reply.Content = out.String()
+			return reply, Usage{}, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			out.WriteString(chunk.Message.Content)
+			reportProgress(ctx, chunk.Message.Content)
+		}
+		reply.ToolCalls = append(reply.ToolCalls, chunk.Message.ToolCalls...)
+		if chunk.Done {
+			reply.Content = out.String()
+			usage := Usage{Backend: "ollama", Model: model, InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+			o.mu.Lock()
+			o.lastUsage = usage
+			o.mu.Unlock()
+			reportUsage(ctx, usage)
+			return reply, usage, nil
+		}
+	}
+	reply.Content = out.String()
+	if ctx.Err() != nil {
+		return reply, Usage{}, fmt.Errorf("ollama: prompt aborted: %w", ctx.Err())
+	}
+	if err := scanner.Err(); err != nil {
+		return reply, Usage{}, fmt.Errorf("ollama: read stream: %w", err)
+	}
+	return reply, Usage{}, fmt.Errorf("ollama: stream ended before done")
+}
+
+func ollamaStatusError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 8*1024))
+	msg := strings.TrimSpace(string(raw))
+	var parsed struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(raw, &parsed) == nil && parsed.Error != "" {
+		msg = parsed.Error
+	}
+	return httpStatusError("ollama", resp, msg, "")
+}
+
+// ListModels returns the locally available models from /api/tags, sorted by name.
+func (o *OllamaAgent) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: build request: %w", err)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: list models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ollamaStatusError(resp)
+	}
+
+	var tags ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("ollama: decode tags: %w", err)
+	}
+	names := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// HealthCheck pings /api/version so the registry sees a stopped server.
+func (o *OllamaAgent) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/api/version", nil)
+	if err != nil {
+		return fmt.Errorf("ollama: build request: %w", err)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ollama unreachable at %s: %w", o.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama health check: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (o *OllamaAgent) SetModel(model string) error {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return fmt.Errorf("model name is required")
+	}
+	o.mu.Lock()
+	o.model = model
+	o.modelSource = "runtime"
+	o.lastUsage = Usage{}
+	statePath := o.modelStatePath
+	o.mu.Unlock()
+
+	if err := saveCurrentModel(statePath, model, "ollama"); err != nil {
+		return fmt.Errorf("persist model state: %w", err)
+	}
+	return nil
+}
+
+func (o *OllamaAgent) Model() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.model
+}
+
+func (o *OllamaAgent) ModelStatus() ModelStatus {
+	o.mu.Lock()
+	status := ModelStatus{
+		Backend:  "ollama",
+		Model:    o.model,
+		Provider: o.baseURL,
+		Source:   o.modelSource,
+	}
+	statePath := o.modelStatePath
+	o.mu.Unlock()
+
+	stateModel, stateProvider, stateUpdatedAt, err := readCurrentModelState(statePath)
+	if err == nil {
+		status.StateModel = stateModel
+		status.StateProvider = stateProvider
+		status.StateUpdatedAt = stateUpdatedAt
+	}
+	return status
+}
+
+// BackendLabel shows the model and the token counts of the last prompt.
+func (o *OllamaAgent) BackendLabel() string {
+	o.mu.Lock()
+	model := o.model
+	usage := o.lastUsage
+	o.mu.Unlock()
+
+	label := "ollama"
+	if model != "" {
+		label = "ollama/" + model
+	}
+	if usage.InputTokens > 0 || usage.OutputTokens > 0 {
+		label += fmt.Sprintf(" · %d→%d tok", usage.InputTokens, usage.OutputTokens)
+	}
+	return label
+}
+
+// SupportsVision reports whether image attachments are sent with the prompt.
+func (o *OllamaAgent) SupportsVision() bool { return o.vision }
+
+func (o *OllamaAgent) Close() error { return nil }
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newFakeOllama(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			for _, part := range []string{"moin", " moin"} {
+				fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%q},\"done\":false}\n", part)
+			}
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":42,"eval_count":7}`+"\n")
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"qwen2.5:7b"},{"name":"llama3.2:latest"}]}`)
+		case "/api/version":
+			fmt.Fprint(w, `{"version":"0.5.0"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestOllamaAgent_StreamsAndReportsUsage(t *testing.T) {
+	ts := newFakeOllama(t)
+	a := NewOllamaAgent(OllamaConfig{BaseURL: ts.URL, Model: "llama3.2:latest"})
+
+	turn := &Turn{ID: "turn-1"}
+	var deltas []string
+	ctx := withProgressReporter(withTurn(context.Background(), turn), func(d string) { deltas = append(deltas, d) })
+
+	resp, err := a.SendPrompt(ctx, "hi")
+	if err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if resp != "moin moin" || len(deltas) != 2 {
+		t.Fatalf("resp=%q deltas=%v", resp, deltas)
+	}
+	usage := turn.Usage()
+	if len(usage) != 1 || usage[0].InputTokens != 42 || usage[0].OutputTokens != 7 {
+		t.Fatalf("usage=%+v", usage)
+	}
+	if label := a.BackendLabel(); !strings.Contains(label, "42→7 tok") {
+		t.Fatalf("label=%q", label)
+	}
+}
+
+func TestOllamaAgent_ListModelsAndHealth(t *testing.T) {
+	ts := newFakeOllama(t)
+	a := NewOllamaAgent(OllamaConfig{BaseURL: ts.URL, Model: "llama3.2:latest"})
+
+	models, err := a.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if strings.Join(models, ",") != "llama3.2:latest,qwen2.5:7b" {
+		t.Fatalf("models=%v", models)
+	}
+	if err := a.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+
+	ts.Close()
+	if err := a.HealthCheck(context.Background()); err == nil {
+		t.Fatal("expected health check to fail against stopped server")
+	}
+}
+
+func TestOllamaAgent_ModelNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"nope\" not found, try pulling it first"}`)
+	}))
+	defer ts.Close()
+
+	_, err := NewOllamaAgent(OllamaConfig{BaseURL: ts.URL, Model: "nope"}).SendPrompt(context.Background(), "hi")
+	if err == nil || IsRetryableError(err) || !strings.Contains(err.Error(), "try pulling") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestOllamaAgent_VisionSendsImages(t *testing.T) {
+	var req ollamaChatRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"a cat"},"done":true}`+"\n")
+	}))
+	defer ts.Close()
+
+	photo := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(photo, []byte("jpeg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := withTurn(context.Background(), &Turn{Message: Message{ChatID: 1, Attachments: []Attachment{{Kind: "image", Path: photo}}}})
+
+	if _, err := NewOllamaAgent(OllamaConfig{BaseURL: ts.URL, Model: "llava", Vision: true}).SendPrompt(ctx, "what is this?"); err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Content != "what is this?" || len(last.Images) != 1 || last.Images[0] != "anBlZw==" {
+		t.Fatalf("message=%+v", last)
+	}
+}
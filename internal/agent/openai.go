@@ -0,0 +1,417 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"visor/internal/observability"
+)
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIConfig configures an OpenAI-compatible chat-completions backend
+// (OpenAI, llama.cpp server, vLLM, LiteLLM, ...).
+type OpenAIConfig struct {
+	BaseURL        string // e.g. http://localhost:8000/v1 (without /chat/completions)
+	APIKey         string // optional for local servers
+	Model          string // default model, overridden by the persisted model state
+	SystemPrompt   string
+	Tools          bool // advertise visor actions as functions (the server must support tool calls)
+	Vision         bool // send image attachments as image_url parts (the model must accept images)
+	HTTPClient     *http.Client
+	ModelStatePath string
+}
+
+// OpenAIAgent implements Agent against a /v1/chat/completions endpoint using
+// server-sent-event streaming.
+type OpenAIAgent struct {
+	baseURL        string
+	apiKey         string
+	systemPrompt   string
+	tools          bool
+	vision         bool
+	client         *http.Client
+	mu             sync.Mutex
+	model          string
+	modelSource    string
+	modelStatePath string
+	log            *observability.Logger
+}
+
+type openAIChatMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	Images     []encodedImage   `json:"-"` // sent as content parts after the text
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"` // "text" or "image_url"
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"` // data:<mime>;base64,<data>
+}
+
+// MarshalJSON sends a message with images as a list of content parts.
+func (m openAIChatMessage) MarshalJSON() ([]byte, error) {
+	type plain openAIChatMessage
+	if len(m.Images) == 0 {
+		return json.Marshal(plain(m))
+	}
+	parts := []openAIContentPart{{Type: "text", Text: m.Content}}
+	for _, img := range m.Images {
+		parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: "data:" + img.MIMEType + ";base64," + img.Data}})
+	}
+	return json.Marshal(struct {
+		plain
+		Content []openAIContentPart `json:"content"`
+	}{plain(m), parts})
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // json encoded
+	} `json:"function"`
+}
+
+// openAITool is the function definition format shared by openai and ollama.
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+func toolDefinitions(tools []Tool) []openAITool {
+	defs := make([]openAITool, 0, len(tools))
+	for _, t := range tools {
+		var def openAITool
+		def.Type = "function"
+		def.Function.Name = t.Name
+		def.Function.Description = t.Description
+		def.Function.Parameters = t.Parameters
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// chatMessages builds the request message list: system prompt, prior
+// conversation of the chat, then the prompt.
+func chatMessages(systemPrompt string, history []HistoryMessage, prompt string) []openAIChatMessage {
+	messages := make([]openAIChatMessage, 0, len(history)+2)
+	if strings.TrimSpace(systemPrompt) != "" {
+		messages = append(messages, openAIChatMessage{Role: "system", Content: systemPrompt})
+	}
+	for _, m := range history {
+		messages = append(messages, openAIChatMessage{Role: m.Role, Content: m.Content})
+	}
+	return append(messages, openAIChatMessage{Role: "user", Content: prompt})
+}
+
+type openAIChatRequest struct {
+	Model         string              `json:"model"`
+	Messages      []openAIChatMessage `json:"messages"`
+	Tools         []openAITool        `json:"tools,omitempty"`
+	Stream        bool                `json:"stream"`
+	StreamOptions *openAIStreamOpts   `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOpts struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage,omitempty"` // final chunk when stream_options.include_usage is set
+}
+
+type openAIErrorBody struct {
+	Error struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Code    json.RawMessage `json:"code"` // string on openai, a number on some compatible servers
+	} `json:"error"`
+}
+
+func NewOpenAIAgent(cfg OpenAIConfig) *OpenAIAgent {
+	baseURL := strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	log := observability.Component("agent.openai")
+	model, source := strings.TrimSpace(cfg.Model), "config"
+	stateModel, _, err := loadCurrentModel(cfg.ModelStatePath)
+	if err != nil {
+		log.Warn(nil, "load current model failed", "path", cfg.ModelStatePath, "error", err.Error())
+	}
+	if stateModel != "" {
+		model, source = stateModel, "state-file"
+	}
+
+	return &OpenAIAgent{
+		baseURL:        baseURL,
+		apiKey:         cfg.APIKey,
+		systemPrompt:   cfg.SystemPrompt,
+		tools:          cfg.Tools,
+		vision:         cfg.Vision,
+		client:         client,
+		model:          model,
+		modelSource:    source,
+		modelStatePath: cfg.ModelStatePath,
+		log:            log,
+	}
+}
+
+func (o *OpenAIAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	model := o.Model()
+	if model == "" {
+		return "", fmt.Errorf("openai: no model configured")
+	}
+
+	ctx, span := observability.StartSpan(ctx, "agent.openai.send_prompt")
+	defer span.End()
+
+	history := historyFromContext(ctx)
+	notePromptHistory(ctx, history)
+	messages := chatMessages(o.systemPrompt, history, prompt)
+	if o.vision {
+		messages[len(messages)-1].Images = turnImages(ctx)
+	}
+	var tb Toolbox
+	if o.tools {
+		tb = toolboxFromContext(ctx)
+	}
+
+	start := time.Now()
+	for round := 0; ; round++ {
+		var tools []openAITool
+		if tb != nil && round < maxToolRounds {
+			tools = toolDefinitions(tb.Tools())
+		}
+		text, calls, err := o.complete(ctx, model, messages, tools)
+		if err != nil || len(calls) == 0 {
+			if err == nil {
+				o.log.Info(ctx, "openai prompt completed", "model", model, "duration_ms", time.Since(start).Milliseconds(), "response_chars", len(text), "tool_rounds", round)
+			}
+			return text, err
+		}
+
+		// run the requested tools and hand the results back in the same turn
+		messages = append(messages, openAIChatMessage{Role: "assistant", Content: text, ToolCalls: calls})
+		for _, c := range calls {
+			result := runToolCall(ctx, tb, "openai", ToolCall{ID: c.ID, Name: c.Function.Name, Arguments: json.RawMessage(c.Function.Arguments)})
+			messages = append(messages, openAIChatMessage{Role: "tool", Content: result, ToolCallID: c.ID})
+		}
+	}
+}
+
+// complete runs one streamed chat completion.
+func (o *OpenAIAgent) complete(ctx context.Context, model string, messages []openAIChatMessage, tools []openAITool) (string, []openAIToolCall, error) {
+	body, err := json.Marshal(openAIChatRequest{Model: model, Messages: messages, Tools: tools, Stream: true, StreamOptions: &openAIStreamOpts{IncludeUsage: true}})
+	if err != nil {
+		return "", nil, fmt.Errorf("openai: encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", nil, fmt.Errorf("openai: build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", nil, requestError("openai", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, o.statusError(resp)
+	}
+	return o.readStream(ctx, model, resp.Body)
+}
+
+// readStream consumes an SSE body, reporting each content delta as progress.
+// Tool call fragments are assembled by index.
+func (o *OpenAIAgent) readStream(ctx context.Context, model string, body io.Reader) (string, []openAIToolCall, error) {
+	var out strings.Builder
+	var calls []openAIToolCall
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return out.String(), calls, nil
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			o.log.Debug(ctx, "openai: skip unparseable stream chunk", "error", err.Error())
+			continue
+		}
+		if chunk.Usage != nil {
+			reportUsage(ctx, Usage{Backend: "openai", Model: model, InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens})
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason == "content_filter" {
+				return out.String(), nil, &ProviderError{Kind: ErrContentFiltered, Backend: "openai", Message: "response stopped by the provider's content filter"}
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				for len(calls) <= tc.Index {
+					calls = append(calls, openAIToolCall{Type: "function"})
+				}
+				c := &calls[tc.Index]
+				if tc.ID != "" {
+					c.ID = tc.ID
+				}
+				c.Function.Name += tc.Function.Name
+				c.Function.Arguments += tc.Function.Arguments
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			out.WriteString(choice.Delta.Content)
+			reportProgress(ctx, choice.Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return out.String(), nil, fmt.Errorf("openai: prompt aborted: %w", ctx.Err())
+		}
+		return out.String(), nil, fmt.Errorf("openai: read stream: %w", err)
+	}
+	// some servers close the stream without [DONE]; treat EOF as completion
+	return out.String(), calls, nil
+}
+
+func (o *OpenAIAgent) statusError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 8*1024))
+	msg := strings.TrimSpace(string(raw))
+	var parsed openAIErrorBody
+	code := ""
+	if json.Unmarshal(raw, &parsed) == nil && parsed.Error.Message != "" {
+		msg = parsed.Error.Message
+		code = parsed.Error.Type + " " + strings.Trim(string(parsed.Error.Code), `"`)
+	}
+	return httpStatusError("openai", resp, msg, code)
+}
+
+// HealthCheck lists /models as a cheap canary: it checks reachability and the
+// API key without spending tokens.
+func (o *OpenAIAgent) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("openai: build request: %w", err)
+	}
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("openai unreachable at %s: %w", o.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return o.statusError(resp)
+	}
+	return nil
+}
+
+func (o *OpenAIAgent) SetModel(model string) error {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return fmt.Errorf("model name is required")
+	}
+	o.mu.Lock()
+	o.model = model
+	o.modelSource = "runtime"
+	statePath := o.modelStatePath
+	o.mu.Unlock()
+
+	if err := saveCurrentModel(statePath, model, "openai"); err != nil {
+		return fmt.Errorf("persist model state: %w", err)
+	}
+	return nil
+}
+
+func (o *OpenAIAgent) Model() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.model
+}
+
+func (o *OpenAIAgent) ModelStatus() ModelStatus {
+	o.mu.Lock()
+	status := ModelStatus{
+		Backend:  "openai",
+		Model:    o.model,
+		Provider: o.baseURL,
+		Source:   o.modelSource,
+	}
+	statePath := o.modelStatePath
+	o.mu.Unlock()
+
+	stateModel, stateProvider, stateUpdatedAt, err := readCurrentModelState(statePath)
+	if err == nil {
+		status.StateModel = stateModel
+		status.StateProvider = stateProvider
+		status.StateUpdatedAt = stateUpdatedAt
+	}
+	return status
+}
+
+func (o *OpenAIAgent) BackendLabel() string {
+	model := o.Model()
+	if model == "" {
+		return "openai"
+	}
+	return "openai/" + model
+}
+
+// SupportsVision reports whether image attachments are sent as image parts.
+func (o *OpenAIAgent) SupportsVision() bool { return o.vision }
+
+func (o *OpenAIAgent) Close() error { return nil }
@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIAgent_StreamsDeltas(t *testing.T) {
+	var gotReq openAIChatRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path=%q", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("authorization=%q", got)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	a := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL + "/v1/", APIKey: "sk-test", Model: "local-model", SystemPrompt: "be brief"})
+	var deltas []string
+	ctx := withProgressReporter(context.Background(), func(d string) { deltas = append(deltas, d) })
+
+	resp, err := a.SendPrompt(ctx, "hi")
+	if err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if resp != "hello" {
+		t.Fatalf("resp=%q want hello", resp)
+	}
+	if strings.Join(deltas, "|") != "hel|lo" {
+		t.Fatalf("deltas=%v", deltas)
+	}
+	if gotReq.Model != "local-model" || !gotReq.Stream || len(gotReq.Messages) != 2 || gotReq.Messages[0].Role != "system" {
+		t.Fatalf("request=%+v", gotReq)
+	}
+}
+
+func TestOpenAIAgent_SendsConversationHistory(t *testing.T) {
+	var gotReq openAIChatRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	history, _ := NewHistory("", 5, 1000)
+	_ = history.Append(3, "my name is ada", "nice to meet you, ada")
+	ctx := withTurn(context.Background(), &Turn{Message: Message{ChatID: 3}, history: history})
+
+	if _, err := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m", SystemPrompt: "sys"}).SendPrompt(ctx, "what is my name?"); err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	var roles []string
+	for _, m := range gotReq.Messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" || gotReq.Messages[1].Content != "my name is ada" || gotReq.Messages[3].Content != "what is my name?" {
+		t.Fatalf("messages = %+v", gotReq.Messages)
+	}
+}
+
+func TestOpenAIAgent_RetryableStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"slow down","type":"rate_limit"}}`)
+	}))
+	defer ts.Close()
+
+	_, err := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m"}).SendPrompt(context.Background(), "hi")
+	var pe *ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err=%v want ProviderError", err)
+	}
+	if pe.Kind != ErrRateLimited || pe.StatusCode != 429 || pe.Message != "slow down" || pe.RetryAfter.Seconds() != 7 {
+		t.Fatalf("provider error=%+v", pe)
+	}
+	if !IsRetryableError(err) {
+		t.Fatal("IsRetryableError should accept typed error")
+	}
+}
+
+func TestOpenAIAgent_ClientErrorNotRetryable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"unknown model"}}`)
+	}))
+	defer ts.Close()
+
+	_, err := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m"}).SendPrompt(context.Background(), "hi")
+	if err == nil || IsRetryableError(err) {
+		t.Fatalf("err=%v want non-retryable error", err)
+	}
+	if !strings.Contains(err.Error(), "unknown model") {
+		t.Fatalf("err=%v should carry upstream message", err)
+	}
+}
+
+func TestOpenAIAgent_SetModelPersists(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "openai-model.json")
+	a := NewOpenAIAgent(OpenAIConfig{Model: "default", ModelStatePath: statePath})
+	if err := a.SetModel("qwen2.5"); err != nil {
+		t.Fatalf("SetModel: %v", err)
+	}
+	if a.BackendLabel() != "openai/qwen2.5" {
+		t.Fatalf("label=%q", a.BackendLabel())
+	}
+
+	reloaded := NewOpenAIAgent(OpenAIConfig{Model: "default", ModelStatePath: statePath})
+	status := reloaded.ModelStatus()
+	if status.Model != "qwen2.5" || status.Source != "state-file" {
+		t.Fatalf("status=%+v", status)
+	}
+}
+
+func TestOpenAIAgent_HealthCheckListsModels(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("path=%q auth=%q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"error":{"message":"invalid api key"}}`)
+	}))
+	defer ts.Close()
+
+	a := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL + "/v1", APIKey: "sk-test", Model: "m"})
+	if err := a.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	status = http.StatusUnauthorized
+	if err := a.HealthCheck(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid api key") {
+		t.Fatalf("err=%v want auth failure", err)
+	}
+}
+
+func TestOpenAIAgent_ContentFilterFinishReason(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"par\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"content_filter\"}]}\n\n")
+	}))
+	defer ts.Close()
+
+	_, err := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m"}).SendPrompt(context.Background(), "hi")
+	if ClassifyError(err) != ErrContentFiltered {
+		t.Fatalf("err=%v want content filtered", err)
+	}
+}
+
+func TestOpenAIAgent_VisionSendsImageParts(t *testing.T) {
+	var raw struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&raw)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"a cat\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	photo := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(photo, []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	turn := &Turn{Message: Message{ChatID: 1, Attachments: []Attachment{{Kind: "image", Path: photo}}}}
+	turn.setPrompt(PromptDump{})
+	ctx := withTurn(context.Background(), turn)
+
+	// without vision the prompt goes out as plain text
+	if _, err := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m"}).SendPrompt(ctx, "what is this?"); err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if got := string(raw.Messages[len(raw.Messages)-1].Content); got != `"what is this?"` {
+		t.Fatalf("content without vision=%s", got)
+	}
+
+	a := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m", Vision: true})
+	if !supportsVision(a) {
+		t.Fatal("vision backend must declare it")
+	}
+	if _, err := a.SendPrompt(ctx, "what is this?"); err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw.Messages[len(raw.Messages)-1].Content, &parts); err != nil {
+		t.Fatalf("content parts: %v", err)
+	}
+	if len(parts) != 2 || parts[0].Text != "what is this?" || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,cG5n" {
+		t.Fatalf("parts=%+v", parts)
+	}
+	if dump, _ := turn.Prompt(); len(dump.Images) != 1 || dump.Images[0] != photo {
+		t.Fatalf("prompt dump images=%v", dump.Images)
+	}
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -17,12 +18,29 @@ import (
 // Pi RPC JSON-lines protocol types
 
 type piCommand struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Type    string    `json:"type"`
+	Message string    `json:"message,omitempty"`
+	Images  []piImage `json:"images,omitempty"`
+}
+
+// piImage is pi's image content block, sent along with a prompt.
+type piImage struct {
+	Type     string `json:"type"` // "image"
+	Data     string `json:"data"` // base64
+	MimeType string `json:"mimeType"`
 }
 
+// piAbortGrace is how long an aborted prompt may take to reach agent_end
+// before the rpc process is restarted as a last resort.
+const piAbortGrace = 15 * time.Second
+
+// piSteerAckTimeout is how long Steer waits for pi to acknowledge a steer or
+// follow_up command before the message is queued instead.
+const piSteerAckTimeout = 5 * time.Second
+
 type piEvent struct {
 	Type    string `json:"type"`
+	Command string `json:"command,omitempty"`
 	Success *bool  `json:"success,omitempty"`
 	Error   string `json:"error,omitempty"`
 
@@ -72,6 +90,13 @@ type PiAgent struct {
 	lastInputTokens     int
 	sessionInputTokens  int
 	mu                  sync.Mutex // serialize prompts (one at a time over shared stdin/stdout)
+	stdinMu             sync.Mutex // serialize writes to stdin (prompt vs. abort)
+	steerSendMu         sync.Mutex // serialize Steer calls, one acknowledgement pending at a time
+	steerMu             sync.Mutex // guards the running turn below
+	steerTurnID         string     // turn of the prompt in flight, empty when idle
+	steerPM             *ProcessManager
+	steerAck            chan error // pending steer/follow_up acknowledgement, nil when none
+	crashLoopHandler    func(reason string)
 	log                 *observability.Logger
 }
 
@@ -94,7 +119,7 @@ func NewPiAgentWithModelState(cfg ProcessConfig, modelStatePath string) *PiAgent
 		source = "state-file"
 	}
 
-	return &PiAgent{
+	p := &PiAgent{
 		toolsCfg:            toolsCfg,
 		model:               model,
 		modelProvider:       provider,
@@ -104,6 +129,110 @@ func NewPiAgentWithModelState(cfg ProcessConfig, modelStatePath string) *PiAgent
 		handoffThreshold:    handoffThresholdFromEnv(),
 		log:                 observability.Component("agent.pi"),
 	}
+	p.toolsCfg.OnCrashLoop = p.crashLooped
+	return p
+}
+
+// SetCrashLoopHandler registers fn to be told when the rpc process crash-loops.
+func (p *PiAgent) SetCrashLoopHandler(fn func(reason string)) {
+	p.toolsMu.Lock()
+	defer p.toolsMu.Unlock()
+	p.crashLoopHandler = fn
+}
+
+func (p *PiAgent) crashLooped(reason string) {
+	p.toolsMu.Lock()
+	fn := p.crashLoopHandler
+	p.toolsMu.Unlock()
+	if fn != nil {
+		fn(reason)
+	}
+}
+
+// HealthCheck fails while the rpc process is crash-looping. An idle session is
+// probed with a get_state command that must be answered before ctx ends, else
+// the process is restarted. While a prompt runs the session is busy and not
+// probed; before the process was started only the pi CLI is checked.
+func (p *PiAgent) HealthCheck(ctx context.Context) error {
+	p.toolsMu.Lock()
+	pm, started := p.toolsPM, p.toolsStarted
+	p.toolsMu.Unlock()
+	if pm != nil {
+		if looping, reason := pm.CrashLoop(); looping {
+			return fmt.Errorf("pi process crash loop: %s", reason)
+		}
+	}
+	if pm == nil || !started {
+		if ok, reason := checkCLI("pi"); !ok {
+			return errors.New(reason)
+		}
+		return nil
+	}
+	if !p.mu.TryLock() {
+		return nil // a prompt is reading the session
+	}
+	defer p.mu.Unlock()
+	return p.pingRPC(ctx, pm)
+}
+
+// pingRPC sends get_state and waits for its response. Must hold mu.
+func (p *PiAgent) pingRPC(ctx context.Context, pm *ProcessManager) error {
+	scanner := pm.Scanner()
+	if scanner == nil {
+		return fmt.Errorf("pi rpc process not running")
+	}
+	if err := p.writeCommand(pm, piCommand{Type: "get_state"}); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for scanner.Scan() {
+			var event piEvent
+			if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Type != "response" || event.Command != "get_state" {
+				continue // leftovers of an earlier turn
+			}
+			if event.Success != nil && !*event.Success {
+				done <- fmt.Errorf("pi rpc get_state failed: %s", event.Error)
+			} else {
+				done <- nil
+			}
+			return
+		}
+		done <- fmt.Errorf("pi rpc %s", withExitDetail("process closed stdout", pm))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// the reader is stuck on an unresponsive session; a restart closes its stdout
+	p.log.Warn(ctx, "pi rpc did not answer the health probe, restarting process")
+	if err := pm.Restart(); err != nil {
+		p.log.Error(ctx, "pi restart after failed probe failed", "error", err.Error())
+	}
+	select {
+	case <-done:
+	case <-time.After(piAbortGrace):
+	}
+	return fmt.Errorf("pi rpc did not answer get_state: %w", ctx.Err())
+}
+
+// ProcessStatus reports the rpc process; ok is false before it was started.
+func (p *PiAgent) ProcessStatus() (ProcessStatus, bool) {
+	p.toolsMu.Lock()
+	pm := p.toolsPM
+	p.toolsMu.Unlock()
+	if pm == nil {
+		return ProcessStatus{}, false
+	}
+	return pm.Status(), true
 }
 
 func (p *PiAgent) Start() error {
@@ -164,6 +293,13 @@ func (p *PiAgent) ModelStatus() ModelStatus {
 	return status
 }
 
+// MaxConcurrentPrompts reports that one rpc process handles one prompt at a time.
+func (p *PiAgent) MaxConcurrentPrompts() int { return 1 }
+
+// SupportsVision is true: image attachments go to pi as image content of the
+// prompt command. Whether the model sees them depends on the model pi runs.
+func (p *PiAgent) SupportsVision() bool { return true }
+
 func (p *PiAgent) BackendLabel() string {
 	p.toolsMu.Lock()
 	model := p.model
@@ -193,12 +329,19 @@ func (p *PiAgent) SendPrompt(ctx context.Context, prompt string) (string, error)
 	p.log.Debug(ctx, "pi mode selected", "mode", "tools", "session", "persistent")
 
 	guarded := withExecutionGuardrail(prompt)
+	sections := []PromptSection{{Name: "runtime", Priority: PromptPriorityMessage, Content: strings.TrimSuffix(guarded, prompt)}}
 	if strings.TrimSpace(p.handoffContext) != "" {
+		sections = append([]PromptSection{{Name: "handoff", Priority: PromptPriorityHandoff, Content: p.handoffContext}}, sections...)
 		guarded = p.handoffContext + "\n\n" + guarded
 		p.handoffContext = ""
 	}
+	notePromptSent(ctx, "", guarded, sections...)
+	var images []piImage
+	for _, img := range turnImages(ctx) {
+		images = append(images, piImage{Type: "image", Data: img.Data, MimeType: img.MIMEType})
+	}
 
-	response, inputTokens, err := p.sendPromptOnce(ctx, pm, guarded)
+	response, inputTokens, err := p.sendPromptOnce(ctx, pm, guarded, images...)
 	if err != nil {
 		return response, err
 	}
@@ -207,7 +350,9 @@ func (p *PiAgent) SendPrompt(ctx context.Context, prompt string) (string, error)
 		hard := guarded + "\n[critical enforcement]\n" +
 			"your previous answer violated policy. do not ask the user to run commands. " +
 			"run the required checks yourself now and return concrete results only."
-		response, inputTokens, err = p.sendPromptOnce(ctx, pm, hard)
+		notePromptSent(ctx, "", hard, sections...)
+		resetProgress(ctx)
+		response, inputTokens, err = p.sendPromptOnce(ctx, pm, hard, images...)
 		if err != nil {
 			return response, err
 		}
@@ -217,7 +362,7 @@ func (p *PiAgent) SendPrompt(ctx context.Context, prompt string) (string, error)
 	return response, nil
 }
 
-func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt string) (string, int, error) {
+func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt string, images ...piImage) (string, int, error) {
 	timeout := pm.cfg.PromptTimeout
 	if timeout > 0 {
 		var cancel context.CancelFunc
@@ -225,20 +370,44 @@ func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt
 		defer cancel()
 	}
 
-	cmd := piCommand{Type: "prompt", Message: prompt}
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return "", 0, fmt.Errorf("pi: marshal command: %w", err)
+	if err := ctx.Err(); err != nil {
+		return "", 0, fmt.Errorf("pi: prompt not sent: %w", err)
 	}
-
-	stdin := pm.Stdin()
-	if stdin == nil {
-		return "", 0, fmt.Errorf("pi: process not running")
+	if err := p.writeCommand(pm, piCommand{Type: "prompt", Message: prompt, Images: images}); err != nil {
+		return "", 0, err
 	}
-	if _, err := fmt.Fprintf(stdin, "%s\n", data); err != nil {
-		return "", 0, fmt.Errorf("pi: write stdin: %w", err)
+	if turn := TurnFromContext(ctx); turn != nil && turn.ID != "" {
+		p.setSteerTarget(turn.ID, pm)
+		defer p.setSteerTarget("", nil)
 	}
 
+	// on cancel/timeout ask pi to abort the turn; the session stays alive and we keep
+	// reading until agent_end. restart only if pi does not wind down in time.
+	var graceTimer *time.Timer
+	var graceMu sync.Mutex
+	stopAbort := context.AfterFunc(ctx, func() {
+		p.log.Warn(nil, "pi prompt aborting", "reason", ctx.Err().Error())
+		if err := p.writeCommand(pm, piCommand{Type: "abort"}); err != nil {
+			p.log.Warn(nil, "pi abort command failed", "error", err.Error())
+		}
+		graceMu.Lock()
+		graceTimer = time.AfterFunc(piAbortGrace, func() {
+			p.log.Error(nil, "pi did not finish after abort, restarting process")
+			if err := pm.Restart(); err != nil {
+				p.log.Error(nil, "pi restart after abort failed", "error", err.Error())
+			}
+		})
+		graceMu.Unlock()
+	})
+	defer func() {
+		stopAbort()
+		graceMu.Lock()
+		if graceTimer != nil {
+			graceTimer.Stop()
+		}
+		graceMu.Unlock()
+	}()
+
 	var response strings.Builder
 	inputTokens := 0
 
@@ -248,17 +417,14 @@ func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt
 	}
 
 	for {
-		select {
-		case <-ctx.Done():
-			return response.String(), inputTokens, fmt.Errorf("pi: timeout waiting for response")
-		default:
-		}
-
 		if !scanner.Scan() {
+			if ctx.Err() != nil {
+				return response.String(), inputTokens, abortError(ctx)
+			}
 			if err := scanner.Err(); err != nil {
-				return response.String(), inputTokens, fmt.Errorf("pi: read stdout: %w", err)
+				return response.String(), inputTokens, &ProviderError{Kind: ErrProcessCrash, Backend: "pi", Message: withExitDetail("read stdout: "+err.Error(), pm), Err: err}
 			}
-			return response.String(), inputTokens, fmt.Errorf("pi: process closed stdout")
+			return response.String(), inputTokens, &ProviderError{Kind: ErrProcessCrash, Backend: "pi", Message: withExitDetail("process closed stdout", pm)}
 		}
 
 		line := scanner.Text()
@@ -274,8 +440,20 @@ func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt
 
 		switch event.Type {
 		case "response":
-			if event.Success != nil && !*event.Success {
-				return "", inputTokens, fmt.Errorf("pi: command rejected: %s", event.Error)
+			failed := event.Success != nil && !*event.Success
+			switch event.Command {
+			case "abort":
+			case "steer", "follow_up":
+				var ackErr error
+				if failed {
+					p.log.Warn(ctx, "pi rejected steering message", "command", event.Command, "error", event.Error)
+					ackErr = fmt.Errorf("pi: %s rejected: %s", event.Command, event.Error)
+				}
+				p.resolveSteerAck(ackErr)
+			default:
+				if failed {
+					return "", inputTokens, cliError("pi", ErrBadRequest, "command rejected: "+event.Error, nil)
+				}
 			}
 		case "message_update":
 			if event.AssistantMessageEvent != nil {
@@ -297,6 +475,9 @@ func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt
 			if event.Message != nil && event.Message.Usage != nil && event.Message.Usage.Input > 0 {
 				inputTokens = event.Message.Usage.Input
 			}
+			if event.Type == "message_end" && event.Message != nil && event.Message.Usage != nil && event.Message.Role == "assistant" {
+				reportUsage(ctx, Usage{Backend: "pi", Provider: event.Message.Provider, Model: event.Message.Model, InputTokens: event.Message.Usage.Input, OutputTokens: event.Message.Usage.Output})
+			}
 			if response.Len() == 0 && event.Message != nil && event.Message.Role == "assistant" {
 				for _, block := range event.Message.Content {
 					if block.Type == "text" && block.Text != "" {
@@ -308,11 +489,119 @@ func (p *PiAgent) sendPromptOnce(ctx context.Context, pm *ProcessManager, prompt
 				}
 			}
 		case "agent_end":
+			p.setSteerTarget("", nil)
+			if ctx.Err() != nil {
+				return response.String(), inputTokens, abortError(ctx)
+			}
 			return response.String(), inputTokens, nil
 		}
 	}
 }
 
+// writeCommand sends one json-lines command to the rpc process.
+func (p *PiAgent) writeCommand(pm *ProcessManager, cmd piCommand) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("pi: marshal command: %w", err)
+	}
+
+	p.stdinMu.Lock()
+	defer p.stdinMu.Unlock()
+	stdin := pm.Stdin()
+	if stdin == nil {
+		return &ProviderError{Kind: ErrProcessCrash, Backend: "pi", Message: "process not running"}
+	}
+	if _, err := fmt.Fprintf(stdin, "%s\n", data); err != nil {
+		return &ProviderError{Kind: ErrProcessCrash, Backend: "pi", Message: "write stdin: " + err.Error(), Err: err}
+	}
+	return nil
+}
+
+// Steer sends message into the running prompt of turnID: "steer" interrupts
+// after the current tool call, "follow_up" waits until pi would stop. Both
+// answers end up in the reply of that turn. Steer waits for pi's response to
+// the command; a rejection, no answer within piSteerAckTimeout or the turn
+// ending first is returned as an error so the queue keeps the message.
+func (p *PiAgent) Steer(ctx context.Context, turnID string, mode SteerMode, message string) error {
+	p.steerSendMu.Lock()
+	defer p.steerSendMu.Unlock()
+	cmdType := "steer"
+	if mode == SteerFollowUp {
+		cmdType = "follow_up"
+	}
+
+	ack := make(chan error, 1)
+	p.steerMu.Lock()
+	if turnID == "" || p.steerTurnID != turnID || p.steerPM == nil {
+		p.steerMu.Unlock()
+		return ErrNotSteerable
+	}
+	// written under steerMu so agent_end cannot slip in between the check and the write
+	if err := p.writeCommand(p.steerPM, piCommand{Type: cmdType, Message: message}); err != nil {
+		p.steerMu.Unlock()
+		return err
+	}
+	p.steerAck = ack
+	p.steerMu.Unlock()
+
+	timer := time.NewTimer(piSteerAckTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-ack:
+		if err != nil {
+			return err
+		}
+	case <-timer.C:
+		p.dropSteerAck(ack)
+		return fmt.Errorf("pi: %s not acknowledged within %s", cmdType, piSteerAckTimeout)
+	case <-ctx.Done():
+		p.dropSteerAck(ack)
+		return ctx.Err()
+	}
+	p.log.Info(ctx, "pi turn steered", "turn_id", turnID, "command", cmdType, "message_chars", len(message))
+	return nil
+}
+
+// resolveSteerAck hands pi's response to the pending Steer call, if any.
+func (p *PiAgent) resolveSteerAck(err error) {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	if p.steerAck != nil {
+		p.steerAck <- err
+		p.steerAck = nil
+	}
+}
+
+// dropSteerAck forgets ack after Steer gave up waiting for it.
+func (p *PiAgent) dropSteerAck(ack chan error) {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	if p.steerAck == ack {
+		p.steerAck = nil
+	}
+}
+
+// setSteerTarget records the turn whose prompt is in flight. It is cleared as
+// soon as agent_end is read so later messages are queued instead; a steer still
+// waiting for its acknowledgement then fails with ErrNotSteerable.
+func (p *PiAgent) setSteerTarget(turnID string, pm *ProcessManager) {
+	p.steerMu.Lock()
+	defer p.steerMu.Unlock()
+	p.steerTurnID = turnID
+	p.steerPM = pm
+	if turnID == "" && p.steerAck != nil {
+		p.steerAck <- fmt.Errorf("%w: the turn ended before pi acknowledged the message", ErrNotSteerable)
+		p.steerAck = nil
+	}
+}
+
+func abortError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &ProviderError{Kind: ErrTimeout, Backend: "pi", Message: "no response before deadline", Err: ctx.Err()}
+	}
+	return fmt.Errorf("pi: prompt aborted: %w", ctx.Err())
+}
+
 func (p *PiAgent) ensureToolsProcess() (*ProcessManager, error) {
 	p.toolsMu.Lock()
 	defer p.toolsMu.Unlock()
@@ -322,7 +611,7 @@ func (p *PiAgent) ensureToolsProcess() (*ProcessManager, error) {
 	}
 	if !p.toolsStarted {
 		if err := p.toolsPM.Start(); err != nil {
-			return nil, fmt.Errorf("pi tools start: %w", err)
+			return nil, &ProviderError{Kind: ErrProcessCrash, Backend: "pi", Message: "tools start: " + err.Error(), Err: err}
 		}
 		p.toolsStarted = true
 		p.lastInputTokens = 0
@@ -397,6 +686,10 @@ func (p *PiAgent) maybeHandoff(ctx context.Context, pm *ProcessManager, inputTok
 		p.log.Warn(ctx, "pi handoff summary failed", "error", err.Error())
 	} else if strings.TrimSpace(summary) != "" {
 		p.handoffContext = "[handoff context from previous rpc session]\n" + strings.TrimSpace(summary)
+		// shared with the other backends so a failover keeps the context
+		if err := setHandoffSummary(ctx, p.handoffContext); err != nil {
+			p.log.Warn(ctx, "pi handoff summary not stored in history", "error", err.Error())
+		}
 	}
 
 	if err := pm.Restart(); err != nil {
@@ -3,10 +3,12 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"visor/internal/observability"
 )
@@ -94,6 +96,18 @@ func TestPiCommand_Marshal(t *testing.T) {
 	}
 }
 
+func TestPiCommand_MarshalImages(t *testing.T) {
+	cmd := piCommand{Type: "prompt", Message: "what is this?", Images: []piImage{{Type: "image", Data: "anBlZw==", MimeType: "image/jpeg"}}}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	expected := `{"type":"prompt","message":"what is this?","images":[{"type":"image","data":"anBlZw==","mimeType":"image/jpeg"}]}`
+	if string(data) != expected {
+		t.Errorf("got %s, want %s", data, expected)
+	}
+}
+
 func TestWithExecutionGuardrail(t *testing.T) {
 	input := "check git status"
 	out := withExecutionGuardrail(input)
@@ -228,3 +242,212 @@ func TestUpdateModelFromMessage_PersistsAndUpdatesArgs(t *testing.T) {
 		t.Fatalf("state file missing provider: %s", data)
 	}
 }
+
+// startFakePi runs a shell script speaking the pi rpc json-lines protocol.
+func startFakePi(t *testing.T, script string) *ProcessManager {
+	t.Helper()
+	pm := NewProcessManager(ProcessConfig{Command: "sh", Args: []string{"-c", script}, RestartDelay: time.Hour})
+	if err := pm.Start(); err != nil {
+		t.Fatalf("start fake pi: %v", err)
+	}
+	t.Cleanup(func() { _ = pm.Stop() })
+	return pm
+}
+
+func TestSendPromptOnce_CancelSendsAbortAndKeepsSession(t *testing.T) {
+	script := `read line
+echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":"partial"}}'
+read line
+case "$line" in
+  *'"abort"'*) echo '{"type":"response","command":"abort","success":true}'; echo '{"type":"agent_end"}' ;;
+esac
+read line
+echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":"second"}}'
+echo '{"type":"agent_end"}'
+cat >/dev/null`
+	pm := startFakePi(t, script)
+	p := &PiAgent{log: observability.Component("agent.pi.test")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	resp, _, err := p.sendPromptOnce(ctx, pm, "first")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want context.Canceled", err)
+	}
+	if resp != "partial" {
+		t.Fatalf("resp=%q want partial", resp)
+	}
+
+	resp, _, err = p.sendPromptOnce(context.Background(), pm, "again")
+	if err != nil {
+		t.Fatalf("second prompt err=%v (session should survive abort)", err)
+	}
+	if resp != "second" {
+		t.Fatalf("resp=%q want second", resp)
+	}
+}
+
+func TestPiSteer_SendsCommandToRunningPrompt(t *testing.T) {
+	script := `read line
+echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":"working"}}'
+read line
+case "$line" in
+  *'"follow_up"'*'"use the other repo"'*) echo '{"type":"response","command":"follow_up","success":true}'; echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":" + switched"}}' ;;
+esac
+read line
+case "$line" in
+  *'"steer"'*) echo '{"type":"response","command":"steer","success":false,"error":"not streaming"}' ;;
+esac
+echo '{"type":"agent_end"}'
+cat >/dev/null`
+	pm := startFakePi(t, script)
+	p := &PiAgent{log: observability.Component("agent.pi.test")}
+
+	if err := p.Steer(context.Background(), "turn-1", SteerFollowUp, "too early"); !errors.Is(err, ErrNotSteerable) {
+		t.Fatalf("idle steer err=%v want ErrNotSteerable", err)
+	}
+
+	ctx := withTurn(context.Background(), &Turn{ID: "turn-1"})
+	ctx = withProgressReporter(ctx, func(string) {})
+	type result struct {
+		resp string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, _, err := p.sendPromptOnce(ctx, pm, "refactor")
+		done <- result{resp, err}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := p.Steer(context.Background(), "turn-1", SteerFollowUp, "use the other repo")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("steer err=%v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := p.Steer(context.Background(), "turn-2", SteerInterrupt, "wrong turn"); !errors.Is(err, ErrNotSteerable) {
+		t.Fatalf("other turn err=%v want ErrNotSteerable", err)
+	}
+	if err := p.Steer(context.Background(), "turn-1", SteerInterrupt, "late"); err == nil || !strings.Contains(err.Error(), "not streaming") {
+		t.Fatalf("rejected steer err=%v, want the rejection so the message is queued", err)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("a rejected steer must not fail the turn: %v", res.err)
+	}
+	if res.resp != "working + switched" {
+		t.Fatalf("resp=%q", res.resp)
+	}
+	if err := p.Steer(context.Background(), "turn-1", SteerInterrupt, "after end"); !errors.Is(err, ErrNotSteerable) {
+		t.Fatalf("steer after agent_end err=%v want ErrNotSteerable", err)
+	}
+}
+
+func TestPiSteer_FailsWhenTheTurnEndsBeforeTheAck(t *testing.T) {
+	script := `read line
+echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":"done"}}'
+read line
+echo '{"type":"agent_end"}'
+cat >/dev/null`
+	pm := startFakePi(t, script)
+	p := &PiAgent{log: observability.Component("agent.pi.test")}
+
+	ctx := withTurn(context.Background(), &Turn{ID: "turn-1"})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := p.sendPromptOnce(ctx, pm, "refactor")
+		done <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	var err error
+	for {
+		err = p.Steer(context.Background(), "turn-1", SteerFollowUp, "use the other repo")
+		// ErrNotSteerable alone means the prompt is not in flight yet
+		if !errors.Is(err, ErrNotSteerable) || strings.Contains(err.Error(), "ended") || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !errors.Is(err, ErrNotSteerable) || !strings.Contains(err.Error(), "ended before pi acknowledged") {
+		t.Fatalf("steer err=%v, want the turn-ended error so the message is queued", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendPromptOnce_CrashReportsStderr(t *testing.T) {
+	pm := startFakePi(t, `read line; echo 'Error: ANTHROPIC_API_KEY not set' >&2; exit 1`)
+	p := &PiAgent{log: observability.Component("agent.pi.test")}
+
+	_, _, err := p.sendPromptOnce(context.Background(), pm, "hi")
+	var pe *ProviderError
+	if !errors.As(err, &pe) || pe.Kind != ErrProcessCrash {
+		t.Fatalf("err=%v want process crash", err)
+	}
+	if !strings.Contains(err.Error(), "ANTHROPIC_API_KEY not set") {
+		t.Fatalf("err=%v lacks the stderr tail", err)
+	}
+}
+
+func TestSendPrompt_DeferralRetryResetsPreview(t *testing.T) {
+	script := `read line
+echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":"please run git status and send me output"}}'
+echo '{"type":"agent_end"}'
+read line
+echo '{"type":"message_update","assistantMessageEvent":{"type":"text_delta","text":"git status: clean"}}'
+echo '{"type":"agent_end"}'
+cat >/dev/null`
+	pm := startFakePi(t, script)
+	p := &PiAgent{toolsPM: pm, toolsStarted: true, log: observability.Component("agent.pi.test")}
+
+	var preview strings.Builder
+	ctx := withProgressReporter(context.Background(), func(d string) { preview.WriteString(d) })
+	ctx = withProgressReset(ctx, preview.Reset)
+	resp, err := p.SendPrompt(ctx, "git status?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "git status: clean" || preview.String() != "git status: clean" {
+		t.Fatalf("resp=%q preview=%q, the deferred attempt must be dropped", resp, preview.String())
+	}
+}
+
+func TestPiHealthCheck_ProbesIdleSession(t *testing.T) {
+	script := `while read line; do
+case "$line" in
+  *'"get_state"'*) echo '{"type":"message_update"}'; echo '{"type":"response","command":"get_state","success":true,"data":{}}' ;;
+esac
+done`
+	pm := startFakePi(t, script)
+	p := &PiAgent{toolsPM: pm, toolsStarted: true, log: observability.Component("agent.pi.test")}
+	if err := p.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("idle session: %v", err)
+	}
+
+	p.mu.Lock()
+	err := p.HealthCheck(context.Background())
+	p.mu.Unlock()
+	if err != nil {
+		t.Fatalf("a busy session must not be probed: %v", err)
+	}
+
+	mute := startFakePi(t, `cat >/dev/null`)
+	p = &PiAgent{toolsPM: mute, toolsStarted: true, log: observability.Component("agent.pi.test")}
+	pid := mute.Status().PID
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.HealthCheck(ctx); err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Fatalf("unresponsive session: %v", err)
+	}
+	if st := mute.Status(); st.PID == pid {
+		t.Fatalf("status=%+v, an unresponsive session must be restarted", st)
+	}
+}
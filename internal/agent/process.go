@@ -2,40 +2,111 @@ package agent
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
 	"visor/internal/observability"
 )
 
+const (
+	defaultMaxRestartDelay = 5 * time.Minute
+	defaultCrashLoopCount  = 5
+	defaultCrashLoopWindow = 2 * time.Minute
+	defaultStderrBytes     = 16 * 1024
+	processExitWait        = 5 * time.Second        // how long Restart waits for a killed process
+	exitDetailWait         = 500 * time.Millisecond // how long errors wait for the exit status
+)
+
 type ProcessConfig struct {
 	Command         string
 	Args            []string
-	RestartDelay    time.Duration
+	RestartDelay    time.Duration // first restart delay after a crash, doubles per consecutive crash
+	MaxRestartDelay time.Duration // cap of the restart delay (0 = 5m)
 	PeriodicRestart time.Duration // 0 = disabled
 	PromptTimeout   time.Duration
+
+	CrashLoopCount  int           // exits within CrashLoopWindow that count as a crash loop (0 = 5)
+	CrashLoopWindow time.Duration // also the uptime after which the backoff resets (0 = 2m)
+	StderrBytes     int           // tail of stderr kept for errors and status (0 = 16KB)
+	Limits          ResourceLimits
+	OnCrashLoop     func(reason string) // called when a crash loop is detected
+}
+
+// ResourceLimits are rlimits applied to the child process; 0 leaves a limit unset.
+type ResourceLimits struct {
+	MemoryMB   int // address space
+	CPUSeconds int // cpu time; the process is killed when it is used up and restarted
+	OpenFiles  int
+}
+
+func (l ResourceLimits) empty() bool {
+	return l.MemoryMB <= 0 && l.CPUSeconds <= 0 && l.OpenFiles <= 0
 }
 
 // ProcessManager manages a persistent CLI agent subprocess with stdin/stdout pipes.
+// The child runs in its own process group so tools it spawned die with it, its
+// stderr tail is kept for errors, and crashes are restarted with exponential backoff.
 type ProcessManager struct {
 	cfg     ProcessConfig
 	mu      sync.Mutex
 	cmd     *exec.Cmd
+	exited  chan struct{} // closed once cmd was waited for
 	stdin   io.WriteCloser
 	scanner *bufio.Scanner
+	stderr  *ringBuffer
 	running bool
+	stopped bool
 	stopCh  chan struct{}
-	log     *observability.Logger
+
+	startedAt    time.Time
+	restarts     int           // respawns after crashes
+	restartDelay time.Duration // delay before the next crash restart
+	crashes      []time.Time   // exits within the crash loop window
+	crashLoop    bool
+	lastExit     string
+	log          *observability.Logger
+}
+
+// ProcessStatus describes a supervised process for /agent.
+type ProcessStatus struct {
+	PID       int
+	Running   bool
+	Restarts  int
+	CrashLoop bool
+	LastExit  string // exit status and stderr tail of the last crash
+	Stderr    string // current stderr tail
+}
+
+// ProcessStatusReporter is implemented by backends running a supervised process.
+type ProcessStatusReporter interface {
+	ProcessStatus() (ProcessStatus, bool)
 }
 
 func NewProcessManager(cfg ProcessConfig) *ProcessManager {
+	if cfg.MaxRestartDelay <= 0 {
+		cfg.MaxRestartDelay = defaultMaxRestartDelay
+	}
+	if cfg.CrashLoopCount <= 0 {
+		cfg.CrashLoopCount = defaultCrashLoopCount
+	}
+	if cfg.CrashLoopWindow <= 0 {
+		cfg.CrashLoopWindow = defaultCrashLoopWindow
+	}
+	if cfg.StderrBytes <= 0 {
+		cfg.StderrBytes = defaultStderrBytes
+	}
 	return &ProcessManager{
-		cfg:    cfg,
-		stopCh: make(chan struct{}),
-		log:    observability.Component("agent.process"),
+		cfg:          cfg,
+		stderr:       newRingBuffer(cfg.StderrBytes),
+		restartDelay: cfg.RestartDelay,
+		stopCh:       make(chan struct{}),
+		log:          observability.Component("agent.process"),
 	}
 }
 
@@ -48,7 +119,6 @@ func (pm *ProcessManager) Start() error {
 	if err := pm.spawn(); err != nil {
 		return err
 	}
-	go pm.watchLoop()
 	if pm.cfg.PeriodicRestart > 0 {
 		go pm.periodicRestartLoop()
 	}
@@ -58,18 +128,32 @@ func (pm *ProcessManager) Start() error {
 func (pm *ProcessManager) Stop() error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
+	if pm.stopped {
+		return nil
+	}
+	pm.stopped = true
 	close(pm.stopCh)
 	if pm.stdin != nil {
 		pm.stdin.Close()
 	}
 	if pm.cmd != nil && pm.cmd.Process != nil {
-		return pm.cmd.Process.Kill()
+		if err := killProcessGroup(pm.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
 	}
 	return nil
 }
 
+// spawn starts the process and a goroutine waiting for it. Must hold mu.
 func (pm *ProcessManager) spawn() error {
-	cmd := exec.Command(pm.cfg.Command, pm.cfg.Args...)
+	name, args := pm.cfg.Command, pm.cfg.Args
+	if !pm.cfg.Limits.empty() {
+		name, args = withResourceLimits(pm.cfg.Limits, name, args)
+	}
+	cmd := exec.Command(name, args...)
+	setProcessGroup(cmd)
+	cmd.Stderr = pm.stderr
+	cmd.WaitDelay = time.Second // don't wait on grandchildren holding stderr after a kill
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -87,16 +171,20 @@ func (pm *ProcessManager) spawn() error {
 		return fmt.Errorf("start process: %w", err)
 	}
 
+	exited := make(chan struct{})
 	pm.cmd = cmd
+	pm.exited = exited
 	pm.stdin = stdin
 	pm.scanner = bufio.NewScanner(stdout)
 	pm.scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 1MB line buffer
 	pm.running = true
+	pm.startedAt = time.Now()
 	pm.log.Info(nil, "agent process spawned", "command", pm.cfg.Command, "args", pm.cfg.Args, "pid", cmd.Process.Pid)
+	go pm.wait(cmd, exited)
 	return nil
 }
 
-// Stdin returns the writer to the child process stdin.
+// Stdin returns the writer to the child process stdin, or nil while no process runs.
 func (pm *ProcessManager) Stdin() io.Writer {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -110,59 +198,197 @@ func (pm *ProcessManager) Scanner() *bufio.Scanner {
 	return pm.scanner
 }
 
-func (pm *ProcessManager) Restart() error {
+// Stderr returns the kept tail of the child's stderr.
+func (pm *ProcessManager) Stderr() string {
+	return pm.stderr.String()
+}
+
+// ExitDetail describes why the process went away, for errors: the last exit
+// status and the last stderr line, or "" when nothing is known. stdout may
+// close before the exit is reaped, so it waits briefly for the process.
+func (pm *ProcessManager) ExitDetail() string {
+	pm.mu.Lock()
+	exited := pm.exited
+	pm.mu.Unlock()
+	if exited != nil {
+		select {
+		case <-exited:
+		case <-time.After(exitDetailWait):
+		}
+	}
+
+	pm.mu.Lock()
+	lastExit := pm.lastExit
+	running := pm.running
+	pm.mu.Unlock()
+	if !running && lastExit != "" {
+		return lastExit
+	}
+	return lastLine(pm.stderr.String())
+}
+
+// Status reports the process state for /agent.
+func (pm *ProcessManager) Status() ProcessStatus {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
+	pm.clearStableCrashLoopLocked(time.Now())
+	st := ProcessStatus{
+		Running:   pm.running,
+		Restarts:  pm.restarts,
+		CrashLoop: pm.crashLoop,
+		LastExit:  pm.lastExit,
+		Stderr:    pm.stderr.String(),
+	}
+	if pm.running && pm.cmd != nil && pm.cmd.Process != nil {
+		st.PID = pm.cmd.Process.Pid
+	}
+	return st
+}
+
+// CrashLoop reports whether the process exited CrashLoopCount times within
+// CrashLoopWindow and has not stayed up for a whole window since.
+func (pm *ProcessManager) CrashLoop() (bool, string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.clearStableCrashLoopLocked(time.Now())
+	return pm.crashLoop, pm.lastExit
+}
+
+// clearStableCrashLoopLocked ends a crash loop once the process ran a whole
+// window without exiting. Must hold mu.
+func (pm *ProcessManager) clearStableCrashLoopLocked(now time.Time) {
+	if pm.crashLoop && pm.running && now.Sub(pm.startedAt) >= pm.cfg.CrashLoopWindow {
+		pm.crashLoop = false
+		pm.crashes = nil
+		pm.restartDelay = pm.cfg.RestartDelay
+		pm.log.Info(nil, "agent process crash loop ended", "command", pm.cfg.Command)
+	}
+}
+
+// Restart kills the process group and spawns a fresh process.
+func (pm *ProcessManager) Restart() error {
+	pm.mu.Lock()
+	if pm.stopped {
+		pm.mu.Unlock()
+		return fmt.Errorf("process manager stopped")
+	}
+	cmd, exited := pm.cmd, pm.exited
+	pm.cmd = nil // the wait goroutine sees the process was replaced
+	pm.running = false
 	if pm.stdin != nil {
 		pm.stdin.Close()
+		pm.stdin = nil
 	}
-	if pm.cmd != nil && pm.cmd.Process != nil {
-		_ = pm.cmd.Process.Kill()
-		_ = pm.cmd.Wait()
+	pm.mu.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		_ = killProcessGroup(cmd)
+		select {
+		case <-exited:
+		case <-time.After(processExitWait):
+			pm.log.Warn(nil, "agent process did not exit after kill", "pid", cmd.Process.Pid)
+		}
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.stopped {
+		return fmt.Errorf("process manager stopped")
+	}
+	if pm.cmd != nil {
+		return nil // a crash restart got there first
 	}
-	pm.running = false
 	return pm.spawn()
 }
 
-func (pm *ProcessManager) watchLoop() {
+// wait reaps cmd and restarts it with backoff if it exited on its own.
+func (pm *ProcessManager) wait(cmd *exec.Cmd, exited chan struct{}) {
+	err := cmd.Wait()
+	close(exited)
+
+	pm.mu.Lock()
+	if pm.stopped || pm.cmd != cmd {
+		pm.mu.Unlock()
+		return // stopped or replaced by Restart
+	}
+	pm.running = false
+	pm.stdin = nil
+	status := "exited cleanly"
+	if err != nil {
+		status = err.Error()
+	}
+	pm.lastExit = status
+	if line := lastLine(pm.stderr.String()); line != "" {
+		pm.lastExit += ": " + truncateLine(line, 300)
+	}
+	delay, loopStarted := pm.noteCrashLocked(time.Now())
+	reason := pm.lastExit
+	pm.mu.Unlock()
+
+	pm.log.Warn(nil, "agent process exited", "command", pm.cfg.Command, "status", status, "restart_delay", delay.String(), "stderr_tail", truncateLine(lastLine(pm.stderr.String()), 300))
+	if loopStarted {
+		pm.log.Error(nil, "agent process crash loop", "command", pm.cfg.Command, "crashes", pm.cfg.CrashLoopCount, "window", pm.cfg.CrashLoopWindow.String(), "reason", reason)
+		if pm.cfg.OnCrashLoop != nil {
+			pm.cfg.OnCrashLoop(reason)
+		}
+	}
+
 	for {
 		select {
 		case <-pm.stopCh:
 			return
-		default:
+		case <-time.After(delay):
 		}
 
 		pm.mu.Lock()
-		cmd := pm.cmd
-		pm.mu.Unlock()
-
-		if cmd == nil || cmd.Process == nil {
-			time.Sleep(500 * time.Millisecond)
-			continue
+		if pm.stopped || pm.cmd != cmd {
+			pm.mu.Unlock()
+			return // Restart spawned a new process meanwhile
 		}
-
-		err := cmd.Wait()
-		select {
-		case <-pm.stopCh:
+		err := pm.spawn()
+		if err == nil {
+			pm.restarts++
+			pm.mu.Unlock()
 			return
-		default:
 		}
+		pm.lastExit = "restart failed: " + err.Error()
+		delay, _ = pm.noteCrashLocked(time.Now())
+		pm.mu.Unlock()
+		pm.log.Error(nil, "agent restart failed", "error", err.Error(), "retry_in", delay.String())
+	}
+}
 
-		if err != nil {
-			pm.log.Warn(nil, "agent process exited", "error", err.Error(), "restart_delay", pm.cfg.RestartDelay.String())
-		} else {
-			pm.log.Info(nil, "agent process exited cleanly", "restart_delay", pm.cfg.RestartDelay.String())
+// noteCrashLocked records an unexpected exit and returns the delay before the
+// restart. A process that ran for a whole crash loop window starts over at
+// RestartDelay. loopStarted is true when this exit starts a crash loop. Must hold mu.
+func (pm *ProcessManager) noteCrashLocked(now time.Time) (delay time.Duration, loopStarted bool) {
+	window := pm.cfg.CrashLoopWindow
+	if now.Sub(pm.startedAt) >= window {
+		pm.restartDelay = pm.cfg.RestartDelay
+	}
+	recent := pm.crashes[:0]
+	for _, t := range pm.crashes {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
 		}
+	}
+	pm.crashes = append(recent, now)
 
-		time.Sleep(pm.cfg.RestartDelay)
+	delay = pm.restartDelay
+	next := pm.restartDelay * 2
+	if next <= 0 {
+		next = time.Second
+	}
+	if next > pm.cfg.MaxRestartDelay {
+		next = pm.cfg.MaxRestartDelay
+	}
+	pm.restartDelay = next
 
-		pm.mu.Lock()
-		pm.running = false
-		if err := pm.spawn(); err != nil {
-			pm.log.Error(nil, "agent restart failed", "error", err.Error())
-		}
-		pm.mu.Unlock()
+	if !pm.crashLoop && len(pm.crashes) >= pm.cfg.CrashLoopCount {
+		pm.crashLoop = true
+		loopStarted = true
 	}
+	return delay, loopStarted
 }
 
 func (pm *ProcessManager) periodicRestartLoop() {
@@ -180,3 +406,64 @@ func (pm *ProcessManager) periodicRestartLoop() {
 		}
 	}
 }
+
+// withResourceLimits wraps the command in a shell that sets the rlimits and
+// then execs it, so the limits apply from the first instruction on.
+func withResourceLimits(l ResourceLimits, name string, args []string) (string, []string) {
+	var script []string
+	if l.MemoryMB > 0 {
+		script = append(script, fmt.Sprintf("ulimit -v %d", l.MemoryMB*1024))
+	}
+	if l.CPUSeconds > 0 {
+		script = append(script, fmt.Sprintf("ulimit -t %d", l.CPUSeconds))
+	}
+	if l.OpenFiles > 0 {
+		script = append(script, fmt.Sprintf("ulimit -n %d", l.OpenFiles))
+	}
+	script = append(script, `exec "$0" "$@"`)
+	return "/bin/sh", append([]string{"-c", strings.Join(script, " && "), name}, args...)
+}
+
+// ringBuffer keeps the last size bytes written to it.
+type ringBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	size int
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, p...)
+	if over := len(r.buf) - r.size; over > 0 {
+		r.buf = append(r.buf[:0], r.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (r *ringBuffer) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return string(r.buf)
+}
+
+// withExitDetail appends what is known about the process exit to msg.
+func withExitDetail(msg string, pm *ProcessManager) string {
+	if detail := pm.ExitDetail(); detail != "" {
+		return msg + " (" + truncateLine(detail, 300) + ")"
+	}
+	return msg
+}
+
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n\r\t ")
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package agent
+
+import "os/exec"
+
+// setProcessGroup is a no-op without unix process groups.
+func setProcessGroup(*exec.Cmd) {}
+
+// killProcessGroup kills cmd only; its children are not tracked.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingBufferKeepsTail(t *testing.T) {
+	r := newRingBuffer(8)
+	r.Write([]byte("hello "))
+	r.Write([]byte("world"))
+	if got := r.String(); got != "lo world" {
+		t.Fatalf("tail=%q", got)
+	}
+	r.Write([]byte("0123456789"))
+	if got := r.String(); got != "23456789" {
+		t.Fatalf("tail=%q", got)
+	}
+}
+
+func TestProcessManagerBackoffDoublesAndResets(t *testing.T) {
+	pm := NewProcessManager(ProcessConfig{RestartDelay: time.Second, MaxRestartDelay: 5 * time.Second, CrashLoopCount: 10, CrashLoopWindow: time.Minute})
+	now := time.Now()
+	pm.startedAt = now
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		d, _ := pm.noteCrashLocked(now)
+		delays = append(delays, d)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Fatalf("delays=%v want %v", delays, want)
+		}
+	}
+
+	// a process that stayed up for a whole window starts over
+	pm.startedAt = now.Add(-2 * time.Minute)
+	if d, _ := pm.noteCrashLocked(now); d != time.Second {
+		t.Fatalf("delay after stable run=%v want 1s", d)
+	}
+}
+
+func TestProcessManagerDetectsCrashLoop(t *testing.T) {
+	reasons := make(chan string, 4)
+	pm := NewProcessManager(ProcessConfig{
+		Command:         "sh",
+		Args:            []string{"-c", "echo starting >&2; echo 'fatal: bad config' >&2; exit 3"},
+		RestartDelay:    5 * time.Millisecond,
+		MaxRestartDelay: 20 * time.Millisecond,
+		CrashLoopCount:  3,
+		CrashLoopWindow: time.Minute,
+		OnCrashLoop:     func(reason string) { reasons <- reason },
+	})
+	if err := pm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Stop()
+
+	select {
+	case reason := <-reasons:
+		if !strings.Contains(reason, "exit status 3") || !strings.Contains(reason, "fatal: bad config") {
+			t.Fatalf("reason=%q", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("crash loop not detected")
+	}
+	if looping, _ := pm.CrashLoop(); !looping {
+		t.Fatal("CrashLoop()=false")
+	}
+	st := pm.Status()
+	if !st.CrashLoop || st.Restarts < 2 || !strings.Contains(st.Stderr, "fatal: bad config") {
+		t.Fatalf("status=%+v", st)
+	}
+	if detail := pm.ExitDetail(); !strings.Contains(detail, "fatal: bad config") {
+		t.Fatalf("exit detail=%q", detail)
+	}
+	select {
+	case reason := <-reasons:
+		t.Fatalf("crash loop reported twice: %q", reason)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestProcessManagerRestartReplacesProcess(t *testing.T) {
+	pm := NewProcessManager(ProcessConfig{Command: "sh", Args: []string{"-c", "echo $$; cat >/dev/null"}, RestartDelay: time.Hour})
+	if err := pm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Stop()
+
+	first := readLine(t, pm)
+	if err := pm.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	second := readLine(t, pm)
+	if first == second {
+		t.Fatalf("restart kept pid %s", first)
+	}
+	if st := pm.Status(); !st.Running || st.Restarts != 0 || st.CrashLoop {
+		t.Fatalf("a requested restart is not a crash: %+v", st)
+	}
+}
+
+func readLine(t *testing.T, pm *ProcessManager) string {
+	t.Helper()
+	line := make(chan string, 1)
+	go func() {
+		sc := pm.Scanner()
+		if sc.Scan() {
+			line <- sc.Text()
+		}
+		close(line)
+	}()
+	select {
+	case l, ok := <-line:
+		if !ok {
+			t.Fatal("process closed stdout")
+		}
+		return l
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout reading stdout")
+	}
+	return ""
+}
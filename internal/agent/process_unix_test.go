@@ -0,0 +1,53 @@
+//go:build unix
+
+package agent
+
+import (
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessManagerRestartKillsProcessGroup(t *testing.T) {
+	pm := NewProcessManager(ProcessConfig{Command: "sh", Args: []string{"-c", "sleep 60 & echo $!; cat >/dev/null"}, RestartDelay: time.Hour})
+	if err := pm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Stop()
+
+	child, err := strconv.Atoi(readLine(t, pm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(child, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("tool subprocess %d survived the restart", child)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessManagerAppliesResourceLimits(t *testing.T) {
+	pm := NewProcessManager(ProcessConfig{
+		Command:      "sh",
+		Args:         []string{"-c", "ulimit -n; ulimit -t; cat >/dev/null"},
+		RestartDelay: time.Hour,
+		Limits:       ResourceLimits{OpenFiles: 64, CPUSeconds: 3600},
+	})
+	if err := pm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Stop()
+
+	if got := readLine(t, pm); got != "64" {
+		t.Fatalf("open files limit=%q want 64", got)
+	}
+	if got := readLine(t, pm); got != "3600" {
+		t.Fatalf("cpu limit=%q want 3600", got)
+	}
+}
@@ -23,3 +23,28 @@ func reportProgress(ctx context.Context, delta string) {
 	}
 	fn(delta)
 }
+
+type progressResetKey struct{}
+
+// withProgressReset attaches fn, called when a backend starts its output over
+// (e.g. a retried prompt) so the partial output of the earlier attempt is
+// dropped from the live preview.
+func withProgressReset(ctx context.Context, fn func()) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressResetKey{}, fn)
+}
+
+// resetProgress discards the partial output reported so far.
+func resetProgress(ctx context.Context) {
+	if fn, ok := ctx.Value(progressResetKey{}).(func()); ok && fn != nil {
+		fn()
+	}
+}
+
+// progressReporterFrom returns the reporter attached to ctx, or nil.
+func progressReporterFrom(ctx context.Context) ProgressReporter {
+	fn, _ := ctx.Value(progressReporterKey{}).(ProgressReporter)
+	return fn
+}
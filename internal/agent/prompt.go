@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Truncation says how a prompt section is shortened when it exceeds its budget.
+type Truncation string
+
+const (
+	TruncateEnd   Truncation = "end"   // keep the start, cut the end (default)
+	TruncateStart Truncation = "start" // keep the end, cut the start
+	TruncateDrop  Truncation = "drop"  // all or nothing
+)
+
+// Section priorities of the contributors visor ships with; higher priorities
+// keep their budget when the prompt has to shrink.
+const (
+	PromptPriorityMessage = 100
+	PromptPriorityHandoff = 90
+	PromptPriorityReply   = 80
+	PromptPriorityMemory  = 60
+	PromptPrioritySkill   = 50
+	PromptPrioritySetup   = 40
+	PromptPrioritySystem  = 20
+)
+
+const (
+	truncationMarker       = "[…]"
+	truncationMarkerTokens = 2
+)
+
+// PromptSection is one named part of a prompt. Sections are rendered in the
+// order they were added, separated by blank lines.
+type PromptSection struct {
+	Name      string
+	Priority  int        // higher keeps its budget first
+	MaxTokens int        // section budget; 0 means only the total budget applies
+	Truncate  Truncation // how to shorten the section, TruncateEnd when empty
+	Content   string
+}
+
+// PromptSectionDump describes how a section ended up in the prompt.
+type PromptSectionDump struct {
+	Name           string     `json:"name"`
+	Priority       int        `json:"priority"`
+	MaxTokens      int        `json:"max_tokens,omitempty"`
+	Truncate       Truncation `json:"truncate"`
+	OriginalTokens int        `json:"original_tokens"`
+	Tokens         int        `json:"tokens"`
+	Truncated      bool       `json:"truncated,omitempty"`
+	Dropped        bool       `json:"dropped,omitempty"`
+	Content        string     `json:"content"`
+}
+
+// PromptDump records exactly what a turn sent to its backend.
+type PromptDump struct {
+	TurnID    string              `json:"turn_id,omitempty"`
+	ChatID    int64               `json:"chat_id"`
+	Backend   string              `json:"backend,omitempty"`
+	At        time.Time           `json:"at"`
+	MaxTokens int                 `json:"max_tokens,omitempty"`
+	Tokens    int                 `json:"tokens"`
+	Sections  []PromptSectionDump `json:"sections"`
+	History   []HistoryMessage    `json:"history,omitempty"` // prior turns sent as separate messages
+	Images    []string            `json:"images,omitempty"`  // attachments sent as image content
+	Prompt    string              `json:"prompt"`            // the final prompt text
+}
+
+// PromptBuilder assembles a prompt from named sections within a token budget.
+type PromptBuilder struct {
+	maxTokens int
+	limits    map[string]int
+	sections  []PromptSection
+}
+
+// NewPromptBuilder returns a builder for a prompt of at most maxTokens tokens
+// (0: unlimited). limits overrides the MaxTokens of sections by name; a name
+// ending in ":" applies to every section with that prefix, e.g. "skill:".
+func NewPromptBuilder(maxTokens int, limits map[string]int) *PromptBuilder {
+	return &PromptBuilder{maxTokens: maxTokens, limits: limits}
+}
+
+// Add appends a section; sections without content are ignored.
+func (b *PromptBuilder) Add(s PromptSection) {
+	if strings.TrimSpace(s.Content) == "" {
+		return
+	}
+	if s.Truncate == "" {
+		s.Truncate = TruncateEnd
+	}
+	if limit, ok := b.limitFor(s.Name); ok {
+		s.MaxTokens = limit
+	}
+	b.sections = append(b.sections, s)
+}
+
+// Sections returns the sections added so far.
+func (b *PromptBuilder) Sections() []PromptSection {
+	return append([]PromptSection(nil), b.sections...)
+}
+
+func (b *PromptBuilder) limitFor(name string) (int, bool) {
+	if limit, ok := b.limits[name]; ok {
+		return limit, true
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		limit, ok := b.limits[name[:i+1]]
+		return limit, ok
+	}
+	return 0, false
+}
+
+// Build renders the prompt. Every section is first cut to its own budget; if
+// the result still exceeds the total budget, sections are shortened from the
+// lowest priority up until it fits.
+func (b *PromptBuilder) Build() (string, PromptDump) {
+	dumps := make([]PromptSectionDump, len(b.sections))
+	for i, s := range b.sections {
+		content := s.Content
+		original := estimateTokens(content)
+		if s.MaxTokens > 0 && original > s.MaxTokens {
+			content = truncateTokens(content, s.MaxTokens, s.Truncate)
+		}
+		dumps[i] = PromptSectionDump{
+			Name: s.Name, Priority: s.Priority, MaxTokens: s.MaxTokens, Truncate: s.Truncate,
+			OriginalTokens: original, Content: content,
+		}
+	}
+
+	if b.maxTokens > 0 {
+		order := make([]int, len(dumps))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, c int) bool { return dumps[order[a]].Priority > dumps[order[c]].Priority })
+		remaining := b.maxTokens
+		for _, i := range order {
+			d := &dumps[i]
+			cost := estimateTokens(d.Content)
+			if cost <= remaining {
+				remaining -= cost
+				continue
+			}
+			d.Content = truncateTokens(d.Content, remaining, d.Truncate)
+			remaining -= estimateTokens(d.Content)
+		}
+	}
+
+	var parts []string
+	for i := range dumps {
+		d := &dumps[i]
+		d.Tokens = estimateTokens(d.Content)
+		d.Dropped = d.Content == ""
+		d.Truncated = !d.Dropped && d.Tokens < d.OriginalTokens
+		if !d.Dropped {
+			parts = append(parts, d.Content)
+		}
+	}
+	prompt := strings.Join(parts, "\n\n")
+	return prompt, PromptDump{At: time.Now(), MaxTokens: b.maxTokens, Tokens: estimateTokens(prompt), Sections: dumps, Prompt: prompt}
+}
+
+// truncateTokens shortens s to about maxTokens tokens, marking the cut.
+func truncateTokens(s string, maxTokens int, mode Truncation) string {
+	if estimateTokens(s) <= maxTokens {
+		return s
+	}
+	if mode == TruncateDrop || maxTokens <= truncationMarkerTokens {
+		return ""
+	}
+	keep := (maxTokens - truncationMarkerTokens) * 4
+	if mode == TruncateStart {
+		cut := len(s) - keep
+		for cut < len(s) && !utf8.RuneStart(s[cut]) {
+			cut++
+		}
+		return truncationMarker + strings.TrimLeft(s[cut:], " \t\n")
+	}
+	cut := keep
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimRight(s[:cut], " \t\n") + truncationMarker
+}
+
+// notePromptSent records the prompt a backend received on the turn in ctx.
+// The registry records every attempt with the backend's name; backends that
+// wrap the prompt record it again with the sections they put in front of it.
+func notePromptSent(ctx context.Context, backend, prompt string, prepended ...PromptSection) {
+	t := TurnFromContext(ctx)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prompt == nil {
+		t.prompt = &PromptDump{ChatID: t.Message.ChatID, TurnID: t.ID, At: time.Now()}
+	}
+	if backend != "" {
+		t.prompt.Backend = backend
+		t.prompt.History = nil
+		t.prompt.Images = nil
+	}
+	var sections []PromptSectionDump
+	for _, s := range prepended {
+		if strings.TrimSpace(s.Content) == "" {
+			continue
+		}
+		tokens := estimateTokens(s.Content)
+		sections = append(sections, PromptSectionDump{Name: s.Name, Priority: s.Priority, Truncate: TruncateDrop, OriginalTokens: tokens, Tokens: tokens, Content: s.Content})
+	}
+	t.prompt.Sections = append(sections, t.promptSections...)
+	t.prompt.Prompt = prompt
+	t.prompt.Tokens = estimateTokens(prompt)
+}
+
+// notePromptHistory records the prior turns a backend sent along with the prompt.
+func notePromptHistory(ctx context.Context, history []HistoryMessage) {
+	t := TurnFromContext(ctx)
+	if t == nil || len(history) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prompt != nil {
+		t.prompt.History = history
+	}
+}
+
+// setPrompt attaches the assembled prompt of the turn.
+func (t *Turn) setPrompt(d PromptDump) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d.TurnID = t.ID
+	d.ChatID = t.Message.ChatID
+	t.prompt = &d
+	t.promptSections = d.Sections
+}
+
+// Prompt returns what the turn sent to its backend; ok is false before the
+// prompt was built.
+func (t *Turn) Prompt() (dump PromptDump, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.prompt == nil {
+		return PromptDump{}, false
+	}
+	d := *t.prompt
+	d.Sections = append([]PromptSectionDump(nil), d.Sections...)
+	return d, true
+}
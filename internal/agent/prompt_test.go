@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sectionDump(t *testing.T, d PromptDump, name string) PromptSectionDump {
+	t.Helper()
+	for _, s := range d.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no section %q in %+v", name, d.Sections)
+	return PromptSectionDump{}
+}
+
+func TestPromptBuilderSectionBudgetsAndStrategies(t *testing.T) {
+	long := strings.Repeat("abcd", 100) // 100 tokens
+	b := NewPromptBuilder(0, map[string]int{"skill:": 5})
+	b.Add(PromptSection{Name: "message", Priority: PromptPriorityMessage, Content: "hello"})
+	b.Add(PromptSection{Name: "memory", Priority: PromptPriorityMemory, MaxTokens: 10, Content: "first " + long})
+	b.Add(PromptSection{Name: "log", Priority: PromptPrioritySystem, MaxTokens: 10, Truncate: TruncateStart, Content: long + " last"})
+	b.Add(PromptSection{Name: "catalog", Priority: PromptPrioritySystem, MaxTokens: 10, Truncate: TruncateDrop, Content: long})
+	b.Add(PromptSection{Name: "skill:weather", Priority: PromptPrioritySkill, MaxTokens: 1000, Content: long})
+	b.Add(PromptSection{Name: "empty", Content: " \n"})
+
+	prompt, dump := b.Build()
+	if !strings.HasPrefix(prompt, "hello\n\nfirst abcd") {
+		t.Fatalf("prompt=%q", prompt)
+	}
+	if len(dump.Sections) != 5 {
+		t.Fatalf("sections=%+v, empty sections must be skipped", dump.Sections)
+	}
+	mem := sectionDump(t, dump, "memory")
+	if !mem.Truncated || mem.Tokens > 10 || !strings.HasSuffix(mem.Content, truncationMarker) || mem.OriginalTokens != 102 {
+		t.Fatalf("memory=%+v", mem)
+	}
+	logSec := sectionDump(t, dump, "log")
+	if !logSec.Truncated || !strings.HasPrefix(logSec.Content, truncationMarker) || !strings.HasSuffix(logSec.Content, " last") {
+		t.Fatalf("log=%+v", logSec)
+	}
+	if catalog := sectionDump(t, dump, "catalog"); !catalog.Dropped || strings.Contains(prompt, catalog.Content+long) {
+		t.Fatalf("catalog=%+v", catalog)
+	}
+	if skill := sectionDump(t, dump, "skill:weather"); skill.MaxTokens != 5 || skill.Tokens > 5 {
+		t.Fatalf("skill limit override not applied: %+v", skill)
+	}
+}
+
+func TestPromptBuilderTotalBudgetShrinksLowPriorityFirst(t *testing.T) {
+	b := NewPromptBuilder(60, nil)
+	b.Add(PromptSection{Name: "message", Priority: PromptPriorityMessage, Content: strings.Repeat("m", 80)})  // 20 tokens
+	b.Add(PromptSection{Name: "system", Priority: PromptPrioritySystem, Content: strings.Repeat("s", 200)})   // 50 tokens
+	b.Add(PromptSection{Name: "memory", Priority: PromptPriorityMemory, Content: strings.Repeat("r", 120)})   // 30 tokens
+	b.Add(PromptSection{Name: "setup", Priority: PromptPrioritySetup, Truncate: TruncateDrop, Content: "ok"}) // 1 token
+
+	prompt, dump := b.Build()
+	if got := sectionDump(t, dump, "message"); got.Truncated || got.Tokens != 20 {
+		t.Fatalf("message=%+v", got)
+	}
+	if got := sectionDump(t, dump, "memory"); got.Truncated {
+		t.Fatalf("memory=%+v", got)
+	}
+	if got := sectionDump(t, dump, "setup"); got.Dropped {
+		t.Fatalf("setup=%+v", got)
+	}
+	if got := sectionDump(t, dump, "system"); !got.Truncated || got.Tokens > 9 {
+		t.Fatalf("system=%+v", got)
+	}
+	if dump.Tokens > 62 { // budget plus the blank lines between sections
+		t.Fatalf("tokens=%d prompt=%q", dump.Tokens, prompt)
+	}
+	if !strings.HasPrefix(prompt, strings.Repeat("m", 80)+"\n\n"+"sss") {
+		t.Fatalf("sections must keep their order: %q", prompt)
+	}
+}
+
+func TestTruncateTokensKeepsRunesWhole(t *testing.T) {
+	s := strings.Repeat("ä", 40) // 80 bytes
+	for _, mode := range []Truncation{TruncateEnd, TruncateStart} {
+		got := truncateTokens(s, 5, mode)
+		if !strings.Contains(got, truncationMarker) || strings.ContainsRune(got, '�') || !strings.Contains(got, "ää") {
+			t.Fatalf("%s: %q", mode, got)
+		}
+		for _, r := range strings.ReplaceAll(got, truncationMarker, "") {
+			if r != 'ä' {
+				t.Fatalf("%s: broken rune in %q", mode, got)
+			}
+		}
+	}
+}
+
+// historyAgent records the history it would send, like the openai backend.
+type historyAgent struct{}
+
+func (historyAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	notePromptHistory(ctx, historyFromContext(ctx))
+	return "ok", nil
+}
+func (historyAgent) Close() error { return nil }
+
+func TestQueuedAgentRecordsLastPrompt(t *testing.T) {
+	r := NewRegistry()
+	r.Register("chat", historyAgent{}, 0)
+	r.HealthCheckAll(context.Background())
+
+	done := make(chan struct{}, 2)
+	qa := NewQueuedAgent(r, "registry", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		done <- struct{}{}
+	})
+	h, err := NewHistory(t.TempDir(), 10, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qa.SetHistory(h)
+	qa.SetPromptBudget(100, map[string]int{"memory": 5})
+	qa.SetPromptHook(func(ctx context.Context, msg Message, b *PromptBuilder) {
+		b.Add(PromptSection{Name: "memory", Priority: PromptPriorityMemory, Content: "[memory context]\nlikes tea and biscuits"})
+	})
+
+	if _, ok := qa.LastPrompt(1); ok {
+		t.Fatal("no prompt expected before the first turn")
+	}
+	for _, content := range []string{"hi", "again"} {
+		qa.Enqueue(context.Background(), Message{ChatID: 1, Content: content, Type: "text"})
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for reply")
+		}
+	}
+
+	dump, ok := qa.LastPrompt(1)
+	if !ok {
+		t.Fatal("last prompt missing")
+	}
+	if dump.Backend != "chat" || dump.ChatID != 1 || dump.TurnID == "" || dump.MaxTokens != 100 {
+		t.Fatalf("dump=%+v", dump)
+	}
+	if !strings.HasPrefix(dump.Prompt, "again\n\n[memory co") || !strings.HasSuffix(dump.Prompt, truncationMarker) {
+		t.Fatalf("prompt=%q", dump.Prompt)
+	}
+	if mem := sectionDump(t, dump, "memory"); !mem.Truncated || mem.MaxTokens != 5 {
+		t.Fatalf("memory=%+v", mem)
+	}
+	if len(dump.History) != 2 || dump.History[0].Content != "hi" {
+		t.Fatalf("history=%+v", dump.History)
+	}
+	// the history is written after the handler returns
+	for deadline := time.Now().Add(time.Second); len(h.Messages(1)) < 4; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("history=%+v, want both turns", h.Messages(1))
+		}
+	}
+}
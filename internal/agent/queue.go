@@ -2,9 +2,11 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -12,9 +14,13 @@ import (
 )
 
 type Message struct {
-	ChatID  int64
-	Content string
-	Type    string // "text", "voice", "photo"
+	ChatID  int64  `json:"chat_id"`
+	Content string `json:"content"`
+	Type    string `json:"type"`               // "text", "voice", "photo", "document", "scheduled"
+	ReplyTo string `json:"reply_to,omitempty"` // text of the message this one replies to
+	TaskID  string `json:"task_id,omitempty"`  // scheduler task of a "scheduled" message
+
+	Attachments []Attachment `json:"attachments,omitempty"` // files stored with the message
 }
 
 type Response struct {
@@ -26,19 +32,67 @@ type QueuedAgent struct {
 	agent                Agent
 	backend              string
 	mu                   sync.Mutex
-	busy                 bool
-	queue                []pendingMsg
+	lanes                map[laneKey]*lane
+	ready                []laneKey // lanes with pending messages waiting for a free slot
+	running              int       // lanes currently processing
+	maxConcurrency       int
 	handler              func(ctx context.Context, chatID int64, response string, err error, duration time.Duration)
 	longRunningHandler   func(ctx context.Context, chatID int64, elapsed time.Duration, preview string)
 	longRunningThreshold time.Duration
+	streamHandler        func(ctx context.Context, chatID int64, partial string)
+	streamInterval       time.Duration
+	turnSeq              atomic.Int64
+	journal              *Journal
+	history              *History
+	toolbox              Toolbox
+	promptHook           func(ctx context.Context, msg Message, b *PromptBuilder)
+	promptTokens         int
+	promptLimits         map[string]int
+	lastPrompts          map[int64]PromptDump // most recent prompt per chat, for /debug/prompt
+	coalesceWindow       time.Duration
+	steerMode            SteerMode
+	steerHandler         func(ctx context.Context, msg Message, mode SteerMode)
 	log                  *observability.Logger
 }
 
 type pendingMsg struct {
 	ctx context.Context
 	msg Message
+	ids []string // journal entry ids (several for a coalesced message), empty without journal
+}
+
+// laneKey identifies an ordered lane. Messages of one chat are processed in order;
+// scheduled prompts get their own lane so they never block interactive replies.
+type laneKey struct {
+	chatID     int64
+	background bool
+}
+
+type lane struct {
+	busy    bool
+	queue   []pendingMsg
+	current *Message           // message being processed, nil when idle
+	cancel  context.CancelFunc // aborts the in-flight prompt
+	turn    *Turn              // turn being processed, nil when idle
+	steered []pendingMsg       // messages injected into turn; journaled until it ends
+
+	coalesceTimer *time.Timer // set while an idle lane waits for more messages
+	coalesceGen   int         // invalidates timers that were replaced
+}
+
+// CancelResult reports what Cancel stopped.
+type CancelResult struct {
+	Canceled []Message // in-flight prompts that were aborted
+	Dropped  []Message // queued messages that were removed
+	Kept     int       // queued messages left in place
 }
 
+func laneFor(msg Message) laneKey {
+	return laneKey{chatID: msg.ChatID, background: msg.Type == "scheduled"}
+}
+
+const defaultMaxConcurrency = 4
+
 // NewQueuedAgent wraps an Agent with a message queue.
 // handler is called with the response for each processed message.
 func NewQueuedAgent(agent Agent, backend string, handler func(ctx context.Context, chatID int64, response string, err error, duration time.Duration)) *QueuedAgent {
@@ -48,8 +102,11 @@ func NewQueuedAgent(agent Agent, backend string, handler func(ctx context.Contex
 	return &QueuedAgent{
 		agent:                agent,
 		backend:              backend,
+		lanes:                make(map[laneKey]*lane),
+		maxConcurrency:       defaultMaxConcurrency,
 		handler:              handler,
 		longRunningThreshold: 3 * time.Minute,
+		streamInterval:       1500 * time.Millisecond,
 		log:                  observability.Component("agent.queue"),
 	}
 }
@@ -66,64 +123,560 @@ func (qa *QueuedAgent) SetLongRunningThreshold(d time.Duration) {
 	qa.longRunningThreshold = d
 }
 
-// Enqueue adds a message. If agent is idle, processes immediately.
-// If busy, queues it and processes after current prompt finishes.
+// SetStreamHandler enables streaming of partial replies.
+// handler receives the full text streamed so far, at most once per stream interval.
+func (qa *QueuedAgent) SetStreamHandler(handler func(ctx context.Context, chatID int64, partial string)) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.streamHandler = handler
+}
+
+func (qa *QueuedAgent) SetStreamInterval(d time.Duration) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	if d > 0 {
+		qa.streamInterval = d
+	}
+}
+
+// SetMaxConcurrency bounds how many lanes are processed in parallel.
+// The effective limit is further capped by backends implementing ConcurrencyLimiter.
+func (qa *QueuedAgent) SetMaxConcurrency(n int) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	if n > 0 {
+		qa.maxConcurrency = n
+	}
+}
+
+// SetJournal persists queued messages so they survive restarts. Call Replay
+// once on startup to re-enqueue what was pending when the process stopped.
+func (qa *QueuedAgent) SetJournal(j *Journal) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.journal = j
+}
+
+// SetHistory records finished turns per chat and hands them to stateless
+// backends through the turn context.
+func (qa *QueuedAgent) SetHistory(h *History) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.history = h
+}
+
+// SetToolbox exposes visor actions as tools to backends with function calling.
+func (qa *QueuedAgent) SetToolbox(tb Toolbox) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.toolbox = tb
+}
+
+// SetPromptHook sets a function that adds sections such as memory and skill
+// context to the prompt builder of a turn; the message itself is already the
+// "message" section. It runs once per turn, so coalesced messages are enriched
+// together.
+func (qa *QueuedAgent) SetPromptHook(hook func(ctx context.Context, msg Message, b *PromptBuilder)) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.promptHook = hook
+}
+
+// SetPromptBudget limits prompts to maxTokens tokens (0: unlimited); limits
+// overrides section budgets by name, see NewPromptBuilder.
+func (qa *QueuedAgent) SetPromptBudget(maxTokens int, limits map[string]int) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.promptTokens = maxTokens
+	qa.promptLimits = limits
+}
+
+// LastPrompt returns the most recent prompt sent for chatID.
+func (qa *QueuedAgent) LastPrompt(chatID int64) (PromptDump, bool) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	d, ok := qa.lastPrompts[chatID]
+	return d, ok
+}
+
+// SetCoalesceWindow merges text, voice and photo messages of a chat into one
+// prompt: an idle chat waits until no new message arrived for d, and messages
+// queued behind a busy turn are merged when the lane picks them up. 0 disables it.
+func (qa *QueuedAgent) SetCoalesceWindow(d time.Duration) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	if d >= 0 {
+		qa.coalesceWindow = d
+	}
+}
+
+// SetSteering forwards text, voice and photo messages that arrive while their
+// chat has a turn running into that turn instead of queueing them, if the
+// backend implements Steerer. handler is told about every injected message.
+func (qa *QueuedAgent) SetSteering(mode SteerMode, handler func(ctx context.Context, msg Message, mode SteerMode)) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	qa.steerMode = mode
+	qa.steerHandler = handler
+}
+
+// Replay re-enqueues journaled messages from a previous run, oldest first.
+// Entries that already reached the attempt limit are moved to the dead-letter file.
+func (qa *QueuedAgent) Replay(ctx context.Context) (replayed int, deadLettered int) {
+	j := qa.getJournal()
+	if j == nil {
+		return 0, 0
+	}
+	for _, entry := range j.Pending() {
+		if entry.Attempts >= j.MaxAttempts() {
+			reason := fmt.Sprintf("processing did not complete after %d attempts", entry.Attempts)
+			if err := j.DeadLetter(entry, reason); err != nil {
+				qa.log.Error(ctx, "dead-letter write failed", "id", entry.ID, "error", err.Error())
+				continue
+			}
+			deadLettered++
+			continue
+		}
+		qa.log.Info(ctx, "replaying journaled message", "id", entry.ID, "chat_id", entry.Message.ChatID, "message_type", entry.Message.Type, "attempts", entry.Attempts, "enqueued_at", entry.EnqueuedAt)
+		qa.enqueue(pendingMsg{ctx: ctx, msg: entry.Message, ids: []string{entry.ID}})
+		replayed++
+	}
+	return replayed, deadLettered
+}
+
+// Enqueue adds a message to its chat lane. If the lane is idle and a slot is free,
+// it is processed immediately; otherwise it waits behind earlier messages of the same lane.
 func (qa *QueuedAgent) Enqueue(ctx context.Context, msg Message) {
+	pending := pendingMsg{ctx: ctx, msg: msg}
+	if j := qa.getJournal(); j != nil {
+		id, err := j.Add(msg)
+		if err != nil {
+			qa.log.Warn(ctx, "queue journal write failed, message kept in memory only", "chat_id", msg.ChatID, "error", err.Error())
+		} else {
+			pending.ids = []string{id}
+		}
+	}
+	if qa.steer(pending) {
+		return
+	}
+	qa.enqueue(pending)
+}
+
+// steer injects p into the running turn of its chat. It only does so when
+// nothing else is queued for the chat, so messages are never reordered.
+func (qa *QueuedAgent) steer(p pendingMsg) bool {
+	if !qa.coalescable(p.msg) {
+		return false
+	}
+	s, ok := qa.agent.(Steerer)
+	if !ok {
+		return false
+	}
+	qa.mu.Lock()
+	mode, handler := qa.steerMode, qa.steerHandler
+	l := qa.lanes[laneFor(p.msg)]
+	var turn *Turn
+	if l != nil && l.turn != nil && len(l.queue) == 0 {
+		turn = l.turn
+	}
+	qa.mu.Unlock()
+	if mode == SteerOff || turn == nil {
+		return false
+	}
+
+	if err := s.Steer(p.ctx, turn.ID, mode, p.msg.Content); err != nil {
+		if !errors.Is(err, ErrNotSteerable) {
+			qa.log.Warn(p.ctx, "steering failed, message queued", "chat_id", p.msg.ChatID, "turn_id", turn.ID, "error", err.Error())
+		}
+		return false
+	}
+	turn.addSteered(p.msg.Content)
+
+	qa.mu.Lock()
+	running := l.turn == turn
+	if running {
+		l.steered = append(l.steered, p)
+	}
+	qa.mu.Unlock()
+	if !running {
+		qa.forget(p)
+	}
+	qa.log.Info(p.ctx, "message steered into running turn", "chat_id", p.msg.ChatID, "message_type", p.msg.Type, "turn_id", turn.ID, "mode", string(mode))
+	if handler != nil {
+		handler(p.ctx, p.msg, mode)
+	}
+	return true
+}
+
+func (qa *QueuedAgent) enqueue(pending pendingMsg) {
+	ctx, msg := pending.ctx, pending.msg
+	key := laneFor(msg)
+
 	qa.mu.Lock()
-	if qa.busy {
-		queueSize := len(qa.queue) + 1
-		qa.log.Info(ctx, "message queued", "chat_id", msg.ChatID, "message_type", msg.Type, "queue_size", queueSize)
-		qa.queue = append(qa.queue, pendingMsg{ctx: ctx, msg: msg})
+	l := qa.lanes[key]
+	if l == nil {
+		l = &lane{}
+		qa.lanes[key] = l
+	}
+	l.queue = append(l.queue, pending)
+
+	if l.busy {
+		qa.log.Info(ctx, "message queued", "chat_id", msg.ChatID, "message_type", msg.Type, "queue_size", len(l.queue))
+		qa.mu.Unlock()
+		return
+	}
+	if l.coalesceTimer != nil || (qa.coalesceWindow > 0 && qa.coalescable(msg)) {
+		if qa.coalescable(msg) {
+			qa.restartCoalesceLocked(key, l)
+		}
+		qa.log.Debug(ctx, "message waiting for coalesce window", "chat_id", msg.ChatID, "message_type", msg.Type, "queue_size", len(l.queue))
 		qa.mu.Unlock()
 		return
 	}
-	qa.busy = true
+	if qa.running >= qa.concurrencyLimitLocked() {
+		if !qa.isReadyLocked(key) {
+			qa.ready = append(qa.ready, key)
+		}
+		qa.log.Info(ctx, "message queued, all slots busy", "chat_id", msg.ChatID, "message_type", msg.Type, "running", qa.running)
+		qa.mu.Unlock()
+		return
+	}
+	l.busy = true
+	qa.running++
 	qa.mu.Unlock()
 
 	qa.log.Debug(ctx, "processing message immediately", "chat_id", msg.ChatID, "message_type", msg.Type)
-	go qa.process(ctx, msg)
+	go qa.runLane(key)
 }
 
-func (qa *QueuedAgent) process(ctx context.Context, msg Message) {
-	qa.processOne(ctx, msg)
+// restartCoalesceLocked (re)starts the quiet period of an idle lane. Must hold mu.
+func (qa *QueuedAgent) restartCoalesceLocked(key laneKey, l *lane) {
+	if l.coalesceTimer != nil {
+		l.coalesceTimer.Stop()
+	}
+	l.coalesceGen++
+	gen := l.coalesceGen
+	l.coalesceTimer = time.AfterFunc(qa.coalesceWindow, func() { qa.flushCoalesced(key, gen) })
+}
 
+// flushCoalesced starts a lane whose coalesce window passed without new messages.
+func (qa *QueuedAgent) flushCoalesced(key laneKey, gen int) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	l := qa.lanes[key]
+	if l == nil || l.coalesceGen != gen || l.coalesceTimer == nil {
+		return // replaced by a newer timer or canceled
+	}
+	l.coalesceTimer = nil
+	if l.busy {
+		return
+	}
+	if len(l.queue) == 0 {
+		delete(qa.lanes, key)
+		return
+	}
+	if qa.running >= qa.concurrencyLimitLocked() {
+		if !qa.isReadyLocked(key) {
+			qa.ready = append(qa.ready, key)
+		}
+		return
+	}
+	l.busy = true
+	qa.running++
+	go qa.runLane(key)
+}
+
+// runLane drains one lane. After each message it hands its slot to a waiting lane
+// (round-robin) so a chatty chat cannot starve the others.
+func (qa *QueuedAgent) runLane(key laneKey) {
 	for {
 		qa.mu.Lock()
-		if len(qa.queue) == 0 {
-			qa.busy = false
+		l := qa.lanes[key]
+		if l == nil || len(l.queue) == 0 {
+			if l != nil {
+				l.busy = false
+				delete(qa.lanes, key)
+			}
+			qa.running--
+			qa.startReadyLocked()
 			qa.mu.Unlock()
-			qa.log.Debug(ctx, "agent queue idle")
+			qa.log.Debug(context.Background(), "agent lane idle", "chat_id", key.chatID, "background", key.background)
 			return
 		}
-		next := qa.queue[0]
-		qa.queue = qa.queue[1:]
-		remaining := len(qa.queue)
+		next := qa.takeNextLocked(l)
+		remaining := len(l.queue)
 		qa.mu.Unlock()
 
-		nextCtx, nextSpan := observability.StartSpan(next.ctx, "agent.process", attribute.String("backend", qa.backend), attribute.String("message_type", next.msg.Type))
-		qa.log.Debug(nextCtx, "agent processing queued message", "chat_id", next.msg.ChatID, "message_type", next.msg.Type, "backend", qa.backend, "remaining_queue", remaining)
-		qa.processOne(nextCtx, next.msg)
-		nextSpan.End()
+		qa.log.Debug(next.ctx, "agent processing message", "chat_id", next.msg.ChatID, "message_type", next.msg.Type, "backend", qa.backend, "remaining_lane_queue", remaining)
+		procCtx, cancel := context.WithCancel(next.ctx)
+		turn := &Turn{ID: fmt.Sprintf("turn-%d", qa.turnSeq.Add(1)), Message: next.msg, history: qa.getHistory(), toolbox: qa.getToolbox()}
+		qa.mu.Lock()
+		current := next.msg
+		l.current = &current
+		l.cancel = cancel
+		l.turn = turn
+		qa.mu.Unlock()
+
+		qa.markAttempt(next)
+		qa.processOne(procCtx, turn)
+		cancel()
+		qa.forget(next)
+
+		qa.mu.Lock()
+		steered := l.steered
+		l.current = nil
+		l.cancel = nil
+		l.turn = nil
+		l.steered = nil
+		qa.mu.Unlock()
+		for _, p := range steered {
+			qa.forget(p)
+		}
+
+		qa.mu.Lock()
+		if len(qa.ready) > 0 && len(l.queue) > 0 {
+			// yield: park this lane behind the waiting ones and pass the slot on
+			l.busy = false
+			qa.ready = append(qa.ready, key)
+			qa.running--
+			qa.startReadyLocked()
+			qa.mu.Unlock()
+			return
+		}
+		qa.mu.Unlock()
+	}
+}
+
+// takeNextLocked pops the next message of l. With coalescing enabled, the
+// mergeable messages at the head of the lane are merged into one. Must hold mu.
+func (qa *QueuedAgent) takeNextLocked(l *lane) pendingMsg {
+	n := 1
+	if qa.coalesceWindow > 0 && qa.coalescable(l.queue[0].msg) {
+		for n < len(l.queue) && qa.coalescable(l.queue[n].msg) {
+			n++
+		}
+	}
+	batch := l.queue[:n]
+	l.queue = l.queue[n:]
+	if n == 1 {
+		return batch[0]
+	}
+
+	msgs := make([]Message, 0, n)
+	merged := pendingMsg{ctx: batch[0].ctx}
+	for _, p := range batch {
+		msgs = append(msgs, p.msg)
+		merged.ids = append(merged.ids, p.ids...)
+	}
+	merged.msg = mergeMessages(msgs)
+	qa.log.Info(merged.ctx, "messages coalesced", "chat_id", merged.msg.ChatID, "count", n, "message_type", merged.msg.Type)
+	return merged
+}
+
+// coalescable reports whether msg may be merged with other messages of its chat.
+// Scheduled prompts, fan-out follow-ups and other internal messages never are,
+// nor are messages whose prefix picks a backend: merged or steered, the prefix
+// would no longer lead the prompt and the route would not match.
+func (qa *QueuedAgent) coalescable(msg Message) bool {
+	switch msg.Type {
+	case "text", "voice", "photo", "document":
+	default:
+		return false
 	}
+	reg, ok := qa.agent.(*Registry)
+	return !ok || !reg.prefixRouted(msg)
 }
 
-func (qa *QueuedAgent) processOne(ctx context.Context, msg Message) {
+// mergeMessages joins msgs into one prompt, each part headed by its position.
+// The merged type is the common type, or "text" for a mix.
+func mergeMessages(msgs []Message) Message {
+	merged := Message{ChatID: msgs[0].ChatID, Type: msgs[0].Type}
+	parts := make([]string, 0, len(msgs))
+	var replies []string
+	for i, m := range msgs {
+		if m.Type != merged.Type {
+			merged.Type = "text"
+		}
+		parts = append(parts, fmt.Sprintf("[message %d/%d]\n%s", i+1, len(msgs), m.Content))
+		if m.ReplyTo != "" {
+			replies = append(replies, m.ReplyTo)
+		}
+		merged.Attachments = append(merged.Attachments, m.Attachments...)
+	}
+	merged.Content = strings.Join(parts, "\n\n")
+	merged.ReplyTo = strings.Join(replies, "\n\n")
+	return merged
+}
+
+// Cancel aborts the in-flight prompts of a chat (interactive and scheduled lane).
+// Queued messages are dropped when dropQueued is set, otherwise they stay queued.
+func (qa *QueuedAgent) Cancel(chatID int64, dropQueued bool) CancelResult {
+	qa.mu.Lock()
+	var res CancelResult
+	var dropped []string // journal ids, removed after unlocking
+	for _, key := range []laneKey{{chatID: chatID}, {chatID: chatID, background: true}} {
+		l := qa.lanes[key]
+		if l == nil {
+			continue
+		}
+		if l.cancel != nil && l.current != nil {
+			l.cancel()
+			res.Canceled = append(res.Canceled, *l.current)
+		}
+		if dropQueued {
+			for _, p := range l.queue {
+				res.Dropped = append(res.Dropped, p.msg)
+				dropped = append(dropped, p.ids...)
+			}
+			l.queue = nil
+			if l.coalesceTimer != nil {
+				l.coalesceTimer.Stop()
+				l.coalesceTimer = nil
+				if !l.busy {
+					delete(qa.lanes, key)
+				}
+			}
+		} else {
+			res.Kept += len(l.queue)
+		}
+	}
+	j := qa.journal
+	qa.mu.Unlock()
+
+	if j != nil && len(dropped) > 0 {
+		if err := j.Remove(dropped...); err != nil {
+			qa.log.Warn(context.Background(), "queue journal remove failed", "id", strings.Join(dropped, ","), "error", err.Error())
+		}
+	}
+	qa.log.Info(context.Background(), "agent cancel requested", "chat_id", chatID, "canceled", len(res.Canceled), "dropped", len(res.Dropped), "kept", res.Kept)
+	return res
+}
+
+func (qa *QueuedAgent) markAttempt(p pendingMsg) {
+	j := qa.getJournal()
+	if j == nil {
+		return
+	}
+	for _, id := range p.ids {
+		if err := j.MarkAttempt(id); err != nil {
+			qa.log.Warn(p.ctx, "queue journal attempt update failed", "id", id, "error", err.Error())
+		}
+	}
+}
+
+func (qa *QueuedAgent) forget(p pendingMsg) {
+	j := qa.getJournal()
+	if j == nil || len(p.ids) == 0 {
+		return
+	}
+	if err := j.Remove(p.ids...); err != nil {
+		qa.log.Warn(p.ctx, "queue journal remove failed", "id", strings.Join(p.ids, ","), "error", err.Error())
+	}
+}
+
+func (qa *QueuedAgent) getHistory() *History {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	return qa.history
+}
+
+func (qa *QueuedAgent) newPromptBuilder() (*PromptBuilder, func(ctx context.Context, msg Message, b *PromptBuilder)) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	return NewPromptBuilder(qa.promptTokens, qa.promptLimits), qa.promptHook
+}
+
+func (qa *QueuedAgent) getToolbox() Toolbox {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	return qa.toolbox
+}
+
+func (qa *QueuedAgent) getJournal() *Journal {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	return qa.journal
+}
+
+// startReadyLocked starts waiting lanes while slots are free. Must hold mu.
+func (qa *QueuedAgent) startReadyLocked() {
+	for len(qa.ready) > 0 && qa.running < qa.concurrencyLimitLocked() {
+		key := qa.ready[0]
+		qa.ready = qa.ready[1:]
+		l := qa.lanes[key]
+		if l == nil || l.busy {
+			continue
+		}
+		if len(l.queue) == 0 {
+			delete(qa.lanes, key) // drained by Cancel while waiting
+			continue
+		}
+		l.busy = true
+		qa.running++
+		go qa.runLane(key)
+	}
+}
+
+func (qa *QueuedAgent) isReadyLocked(key laneKey) bool {
+	for _, k := range qa.ready {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (qa *QueuedAgent) concurrencyLimitLocked() int {
+	limit := qa.maxConcurrency
+	if backendLimit := maxConcurrentPrompts(qa.agent); backendLimit > 0 && backendLimit < limit {
+		limit = backendLimit
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+func (qa *QueuedAgent) processOne(ctx context.Context, turn *Turn) {
+	msg := turn.Message
 	ctx, span := observability.StartSpan(ctx, "agent.process", attribute.String("backend", qa.backend), attribute.String("message_type", msg.Type))
 	defer span.End()
 
-	qa.log.Debug(ctx, "agent prompt start", "chat_id", msg.ChatID, "message_type", msg.Type, "backend", qa.backend)
+	history := turn.history
+	ctx = withTurn(ctx, turn)
+
+	builder, hook := qa.newPromptBuilder()
+	builder.Add(PromptSection{Name: "message", Priority: PromptPriorityMessage, Content: msg.Content})
+	if hook != nil {
+		hook(ctx, msg, builder)
+	}
+	prompt, dump := builder.Build()
+	dump.Backend = qa.backend
+	turn.setPrompt(dump)
+
+	qa.log.Debug(ctx, "agent prompt start", "chat_id", msg.ChatID, "message_type", msg.Type, "backend", qa.backend, "turn_id", turn.ID, "prompt_tokens", dump.Tokens)
 
 	startedAt := time.Now()
 	var progressMu sync.Mutex
 	progressTail := ""
+	var streamed strings.Builder
+	streamDirty := false
 
 	reporter := func(delta string) {
 		progressMu.Lock()
 		defer progressMu.Unlock()
 		progressTail = keepTail(progressTail + delta)
+		streamed.WriteString(delta)
+		streamDirty = true
 	}
 
-	reportCtx := withProgressReporter(ctx, reporter)
+	reportCtx := withProgressReset(withProgressReporter(ctx, reporter), func() {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progressTail = ""
+		streamed.Reset()
+		streamDirty = false
+	})
 
 	notifyDone := make(chan struct{})
 	go func() {
@@ -153,17 +706,62 @@ func (qa *QueuedAgent) processOne(ctx context.Context, msg Message) {
 		}
 	}()
 
-	response, err := qa.agent.SendPrompt(reportCtx, msg.Content)
+	// stream partial output; waited on below so no edit can land after the final reply.
+	var streamWG sync.WaitGroup
+	if streamHandler, interval := qa.getStreamHandler(); streamHandler != nil {
+		streamWG.Add(1)
+		go func() {
+			defer streamWG.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-notifyDone:
+					return
+				case <-ticker.C:
+					progressMu.Lock()
+					dirty := streamDirty
+					partial := streamed.String()
+					streamDirty = false
+					progressMu.Unlock()
+					if dirty && strings.TrimSpace(partial) != "" {
+						streamHandler(ctx, msg.ChatID, partial)
+					}
+				}
+			}
+		}()
+	}
+
+	response, err := qa.agent.SendPrompt(reportCtx, prompt)
 	close(notifyDone)
+	streamWG.Wait()
+	if sent, ok := turn.Prompt(); ok {
+		qa.mu.Lock()
+		if qa.lastPrompts == nil {
+			qa.lastPrompts = make(map[int64]PromptDump)
+		}
+		qa.lastPrompts[msg.ChatID] = sent
+		qa.mu.Unlock()
+	}
 
 	duration := time.Since(startedAt)
 	durationMs := duration.Milliseconds()
 	if err != nil {
 		qa.log.Error(ctx, "agent prompt error", "chat_id", msg.ChatID, "backend", qa.backend, "duration_ms", durationMs, "error", err.Error())
 	} else {
-		qa.log.Info(ctx, "agent prompt processed", "chat_id", msg.ChatID, "backend", qa.backend, "duration_ms", durationMs)
+		inputTokens, outputTokens := sumUsage(turn.Usage())
+		qa.log.Info(ctx, "agent prompt processed", "chat_id", msg.ChatID, "backend", qa.backend, "duration_ms", durationMs, "input_tokens", inputTokens, "output_tokens", outputTokens)
 	}
 	qa.handler(ctx, msg.ChatID, response, err, duration)
+
+	// after the handler, so the history keeps the reply the user got (see Turn.SetReply)
+	if err == nil && history != nil {
+		if reply := turn.historyReply(response); strings.TrimSpace(reply) != "" {
+			if histErr := history.Append(msg.ChatID, turn.userContent(), reply); histErr != nil {
+				qa.log.Warn(ctx, "conversation history write failed", "chat_id", msg.ChatID, "error", histErr.Error())
+			}
+		}
+	}
 }
 
 func (qa *QueuedAgent) getLongRunningHandler() func(ctx context.Context, chatID int64, elapsed time.Duration, preview string) {
@@ -172,6 +770,12 @@ func (qa *QueuedAgent) getLongRunningHandler() func(ctx context.Context, chatID
 	return qa.longRunningHandler
 }
 
+func (qa *QueuedAgent) getStreamHandler() (func(ctx context.Context, chatID int64, partial string), time.Duration) {
+	qa.mu.Lock()
+	defer qa.mu.Unlock()
+	return qa.streamHandler, qa.streamInterval
+}
+
 func (qa *QueuedAgent) getLongRunningThreshold() time.Duration {
 	qa.mu.Lock()
 	defer qa.mu.Unlock()
@@ -186,11 +790,15 @@ func keepTail(s string) string {
 	return s[len(s)-max:]
 }
 
-// QueueLen returns the number of pending messages.
+// QueueLen returns the number of pending messages across all lanes.
 func (qa *QueuedAgent) QueueLen() int {
 	qa.mu.Lock()
 	defer qa.mu.Unlock()
-	return len(qa.queue)
+	n := 0
+	for _, l := range qa.lanes {
+		n += len(l.queue)
+	}
+	return n
 }
 
 // CurrentBackend returns the current backend label.
@@ -232,6 +840,34 @@ func (qa *QueuedAgent) SwitchBackend(name string) error {
 	return reg.SetActive(name)
 }
 
+// ResetBackend drops a SwitchBackend pin so the registry returns to priority order.
+func (qa *QueuedAgent) ResetBackend() {
+	if reg, ok := qa.agent.(*Registry); ok {
+		reg.Unpin()
+	}
+}
+
+// BackendStatus returns per-backend breaker state. A single backend is only
+// listed when it runs a supervised process.
+func (qa *QueuedAgent) BackendStatus() []BackendStatus {
+	if reg, ok := qa.agent.(*Registry); ok {
+		return reg.Status()
+	}
+	// a single backend has no breaker; only its process is worth showing
+	if ps, ok := processStatus(qa.agent); ok {
+		return []BackendStatus{{Name: qa.backend, Healthy: !ps.CrashLoop, Active: true, State: BreakerClosed, Process: &ps}}
+	}
+	return nil
+}
+
+// ListModels returns the models served by the active backend.
+func (qa *QueuedAgent) ListModels(ctx context.Context) ([]string, error) {
+	if reg, ok := qa.agent.(*Registry); ok {
+		return reg.ListModelsOnActive(ctx)
+	}
+	return listModels(ctx, qa.agent)
+}
+
 func (qa *QueuedAgent) SwitchModel(model string) error {
 	if reg, ok := qa.agent.(*Registry); ok {
 		return reg.SetModelOnActive(model)
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -173,3 +175,438 @@ func TestQueuedAgent_SwitchModel(t *testing.T) {
 		t.Fatalf("CurrentBackend=%q want %q", got, "pi/gpt-5")
 	}
 }
+
+func TestQueuedAgent_StreamsPartialOutputBeforeFinal(t *testing.T) {
+	var mu sync.Mutex
+	var partials []string
+	var streamTurn, finalTurn string
+	finished := make(chan struct{})
+
+	qa := NewQueuedAgent(&progressAgent{delay: 60 * time.Millisecond}, "progress", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		mu.Lock()
+		if turn := TurnFromContext(ctx); turn != nil {
+			finalTurn = turn.ID
+		}
+		mu.Unlock()
+		close(finished)
+	})
+	qa.SetStreamInterval(10 * time.Millisecond)
+	qa.SetStreamHandler(func(ctx context.Context, chatID int64, partial string) {
+		mu.Lock()
+		defer mu.Unlock()
+		partials = append(partials, partial)
+		if turn := TurnFromContext(ctx); turn != nil {
+			streamTurn = turn.ID
+		}
+	})
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "x", Type: "text"})
+	<-finished
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(partials) == 0 {
+		t.Fatal("expected at least one streamed partial")
+	}
+	if partials[0] != "step 1" {
+		t.Fatalf("first partial=%q want %q", partials[0], "step 1")
+	}
+	if streamTurn == "" || streamTurn != finalTurn {
+		t.Fatalf("stream turn=%q final turn=%q, want same non-empty id", streamTurn, finalTurn)
+	}
+}
+
+// gateAgent blocks each prompt until released and records concurrency.
+type gateAgent struct {
+	mu      sync.Mutex
+	active  int
+	peak    int
+	release chan struct{}
+	limit   int
+}
+
+func (g *gateAgent) SendPrompt(_ context.Context, prompt string) (string, error) {
+	g.mu.Lock()
+	g.active++
+	if g.active > g.peak {
+		g.peak = g.active
+	}
+	g.mu.Unlock()
+	<-g.release
+	g.mu.Lock()
+	g.active--
+	g.mu.Unlock()
+	return "reply:" + prompt, nil
+}
+
+func (g *gateAgent) Close() error { return nil }
+
+func (g *gateAgent) Peak() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.peak
+}
+
+type limitedGateAgent struct{ *gateAgent }
+
+func (l limitedGateAgent) MaxConcurrentPrompts() int { return l.limit }
+
+func TestQueuedAgent_ChatsRunInParallel(t *testing.T) {
+	gate := &gateAgent{release: make(chan struct{})}
+	done := make(chan string, 4)
+	qa := NewQueuedAgent(gate, "gate", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		done <- response
+	})
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "a", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 2, Content: "b", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "scheduled", Type: "scheduled"})
+	time.Sleep(30 * time.Millisecond)
+
+	if got := gate.Peak(); got != 3 {
+		t.Fatalf("peak concurrency=%d want 3 (two chats + scheduled lane)", got)
+	}
+	close(gate.release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+}
+
+func TestQueuedAgent_OrderWithinChatUnderConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	got := map[int64][]string{}
+	var wg sync.WaitGroup
+	wg.Add(6)
+
+	qa := NewQueuedAgent(&slowAgent{delay: 5 * time.Millisecond}, "slow", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		mu.Lock()
+		got[chatID] = append(got[chatID], response)
+		mu.Unlock()
+		wg.Done()
+	})
+	qa.SetMaxConcurrency(2)
+
+	for _, content := range []string{"1", "2", "3"} {
+		qa.Enqueue(context.Background(), Message{ChatID: 10, Content: content, Type: "text"})
+		qa.Enqueue(context.Background(), Message{ChatID: 20, Content: content, Type: "text"})
+	}
+	wg.Wait()
+
+	for _, chat := range []int64{10, 20} {
+		want := []string{"reply:1", "reply:2", "reply:3"}
+		for i := range want {
+			if got[chat][i] != want[i] {
+				t.Fatalf("chat %d order=%v want %v", chat, got[chat], want)
+			}
+		}
+	}
+}
+
+func TestQueuedAgent_BackendConcurrencyLimit(t *testing.T) {
+	gate := &gateAgent{release: make(chan struct{}), limit: 1}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	qa := NewQueuedAgent(limitedGateAgent{gate}, "pi", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		wg.Done()
+	})
+
+	for chat := int64(1); chat <= 3; chat++ {
+		qa.Enqueue(context.Background(), Message{ChatID: chat, Content: "x", Type: "text"})
+	}
+	time.Sleep(30 * time.Millisecond)
+	if qa.QueueLen() != 2 {
+		t.Fatalf("queue len=%d want 2 while single slot is busy", qa.QueueLen())
+	}
+	close(gate.release)
+	wg.Wait()
+
+	if got := gate.Peak(); got != 1 {
+		t.Fatalf("peak concurrency=%d want 1", got)
+	}
+}
+
+// blockingAgent blocks until its context is canceled.
+type blockingAgent struct{}
+
+func (b *blockingAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (b *blockingAgent) Close() error { return nil }
+
+func TestQueuedAgent_CancelKeepsOrDropsQueue(t *testing.T) {
+	errs := make(chan error, 4)
+	qa := NewQueuedAgent(&blockingAgent{}, "blocking", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		errs <- err
+	})
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "first", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "second", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "third", Type: "text"})
+	time.Sleep(20 * time.Millisecond)
+
+	res := qa.Cancel(1, false)
+	if len(res.Canceled) != 1 || res.Canceled[0].Content != "first" {
+		t.Fatalf("canceled=%v want [first]", res.Canceled)
+	}
+	if res.Kept != 2 || len(res.Dropped) != 0 {
+		t.Fatalf("kept=%d dropped=%d want kept=2 dropped=0", res.Kept, len(res.Dropped))
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want context.Canceled", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	res = qa.Cancel(1, true)
+	if len(res.Canceled) != 1 || res.Canceled[0].Content != "second" {
+		t.Fatalf("canceled=%v want [second]", res.Canceled)
+	}
+	if len(res.Dropped) != 1 || res.Dropped[0].Content != "third" {
+		t.Fatalf("dropped=%v want [third]", res.Dropped)
+	}
+	<-errs
+
+	time.Sleep(20 * time.Millisecond)
+	if qa.QueueLen() != 0 {
+		t.Fatalf("queue len=%d want 0", qa.QueueLen())
+	}
+	if res := qa.Cancel(1, true); len(res.Canceled) != 0 {
+		t.Fatalf("idle cancel canceled=%v want none", res.Canceled)
+	}
+}
+
+func TestQueuedAgent_JournalReplayAndDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJournal(dir, 2)
+	if err != nil {
+		t.Fatalf("NewJournal: %v", err)
+	}
+	// left over from a previous run: one fresh message, one that already failed twice
+	if _, err := j.Add(Message{ChatID: 1, Content: "resume me", Type: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	poison, _ := j.Add(Message{ChatID: 1, Content: "poison", Type: "text"})
+	_ = j.MarkAttempt(poison)
+	_ = j.MarkAttempt(poison)
+
+	got := make(chan string, 2)
+	qa := NewQueuedAgent(&EchoAgent{}, "echo", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		got <- response
+	})
+	qa.SetJournal(j)
+
+	replayed, deadLettered := qa.Replay(context.Background())
+	if replayed != 1 || deadLettered != 1 {
+		t.Fatalf("replayed=%d dead=%d want 1/1", replayed, deadLettered)
+	}
+	if resp := <-got; resp != "echo: resume me" {
+		t.Fatalf("resp=%q want echo: resume me", resp)
+	}
+
+	qa.Enqueue(context.Background(), Message{ChatID: 2, Content: "new", Type: "text"})
+	<-got
+	time.Sleep(20 * time.Millisecond)
+	if n := len(j.Pending()); n != 0 {
+		t.Fatalf("journal pending=%d want 0 after processing", n)
+	}
+}
+
+func TestQueuedAgent_CoalescesMessagesWithinWindow(t *testing.T) {
+	j, err := NewJournal(t.TempDir(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		response string
+		msgType  string
+	}
+	done := make(chan result, 4)
+	qa := NewQueuedAgent(&EchoAgent{}, "echo", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		done <- result{response: response, msgType: TurnFromContext(ctx).Message.Type}
+	})
+	qa.SetJournal(j)
+	qa.SetCoalesceWindow(40 * time.Millisecond)
+	var hookCalls int
+	qa.SetPromptHook(func(ctx context.Context, msg Message, b *PromptBuilder) {
+		hookCalls++
+		b.Add(PromptSection{Name: "memory", Priority: PromptPriorityMemory, Content: "[memory context]\nlikes tea"})
+	})
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "hey", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "[Voice message] are you there", Type: "voice"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "[photo:abc] look", Type: "photo"})
+
+	var got result
+	select {
+	case got = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for coalesced reply")
+	}
+	want := "echo: [message 1/3]\nhey\n\n[message 2/3]\n[Voice message] are you there\n\n[message 3/3]\n[photo:abc] look\n\n[memory context]\nlikes tea"
+	if got.response != want {
+		t.Fatalf("response=%q\nwant %q", got.response, want)
+	}
+	if got.msgType != "text" {
+		t.Fatalf("merged type=%q want text", got.msgType)
+	}
+	select {
+	case extra := <-done:
+		t.Fatalf("unexpected second reply %q", extra.response)
+	case <-time.After(60 * time.Millisecond):
+	}
+	if hookCalls != 1 {
+		t.Fatalf("prompt hook calls=%d want 1", hookCalls)
+	}
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Fatalf("journal still holds %d entries", len(pending))
+	}
+}
+
+func TestQueuedAgent_CoalescesMessagesQueuedWhileBusy(t *testing.T) {
+	gate := &gateAgent{release: make(chan struct{})}
+	done := make(chan string, 4)
+	qa := NewQueuedAgent(gate, "gate", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		done <- response
+	})
+	qa.SetCoalesceWindow(5 * time.Millisecond)
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "first", Type: "text"})
+	time.Sleep(30 * time.Millisecond) // window passed, first turn is running
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "stop", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "use the other repo", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "fan-out results", Type: "fanout"})
+
+	want := []string{
+		"reply:first",
+		"reply:[message 1/2]\nstop\n\n[message 2/2]\nuse the other repo",
+		"reply:fan-out results", // internal messages are never merged
+	}
+	for i, w := range want {
+		gate.release <- struct{}{}
+		select {
+		case got := <-done:
+			if got != w {
+				t.Fatalf("reply %d=%q want %q", i, got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for reply %d", i)
+		}
+	}
+}
+
+// steerAgent holds each prompt until released and accepts steering messages
+// for the turns in flight, appending them to their reply.
+type steerAgent struct {
+	mu      sync.Mutex
+	running map[string][]string // turn id -> steered messages
+	started chan string
+	release chan struct{}
+}
+
+func (s *steerAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	id := TurnFromContext(ctx).ID
+	s.mu.Lock()
+	if s.running == nil {
+		s.running = make(map[string][]string)
+	}
+	s.running[id] = nil
+	s.mu.Unlock()
+	s.started <- prompt
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steered := s.running[id]
+	delete(s.running, id)
+	return "reply:" + strings.Join(append([]string{prompt}, steered...), "+"), nil
+}
+
+func (s *steerAgent) Steer(_ context.Context, turnID string, mode SteerMode, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steered, ok := s.running[turnID]
+	if !ok {
+		return ErrNotSteerable
+	}
+	s.running[turnID] = append(steered, string(mode)+":"+message)
+	return nil
+}
+
+func (s *steerAgent) Close() error { return nil }
+
+func TestQueuedAgent_SteersMessagesIntoRunningTurn(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJournal(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := NewHistory(dir, 10, 4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa := &steerAgent{started: make(chan string, 4), release: make(chan struct{})}
+	done := make(chan string, 4)
+	qa := NewQueuedAgent(sa, "pi", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		done <- response
+	})
+	qa.SetJournal(j)
+	qa.SetHistory(history)
+	notified := make(chan Message, 4)
+	qa.SetSteering(SteerInterrupt, func(ctx context.Context, msg Message, mode SteerMode) {
+		notified <- msg
+	})
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "refactor the parser", Type: "text"})
+	<-sa.started
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "stop, use the other repo", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "daily digest", Type: "scheduled"})
+	<-sa.started // the scheduled lane runs on its own and is never steered
+
+	select {
+	case msg := <-notified:
+		if msg.Content != "stop, use the other repo" {
+			t.Fatalf("notified %q", msg.Content)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("steering handler not called")
+	}
+	if n := len(j.Pending()); n != 3 {
+		t.Fatalf("journal pending=%d want 3 while the turns run", n)
+	}
+
+	sa.release <- struct{}{}
+	sa.release <- struct{}{}
+	got := map[string]bool{<-done: true, <-done: true}
+	if !got["reply:refactor the parser+steer:stop, use the other repo"] || !got["reply:daily digest"] {
+		t.Fatalf("replies=%v", got)
+	}
+	select {
+	case extra := <-done:
+		t.Fatalf("steered message got its own reply %q", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := len(j.Pending()); n != 0 {
+		t.Fatalf("journal pending=%d want 0 after the turn", n)
+	}
+	found := false
+	for _, m := range history.Messages(1) {
+		found = found || (m.Role == "user" && m.Content == "refactor the parser\n\nstop, use the other repo")
+	}
+	if !found {
+		t.Fatalf("history lacks the steered message: %+v", history.Messages(1))
+	}
+
+	// without a running turn the message is processed normally
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "thanks", Type: "text"})
+	<-sa.started
+	sa.release <- struct{}{}
+	if resp := <-done; resp != "reply:thanks" {
+		t.Fatalf("reply=%q", resp)
+	}
+	// the history and the journal are written after the handler returns
+	for deadline := time.Now().Add(time.Second); len(j.Pending()) > 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("journal pending=%d after the last turn", len(j.Pending()))
+		}
+	}
+}
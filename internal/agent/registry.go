@@ -2,12 +2,15 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"visor/internal/observability"
 )
 
@@ -15,29 +18,59 @@ import (
 type Backend struct {
 	Name        string
 	Agent       Agent
-	Priority    int // lower = higher priority
-	Healthy     bool
+	Priority    int  // lower = higher priority
+	Healthy     bool // false while the breaker is open
 	LastErr     string
-	UnhealthyAt time.Time // when it was marked unhealthy (for cooldown recovery)
+	LastLatency time.Duration // duration of the last successful probe
+	LastProbeAt time.Time
+
+	breaker    circuitBreaker
+	firstToken latencyHistogram // time to first token (or full answer) of prompts
 }
 
 // Registry manages multiple backends with priority-based selection.
 // It implements the Agent interface by proxying to the active backend.
+// Each backend has a circuit breaker: failures open it with exponential
+// backoff, and once the backoff expires the backend is half-open: probes run
+// and a single trial prompt is let through until one of them closes it again.
 type Registry struct {
-	backends []*Backend // sorted by priority (lowest first = highest priority)
-	active   *Backend
-	mu       sync.RWMutex
-	cooldown time.Duration         // how long before unhealthy backends are retried
-	OnSwitch func(from, to string) // called when active backend changes due to failover
-	log      *observability.Logger
+	backends    []*Backend // sorted by priority (lowest first = highest priority)
+	active      *Backend
+	pinned      *Backend    // chosen via SetActive; preferred while its breaker allows traffic
+	routes      []RouteRule // per-message rules, first match wins; a pin overrides them
+	hedge       HedgePolicy
+	mu          sync.RWMutex
+	cooldown    time.Duration         // initial open duration of a tripped breaker
+	maxCooldown time.Duration         // cap for the doubling backoff
+	OnSwitch    func(from, to string) // called when active backend changes due to failover
+	stopProbe   chan struct{}
+	log         *observability.Logger
 }
 
-const defaultCooldown = 5 * time.Minute
+const (
+	defaultCooldown    = 30 * time.Second
+	defaultMaxCooldown = 10 * time.Minute
+	probeTimeout       = 5 * time.Second
+)
 
 func NewRegistry() *Registry {
 	return &Registry{
-		cooldown: defaultCooldown,
-		log:      observability.Component("agent.registry"),
+		cooldown:    defaultCooldown,
+		maxCooldown: defaultMaxCooldown,
+		log:         observability.Component("agent.registry"),
+	}
+}
+
+// SetBackoff configures the breaker backoff: base for the first trip, doubling
+// on each consecutive trip up to max. Zero values keep the defaults.
+func (r *Registry) SetBackoff(base, max time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if base > 0 {
+		r.cooldown = base
+	}
+	if max > 0 {
+		r.maxCooldown = max
 	}
 }
 
@@ -51,8 +84,14 @@ func (r *Registry) Register(name string, a Agent, priority int) {
 		Agent:    a,
 		Priority: priority,
 		Healthy:  true, // assume healthy until checked
+		breaker:  circuitBreaker{state: BreakerClosed},
 	}
 	r.backends = append(r.backends, b)
+	if n, ok := a.(CrashLoopNotifier); ok {
+		n.SetCrashLoopHandler(func(reason string) {
+			r.MarkUnhealthy(name, "crash loop: "+reason)
+		})
+	}
 
 	// keep sorted by priority
 	for i := len(r.backends) - 1; i > 0; i-- {
@@ -64,48 +103,175 @@ func (r *Registry) Register(name string, a Agent, priority int) {
 	r.log.Info(nil, "backend registered", "name", name, "priority", priority)
 }
 
-// HealthCheckAll runs health checks on all backends and selects the best one.
+// HealthCheckAll probes every backend regardless of breaker state and selects
+// the best one. Used at startup; the background prober uses ProbeAll.
 func (r *Registry) HealthCheckAll(ctx context.Context) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.probe(ctx, false)
+}
+
+// ProbeAll sends a canary to every backend whose breaker is closed or due for
+// a half-open retry, updates the breakers and reselects the active backend,
+// so a recovered higher-priority backend is used again automatically.
+func (r *Registry) ProbeAll(ctx context.Context) {
+	r.probe(ctx, true)
+}
 
+func (r *Registry) probe(ctx context.Context, respectBreaker bool) {
+	r.mu.Lock()
+	now := time.Now()
+	var due []*Backend
 	for _, b := range r.backends {
-		healthy, reason := checkHealth(ctx, b.Name)
-		b.Healthy = healthy
-		if !healthy {
-			b.LastErr = reason
-			b.UnhealthyAt = time.Now()
-			r.log.Warn(ctx, "backend unhealthy", "name", b.Name, "reason", reason)
-		} else {
-			b.LastErr = ""
-			b.UnhealthyAt = time.Time{}
-			r.log.Info(ctx, "backend healthy", "name", b.Name)
+		if respectBreaker && !r.allowLocked(ctx, b, now) {
+			continue
 		}
+		due = append(due, b)
 	}
+	r.mu.Unlock()
 
+	type result struct {
+		healthy bool
+		reason  string
+		latency time.Duration
+	}
+	results := make([]result, len(due))
+	for i, b := range due {
+		start := time.Now()
+		healthy, reason := checkBackendHealth(ctx, b)
+		results[i] = result{healthy: healthy, reason: reason, latency: time.Since(start)}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.active
+	for i, b := range due {
+		res := results[i]
+		b.LastProbeAt = time.Now()
+		if res.healthy {
+			r.recordSuccessLocked(ctx, b, res.latency)
+			r.log.Debug(ctx, "backend probe ok", "name", b.Name, "latency_ms", res.latency.Milliseconds())
+		} else {
+			r.recordFailureLocked(ctx, b, res.reason, 0)
+		}
+	}
 	r.selectActiveLocked(ctx)
+	if respectBreaker && old != nil && r.active != nil && old != r.active {
+		r.log.Info(ctx, "prober switched active backend", "from", old.Name, "to", r.active.Name)
+	}
 }
 
-// selectActiveLocked picks the highest-priority healthy backend. Must hold mu.
-// Also performs cooldown recovery: backends unhealthy for longer than cooldown
-// are automatically marked healthy again.
-func (r *Registry) selectActiveLocked(ctx context.Context) {
+// StartProber probes all backends every interval until Close. A non-positive
+// interval disables probing.
+func (r *Registry) StartProber(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	if r.stopProbe != nil {
+		r.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	r.stopProbe = stop
+	r.mu.Unlock()
+
+	r.log.Info(nil, "backend prober started", "interval", interval.String())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.ProbeAll(context.Background())
+			}
+		}
+	}()
+}
+
+// allowLocked reports whether b may take traffic, logging the open → half-open
+// transition. Must hold mu.
+func (r *Registry) allowLocked(ctx context.Context, b *Backend, now time.Time) bool {
+	wasOpen := b.breaker.state == BreakerOpen
+	if !b.breaker.allow(now) {
+		return false
+	}
+	if wasOpen {
+		b.Healthy = true
+		r.log.Info(ctx, "backend breaker half-open", "name", b.Name)
+	}
+	return true
+}
+
+// acquireLocked reports whether a prompt may start on b now; a half-open
+// breaker admits one trial prompt at a time. Must hold mu.
+func (r *Registry) acquireLocked(ctx context.Context, b *Backend, now time.Time) bool {
+	if !r.allowLocked(ctx, b, now) {
+		return false
+	}
+	return b.breaker.acquire(now, r.maxCooldown)
+}
+
+// admitLocked returns preferred if a prompt may start on it, else the
+// highest-priority other backend that admits one, or nil. Must hold mu.
+func (r *Registry) admitLocked(ctx context.Context, preferred *Backend) *Backend {
 	now := time.Now()
+	if preferred != nil && r.acquireLocked(ctx, preferred, now) {
+		return preferred
+	}
 	for _, b := range r.backends {
-		if !b.Healthy && !b.UnhealthyAt.IsZero() && now.Sub(b.UnhealthyAt) >= r.cooldown {
-			b.Healthy = true
-			b.LastErr = ""
-			b.UnhealthyAt = time.Time{}
-			r.log.Info(ctx, "backend recovered after cooldown", "name", b.Name)
+		if b != preferred && r.acquireLocked(ctx, b, now) {
+			if preferred != nil {
+				r.log.Debug(ctx, "half-open trial in flight, using next backend", "backend", preferred.Name, "next", b.Name)
+			}
+			return b
 		}
 	}
+	return nil
+}
+
+// recordSuccessLocked closes b's breaker. Must hold mu.
+func (r *Registry) recordSuccessLocked(ctx context.Context, b *Backend, latency time.Duration) {
+	if b.breaker.state != BreakerClosed {
+		r.log.Info(ctx, "backend breaker closed", "name", b.Name, "was", string(b.breaker.state))
+	}
+	b.breaker.success()
+	b.Healthy = true
+	b.LastErr = ""
+	if latency > 0 {
+		b.LastLatency = latency
+	}
+}
 
+// recordFailureLocked trips b's breaker with exponential backoff, kept open for
+// at least minOpen (e.g. an upstream Retry-After). Must hold mu.
+func (r *Registry) recordFailureLocked(ctx context.Context, b *Backend, reason string, minOpen time.Duration) {
+	now := time.Now()
+	backoff := b.breaker.trip(now, r.cooldown, r.maxCooldown)
+	if minOpen > backoff {
+		backoff = minOpen
+		b.breaker.openUntil = now.Add(backoff)
+	}
+	b.Healthy = false
+	b.LastErr = reason
+	r.log.Warn(ctx, "backend breaker opened", "name", b.Name, "reason", reason, "backoff", backoff.String(), "trips", b.breaker.trips)
+}
+
+// selectActiveLocked picks the pinned backend, or else the highest-priority
+// backend whose breaker allows traffic (closed, or half-open after its backoff
+// expired). Must hold mu.
+func (r *Registry) selectActiveLocked(ctx context.Context) {
+	now := time.Now()
 	old := r.active
 	r.active = nil
-	for _, b := range r.backends {
-		if b.Healthy {
-			r.active = b
-			break
+	if r.pinned != nil && r.allowLocked(ctx, r.pinned, now) {
+		r.active = r.pinned
+	} else {
+		for _, b := range r.backends {
+			if r.allowLocked(ctx, b, now) {
+				r.active = b
+				break
+			}
 		}
 	}
 
@@ -156,6 +322,16 @@ func (r *Registry) ActiveModelStatus() ModelStatus {
 	return modelStatus(r.active.Name, r.active.Agent)
 }
 
+func (r *Registry) ListModelsOnActive(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	active := r.active
+	r.mu.RUnlock()
+	if active == nil {
+		return nil, fmt.Errorf("no active backend")
+	}
+	return listModels(ctx, active.Agent)
+}
+
 func (r *Registry) SetModelOnActive(model string) error {
 	r.mu.RLock()
 	active := r.active
@@ -166,17 +342,31 @@ func (r *Registry) SetModelOnActive(model string) error {
 	return switchModel(active.Agent, model)
 }
 
-// SetActive explicitly pins the active backend to the named one.
+// MaxConcurrentPrompts returns the tightest limit among registered backends,
+// since failover may route any prompt to any of them.
+func (r *Registry) MaxConcurrentPrompts() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	limit := 0
+	for _, b := range r.backends {
+		if n := maxConcurrentPrompts(b.Agent); n > 0 && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	return limit
+}
+
+// SetActive explicitly pins the active backend to the named one. The pin
+// survives probes; failover still leaves it while its breaker is open.
 // Returns an error if the backend isn't registered.
 func (r *Registry) SetActive(name string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	for _, b := range r.backends {
-		if b.Name == name {
-			r.active = b
-			r.log.Info(nil, "active backend pinned by user", "name", name)
-			return nil
-		}
+	if b := r.backendLocked(name); b != nil {
+		r.active = b
+		r.pinned = b
+		r.log.Info(nil, "active backend pinned by user", "name", name)
+		return nil
 	}
 	var names []string
 	for _, b := range r.backends {
@@ -185,17 +375,82 @@ func (r *Registry) SetActive(name string) error {
 	return fmt.Errorf("backend %q not registered (available: %s)", name, strings.Join(names, ", "))
 }
 
-// MarkUnhealthy marks a backend as unhealthy and triggers reselection.
+// SetRoutes installs routing rules. Every rule must name a registered backend.
+func (r *Registry) SetRoutes(rules []RouteRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range rules {
+		if err := rules[i].compile(i); err != nil {
+			return err
+		}
+		if r.backendLocked(rules[i].Backend) == nil {
+			return fmt.Errorf("route %s: backend %q not registered", rules[i].Name, rules[i].Backend)
+		}
+	}
+	r.routes = rules
+	r.log.Info(nil, "routing rules installed", "rules", len(rules))
+	return nil
+}
+
+func (r *Registry) backendLocked(name string) *Backend {
+	for _, b := range r.backends {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// routeLocked returns the first rule matching the message of the turn in ctx.
+// Must hold mu.
+func (r *Registry) routeLocked(ctx context.Context) *RouteRule {
+	if r.pinned != nil || len(r.routes) == 0 {
+		return nil
+	}
+	turn := TurnFromContext(ctx)
+	if turn == nil {
+		return nil
+	}
+	for i := range r.routes {
+		if r.routes[i].matches(turn.Message) {
+			return &r.routes[i]
+		}
+	}
+	return nil
+}
+
+// prefixRouted reports whether a routing rule with a prefix matches msg.
+func (r *Registry) prefixRouted(msg Message) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.routes {
+		if r.routes[i].Prefix != "" && r.routes[i].matches(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unpin drops the SetActive pin and returns to priority order.
+func (r *Registry) Unpin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pinned == nil {
+		return
+	}
+	r.log.Info(nil, "backend pin cleared", "name", r.pinned.Name)
+	r.pinned = nil
+	r.selectActiveLocked(nil)
+}
+
+// MarkUnhealthy trips a backend's breaker and triggers reselection.
 func (r *Registry) MarkUnhealthy(name, reason string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	for _, b := range r.backends {
 		if b.Name == name {
-			b.Healthy = false
-			b.LastErr = reason
-			b.UnhealthyAt = time.Now()
-			r.log.Warn(nil, "backend marked unhealthy", "name", name, "reason", reason)
+			r.recordFailureLocked(nil, b, reason, 0)
 			break
 		}
 	}
@@ -203,16 +458,14 @@ func (r *Registry) MarkUnhealthy(name, reason string) {
 	r.selectActiveLocked(nil)
 }
 
-// MarkHealthy marks a backend as healthy and triggers reselection.
+// MarkHealthy closes a backend's breaker and triggers reselection.
 func (r *Registry) MarkHealthy(name string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	for _, b := range r.backends {
 		if b.Name == name {
-			b.Healthy = true
-			b.LastErr = ""
-			b.UnhealthyAt = time.Time{}
+			r.recordSuccessLocked(nil, b, 0)
 			break
 		}
 	}
@@ -233,80 +486,221 @@ func (r *Registry) Status() []BackendStatus {
 	out := make([]BackendStatus, len(r.backends))
 	for i, b := range r.backends {
 		out[i] = BackendStatus{
-			Name:     b.Name,
-			Priority: b.Priority,
-			Healthy:  b.Healthy,
-			Active:   b.Name == active,
-			LastErr:  b.LastErr,
+			Name:        b.Name,
+			Priority:    b.Priority,
+			Healthy:     b.Healthy,
+			Active:      b.Name == active,
+			LastErr:     b.LastErr,
+			State:       b.breaker.state,
+			LastLatency: b.LastLatency,
+			LastProbeAt: b.LastProbeAt,
+
+			FirstTokenP50:     b.firstToken.quantile(0.5),
+			FirstTokenP95:     b.firstToken.quantile(0.95),
+			FirstTokenSamples: b.firstToken.total,
+		}
+		if b.breaker.state == BreakerOpen {
+			out[i].OpenUntil = b.breaker.openUntil
+		}
+		if ps, ok := processStatus(b.Agent); ok {
+			out[i].Process = &ps
 		}
 	}
 	return out
 }
 
 type BackendStatus struct {
-	Name     string
-	Priority int
-	Healthy  bool
-	Active   bool
-	LastErr  string
+	Name        string
+	Priority    int
+	Healthy     bool
+	Active      bool
+	LastErr     string
+	State       BreakerState
+	LastLatency time.Duration
+	LastProbeAt time.Time
+	OpenUntil   time.Time // set while the breaker is open
+
+	// first-token latency of prompts (bucket upper bounds), used for hedge delays
+	FirstTokenP50     time.Duration
+	FirstTokenP95     time.Duration
+	FirstTokenSamples int
+
+	Process *ProcessStatus // supervised process of pi and jsonl exec backends
 }
 
-// SendPrompt implements Agent by proxying to the active backend.
-// On retryable errors (rate limit, quota), marks the backend unhealthy
-// and retries with the next available backend.
+// SendPrompt implements Agent by proxying to the active backend, or to the
+// backend of the first matching routing rule while its breaker allows traffic.
+// Successes close the backend's breaker. Failures are handled by error kind
+// (see policyFor): backend-side ones open the breaker and retry the prompt on
+// the next available backend, the rest are returned as is.
 func (r *Registry) SendPrompt(ctx context.Context, prompt string) (string, error) {
-	r.mu.RLock()
-	active := r.active
-	r.mu.RUnlock()
+	resp, _, err := r.SendPromptVia(ctx, prompt)
+	return resp, err
+}
+
+// SendPromptVia is SendPrompt that also returns the name of the backend that
+// answered, or of the last one that failed; it is empty when none was tried.
+func (r *Registry) SendPromptVia(ctx context.Context, prompt string) (resp, backend string, err error) {
+	r.mu.Lock()
+	var active *Backend
+	rule := r.routeLocked(ctx)
+	fallback := false
+	if rule != nil {
+		prompt = rule.stripPrefix(prompt)
+		if b := r.backendLocked(rule.Backend); b != nil && r.acquireLocked(ctx, b, time.Now()) {
+			active = b
+		} else {
+			fallback = true
+			r.log.Warn(ctx, "routed backend unavailable, using priority order", "route", rule.Name, "backend", rule.Backend)
+		}
+	}
+	if active == nil {
+		active = r.admitLocked(ctx, r.active)
+	}
+	r.mu.Unlock()
 
 	if active == nil {
-		return "", fmt.Errorf("no healthy backend available")
+		return "", "", fmt.Errorf("no healthy backend available")
 	}
 
-	r.log.Info(ctx, "routing prompt", "backend", active.Name)
-	resp, err := active.Agent.SendPrompt(ctx, prompt)
+	if rule != nil {
+		r.log.Info(ctx, "routing prompt", "backend", active.Name, "route", rule.Name)
+	} else {
+		r.log.Info(ctx, "routing prompt", "backend", active.Name)
+	}
+	resp, used, err := r.sendHedged(ctx, active, prompt)
 	if err == nil {
-		return resp, nil
+		r.noteRoute(ctx, rule, used, fallback, used != active)
+		return resp, used.Name, nil
 	}
 
-	if !IsRetryableError(err) {
-		return resp, err
+	policy := r.policyFor(ctx, err)
+	if !policy.failover {
+		return resp, used.Name, err
 	}
 
-	// retryable error — mark unhealthy and try next backend
+	// backend-side failure — open the breaker and try next backend
 	oldName := active.Name
-	r.log.Warn(ctx, "retryable error from backend, failing over", "backend", oldName, "error", err.Error())
+	r.log.Warn(ctx, "backend failed, failing over", "backend", oldName, "kind", string(ClassifyError(err)), "error", err.Error())
 
 	r.mu.Lock()
-	for _, b := range r.backends {
-		if b.Name == oldName {
-			b.Healthy = false
-			b.LastErr = err.Error()
-			b.UnhealthyAt = time.Now()
-			break
-		}
-	}
+	wasActive := r.active == active // false for a routed backend
+	r.recordFailureLocked(ctx, active, err.Error(), policy.minOpen)
 	r.selectActiveLocked(ctx)
-	next := r.active
+	next := r.admitLocked(ctx, r.active)
 	r.mu.Unlock()
 
 	if next == nil || next.Name == oldName {
-		return resp, fmt.Errorf("all backends exhausted (last: %s): %w", oldName, err)
+		return resp, oldName, fmt.Errorf("all backends exhausted (last: %s): %w", oldName, err)
 	}
 
 	r.log.Info(ctx, "failover: retrying with next backend", "from", oldName, "to", next.Name)
-	if r.OnSwitch != nil {
+	if r.OnSwitch != nil && wasActive {
 		r.OnSwitch(oldName, next.Name)
 	}
+	resetProgress(ctx) // the failed backend's partial output is not part of the answer
+	resp, err = r.sendTo(ctx, next, prompt)
+	if err != nil {
+		r.noteFailure(ctx, next, err)
+		return resp, next.Name, err
+	}
+	r.noteRoute(ctx, rule, next, true, false)
+	return resp, next.Name, nil
+}
 
-	return next.Agent.SendPrompt(ctx, prompt)
+// noteRoute records on the turn and the current span how b was chosen, when a
+// routing rule matched or a hedge request won.
+func (r *Registry) noteRoute(ctx context.Context, rule *RouteRule, b *Backend, fallback, hedged bool) {
+	if rule == nil && !hedged {
+		return
+	}
+	route := Route{Backend: backendLabel(b.Name, b.Agent), Fallback: fallback && rule != nil, Hedged: hedged}
+	if rule != nil {
+		route.Rule = rule.Name
+	}
+	setRoute(ctx, route)
+	if ctx != nil {
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("route", route.Rule),
+			attribute.String("route_backend", b.Name),
+			attribute.Bool("route_fallback", route.Fallback),
+			attribute.Bool("hedged", hedged),
+		)
+	}
 }
 
-// Close shuts down all registered backends.
+// sendTo sends prompt to b and closes its breaker on success. Prompt duration
+// depends on the answer length, so only probes update LastLatency; the time to
+// the first streamed token (or the answer, without streaming) goes into b's
+// first-token histogram.
+func (r *Registry) sendTo(ctx context.Context, b *Backend, prompt string) (string, error) {
+	start := time.Now()
+	var once sync.Once
+	observe := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			b.firstToken.observe(time.Since(start))
+			r.mu.Unlock()
+		})
+	}
+	outer := progressReporterFrom(ctx)
+	ctx = withProgressReporter(ctx, func(delta string) {
+		observe()
+		if outer != nil {
+			outer(delta)
+		}
+	})
+
+	notePromptSent(ctx, b.Name, prompt)
+	if t := TurnFromContext(ctx); t != nil && hasImage(t.Message.Attachments) && !supportsVision(b.Agent) {
+		r.log.Debug(ctx, "backend without vision gets attachment paths only", "backend", b.Name, "attachments", len(t.Message.Attachments))
+	}
+	resp, err := b.Agent.SendPrompt(ctx, prompt)
+	if err == nil {
+		observe()
+		r.mu.Lock()
+		r.recordSuccessLocked(ctx, b, 0)
+		r.mu.Unlock()
+	} else if !r.policyFor(ctx, err).failover {
+		// no verdict on the backend; a backend-side failure trips the breaker instead
+		r.mu.Lock()
+		b.breaker.release()
+		r.mu.Unlock()
+	}
+	return resp, err
+}
+
+// Steer forwards message to the backend running turnID, if that backend can
+// be steered. It returns ErrNotSteerable when none of them runs the turn.
+func (r *Registry) Steer(ctx context.Context, turnID string, mode SteerMode, message string) error {
+	r.mu.RLock()
+	backends := append([]*Backend(nil), r.backends...)
+	r.mu.RUnlock()
+
+	for _, b := range backends {
+		s, ok := b.Agent.(Steerer)
+		if !ok {
+			continue
+		}
+		err := s.Steer(ctx, turnID, mode, message)
+		if errors.Is(err, ErrNotSteerable) {
+			continue
+		}
+		return err
+	}
+	return ErrNotSteerable
+}
+
+// Close stops the prober and shuts down all registered backends.
 func (r *Registry) Close() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.stopProbe != nil {
+		close(r.stopProbe)
+		r.stopProbe = nil
+	}
+
 	var errs []string
 	for _, b := range r.backends {
 		if err := b.Agent.Close(); err != nil {
@@ -319,33 +713,56 @@ func (r *Registry) Close() error {
 	return nil
 }
 
-// IsRetryableError checks if an error indicates a rate limit, quota exhaustion,
-// or capacity issue that warrants failing over to another backend.
+// IsRetryableError reports whether err is a rate limit, quota exhaustion or
+// capacity problem, i.e. one another backend would not share.
 func IsRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-	msg := strings.ToLower(err.Error())
-	for _, pattern := range retryablePatterns {
-		if strings.Contains(msg, pattern) {
-			return true
-		}
+	switch ClassifyError(err) {
+	case ErrRateLimited, ErrQuotaExhausted, ErrUnavailable:
+		return true
 	}
 	return false
 }
 
-var retryablePatterns = []string{
-	"rate limit",
-	"rate_limit",
-	"ratelimit",
-	"quota",
-	"overloaded",
-	"429",
-	"too many requests",
-	"capacity",
-	"server_overloaded",
-	"resource_exhausted",
-	"throttl",
+// failurePolicy is what the registry does with a failed prompt.
+type failurePolicy struct {
+	failover bool          // open the breaker and retry on the next backend
+	minOpen  time.Duration // keep the breaker open at least this long
+}
+
+// policyFor maps the error kind to a policy. Bad requests, content filtering
+// and unclassified errors are surfaced as is: another backend would not help
+// (or should not see a filtered prompt).
+func (r *Registry) policyFor(ctx context.Context, err error) failurePolicy {
+	if ctx != nil && ctx.Err() != nil {
+		return failurePolicy{} // caller canceled or ran out of time; nothing to retry
+	}
+	switch ClassifyError(err) {
+	case ErrRateLimited, ErrUnavailable:
+		return failurePolicy{failover: true, minOpen: retryAfter(err)}
+	case ErrQuotaExhausted, ErrAuth:
+		return failurePolicy{failover: true, minOpen: r.maxCooldown}
+	case ErrTimeout, ErrProcessCrash:
+		return failurePolicy{failover: true}
+	default:
+		return failurePolicy{}
+	}
+}
+
+// checkBackendHealth prefers the backend's own probe and falls back to checkHealth.
+func checkBackendHealth(ctx context.Context, b *Backend) (healthy bool, reason string) {
+	hc, ok := b.Agent.(HealthChecker)
+	if !ok {
+		return checkHealth(ctx, b.Name)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if err := hc.HealthCheck(probeCtx); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
 }
 
 // checkHealth verifies a backend is available.
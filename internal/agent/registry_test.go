@@ -3,6 +3,8 @@ package agent
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -258,6 +260,25 @@ func TestSendPromptAllBackendsExhausted(t *testing.T) {
 	// but the second failure just returns the error (no more backends to try)
 }
 
+func TestSendPromptFailoverTripsBothFailingBackends(t *testing.T) {
+	r := NewRegistry()
+	r.Register("a", &failAgent{err: fmt.Errorf("rate limit exceeded")}, 0)
+	r.Register("b", &failAgent{err: fmt.Errorf("quota exhausted")}, 1)
+	r.HealthCheckAll(context.Background())
+
+	if _, err := r.SendPrompt(context.Background(), "hello"); err == nil {
+		t.Fatal("expected error when both backends fail")
+	}
+	for _, s := range r.Status() {
+		if s.State != BreakerOpen || s.Healthy {
+			t.Errorf("%s state=%s healthy=%v, the failed retry must open its breaker too", s.Name, s.State, s.Healthy)
+		}
+	}
+	if r.Active() != "" {
+		t.Errorf("active=%q, want none", r.Active())
+	}
+}
+
 func TestCooldownRecovery(t *testing.T) {
 	r := NewRegistry()
 	r.cooldown = 10 * time.Millisecond // short cooldown for testing
@@ -317,3 +338,351 @@ func TestOnSwitchNotCalledWithoutFailover(t *testing.T) {
 		t.Error("OnSwitch should not be called when no failover happens")
 	}
 }
+
+type probedAgent struct {
+	EchoAgent
+	err error
+}
+
+func (p *probedAgent) HealthCheck(context.Context) error { return p.err }
+
+func TestHealthCheckAllUsesBackendProbe(t *testing.T) {
+	r := NewRegistry()
+	r.Register("local", &probedAgent{err: fmt.Errorf("connection refused")}, 0)
+	r.Register("echo", &EchoAgent{}, 1)
+	r.HealthCheckAll(context.Background())
+
+	if r.Active() != "echo" {
+		t.Fatalf("active = %q, want 'echo' (probe failed for local)", r.Active())
+	}
+	if st := r.Status(); st[0].LastErr != "connection refused" {
+		t.Fatalf("last err = %q", st[0].LastErr)
+	}
+}
+
+// togglingProbe fails its health check while down is set.
+type togglingProbe struct {
+	EchoAgent
+	mu   sync.Mutex
+	down bool
+}
+
+func (p *togglingProbe) HealthCheck(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func (p *togglingProbe) setDown(down bool) {
+	p.mu.Lock()
+	p.down = down
+	p.mu.Unlock()
+}
+
+func TestBreakerBackoffDoublesAndCaps(t *testing.T) {
+	var cb circuitBreaker
+	now := time.Now()
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, cb.trip(now, time.Second, 5*time.Second))
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("backoffs = %v, want %v", got, want)
+		}
+	}
+	if cb.allow(now) {
+		t.Fatal("open breaker should not allow traffic before backoff expires")
+	}
+	if !cb.allow(now.Add(5*time.Second)) || cb.state != BreakerHalfOpen {
+		t.Fatalf("state = %s, want half-open after backoff", cb.state)
+	}
+	cb.success()
+	if cb.state != BreakerClosed || cb.trips != 0 {
+		t.Fatalf("after success: state=%s trips=%d", cb.state, cb.trips)
+	}
+}
+
+func TestBreakerHalfOpenAdmitsOneTrial(t *testing.T) {
+	var cb circuitBreaker
+	now := time.Now()
+	cb.trip(now, time.Second, time.Minute)
+	later := now.Add(time.Second)
+	if !cb.acquire(later, time.Minute) || cb.state != BreakerHalfOpen {
+		t.Fatalf("first prompt after the backoff must be the trial, state=%s", cb.state)
+	}
+	if cb.acquire(later, time.Minute) {
+		t.Fatal("a second prompt must wait for the trial")
+	}
+	if !cb.allow(later) {
+		t.Fatal("a half-open backend stays eligible for selection and probes")
+	}
+	cb.release()
+	if !cb.acquire(later, time.Minute) {
+		t.Fatal("a released slot admits the next trial")
+	}
+	if cb.acquire(later.Add(time.Minute), time.Minute) != true {
+		t.Fatal("a trial without a verdict expires after its ttl")
+	}
+	cb.success()
+	if !cb.acquire(later, time.Minute) || !cb.acquire(later, time.Minute) {
+		t.Fatal("a closed breaker admits every prompt")
+	}
+}
+
+// trialAgent blocks every prompt until release is closed.
+type trialAgent struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *trialAgent) SendPrompt(context.Context, string) (string, error) {
+	g.started <- struct{}{}
+	<-g.release
+	return "trial ok", nil
+}
+func (g *trialAgent) Close() error { return nil }
+
+func TestSendPromptHalfOpenSendsOneTrial(t *testing.T) {
+	r := NewRegistry()
+	r.cooldown = time.Millisecond
+	primary := &trialAgent{started: make(chan struct{}, 2), release: make(chan struct{})}
+	r.Register("primary", primary, 0)
+	r.Register("fallback", &EchoAgent{}, 1)
+	r.HealthCheckAll(context.Background())
+	r.MarkUnhealthy("primary", "down")
+	time.Sleep(5 * time.Millisecond)
+	r.MarkHealthy("fallback") // reselect: primary is half-open and active again
+	if r.Active() != "primary" {
+		t.Fatalf("active=%q", r.Active())
+	}
+
+	trial := make(chan string, 1)
+	go func() {
+		resp, _ := r.SendPrompt(context.Background(), "first")
+		trial <- resp
+	}()
+	<-primary.started
+
+	resp, err := r.SendPrompt(context.Background(), "second")
+	if err != nil || resp != "echo: second" {
+		t.Fatalf("second prompt during the trial: resp=%q err=%v, want the fallback", resp, err)
+	}
+	close(primary.release)
+	if got := <-trial; got != "trial ok" {
+		t.Fatalf("trial resp=%q", got)
+	}
+	if resp, _ := r.SendPrompt(context.Background(), "third"); resp != "trial ok" {
+		t.Fatalf("after a successful trial primary takes all traffic again, resp=%q", resp)
+	}
+}
+
+func TestProbeAllRecoversPreferredBackend(t *testing.T) {
+	primary := &togglingProbe{down: true}
+	r := NewRegistry()
+	r.SetBackoff(50*time.Millisecond, time.Second)
+	r.Register("primary", primary, 0)
+	r.Register("fallback", &EchoAgent{}, 1)
+	r.HealthCheckAll(context.Background())
+	if r.Active() != "fallback" {
+		t.Fatalf("active = %q, want fallback", r.Active())
+	}
+
+	// still failing once half-open: breaker reopens with a doubled backoff
+	time.Sleep(60 * time.Millisecond)
+	r.ProbeAll(context.Background())
+	st := r.Status()
+	if st[0].State != BreakerOpen || st[0].LastErr != "connection refused" {
+		t.Fatalf("primary status = %+v, want open with last error", st[0])
+	}
+	if d := time.Until(st[0].OpenUntil); d <= 50*time.Millisecond || d > 100*time.Millisecond {
+		t.Fatalf("reopened for %s, want ~100ms", d)
+	}
+
+	primary.setDown(false)
+	time.Sleep(110 * time.Millisecond)
+	r.ProbeAll(context.Background())
+	if r.Active() != "primary" {
+		t.Fatalf("active = %q, want primary after successful probe", r.Active())
+	}
+	st = r.Status()
+	if st[0].State != BreakerClosed || st[0].LastErr != "" || st[0].LastProbeAt.IsZero() {
+		t.Fatalf("primary status = %+v, want closed", st[0])
+	}
+}
+
+func TestStartProberStopsOnClose(t *testing.T) {
+	primary := &togglingProbe{}
+	r := NewRegistry()
+	r.Register("primary", primary, 0)
+	r.Register("fallback", &EchoAgent{}, 1)
+	r.HealthCheckAll(context.Background())
+
+	primary.setDown(true)
+	r.StartProber(5 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for r.Active() != "fallback" {
+		if time.Now().After(deadline) {
+			t.Fatal("prober did not fail over to fallback")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendPromptPolicyByErrorKind(t *testing.T) {
+	tests := []struct {
+		kind     ErrorKind
+		failover bool
+	}{
+		{ErrRateLimited, true},
+		{ErrQuotaExhausted, true},
+		{ErrUnavailable, true},
+		{ErrAuth, true},
+		{ErrTimeout, true},
+		{ErrProcessCrash, true},
+		{ErrBadRequest, false},
+		{ErrContentFiltered, false},
+	}
+	for _, tc := range tests {
+		r := NewRegistry()
+		r.Register("primary", &failAgent{err: &ProviderError{Kind: tc.kind, Backend: "primary"}}, 0)
+		r.Register("fallback", &EchoAgent{}, 1)
+		r.HealthCheckAll(context.Background())
+
+		resp, err := r.SendPrompt(context.Background(), "hello")
+		if tc.failover {
+			if err != nil || resp != "echo: hello" || r.Active() != "fallback" {
+				t.Errorf("%s: resp=%q err=%v active=%q, want failover", tc.kind, resp, err, r.Active())
+			}
+			continue
+		}
+		if err == nil || r.Active() != "primary" {
+			t.Errorf("%s: err=%v active=%q, want error surfaced without failover", tc.kind, err, r.Active())
+		}
+	}
+}
+
+func TestSendPromptBreakerHonoursRetryAfterAndQuota(t *testing.T) {
+	r := NewRegistry()
+	r.SetBackoff(time.Second, time.Hour)
+	r.Register("limited", &failAgent{err: &ProviderError{Kind: ErrRateLimited, Backend: "limited", RetryAfter: 2 * time.Minute}}, 0)
+	r.Register("broke", &failAgent{err: &ProviderError{Kind: ErrQuotaExhausted, Backend: "broke"}}, 1)
+	r.Register("echo", &EchoAgent{}, 2)
+	r.HealthCheckAll(context.Background())
+
+	if _, err := r.SendPrompt(context.Background(), "a"); err == nil {
+		t.Fatal("expected error: failover target fails too")
+	}
+	if _, err := r.SendPrompt(context.Background(), "b"); err != nil {
+		t.Fatalf("third backend should answer: %v", err)
+	}
+	st := r.Status()
+	if d := time.Until(st[0].OpenUntil); d < time.Minute || d > 2*time.Minute {
+		t.Fatalf("rate limited breaker open for %s, want Retry-After", d)
+	}
+	if d := time.Until(st[1].OpenUntil); d < 59*time.Minute {
+		t.Fatalf("quota breaker open for %s, want max backoff", d)
+	}
+}
+
+func TestSendPromptNoFailoverWhenCallerGaveUp(t *testing.T) {
+	r := NewRegistry()
+	r.Register("primary", &failAgent{err: &ProviderError{Kind: ErrTimeout, Backend: "primary", Err: context.DeadlineExceeded}}, 0)
+	r.Register("fallback", &EchoAgent{}, 1)
+	r.HealthCheckAll(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.SendPrompt(ctx, "hello"); err == nil {
+		t.Fatal("expected error")
+	}
+	if r.Active() != "primary" {
+		t.Fatalf("active=%q, canceled caller must not trip the breaker", r.Active())
+	}
+}
+
+// partialFailAgent streams a partial answer, then fails with err.
+type partialFailAgent struct {
+	err error
+}
+
+func (p *partialFailAgent) SendPrompt(ctx context.Context, _ string) (string, error) {
+	reportProgress(ctx, "half an ans")
+	return "", p.err
+}
+func (p *partialFailAgent) Close() error { return nil }
+
+func TestSendPromptFailoverResetsPreview(t *testing.T) {
+	r := NewRegistry()
+	r.Register("primary", &partialFailAgent{err: fmt.Errorf("rate limit exceeded (429)")}, 0)
+	r.Register("fallback", &partialFailAgent{err: nil}, 1)
+	r.HealthCheckAll(context.Background())
+
+	var preview strings.Builder
+	ctx := withProgressReporter(context.Background(), func(d string) { preview.WriteString(d) })
+	ctx = withProgressReset(ctx, preview.Reset)
+	if _, err := r.SendPrompt(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if preview.String() != "half an ans" {
+		t.Fatalf("preview=%q, the failed backend's output must be dropped", preview.String())
+	}
+}
+
+func TestSetActivePinSurvivesProbesUntilUnpinned(t *testing.T) {
+	r := NewRegistry()
+	r.Register("primary", &EchoAgent{}, 0)
+	r.Register("cheap", &EchoAgent{}, 1)
+	if err := r.SetActive("cheap"); err != nil {
+		t.Fatal(err)
+	}
+	r.ProbeAll(context.Background())
+	if r.Active() != "cheap" {
+		t.Fatalf("active = %q, want pinned cheap after probe", r.Active())
+	}
+	r.Unpin()
+	if r.Active() != "primary" {
+		t.Fatalf("active = %q, want primary after unpin", r.Active())
+	}
+}
+
+// crashingAgent reports a crash loop on demand and exposes its process.
+type crashingAgent struct {
+	EchoAgent
+	onCrash func(reason string)
+}
+
+func (c *crashingAgent) SetCrashLoopHandler(fn func(reason string)) { c.onCrash = fn }
+func (c *crashingAgent) ProcessStatus() (ProcessStatus, bool) {
+	return ProcessStatus{CrashLoop: true, LastExit: "exit status 1: oom"}, true
+}
+
+func TestRegistryCrashLoopOpensBreaker(t *testing.T) {
+	crashing := &crashingAgent{}
+	r := NewRegistry()
+	r.Register("primary", crashing, 0)
+	r.Register("fallback", &EchoAgent{}, 1)
+	r.HealthCheckAll(context.Background())
+	if crashing.onCrash == nil {
+		t.Fatal("registry did not subscribe to crash loops")
+	}
+
+	crashing.onCrash("exit status 1: oom")
+	if r.Active() != "fallback" {
+		t.Fatalf("active = %q, want fallback", r.Active())
+	}
+	st := r.Status()
+	if st[0].State != BreakerOpen || st[0].LastErr != "crash loop: exit status 1: oom" {
+		t.Fatalf("primary status = %+v", st[0])
+	}
+	if st[0].Process == nil || !st[0].Process.CrashLoop || st[1].Process != nil {
+		t.Fatalf("process status = %+v / %+v", st[0].Process, st[1].Process)
+	}
+}
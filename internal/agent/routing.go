@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RouteRule sends matching messages to a specific backend. All conditions
+// that are set must match; a list matches if any of its entries does.
+type RouteRule struct {
+	Name    string   `json:"name"`
+	Types   []string `json:"types,omitempty"`  // message types: text, voice, photo, scheduled, fanout
+	Chats   []int64  `json:"chats,omitempty"`  // chat ids
+	Prefix  string   `json:"prefix,omitempty"` // leading command such as "/deep"; stripped from the prompt
+	Match   string   `json:"match,omitempty"`  // regular expression on the message content
+	Backend string   `json:"backend"`          // registered backend name
+
+	match *regexp.Regexp
+}
+
+// RoutesConfig is the config/agent-routes.json schema.
+type RoutesConfig struct {
+	Routes []RouteRule `json:"routes"` // evaluated in order, first match wins
+}
+
+// Route records how the backend of a turn was chosen.
+type Route struct {
+	Rule     string // name of the matched rule, empty when only hedging applied
+	Backend  string // label of the backend that answered
+	Fallback bool   // the routed backend was unavailable or failed; priority order answered
+	Hedged   bool   // a hedge request to a second backend won the race
+}
+
+// LoadRoutes reads the routing rules file. A missing file yields no rules.
+func LoadRoutes(path string) ([]RouteRule, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read routes: %w", err)
+	}
+	var cfg RoutesConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decode routes: %w", err)
+	}
+	for i := range cfg.Routes {
+		if err := cfg.Routes[i].compile(i); err != nil {
+			return nil, err
+		}
+	}
+	return cfg.Routes, nil
+}
+
+func (r *RouteRule) compile(i int) error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("route%d", i+1)
+	}
+	r.Backend = strings.TrimSpace(r.Backend)
+	if r.Backend == "" {
+		return fmt.Errorf("route %s: backend is required", r.Name)
+	}
+	if len(r.Types) == 0 && len(r.Chats) == 0 && r.Prefix == "" && r.Match == "" {
+		return fmt.Errorf("route %s: at least one of types, chats, prefix or match is required", r.Name)
+	}
+	if r.Match != "" {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("route %s: invalid match: %w", r.Name, err)
+		}
+		r.match = re
+	}
+	return nil
+}
+
+// matches reports whether msg satisfies every condition of the rule.
+func (r *RouteRule) matches(msg Message) bool {
+	if len(r.Types) > 0 && !containsString(r.Types, msg.Type) {
+		return false
+	}
+	if len(r.Chats) > 0 {
+		found := false
+		for _, id := range r.Chats {
+			if id == msg.ChatID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Prefix != "" && !hasCommandPrefix(msg.Content, r.Prefix) {
+		return false
+	}
+	if r.match != nil && !r.match.MatchString(msg.Content) {
+		return false
+	}
+	return true
+}
+
+// stripPrefix removes the rule's prefix from the start of prompt.
+func (r *RouteRule) stripPrefix(prompt string) string {
+	if r.Prefix == "" || !hasCommandPrefix(prompt, r.Prefix) {
+		return prompt
+	}
+	return strings.TrimLeft(strings.TrimLeft(prompt, " \t\n")[len(r.Prefix):], " \t")
+}
+
+// hasCommandPrefix reports whether s starts with prefix as a whole word, so
+// "/deep" matches "/deep why?" but not "/deeper".
+func hasCommandPrefix(s, prefix string) bool {
+	s = strings.TrimLeft(s, " \t\n")
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	rest := s[len(prefix):]
+	return rest == "" || strings.ContainsAny(rest[:1], " \t\n")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setRoute records the route of the turn in ctx, if any.
+func setRoute(ctx context.Context, route Route) {
+	if t := TurnFromContext(ctx); t != nil {
+		t.mu.Lock()
+		t.route = &route
+		t.mu.Unlock()
+	}
+}
+
+// Route returns how the backend of the turn was chosen; ok is false when
+// neither a routing rule nor a hedge request picked it.
+func (t *Turn) Route() (route Route, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.route == nil {
+		return Route{}, false
+	}
+	return *t.route, true
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedAgent answers with its name so tests can see which backend was used.
+type namedAgent struct{ name string }
+
+func (n *namedAgent) SendPrompt(_ context.Context, prompt string) (string, error) {
+	return n.name + ": " + prompt, nil
+}
+func (n *namedAgent) Close() error { return nil }
+
+func routedRegistry(t *testing.T, strong Agent) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	r.Register("fast", &namedAgent{name: "fast"}, 0)
+	r.Register("strong", strong, 1)
+	r.Register("cheap", &namedAgent{name: "cheap"}, 2)
+	r.HealthCheckAll(context.Background())
+	err := r.SetRoutes([]RouteRule{
+		{Name: "background", Types: []string{"scheduled"}, Backend: "cheap"},
+		{Name: "deep", Prefix: "/deep", Backend: "strong"},
+		{Name: "analysis", Match: `(?i)\banaly[sz]e\b`, Types: []string{"text"}, Backend: "strong"},
+		{Name: "vision", Types: []string{"photo"}, Chats: []int64{7}, Backend: "strong"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func sendRouted(t *testing.T, r *Registry, msg Message, prompt string) (string, *Turn) {
+	t.Helper()
+	turn := &Turn{Message: msg}
+	resp, err := r.SendPrompt(withTurn(context.Background(), turn), prompt)
+	if err != nil {
+		t.Fatalf("SendPrompt(%q): %v", prompt, err)
+	}
+	return resp, turn
+}
+
+func TestRegistryRoutesByTypePrefixMatchAndChat(t *testing.T) {
+	r := routedRegistry(t, &namedAgent{name: "strong"})
+
+	tests := []struct {
+		msg       Message
+		prompt    string
+		wantResp  string
+		wantRoute string
+	}{
+		{Message{ChatID: 1, Type: "scheduled", Content: "daily digest"}, "daily digest", "cheap: daily digest", "background"},
+		{Message{ChatID: 1, Type: "text", Content: "/deep why is the sky blue"}, "/deep why is the sky blue\n\n[memory context]\n-", "strong: why is the sky blue\n\n[memory context]\n-", "deep"},
+		{Message{ChatID: 1, Type: "text", Content: "please Analyze this log"}, "please Analyze this log", "strong: please Analyze this log", "analysis"},
+		{Message{ChatID: 7, Type: "photo", Content: "[photo:abc]"}, "[photo:abc]", "strong: [photo:abc]", "vision"},
+		{Message{ChatID: 8, Type: "photo", Content: "[photo:abc]"}, "[photo:abc]", "fast: [photo:abc]", ""},
+		{Message{ChatID: 1, Type: "text", Content: "/deeper thoughts"}, "/deeper thoughts", "fast: /deeper thoughts", ""},
+		{Message{ChatID: 1, Type: "voice", Content: "[Voice message] analyze"}, "[Voice message] analyze", "fast: [Voice message] analyze", ""},
+	}
+	for _, tc := range tests {
+		resp, turn := sendRouted(t, r, tc.msg, tc.prompt)
+		if resp != tc.wantResp {
+			t.Errorf("%q: response=%q want %q", tc.msg.Content, resp, tc.wantResp)
+		}
+		route, ok := turn.Route()
+		if tc.wantRoute == "" {
+			if ok {
+				t.Errorf("%q: unexpected route %+v", tc.msg.Content, route)
+			}
+			continue
+		}
+		if !ok || route.Rule != tc.wantRoute || route.Fallback {
+			t.Errorf("%q: route=%+v ok=%v want rule %q", tc.msg.Content, route, ok, tc.wantRoute)
+		}
+	}
+	if r.Active() != "fast" {
+		t.Fatalf("routing must not change the active backend, got %q", r.Active())
+	}
+}
+
+func TestRegistryRouteFallsBackWhenBackendUnhealthy(t *testing.T) {
+	r := routedRegistry(t, &namedAgent{name: "strong"})
+	r.MarkUnhealthy("strong", "down")
+
+	resp, turn := sendRouted(t, r, Message{ChatID: 1, Type: "text", Content: "/deep hi"}, "/deep hi")
+	if resp != "fast: hi" {
+		t.Fatalf("response=%q want priority order with the prefix stripped", resp)
+	}
+	if route, ok := turn.Route(); !ok || route.Rule != "deep" || route.Backend != "fast" || !route.Fallback {
+		t.Fatalf("route=%+v ok=%v", route, ok)
+	}
+}
+
+func TestRegistryRoutedBackendFailureFailsOverWithoutSwitch(t *testing.T) {
+	r := routedRegistry(t, &failAgent{err: fmt.Errorf("rate limit exceeded (429)")})
+	r.OnSwitch = func(from, to string) { t.Errorf("unexpected switch notification %s→%s", from, to) }
+
+	resp, turn := sendRouted(t, r, Message{ChatID: 1, Type: "text", Content: "/deep hi"}, "/deep hi")
+	if resp != "fast: hi" {
+		t.Fatalf("response=%q", resp)
+	}
+	if route, _ := turn.Route(); route.Backend != "fast" || !route.Fallback {
+		t.Fatalf("route=%+v", route)
+	}
+	for _, st := range r.Status() {
+		if st.Name == "strong" && st.State != BreakerOpen {
+			t.Fatalf("strong breaker=%s want open", st.State)
+		}
+	}
+}
+
+func TestRegistryPinOverridesRoutes(t *testing.T) {
+	r := routedRegistry(t, &namedAgent{name: "strong"})
+	if err := r.SetActive("cheap"); err != nil {
+		t.Fatal(err)
+	}
+	resp, turn := sendRouted(t, r, Message{ChatID: 1, Type: "text", Content: "/deep hi"}, "/deep hi")
+	if resp != "cheap: /deep hi" {
+		t.Fatalf("response=%q", resp)
+	}
+	if _, ok := turn.Route(); ok {
+		t.Fatal("no route expected while pinned")
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	dir := t.TempDir()
+	if rules, err := LoadRoutes(filepath.Join(dir, "missing.json")); err != nil || rules != nil {
+		t.Fatalf("missing file: rules=%v err=%v", rules, err)
+	}
+
+	path := filepath.Join(dir, "routes.json")
+	write := func(body string) {
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"routes":[{"types":["voice"],"backend":"fast"},{"name":"deep","prefix":"/deep","backend":"strong"}]}`)
+	rules, err := LoadRoutes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Name != "route1" || rules[1].Prefix != "/deep" {
+		t.Fatalf("rules=%+v", rules)
+	}
+
+	for body, want := range map[string]string{
+		`{"routes":[{"types":["voice"]}]}`:                   "backend is required",
+		`{"routes":[{"backend":"fast"}]}`:                    "at least one of",
+		`{"routes":[{"match":"([","backend":"fast"}]}`:       "invalid match",
+		`{"routes":[{"name":"x","types":["voice"],"backend"`: "decode routes",
+	} {
+		write(body)
+		if _, err := LoadRoutes(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err=%v want %q", body, err, want)
+		}
+	}
+
+	r := NewRegistry()
+	r.Register("fast", &EchoAgent{}, 0)
+	if err := r.SetRoutes([]RouteRule{{Name: "x", Types: []string{"voice"}, Backend: "missing"}}); err == nil {
+		t.Fatal("expected error for unregistered route backend")
+	}
+}
+
+func TestQueuedAgentNeverCoalescesPrefixRoutedMessages(t *testing.T) {
+	done := make(chan string, 4)
+	qa := NewQueuedAgent(routedRegistry(t, &namedAgent{name: "strong"}), "registry", func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		done <- response
+	})
+	qa.SetCoalesceWindow(40 * time.Millisecond)
+
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "hey", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "/deep why is the sky blue", Type: "text"})
+	qa.Enqueue(context.Background(), Message{ChatID: 1, Content: "thanks", Type: "text"})
+
+	for _, want := range []string{"fast: hey", "strong: why is the sky blue", "fast: thanks"} {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("response=%q want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+}
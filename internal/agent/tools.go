@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"visor/internal/observability"
+)
+
+// maxToolRounds bounds the tool calls of one turn; the last request is sent
+// without tools so the model has to answer.
+const maxToolRounds = 8
+
+// Tool describes a visor capability (schedule, skills, memory) a model with
+// native function calling can use within a turn.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // json schema of the arguments object
+}
+
+// ToolCall is one function call requested by the model.
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Toolbox executes tool calls. Backends with function calling (openai, ollama)
+// advertise its tools and feed the results back into the same turn; the others
+// keep using fenced action blocks in the reply.
+type Toolbox interface {
+	Tools() []Tool
+	Call(ctx context.Context, call ToolCall) (string, error)
+}
+
+// toolboxFromContext returns the toolbox of the turn in ctx, or nil.
+func toolboxFromContext(ctx context.Context) Toolbox {
+	t := TurnFromContext(ctx)
+	if t == nil || t.toolbox == nil || len(t.toolbox.Tools()) == 0 {
+		return nil
+	}
+	return t.toolbox
+}
+
+// runToolCall executes call and renders the result for the model. Failures are
+// returned as text so the model can react to them in the same turn.
+func runToolCall(ctx context.Context, tb Toolbox, backend string, call ToolCall) string {
+	log := observability.Component("agent.tools")
+	start := time.Now()
+	result, err := tb.Call(ctx, call)
+	if err != nil {
+		log.Warn(ctx, "tool call failed", "backend", backend, "tool", call.Name, "duration_ms", time.Since(start).Milliseconds(), "error", err.Error())
+		return "error: " + err.Error()
+	}
+	log.Info(ctx, "tool call completed", "backend", backend, "tool", call.Name, "duration_ms", time.Since(start).Milliseconds(), "result_chars", len(result))
+	if result == "" {
+		return "ok"
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeToolbox records tool calls and answers with a fixed result.
+type fakeToolbox struct {
+	mu    sync.Mutex
+	calls []ToolCall
+}
+
+func (f *fakeToolbox) Tools() []Tool {
+	return []Tool{{Name: "schedule_list", Description: "list tasks", Parameters: json.RawMessage(`{"type":"object","properties":{}}`)}}
+}
+
+func (f *fakeToolbox) Call(_ context.Context, call ToolCall) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	if call.Name != "schedule_list" {
+		return "", fmt.Errorf("unknown tool %q", call.Name)
+	}
+	return "- ping @ 2026-01-01T09:00:00Z [t1]", nil
+}
+
+func TestOpenAIAgent_ToolCallsRoundTripWithinTurn(t *testing.T) {
+	var requests []openAIChatRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			// arguments arrive in fragments across chunks
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"schedule_list","arguments":"{\"fil"}}]}}]}`+"\n\n")
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ter\":\"\"}"}}]},"finish_reason":"tool_calls"}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"you have 1 task\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	tb := &fakeToolbox{}
+	ctx := withTurn(context.Background(), &Turn{Message: Message{ChatID: 1}, toolbox: tb})
+	a := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m", Tools: true})
+	resp, err := a.SendPrompt(ctx, "what is scheduled?")
+	if err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if resp != "you have 1 task" {
+		t.Fatalf("resp=%q", resp)
+	}
+	if len(tb.calls) != 1 || tb.calls[0].Name != "schedule_list" || string(tb.calls[0].Arguments) != `{"filter":""}` {
+		t.Fatalf("calls=%+v", tb.calls)
+	}
+	if len(requests) != 2 || len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "schedule_list" {
+		t.Fatalf("requests=%+v", requests)
+	}
+	msgs := requests[1].Messages
+	last, prev := msgs[len(msgs)-1], msgs[len(msgs)-2]
+	if prev.Role != "assistant" || len(prev.ToolCalls) != 1 || prev.ToolCalls[0].ID != "call_1" {
+		t.Fatalf("assistant message=%+v", prev)
+	}
+	if last.Role != "tool" || last.ToolCallID != "call_1" || last.Content != "- ping @ 2026-01-01T09:00:00Z [t1]" {
+		t.Fatalf("tool message=%+v", last)
+	}
+}
+
+func TestOpenAIAgent_NoToolsWhenDisabled(t *testing.T) {
+	var req openAIChatRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	ctx := withTurn(context.Background(), &Turn{toolbox: &fakeToolbox{}})
+	if _, err := NewOpenAIAgent(OpenAIConfig{BaseURL: ts.URL, Model: "m"}).SendPrompt(ctx, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Tools) != 0 {
+		t.Fatalf("tools sent without OpenAIConfig.Tools: %+v", req.Tools)
+	}
+}
+
+func TestOllamaAgent_ToolCallsRoundTripWithinTurn(t *testing.T) {
+	var requests []ollamaChatRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"nope","arguments":{}}}]},"done":false}`+"\n")
+			fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":10,"eval_count":3}`+"\n")
+			return
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"that tool does not exist"},"done":true,"prompt_eval_count":20,"eval_count":6}`+"\n")
+	}))
+	defer ts.Close()
+
+	tb := &fakeToolbox{}
+	turn := &Turn{Message: Message{ChatID: 1}, toolbox: tb}
+	a := NewOllamaAgent(OllamaConfig{BaseURL: ts.URL, Model: "qwen2.5", Tools: true})
+	resp, err := a.SendPrompt(withTurn(context.Background(), turn), "hi")
+	if err != nil {
+		t.Fatalf("SendPrompt: %v", err)
+	}
+	if resp != "that tool does not exist" || len(requests) != 2 {
+		t.Fatalf("resp=%q requests=%d", resp, len(requests))
+	}
+	msgs := requests[1].Messages
+	if last := msgs[len(msgs)-1]; last.Role != "tool" || last.ToolName != "nope" || last.Content != `error: unknown tool "nope"` {
+		t.Fatalf("tool message=%+v", last)
+	}
+	if len(turn.Usage()) != 2 {
+		t.Fatalf("usage entries=%d, want one per request", len(turn.Usage()))
+	}
+}
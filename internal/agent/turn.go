@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Turn describes the message QueuedAgent is currently processing.
+// It is attached to the context handed to queue handlers so stream updates
+// and the final reply of the same turn can be correlated.
+type Turn struct {
+	ID      string
+	Message Message
+
+	history *History // prior turns of the chat, nil without history
+	toolbox Toolbox  // visor actions for function-calling backends, nil without
+
+	mu      sync.Mutex
+	usage   []Usage
+	route   *Route   // set by the registry when a routing rule matched
+	steered []string // follow-up messages injected while the turn was running
+	reply   *string  // text the user received, set by the queue handler
+
+	prompt         *PromptDump         // what was sent to the backend
+	promptSections []PromptSectionDump // sections assembled by the prompt builder
+}
+
+// addSteered records a message that was injected into the running turn.
+func (t *Turn) addSteered(content string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steered = append(t.steered, content)
+}
+
+// userContent is the user side of the turn for the history: the message plus
+// everything injected while it ran.
+func (t *Turn) userContent() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.steered) == 0 {
+		return t.Message.Content
+	}
+	return strings.Join(append([]string{t.Message.Content}, t.steered...), "\n\n")
+}
+
+// SetReply records the text the user actually received for this turn. The
+// history keeps it instead of the raw backend output, which may still carry
+// contract metadata and action blocks.
+func (t *Turn) SetReply(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reply = &text
+}
+
+// historyReply is the assistant side of the turn for the history: the reply
+// set by the handler, or raw when the handler set none.
+func (t *Turn) historyReply(raw string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.reply == nil {
+		return raw
+	}
+	return *t.reply
+}
+
+type turnKey struct{}
+
+func withTurn(ctx context.Context, t *Turn) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, turnKey{}, t)
+}
+
+// TurnFromContext returns the turn attached by QueuedAgent, or nil.
+func TurnFromContext(ctx context.Context) *Turn {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(turnKey{}).(*Turn)
+	return t
+}
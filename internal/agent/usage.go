@@ -0,0 +1,59 @@
+package agent
+
+import "context"
+
+// Usage is the token accounting a backend reports for one model call.
+type Usage struct {
+	Backend      string `json:"backend"`
+	Provider     string `json:"provider,omitempty"` // upstream provider when the backend proxies several (pi)
+	Model        string `json:"model,omitempty"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+type usageSinkKey struct{}
+
+// WithUsageSink returns a context whose backend calls also hand their usage to
+// fn. Callers that run prompts outside a turn (subagent stations) use it to keep
+// that usage in the ledger.
+func WithUsageSink(ctx context.Context, fn func(Usage)) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, usageSinkKey{}, fn)
+}
+
+// reportUsage records usage on the turn in ctx (if any) and hands it to the
+// usage sink (if any). Backends call it once per model call; a turn may collect
+// several entries (failover, handoff).
+func reportUsage(ctx context.Context, u Usage) {
+	if u.InputTokens == 0 && u.OutputTokens == 0 {
+		return
+	}
+	if fn, ok := ctx.Value(usageSinkKey{}).(func(Usage)); ok {
+		fn(u)
+	}
+	t := TurnFromContext(ctx)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage = append(t.usage, u)
+}
+
+// Usage returns the usage entries reported during the turn.
+func (t *Turn) Usage() []Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Usage(nil), t.usage...)
+}
+
+// sumUsage adds up input and output tokens across entries.
+func sumUsage(entries []Usage) (input, output int) {
+	for _, u := range entries {
+		input += u.InputTokens
+		output += u.OutputTokens
+	}
+	return input, output
+}
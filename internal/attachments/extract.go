@@ -0,0 +1,166 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	previewChars   = 1500 // excerpt of a document shown in the prompt
+	csvPreviewRows = 5    // data rows shown below the csv header
+	pdfTimeout     = 30 * time.Second
+)
+
+// ErrUnsupported is returned for documents whose text cannot be extracted.
+var ErrUnsupported = errors.New("unsupported document format")
+
+// Extraction is the text content of a stored document.
+type Extraction struct {
+	Format  string // "text", "csv" or "pdf"
+	Text    string // the full text; csv files as they are
+	Preview string // excerpt for the prompt
+	Rows    int    // csv data rows, without the header
+	Columns int    // csv columns of the header
+}
+
+// Extractor turns stored documents into text.
+type Extractor struct {
+	PDFToText string // pdftotext binary (poppler-utils); empty disables pdfs
+}
+
+// Extract reads the text of the document at path. The format is taken from
+// the file extension, then from mimeType.
+func (e Extractor) Extract(ctx context.Context, path, mimeType string) (Extraction, error) {
+	switch format := documentFormat(path, mimeType); format {
+	case "pdf":
+		return e.extractPDF(ctx, path)
+	case "csv", "tsv":
+		return extractCSV(path, format == "tsv")
+	case "text":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Extraction{}, err
+		}
+		if !utf8.Valid(data) {
+			return Extraction{}, fmt.Errorf("%w: not utf-8 text", ErrUnsupported)
+		}
+		text := string(data)
+		return Extraction{Format: "text", Text: text, Preview: preview(text)}, nil
+	default:
+		return Extraction{}, fmt.Errorf("%w: %s", ErrUnsupported, mimeType)
+	}
+}
+
+func documentFormat(path, mimeType string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return "pdf"
+	case ".csv":
+		return "csv"
+	case ".tsv":
+		return "tsv"
+	case ".txt", ".text", ".md", ".markdown", ".log", ".json", ".yaml", ".yml", ".toml", ".ini", ".xml":
+		return "text"
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	switch {
+	case mimeType == "application/pdf":
+		return "pdf"
+	case mimeType == "text/csv":
+		return "csv"
+	case mimeType == "text/tab-separated-values":
+		return "tsv"
+	case strings.HasPrefix(mimeType, "text/"), mimeType == "application/json", mimeType == "application/xml":
+		return "text"
+	}
+	return ""
+}
+
+func (e Extractor) extractPDF(ctx context.Context, path string) (Extraction, error) {
+	if e.PDFToText == "" {
+		return Extraction{}, fmt.Errorf("%w: pdf extraction is disabled", ErrUnsupported)
+	}
+	ctx, cancel := context.WithTimeout(ctx, pdfTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.PDFToText, "-enc", "UTF-8", path, "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return Extraction{}, fmt.Errorf("pdftotext not found (%s), install poppler-utils or set PDFTOTEXT_BIN: %w", e.PDFToText, err)
+		}
+		return Extraction{}, fmt.Errorf("pdftotext: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	text := strings.ToValidUTF8(stdout.String(), "")
+	if strings.TrimSpace(strings.ReplaceAll(text, "\f", "")) == "" {
+		return Extraction{}, fmt.Errorf("pdf has no text layer (scanned?)")
+	}
+	return Extraction{Format: "pdf", Text: text, Preview: preview(text)}, nil
+}
+
+func extractCSV(path string, tabs bool) (Extraction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Extraction{}, err
+	}
+	if !utf8.Valid(data) {
+		return Extraction{}, fmt.Errorf("%w: not utf-8 text", ErrUnsupported)
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	if tabs {
+		r.Comma = '\t'
+	}
+
+	x := Extraction{Format: "csv", Text: string(data)}
+	var shown bytes.Buffer
+	w := csv.NewWriter(&shown)
+	for i := 0; ; i++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Extraction{}, fmt.Errorf("parse csv: %w", err)
+		}
+		if i == 0 {
+			x.Columns = len(record)
+		} else {
+			x.Rows++
+		}
+		if i <= csvPreviewRows {
+			_ = w.Write(record)
+		}
+	}
+	w.Flush()
+	x.Preview = preview(shown.String())
+	if x.Rows > csvPreviewRows {
+		x.Preview = strings.TrimRight(x.Preview, "\n") + fmt.Sprintf("\n… %d more rows", x.Rows-csvPreviewRows)
+	}
+	return x, nil
+}
+
+// preview returns the start of text, cut at a rune boundary.
+func preview(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= previewChars {
+		return text
+	}
+	cut := previewChars
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return strings.TrimRight(text[:cut], " \t\n") + "…"
+}
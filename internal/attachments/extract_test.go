@@ -0,0 +1,95 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractTextAndCSV(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	var e Extractor
+
+	notes := writeFile(t, dir, "notes.md", "# plan\n\n"+strings.Repeat("ä", previewChars))
+	x, err := e.Extract(ctx, notes, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Format != "text" || !strings.HasPrefix(x.Text, "# plan") || !strings.HasSuffix(x.Preview, "…") || len(x.Preview) > previewChars+len("…") {
+		t.Fatalf("text extraction=%+v", x)
+	}
+	if !strings.HasSuffix(strings.TrimSuffix(x.Preview, "…"), "ä") {
+		t.Fatalf("preview cut a rune: %q", x.Preview[len(x.Preview)-8:])
+	}
+
+	var rows strings.Builder
+	rows.WriteString("date,amount,\"note, quoted\"\n")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(&rows, "2026-01-0%d,%d,x\n", i, i*10)
+	}
+	x, err = e.Extract(ctx, writeFile(t, dir, "export", rows.String()), "text/csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Format != "csv" || x.Rows != 8 || x.Columns != 3 {
+		t.Fatalf("csv extraction=%+v", x)
+	}
+	if !strings.HasPrefix(x.Preview, "date,amount,\"note, quoted\"\n2026-01-01,10,x") || !strings.Contains(x.Preview, "2026-01-05") ||
+		strings.Contains(x.Preview, "2026-01-06") || !strings.HasSuffix(x.Preview, "… 3 more rows") {
+		t.Fatalf("csv preview=%q", x.Preview)
+	}
+
+	if _, err := e.Extract(ctx, writeFile(t, dir, "blob.bin", "\x00\xff"), "application/octet-stream"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("binary file: %v", err)
+	}
+	if _, err := e.Extract(ctx, writeFile(t, dir, "latin1.txt", "caf\xe9"), "text/plain"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("invalid utf-8: %v", err)
+	}
+}
+
+func TestExtractPDF(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	pdf := writeFile(t, dir, "report.pdf", "%PDF-1.7")
+
+	// stand-in for pdftotext: prints its arguments and a page
+	fake := writeFile(t, dir, "pdftotext", "#!/bin/sh\necho \"args: $*\"\nprintf 'quarterly report\\f'\n")
+	if err := os.Chmod(fake, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	x, err := Extractor{PDFToText: fake}.Extract(ctx, pdf, "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Format != "pdf" || !strings.Contains(x.Text, "args: -enc UTF-8 "+pdf+" -") || !strings.Contains(x.Preview, "quarterly report") {
+		t.Fatalf("pdf extraction=%+v", x)
+	}
+
+	empty := writeFile(t, dir, "scan", "#!/bin/sh\nprintf '\\f\\n'\n")
+	if err := os.Chmod(empty, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Extractor{PDFToText: empty}).Extract(ctx, pdf, ""); err == nil || !strings.Contains(err.Error(), "no text layer") {
+		t.Fatalf("scanned pdf: %v", err)
+	}
+	if _, err := (Extractor{PDFToText: "visor-test-no-pdftotext"}).Extract(ctx, pdf, ""); err == nil || !strings.Contains(err.Error(), "PDFTOTEXT_BIN") {
+		t.Fatalf("missing pdftotext: %v", err)
+	}
+	if _, err := (Extractor{}).Extract(ctx, pdf, ""); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("disabled pdf extraction: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package attachments
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"visor/internal/observability"
+)
+
+// MaxFileBytes is the largest file the bot api lets bots download.
+const MaxFileBytes = 20 << 20
+
+// pruneInterval limits how often Save sweeps expired messages.
+const pruneInterval = time.Hour
+
+// Store keeps files users sent, one directory per message:
+// <dir>/<chat id>/<message id>/<name>.
+type Store struct {
+	dir       string
+	retention time.Duration // 0 keeps files forever
+	mu        sync.Mutex
+	lastPrune time.Time
+	log       *observability.Logger
+}
+
+// Open returns a store rooted at dir, creating it if needed.
+func Open(dir string, retention time.Duration) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("attachment dir is required")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve attachment dir: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, fmt.Errorf("create attachment dir: %w", err)
+	}
+	return &Store{dir: abs, retention: retention, log: observability.Component("attachments")}, nil
+}
+
+// Dir returns the absolute root of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save writes r to the directory of the message and returns the absolute
+// path. Files above MaxFileBytes are rejected.
+func (s *Store) Save(chatID int64, messageID int, name string, r io.Reader) (string, error) {
+	s.maybePrune(time.Now())
+
+	// ".." would escape the message directory
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid attachment name %q", name)
+	}
+	dir := filepath.Join(s.dir, strconv.FormatInt(chatID, 10), strconv.Itoa(messageID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create message dir: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	// a unique temp name, so it never collides with another attachment of the message
+	f, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("create attachment: %w", err)
+	}
+	tmp := f.Name()
+	n, err := io.Copy(f, io.LimitReader(r, MaxFileBytes+1))
+	if err == nil {
+		err = f.Chmod(0o644) // CreateTemp uses 0600
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > MaxFileBytes {
+		err = fmt.Errorf("attachment exceeds %d bytes", MaxFileBytes)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("write attachment: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("write attachment: %w", err)
+	}
+	return path, nil
+}
+
+// Prune removes message directories last modified before now minus the
+// retention and returns how many were removed.
+func (s *Store) Prune(now time.Time) int {
+	if s.retention <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-s.retention)
+	chats, err := os.ReadDir(s.dir)
+	if err != nil {
+		s.log.Warn(nil, "attachment prune failed", "dir", s.dir, "error", err.Error())
+		return 0
+	}
+	removed := 0
+	for _, chat := range chats {
+		if !chat.IsDir() {
+			continue
+		}
+		chatDir := filepath.Join(s.dir, chat.Name())
+		messages, err := os.ReadDir(chatDir)
+		if err != nil {
+			continue
+		}
+		for _, m := range messages {
+			info, err := m.Info()
+			if err != nil || !m.IsDir() || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(chatDir, m.Name())); err != nil {
+				s.log.Warn(nil, "attachment prune failed", "dir", filepath.Join(chatDir, m.Name()), "error", err.Error())
+				continue
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.log.Info(nil, "attachments pruned", "removed", removed, "retention_h", int(s.retention/time.Hour))
+	}
+	return removed
+}
+
+func (s *Store) maybePrune(now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.lastPrune) >= pruneInterval
+	if due {
+		s.lastPrune = now
+	}
+	s.mu.Unlock()
+	if due {
+		s.Prune(now)
+	}
+}
@@ -0,0 +1,56 @@
+package attachments
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreSaveAndPrune(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "attachments"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := s.Save(12345, 7, "../photo.jpg", strings.NewReader("jpeg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(s.Dir(), "12345", "7", "photo.jpg"); path != want {
+		t.Fatalf("path=%q want %q", path, want)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "jpeg" {
+		t.Fatalf("content=%q", data)
+	}
+
+	if _, err := s.Save(12345, 8, "big.bin", strings.NewReader(strings.Repeat("x", MaxFileBytes+1))); err == nil {
+		t.Fatal("expected error for a file above MaxFileBytes")
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir(), "12345", "8", "big.bin")); !os.IsNotExist(err) {
+		t.Fatalf("oversized file left behind: %v", err)
+	}
+
+	for _, name := range []string{"..", "a/..", ".", "/"} {
+		if path, err := s.Save(12345, 9, name, strings.NewReader("x")); err == nil {
+			t.Fatalf("name %q saved as %q, want an error", name, path)
+		}
+	}
+	if _, err := s.Save(12345, 7, "backup.tmp", strings.NewReader("bak")); err != nil {
+		t.Fatalf("backup.tmp: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 2 {
+		t.Fatalf("message dir has %d entries, want photo.jpg and backup.tmp only", len(entries))
+	}
+
+	if n := s.Prune(time.Now()); n != 0 {
+		t.Fatalf("pruned %d fresh messages", n)
+	}
+	if n := s.Prune(time.Now().Add(48 * time.Hour)); n != 2 {
+		t.Fatalf("pruned %d, want 2 message dirs", n)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expired attachment still there: %v", err)
+	}
+}
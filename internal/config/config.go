@@ -5,30 +5,101 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	TelegramBotToken      string
-	TelegramWebhookSecret string
-	UserChatID            string
-	Port                  int
-	AgentBackend          string   // primary backend for backward compat (first in AgentBackends)
-	AgentBackends         []string // priority-ordered list: "pi,echo" (default: [AgentBackend])
-	OpenAIAPIKey          string
-	DataDir               string // base directory for runtime data (default: "data")
-	ElevenLabsAPIKey      string
-	ElevenLabsVoiceID     string
-	LogLevel              string
-	LogVerbose            bool
-	OTELEnabled           bool
-	OTELEndpoint          string
-	OTELServiceName       string
-	OTELEnvironment       string
-	OTELInsecure          bool
-	SelfEvolutionEnabled  bool
-	SelfEvolutionRepoDir  string
-	SelfEvolutionPush     bool
-	Timezone              string
+	TelegramBotToken       string
+	TelegramWebhookSecret  string
+	TelegramMode           string            // "webhook" or "polling"
+	TelegramPollTimeout    time.Duration     // long-poll wait per getUpdates call
+	TelegramReactionSkills map[string]string // reaction emoji or custom emoji id -> skill name
+	UserChatID             string
+	Port                   int
+	AgentBackend           string   // primary backend for backward compat (first in AgentBackends)
+	AgentBackends          []string // priority-ordered list: "pi,echo" (default: [AgentBackend])
+	OpenAIAPIKey           string
+	DataDir                string // base directory for runtime data (default: "data")
+	ElevenLabsAPIKey       string
+	ElevenLabsVoiceID      string
+	LogLevel               string
+	LogVerbose             bool
+	OTELEnabled            bool
+	OTELEndpoint           string
+	OTELServiceName        string
+	OTELEnvironment        string
+	OTELInsecure           bool
+	SelfEvolutionEnabled   bool
+	SelfEvolutionRepoDir   string
+	SelfEvolutionPush      bool
+	Timezone               string
+	StreamReplies          bool          // stream partial agent output by editing a live telegram message
+	StreamEditInterval     time.Duration // minimum time between live message edits
+	AgentMaxConcurrency    int           // chats processed in parallel (backends may cap this further)
+	AgentQueueMaxAttempts  int           // journaled queue: attempts before a message is dead-lettered
+	AgentProbeInterval     time.Duration // background backend health probes (0 disables)
+	AgentBreakerBackoff    time.Duration // first circuit breaker open duration, doubles per trip
+	AgentBreakerMaxBackoff time.Duration
+	AgentHistoryTurns      int           // user/assistant turns kept per chat for stateless backends (0 disables)
+	AgentHistoryTokens     int           // estimated token budget of the replayed history
+	AgentCoalesceWindow    time.Duration // merge messages of a chat sent within this window (0 disables)
+	AgentSteering          string        // "", "steer" or "follow_up": inject messages into a running pi turn
+
+	// prompt assembly
+	AgentPromptTokens   int            // estimated token budget of an assembled prompt (0 = unlimited)
+	AgentPromptSections map[string]int // token budgets by section name ("skill:" covers every skill)
+	DebugPromptDump     bool           // serve GET /debug/prompt
+
+	// files users send (photos, documents), stored per message under DATA_DIR/attachments
+	AttachmentsRetention time.Duration // age after which stored attachments are deleted (0 keeps them)
+	PDFToTextBin         string        // pdftotext binary used to extract text from pdf documents
+
+	// pi rpc process supervision
+	PiMaxRestartDelay time.Duration // cap of the doubling restart delay after crashes
+	PiLimitMemoryMB   int           // rlimits of the pi process (0 = unlimited)
+	PiLimitCPUSeconds int
+	PiLimitOpenFiles  int
+
+	// openai-compatible chat backend (AGENT_BACKEND=openai)
+	OpenAIChatBaseURL          string
+	OpenAIChatAPIKey           string
+	OpenAIChatModel            string
+	OpenAIChatSystemPromptFile string
+	OpenAIChatTools            bool // expose visor actions as functions
+	OpenAIChatVision           bool // send photos as image parts (model must accept images)
+
+	// ollama backend (AGENT_BACKEND=ollama)
+	OllamaBaseURL          string
+	OllamaModel            string
+	OllamaSystemPromptFile string
+	OllamaTools            bool // expose visor actions as functions (model must support tools)
+	OllamaVision           bool // send photos as message images (needs a vision model)
+
+	// generic cli backends ([backends.<name>] tables; EXEC_* env defines "exec")
+	ExecBackendsFile string
+
+	// record/replay backend (AGENT_BACKEND=cassette) for deterministic e2e runs
+	CassetteFile    string
+	CassetteMode    string // "replay" or "record"
+	CassetteBackend string // backend wrapped in record mode
+	CassetteExact   bool   // replay: match prompts exactly instead of normalized
+
+	// per-message backend routing rules (needs AGENT_BACKENDS); missing file disables it
+	AgentRoutesFile string
+
+	// request hedging across AGENT_BACKENDS (0 disables)
+	AgentHedgeDelay time.Duration // longest wait for the first token before a second backend is asked
+	AgentHedgeChats []int64       // chats to hedge; empty hedges every chat
+
+	// subagent orchestration (M9); missing file disables it
+	SubagentStationsFile string
+
+	// usage ledger + daily budgets (USD, 0 = off)
+	UsagePricesFile     string
+	UsageDailyWarnUSD   float64
+	UsageDailySwitchUSD float64
+	UsageDailyLimitUSD  float64
+	UsageBudgetBackend  string // backend the registry switches to at the switch threshold
 }
 
 func Load() (*Config, error) {
@@ -51,6 +122,35 @@ func Load() (*Config, error) {
 		}
 	}
 
+	telegramMode := strings.ToLower(strings.TrimSpace(os.Getenv("TELEGRAM_MODE")))
+	switch telegramMode {
+	case "":
+		telegramMode = "webhook"
+	case "webhook", "polling":
+	default:
+		return nil, fmt.Errorf("TELEGRAM_MODE must be webhook or polling")
+	}
+	telegramPollTimeout := 30 * time.Second
+	if v := os.Getenv("TELEGRAM_POLL_TIMEOUT_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("TELEGRAM_POLL_TIMEOUT_SECONDS must be a positive number")
+		}
+		telegramPollTimeout = time.Duration(n) * time.Second
+	}
+	telegramReactionSkills := map[string]string{}
+	for _, v := range strings.Split(os.Getenv("TELEGRAM_REACTION_SKILLS"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		emoji, skill, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(emoji) == "" || strings.TrimSpace(skill) == "" {
+			return nil, fmt.Errorf("TELEGRAM_REACTION_SKILLS must be a comma-separated list of emoji=skill")
+		}
+		telegramReactionSkills[strings.TrimSpace(emoji)] = strings.TrimSpace(skill)
+	}
+
 	backend := os.Getenv("AGENT_BACKEND")
 	if backend == "" {
 		backend = "echo"
@@ -105,27 +205,348 @@ func Load() (*Config, error) {
 		tz = "UTC"
 	}
 
+	streamReplies := os.Getenv("STREAM_REPLIES") == "1" || os.Getenv("STREAM_REPLIES") == "true"
+	streamEditInterval := 1500 * time.Millisecond
+	if v := os.Getenv("STREAM_EDIT_INTERVAL_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("STREAM_EDIT_INTERVAL_MS must be a positive number")
+		}
+		streamEditInterval = time.Duration(ms) * time.Millisecond
+	}
+
+	agentMaxConcurrency := 4
+	if v := os.Getenv("AGENT_MAX_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("AGENT_MAX_CONCURRENCY must be a positive number")
+		}
+		agentMaxConcurrency = n
+	}
+
+	agentQueueMaxAttempts := 3
+	if v := os.Getenv("AGENT_QUEUE_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("AGENT_QUEUE_MAX_ATTEMPTS must be a positive number")
+		}
+		agentQueueMaxAttempts = n
+	}
+
+	agentProbeInterval := 60 * time.Second
+	if v := os.Getenv("AGENT_PROBE_INTERVAL_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("AGENT_PROBE_INTERVAL_SECONDS must be a non-negative number")
+		}
+		agentProbeInterval = time.Duration(n) * time.Second
+	}
+
+	agentBreakerBackoff := 30 * time.Second
+	if v := os.Getenv("AGENT_BREAKER_BACKOFF_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("AGENT_BREAKER_BACKOFF_SECONDS must be a positive number")
+		}
+		agentBreakerBackoff = time.Duration(n) * time.Second
+	}
+
+	agentBreakerMaxBackoff := 10 * time.Minute
+	if v := os.Getenv("AGENT_BREAKER_MAX_BACKOFF_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("AGENT_BREAKER_MAX_BACKOFF_SECONDS must be a positive number")
+		}
+		agentBreakerMaxBackoff = time.Duration(n) * time.Second
+	}
+
+	agentHistoryTurns := 20
+	if v := os.Getenv("AGENT_HISTORY_TURNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("AGENT_HISTORY_TURNS must be a non-negative number")
+		}
+		agentHistoryTurns = n
+	}
+
+	agentCoalesceWindow := time.Duration(0)
+	if v := os.Getenv("AGENT_COALESCE_WINDOW_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("AGENT_COALESCE_WINDOW_MS must be a non-negative number")
+		}
+		agentCoalesceWindow = time.Duration(ms) * time.Millisecond
+	}
+
+	agentSteering := strings.ToLower(strings.TrimSpace(os.Getenv("AGENT_STEERING")))
+	switch agentSteering {
+	case "", "off":
+		agentSteering = ""
+	case "steer", "follow_up":
+	default:
+		return nil, fmt.Errorf("AGENT_STEERING must be off, steer or follow_up")
+	}
+
+	agentPromptTokens := 16000
+	if v := os.Getenv("AGENT_PROMPT_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("AGENT_PROMPT_TOKENS must be a non-negative number")
+		}
+		agentPromptTokens = n
+	}
+	agentPromptSections := map[string]int{}
+	for _, v := range strings.Split(os.Getenv("AGENT_PROMPT_SECTION_TOKENS"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		name, tokens, ok := strings.Cut(v, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(tokens))
+		if !ok || strings.TrimSpace(name) == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("AGENT_PROMPT_SECTION_TOKENS must be a comma-separated list of section=tokens")
+		}
+		agentPromptSections[strings.TrimSpace(name)] = n
+	}
+	debugPromptDump := os.Getenv("DEBUG_PROMPT_DUMP") == "1" || os.Getenv("DEBUG_PROMPT_DUMP") == "true"
+
+	attachmentsRetention := 30 * 24 * time.Hour
+	if v := os.Getenv("ATTACHMENTS_RETENTION_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("ATTACHMENTS_RETENTION_DAYS must be a non-negative number")
+		}
+		attachmentsRetention = time.Duration(n) * 24 * time.Hour
+	}
+	pdfToTextBin := os.Getenv("PDFTOTEXT_BIN")
+	if pdfToTextBin == "" {
+		pdfToTextBin = "pdftotext"
+	}
+
+	piMaxRestartDelay := 5 * time.Minute
+	if v := os.Getenv("PI_MAX_RESTART_DELAY_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("PI_MAX_RESTART_DELAY_SECONDS must be a positive number")
+		}
+		piMaxRestartDelay = time.Duration(n) * time.Second
+	}
+	piLimitMemoryMB := 0
+	if v := os.Getenv("PI_LIMIT_MEMORY_MB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("PI_LIMIT_MEMORY_MB must be a non-negative number")
+		}
+		piLimitMemoryMB = n
+	}
+	piLimitCPUSeconds := 0
+	if v := os.Getenv("PI_LIMIT_CPU_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("PI_LIMIT_CPU_SECONDS must be a non-negative number")
+		}
+		piLimitCPUSeconds = n
+	}
+	piLimitOpenFiles := 0
+	if v := os.Getenv("PI_LIMIT_OPEN_FILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("PI_LIMIT_OPEN_FILES must be a non-negative number")
+		}
+		piLimitOpenFiles = n
+	}
+
+	agentHistoryTokens := 4000
+	if v := os.Getenv("AGENT_HISTORY_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("AGENT_HISTORY_TOKENS must be a positive number")
+		}
+		agentHistoryTokens = n
+	}
+
+	openAIChatBaseURL := os.Getenv("OPENAI_CHAT_BASE_URL")
+	if openAIChatBaseURL == "" {
+		openAIChatBaseURL = "https://api.openai.com/v1"
+	}
+	openAIChatAPIKey := os.Getenv("OPENAI_CHAT_API_KEY")
+	if openAIChatAPIKey == "" {
+		openAIChatAPIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	openAIChatModel := os.Getenv("OPENAI_CHAT_MODEL")
+	if openAIChatModel == "" {
+		openAIChatModel = "gpt-4o-mini"
+	}
+	openAIChatSystemPromptFile := os.Getenv("OPENAI_CHAT_SYSTEM_PROMPT_FILE")
+	if openAIChatSystemPromptFile == "" {
+		openAIChatSystemPromptFile = ".pi/SYSTEM.md"
+	}
+
+	openAIChatTools := os.Getenv("OPENAI_CHAT_TOOLS") != "0" && os.Getenv("OPENAI_CHAT_TOOLS") != "false"
+	openAIChatVision := os.Getenv("OPENAI_CHAT_VISION") == "1" || os.Getenv("OPENAI_CHAT_VISION") == "true"
+
+	ollamaBaseURL := os.Getenv("OLLAMA_BASE_URL")
+	if ollamaBaseURL == "" {
+		ollamaBaseURL = "http://localhost:11434"
+	}
+	ollamaModel := os.Getenv("OLLAMA_MODEL")
+	if ollamaModel == "" {
+		ollamaModel = "llama3.2"
+	}
+	ollamaSystemPromptFile := os.Getenv("OLLAMA_SYSTEM_PROMPT_FILE")
+	if ollamaSystemPromptFile == "" {
+		ollamaSystemPromptFile = ".pi/SYSTEM.md"
+	}
+	ollamaTools := os.Getenv("OLLAMA_TOOLS") == "1" || os.Getenv("OLLAMA_TOOLS") == "true"
+	ollamaVision := os.Getenv("OLLAMA_VISION") == "1" || os.Getenv("OLLAMA_VISION") == "true"
+
+	execBackendsFile := os.Getenv("EXEC_BACKENDS_FILE")
+	if execBackendsFile == "" {
+		execBackendsFile = "config/exec-backends.toml"
+	}
+
+	cassetteFile := os.Getenv("CASSETTE_FILE")
+	if cassetteFile == "" {
+		cassetteFile = "testdata/cassettes/session.jsonl"
+	}
+	cassetteMode := strings.ToLower(strings.TrimSpace(os.Getenv("CASSETTE_MODE")))
+	if cassetteMode == "" {
+		cassetteMode = "replay"
+	}
+	if cassetteMode != "replay" && cassetteMode != "record" {
+		return nil, fmt.Errorf("CASSETTE_MODE must be replay or record")
+	}
+	cassetteBackend := strings.TrimSpace(os.Getenv("CASSETTE_BACKEND"))
+	if cassetteBackend == "cassette" {
+		return nil, fmt.Errorf("CASSETTE_BACKEND cannot be cassette")
+	}
+	cassetteExact := os.Getenv("CASSETTE_MATCH") == "exact"
+
+	agentRoutesFile := os.Getenv("AGENT_ROUTES_FILE")
+	if agentRoutesFile == "" {
+		agentRoutesFile = "config/agent-routes.json"
+	}
+
+	agentHedgeDelay := time.Duration(0)
+	if v := os.Getenv("AGENT_HEDGE_DELAY_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("AGENT_HEDGE_DELAY_MS must be a non-negative number")
+		}
+		agentHedgeDelay = time.Duration(ms) * time.Millisecond
+	}
+	var agentHedgeChats []int64
+	for _, v := range strings.Split(os.Getenv("AGENT_HEDGE_CHATS"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("AGENT_HEDGE_CHATS must be a comma-separated list of chat ids")
+		}
+		agentHedgeChats = append(agentHedgeChats, id)
+	}
+
+	subagentStationsFile := os.Getenv("SUBAGENT_STATIONS_FILE")
+	if subagentStationsFile == "" {
+		subagentStationsFile = "config/subagent-stations.json"
+	}
+
+	usagePricesFile := os.Getenv("USAGE_PRICES_FILE")
+	if usagePricesFile == "" {
+		usagePricesFile = "config/model-prices.json"
+	}
+	usageBudgets := map[string]float64{}
+	for _, key := range []string{"USAGE_DAILY_WARN_USD", "USAGE_DAILY_SWITCH_USD", "USAGE_DAILY_LIMIT_USD"} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", key)
+		}
+		usageBudgets[key] = f
+	}
+	usageBudgetBackend := os.Getenv("USAGE_BUDGET_BACKEND")
+	if usageBudgetBackend == "" && len(backends) > 1 {
+		usageBudgetBackend = backends[len(backends)-1]
+	}
+
 	return &Config{
-		TelegramBotToken:      token,
-		TelegramWebhookSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
-		UserChatID:            userChatID,
-		Port:                  port,
-		AgentBackend:          backend,
-		AgentBackends:         backends,
-		OpenAIAPIKey:          os.Getenv("OPENAI_API_KEY"),
-		ElevenLabsAPIKey:      os.Getenv("ELEVENLABS_API_KEY"),
-		ElevenLabsVoiceID:     os.Getenv("ELEVENLABS_VOICE_ID"),
-		DataDir:               dataDir,
-		LogLevel:              logLevel,
-		LogVerbose:            logVerbose,
-		OTELEnabled:           otelEnabled,
-		OTELEndpoint:          os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
-		OTELServiceName:       otelServiceName,
-		OTELEnvironment:       otelEnvironment,
-		OTELInsecure:          otelInsecure,
-		SelfEvolutionEnabled:  selfEvolutionEnabled,
-		SelfEvolutionRepoDir:  selfEvolutionRepoDir,
-		SelfEvolutionPush:     selfEvolutionPush,
-		Timezone:              tz,
+		TelegramBotToken:       token,
+		TelegramWebhookSecret:  os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		TelegramMode:           telegramMode,
+		TelegramPollTimeout:    telegramPollTimeout,
+		TelegramReactionSkills: telegramReactionSkills,
+		UserChatID:             userChatID,
+		Port:                   port,
+		AgentBackend:           backend,
+		AgentBackends:          backends,
+		OpenAIAPIKey:           os.Getenv("OPENAI_API_KEY"),
+		ElevenLabsAPIKey:       os.Getenv("ELEVENLABS_API_KEY"),
+		ElevenLabsVoiceID:      os.Getenv("ELEVENLABS_VOICE_ID"),
+		DataDir:                dataDir,
+		LogLevel:               logLevel,
+		LogVerbose:             logVerbose,
+		OTELEnabled:            otelEnabled,
+		OTELEndpoint:           os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTELServiceName:        otelServiceName,
+		OTELEnvironment:        otelEnvironment,
+		OTELInsecure:           otelInsecure,
+		SelfEvolutionEnabled:   selfEvolutionEnabled,
+		SelfEvolutionRepoDir:   selfEvolutionRepoDir,
+		SelfEvolutionPush:      selfEvolutionPush,
+		Timezone:               tz,
+		StreamReplies:          streamReplies,
+		StreamEditInterval:     streamEditInterval,
+		AgentMaxConcurrency:    agentMaxConcurrency,
+		AgentQueueMaxAttempts:  agentQueueMaxAttempts,
+		AgentProbeInterval:     agentProbeInterval,
+		AgentHistoryTurns:      agentHistoryTurns,
+		AgentHistoryTokens:     agentHistoryTokens,
+		AgentCoalesceWindow:    agentCoalesceWindow,
+		AgentSteering:          agentSteering,
+		AgentPromptTokens:      agentPromptTokens,
+		AgentPromptSections:    agentPromptSections,
+		DebugPromptDump:        debugPromptDump,
+		AttachmentsRetention:   attachmentsRetention,
+		PDFToTextBin:           pdfToTextBin,
+		PiMaxRestartDelay:      piMaxRestartDelay,
+		PiLimitMemoryMB:        piLimitMemoryMB,
+		PiLimitCPUSeconds:      piLimitCPUSeconds,
+		PiLimitOpenFiles:       piLimitOpenFiles,
+		AgentBreakerBackoff:    agentBreakerBackoff,
+		AgentBreakerMaxBackoff: agentBreakerMaxBackoff,
+
+		OpenAIChatBaseURL:          openAIChatBaseURL,
+		OpenAIChatAPIKey:           openAIChatAPIKey,
+		OpenAIChatModel:            openAIChatModel,
+		OpenAIChatSystemPromptFile: openAIChatSystemPromptFile,
+		OpenAIChatTools:            openAIChatTools,
+		OpenAIChatVision:           openAIChatVision,
+
+		OllamaBaseURL:          ollamaBaseURL,
+		OllamaModel:            ollamaModel,
+		OllamaSystemPromptFile: ollamaSystemPromptFile,
+		OllamaTools:            ollamaTools,
+		OllamaVision:           ollamaVision,
+
+		ExecBackendsFile:     execBackendsFile,
+		CassetteFile:         cassetteFile,
+		CassetteMode:         cassetteMode,
+		CassetteBackend:      cassetteBackend,
+		CassetteExact:        cassetteExact,
+		AgentRoutesFile:      agentRoutesFile,
+		AgentHedgeDelay:      agentHedgeDelay,
+		AgentHedgeChats:      agentHedgeChats,
+		SubagentStationsFile: subagentStationsFile,
+
+		UsagePricesFile:     usagePricesFile,
+		UsageDailyWarnUSD:   usageBudgets["USAGE_DAILY_WARN_USD"],
+		UsageDailySwitchUSD: usageBudgets["USAGE_DAILY_SWITCH_USD"],
+		UsageDailyLimitUSD:  usageBudgets["USAGE_DAILY_LIMIT_USD"],
+		UsageBudgetBackend:  usageBudgetBackend,
 	}, nil
 }
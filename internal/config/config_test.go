@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func clearEnv() {
@@ -104,3 +105,450 @@ func TestLoad_InvalidPort(t *testing.T) {
 		t.Fatal("expected error for invalid port")
 	}
 }
+
+func TestLoad_AgentMaxConcurrency(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_MAX_CONCURRENCY")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AgentMaxConcurrency != 4 {
+		t.Fatalf("default concurrency=%d want 4", cfg.AgentMaxConcurrency)
+	}
+
+	os.Setenv("AGENT_MAX_CONCURRENCY", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for non-positive AGENT_MAX_CONCURRENCY")
+	}
+}
+
+func TestLoad_AgentProbeAndBreaker(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_PROBE_INTERVAL_SECONDS")
+	defer os.Unsetenv("AGENT_BREAKER_BACKOFF_SECONDS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AgentProbeInterval != time.Minute || cfg.AgentBreakerBackoff != 30*time.Second || cfg.AgentBreakerMaxBackoff != 10*time.Minute {
+		t.Fatalf("defaults: probe=%s backoff=%s max=%s", cfg.AgentProbeInterval, cfg.AgentBreakerBackoff, cfg.AgentBreakerMaxBackoff)
+	}
+
+	os.Setenv("AGENT_PROBE_INTERVAL_SECONDS", "0")
+	cfg, err = Load()
+	if err != nil || cfg.AgentProbeInterval != 0 {
+		t.Fatalf("probe interval 0 should disable probing: cfg=%v err=%v", cfg, err)
+	}
+
+	os.Setenv("AGENT_BREAKER_BACKOFF_SECONDS", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for non-positive AGENT_BREAKER_BACKOFF_SECONDS")
+	}
+}
+
+func TestLoad_AgentHistory(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_HISTORY_TURNS")
+	defer os.Unsetenv("AGENT_HISTORY_TOKENS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AgentHistoryTurns != 20 || cfg.AgentHistoryTokens != 4000 {
+		t.Fatalf("defaults: turns=%d tokens=%d", cfg.AgentHistoryTurns, cfg.AgentHistoryTokens)
+	}
+
+	os.Setenv("AGENT_HISTORY_TURNS", "0")
+	if cfg, err := Load(); err != nil || cfg.AgentHistoryTurns != 0 {
+		t.Fatalf("history turns 0 should disable history: cfg=%v err=%v", cfg, err)
+	}
+
+	os.Setenv("AGENT_HISTORY_TOKENS", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for non-positive AGENT_HISTORY_TOKENS")
+	}
+}
+
+func TestLoad_AgentCoalesceWindow(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_COALESCE_WINDOW_MS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AgentCoalesceWindow != 0 {
+		t.Fatalf("default window=%v want 0 (disabled)", cfg.AgentCoalesceWindow)
+	}
+
+	os.Setenv("AGENT_COALESCE_WINDOW_MS", "1500")
+	if cfg, err := Load(); err != nil || cfg.AgentCoalesceWindow != 1500*time.Millisecond {
+		t.Fatalf("window: cfg=%v err=%v", cfg, err)
+	}
+
+	os.Setenv("AGENT_COALESCE_WINDOW_MS", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative AGENT_COALESCE_WINDOW_MS")
+	}
+}
+
+func TestLoad_AgentSteering(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_STEERING")
+
+	for value, want := range map[string]string{"": "", "off": "", "steer": "steer", "Follow_Up": "follow_up"} {
+		os.Setenv("AGENT_STEERING", value)
+		cfg, err := Load()
+		if err != nil || cfg.AgentSteering != want {
+			t.Fatalf("%q: cfg=%v err=%v want %q", value, cfg, err, want)
+		}
+	}
+	os.Setenv("AGENT_STEERING", "always")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for unknown AGENT_STEERING")
+	}
+}
+
+func TestLoad_TelegramMode(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("TELEGRAM_MODE")
+	defer os.Unsetenv("TELEGRAM_POLL_TIMEOUT_SECONDS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelegramMode != "webhook" || cfg.TelegramPollTimeout != 30*time.Second {
+		t.Fatalf("defaults: mode=%q timeout=%v", cfg.TelegramMode, cfg.TelegramPollTimeout)
+	}
+
+	os.Setenv("TELEGRAM_MODE", "Polling")
+	os.Setenv("TELEGRAM_POLL_TIMEOUT_SECONDS", "50")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelegramMode != "polling" || cfg.TelegramPollTimeout != 50*time.Second {
+		t.Fatalf("mode=%q timeout=%v", cfg.TelegramMode, cfg.TelegramPollTimeout)
+	}
+
+	os.Setenv("TELEGRAM_POLL_TIMEOUT_SECONDS", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for TELEGRAM_POLL_TIMEOUT_SECONDS=0")
+	}
+	os.Unsetenv("TELEGRAM_POLL_TIMEOUT_SECONDS")
+	os.Setenv("TELEGRAM_MODE", "push")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for unknown TELEGRAM_MODE")
+	}
+}
+
+func TestLoad_TelegramReactionSkills(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("TELEGRAM_REACTION_SKILLS")
+
+	os.Setenv("TELEGRAM_REACTION_SKILLS", "🔖=bookmark, 5368324170671202286 = translate")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.TelegramReactionSkills) != 2 || cfg.TelegramReactionSkills["🔖"] != "bookmark" || cfg.TelegramReactionSkills["5368324170671202286"] != "translate" {
+		t.Fatalf("reaction skills=%v", cfg.TelegramReactionSkills)
+	}
+
+	os.Setenv("TELEGRAM_REACTION_SKILLS", "🔖")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for a mapping without skill")
+	}
+}
+
+func TestLoad_Vision(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("OPENAI_CHAT_VISION")
+	defer os.Unsetenv("OLLAMA_VISION")
+	defer os.Unsetenv("ATTACHMENTS_RETENTION_DAYS")
+	defer os.Unsetenv("PDFTOTEXT_BIN")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OpenAIChatVision || cfg.OllamaVision || cfg.AttachmentsRetention != 30*24*time.Hour || cfg.PDFToTextBin != "pdftotext" {
+		t.Fatalf("defaults: openai=%v ollama=%v retention=%v pdftotext=%q", cfg.OpenAIChatVision, cfg.OllamaVision, cfg.AttachmentsRetention, cfg.PDFToTextBin)
+	}
+
+	os.Setenv("OPENAI_CHAT_VISION", "true")
+	os.Setenv("OLLAMA_VISION", "1")
+	os.Setenv("ATTACHMENTS_RETENTION_DAYS", "0")
+	os.Setenv("PDFTOTEXT_BIN", "/opt/poppler/bin/pdftotext")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.OpenAIChatVision || !cfg.OllamaVision || cfg.AttachmentsRetention != 0 || cfg.PDFToTextBin != "/opt/poppler/bin/pdftotext" {
+		t.Fatalf("openai=%v ollama=%v retention=%v pdftotext=%q", cfg.OpenAIChatVision, cfg.OllamaVision, cfg.AttachmentsRetention, cfg.PDFToTextBin)
+	}
+
+	os.Setenv("ATTACHMENTS_RETENTION_DAYS", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative ATTACHMENTS_RETENTION_DAYS")
+	}
+}
+
+func TestLoad_AgentPrompt(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_PROMPT_TOKENS")
+	defer os.Unsetenv("AGENT_PROMPT_SECTION_TOKENS")
+	defer os.Unsetenv("DEBUG_PROMPT_DUMP")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AgentPromptTokens != 16000 || len(cfg.AgentPromptSections) != 0 || cfg.DebugPromptDump {
+		t.Fatalf("defaults: tokens=%d sections=%v dump=%v", cfg.AgentPromptTokens, cfg.AgentPromptSections, cfg.DebugPromptDump)
+	}
+
+	os.Setenv("AGENT_PROMPT_TOKENS", "0")
+	os.Setenv("AGENT_PROMPT_SECTION_TOKENS", "memory=800, skill:=1200,setup=0")
+	os.Setenv("DEBUG_PROMPT_DUMP", "true")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AgentPromptTokens != 0 || !cfg.DebugPromptDump {
+		t.Fatalf("tokens=%d dump=%v", cfg.AgentPromptTokens, cfg.DebugPromptDump)
+	}
+	if len(cfg.AgentPromptSections) != 3 || cfg.AgentPromptSections["memory"] != 800 || cfg.AgentPromptSections["skill:"] != 1200 {
+		t.Fatalf("sections=%v", cfg.AgentPromptSections)
+	}
+
+	for key, value := range map[string]string{
+		"AGENT_PROMPT_TOKENS":         "-1",
+		"AGENT_PROMPT_SECTION_TOKENS": "memory",
+	} {
+		os.Setenv(key, value)
+		if _, err := Load(); err == nil {
+			t.Fatalf("expected error for %s=%q", key, value)
+		}
+		os.Unsetenv(key)
+	}
+	os.Setenv("AGENT_PROMPT_SECTION_TOKENS", "=5")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for a section budget without name")
+	}
+}
+
+func TestLoad_PiProcessSupervision(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("PI_MAX_RESTART_DELAY_SECONDS")
+	defer os.Unsetenv("PI_LIMIT_MEMORY_MB")
+	defer os.Unsetenv("PI_LIMIT_CPU_SECONDS")
+	defer os.Unsetenv("PI_LIMIT_OPEN_FILES")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PiMaxRestartDelay != 5*time.Minute || cfg.PiLimitMemoryMB != 0 || cfg.PiLimitCPUSeconds != 0 || cfg.PiLimitOpenFiles != 0 {
+		t.Fatalf("defaults: %+v", cfg)
+	}
+
+	os.Setenv("PI_MAX_RESTART_DELAY_SECONDS", "60")
+	os.Setenv("PI_LIMIT_MEMORY_MB", "4096")
+	os.Setenv("PI_LIMIT_CPU_SECONDS", "86400")
+	os.Setenv("PI_LIMIT_OPEN_FILES", "1024")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PiMaxRestartDelay != time.Minute || cfg.PiLimitMemoryMB != 4096 || cfg.PiLimitCPUSeconds != 86400 || cfg.PiLimitOpenFiles != 1024 {
+		t.Fatalf("overrides: %+v", cfg)
+	}
+
+	os.Setenv("PI_LIMIT_OPEN_FILES", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative PI_LIMIT_OPEN_FILES")
+	}
+	os.Setenv("PI_LIMIT_OPEN_FILES", "")
+	os.Setenv("PI_MAX_RESTART_DELAY_SECONDS", "0")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for zero PI_MAX_RESTART_DELAY_SECONDS")
+	}
+}
+
+func TestLoad_ToolCallingDefaults(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("OPENAI_CHAT_TOOLS")
+	defer os.Unsetenv("OLLAMA_TOOLS")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.OpenAIChatTools || cfg.OllamaTools {
+		t.Fatalf("defaults: openai=%v ollama=%v", cfg.OpenAIChatTools, cfg.OllamaTools)
+	}
+
+	os.Setenv("OPENAI_CHAT_TOOLS", "false")
+	os.Setenv("OLLAMA_TOOLS", "true")
+	cfg, err = Load()
+	if err != nil || cfg.OpenAIChatTools || !cfg.OllamaTools {
+		t.Fatalf("overrides: cfg=%+v err=%v", cfg, err)
+	}
+}
+
+func TestLoad_UsageBudget(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	os.Setenv("AGENT_BACKENDS", "pi,ollama")
+	os.Setenv("USAGE_DAILY_SWITCH_USD", "2.5")
+	defer os.Unsetenv("AGENT_BACKENDS")
+	defer os.Unsetenv("USAGE_DAILY_SWITCH_USD")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.UsagePricesFile != "config/model-prices.json" || cfg.UsageDailySwitchUSD != 2.5 || cfg.UsageDailyWarnUSD != 0 {
+		t.Fatalf("usage config: %+v", cfg)
+	}
+	if cfg.UsageBudgetBackend != "ollama" {
+		t.Fatalf("budget backend=%q want last AGENT_BACKENDS entry", cfg.UsageBudgetBackend)
+	}
+
+	os.Setenv("USAGE_DAILY_SWITCH_USD", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative USAGE_DAILY_SWITCH_USD")
+	}
+}
+
+func TestLoad_OpenAIChatKeyFallsBackToOpenAIKey(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	os.Setenv("OPENAI_API_KEY", "sk-shared")
+	defer os.Unsetenv("OPENAI_API_KEY")
+	defer os.Unsetenv("OPENAI_CHAT_API_KEY")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OpenAIChatAPIKey != "sk-shared" {
+		t.Fatalf("chat key=%q want fallback sk-shared", cfg.OpenAIChatAPIKey)
+	}
+	if cfg.OpenAIChatBaseURL != "https://api.openai.com/v1" {
+		t.Fatalf("base url=%q", cfg.OpenAIChatBaseURL)
+	}
+
+	os.Setenv("OPENAI_CHAT_API_KEY", "sk-chat")
+	cfg, _ = Load()
+	if cfg.OpenAIChatAPIKey != "sk-chat" {
+		t.Fatalf("chat key=%q want sk-chat", cfg.OpenAIChatAPIKey)
+	}
+}
+
+func TestLoad_Cassette(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("CASSETTE_MODE")
+	defer os.Unsetenv("CASSETTE_BACKEND")
+	defer os.Unsetenv("CASSETTE_MATCH")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CassetteFile != "testdata/cassettes/session.jsonl" || cfg.CassetteMode != "replay" || cfg.CassetteExact {
+		t.Fatalf("defaults: file=%q mode=%q exact=%v", cfg.CassetteFile, cfg.CassetteMode, cfg.CassetteExact)
+	}
+
+	os.Setenv("CASSETTE_MODE", "Record")
+	os.Setenv("CASSETTE_BACKEND", "openai")
+	os.Setenv("CASSETTE_MATCH", "exact")
+	cfg, err = Load()
+	if err != nil || cfg.CassetteMode != "record" || cfg.CassetteBackend != "openai" || !cfg.CassetteExact {
+		t.Fatalf("overrides: cfg=%+v err=%v", cfg, err)
+	}
+
+	os.Setenv("CASSETTE_MODE", "rewind")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for unknown CASSETTE_MODE")
+	}
+}
+
+func TestLoad_AgentRoutesFile(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_ROUTES_FILE")
+
+	cfg, err := Load()
+	if err != nil || cfg.AgentRoutesFile != "config/agent-routes.json" {
+		t.Fatalf("default: cfg=%v err=%v", cfg, err)
+	}
+	os.Setenv("AGENT_ROUTES_FILE", "/etc/visor/routes.json")
+	if cfg, err := Load(); err != nil || cfg.AgentRoutesFile != "/etc/visor/routes.json" {
+		t.Fatalf("override: cfg=%v err=%v", cfg, err)
+	}
+}
+
+func TestLoad_AgentHedge(t *testing.T) {
+	clearEnv()
+	os.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	os.Setenv("USER_PHONE_NUMBER", "123")
+	defer os.Unsetenv("AGENT_HEDGE_DELAY_MS")
+	defer os.Unsetenv("AGENT_HEDGE_CHATS")
+
+	cfg, err := Load()
+	if err != nil || cfg.AgentHedgeDelay != 0 || cfg.AgentHedgeChats != nil {
+		t.Fatalf("default: cfg=%v err=%v", cfg, err)
+	}
+	os.Setenv("AGENT_HEDGE_DELAY_MS", "4000")
+	os.Setenv("AGENT_HEDGE_CHATS", "123, -1005")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AgentHedgeDelay != 4*time.Second || len(cfg.AgentHedgeChats) != 2 || cfg.AgentHedgeChats[1] != -1005 {
+		t.Fatalf("override: delay=%v chats=%v", cfg.AgentHedgeDelay, cfg.AgentHedgeChats)
+	}
+	os.Setenv("AGENT_HEDGE_CHATS", "me")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for non-numeric chat id")
+	}
+	os.Setenv("AGENT_HEDGE_CHATS", "")
+	os.Setenv("AGENT_HEDGE_DELAY_MS", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative delay")
+	}
+}
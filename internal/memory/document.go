@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	documentChunkChars   = 1000 // target chunk size of remembered documents
+	documentChunkOverlap = 150  // characters repeated at the start of the next chunk
+	maxDocumentChunks    = 200  // longer documents are cut, one embedding call per document
+)
+
+// ChunkText splits text into chunks of at most size characters, breaking at
+// whitespace. Consecutive chunks share about overlap characters so a passage
+// cut at a boundary is still found whole in one of them. Whitespace runs are
+// collapsed; a single word longer than size becomes its own chunk.
+func ChunkText(text string, size, overlap int) []string {
+	words := strings.Fields(text)
+	var chunks []string
+	for start := 0; start < len(words); {
+		end, n := start+1, len(words[start])
+		for end < len(words) && n+1+len(words[end]) <= size {
+			n += 1 + len(words[end])
+			end++
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+		next, back := end, 0
+		for next-1 > start && back+len(words[next-1])+1 <= overlap {
+			back += len(words[next-1]) + 1
+			next--
+		}
+		start = next
+	}
+	return chunks
+}
+
+// SaveDocument chunks, embeds and stores a document. Every chunk records
+// source and its position ("report.pdf#3") so lookups can cite it. It returns
+// the number of chunks stored; documents above maxDocumentChunks are cut.
+func (m *Manager) SaveDocument(source, text string) (int, error) {
+	chunks := ChunkText(text, documentChunkChars, documentChunkOverlap)
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+	if len(chunks) > maxDocumentChunks {
+		m.log.Warn(context.Background(), "document cut for memory", "source", source, "chunks", len(chunks), "kept", maxDocumentChunks)
+		chunks = chunks[:maxDocumentChunks]
+	}
+
+	embeddings, err := m.embedder.EmbedBatch(chunks)
+	if err != nil {
+		return 0, fmt.Errorf("memory save document: embed: %w", err)
+	}
+	if len(embeddings) != len(chunks) {
+		return 0, fmt.Errorf("memory save document: got %d embeddings for %d chunks", len(embeddings), len(chunks))
+	}
+
+	memories := make([]Memory, len(chunks))
+	for i, chunk := range chunks {
+		memories[i] = Memory{
+			Text:      chunk,
+			Embedding: embeddings[i],
+			Source:    fmt.Sprintf("%s#%d", source, i+1),
+		}
+	}
+	if err := m.store.Append(memories); err != nil {
+		return 0, fmt.Errorf("memory save document: store: %w", err)
+	}
+
+	m.log.Info(context.Background(), "document saved to memory", "source", source, "chunks", len(chunks))
+	return len(chunks), nil
+}
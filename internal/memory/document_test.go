@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	text := strings.Repeat("alpha beta  gamma\n\ndelta ", 50) // 200 words, 1099 chars once collapsed
+	chunks := ChunkText(text, 120, 30)
+	if len(chunks) < 10 {
+		t.Fatalf("chunks=%d, want the text split into many chunks", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 120 {
+			t.Fatalf("chunk %d has %d chars", i, len(c))
+		}
+		if strings.Contains(c, "  ") || strings.Contains(c, "\n") {
+			t.Fatalf("chunk %d keeps raw whitespace: %q", i, c)
+		}
+	}
+	for i := 1; i < len(chunks); i++ {
+		prev := strings.Fields(chunks[i-1])
+		if tail := prev[len(prev)-1]; !strings.Contains(chunks[i], tail) {
+			t.Fatalf("chunk %d does not overlap the previous one (%q): %q", i, tail, chunks[i])
+		}
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(last, "delta") {
+		t.Fatalf("last chunk=%q, the end of the text is missing", last)
+	}
+
+	if got := ChunkText(" \n\t", 100, 10); len(got) != 0 {
+		t.Fatalf("blank text: %q", got)
+	}
+	long := strings.Repeat("x", 50)
+	if got := ChunkText("a "+long+" b", 10, 5); len(got) != 3 || got[1] != long {
+		t.Fatalf("long word: %q", got)
+	}
+}
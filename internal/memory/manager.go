@@ -78,6 +78,10 @@ func (m *Manager) Lookup(query string, maxResults int) (string, error) {
 	var sb strings.Builder
 	sb.WriteString("relevant memories:\n")
 	for _, r := range results {
+		if r.Memory.Source != "" {
+			sb.WriteString(fmt.Sprintf("- [%.2f] (%s) %s\n", r.Similarity, r.Memory.Source, r.Memory.Text))
+			continue
+		}
 		sb.WriteString(fmt.Sprintf("- [%.2f] %s\n", r.Similarity, r.Memory.Text))
 	}
 	return sb.String(), nil
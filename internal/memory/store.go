@@ -19,7 +19,8 @@ type Memory struct {
 	ID        string    `parquet:"id"`
 	Text      string    `parquet:"text"`
 	Embedding []float32 `parquet:"embedding,list"`
-	CreatedAt int64     `parquet:"created_at"` // unix millis
+	CreatedAt int64     `parquet:"created_at"`      // unix millis
+	Source    string    `parquet:"source,optional"` // origin of imported text, e.g. "report.pdf#3"; empty for chat memories
 }
 
 // Store manages persistent memories in parquet files.
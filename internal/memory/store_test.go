@@ -2,8 +2,11 @@ package memory
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/parquet-go/parquet-go"
 )
 
 func tempDir(t *testing.T) string {
@@ -177,3 +180,46 @@ func TestStore_WithEmbedding(t *testing.T) {
 		t.Errorf("embedding[100] = %f, want 0.1", all[0].Embedding[100])
 	}
 }
+
+func TestStore_SourceAndOlderChunks(t *testing.T) {
+	dir := tempDir(t)
+	store, _ := NewStore(dir)
+
+	// a chunk written before memories had a source column
+	type memoryWithoutSource struct {
+		ID        string    `parquet:"id"`
+		Text      string    `parquet:"text"`
+		Embedding []float32 `parquet:"embedding,list"`
+		CreatedAt int64     `parquet:"created_at"`
+	}
+	f, err := os.Create(filepath.Join(dir, "chunk_1.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := parquet.NewGenericWriter[memoryWithoutSource](f)
+	if _, err := w.Write([]memoryWithoutSource{{ID: "old", Text: "likes tea", CreatedAt: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := store.Append([]Memory{{Text: "q3 revenue grew", Source: "report.pdf#2", CreatedAt: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, compact := range []bool{false, true} {
+		if compact {
+			if err := store.Compact(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		all, err := store.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 2 || all[0].Text != "likes tea" || all[0].Source != "" || all[1].Source != "report.pdf#2" {
+			t.Fatalf("compact=%v memories=%+v", compact, all)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package observability
 
-import "context"
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
 
 type contextKey string
 
@@ -17,3 +21,14 @@ func RequestIDFromContext(ctx context.Context) string {
 	v, _ := ctx.Value(requestIDKey).(string)
 	return v
 }
+
+// Detach returns a fresh context for work that outlives ctx. It keeps the
+// request id and trace span for correlation but no other values and no
+// cancellation.
+func Detach(ctx context.Context) context.Context {
+	out := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	if id := RequestIDFromContext(ctx); id != "" {
+		out = WithRequestID(out, id)
+	}
+	return out
+}
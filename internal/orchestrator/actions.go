@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Task is one sub-prompt dispatched to a station.
+type Task struct {
+	Station string `json:"station"`
+	Prompt  string `json:"prompt"`
+}
+
+type ActionEnvelope struct {
+	Tasks []Task `json:"tasks"`
+}
+
+// ExtractActions parses subagent_actions JSON blocks from agent response.
+// Returns clean text (with JSON block removed) and parsed actions.
+// Format in agent response:
+//
+//	```json
+//	{"subagent_actions": {"tasks": [{"station": "research", "prompt": "..."}]}}
+//	```
+func ExtractActions(response string) (cleanText string, actions *ActionEnvelope, err error) {
+	idx := 0
+	for {
+		start := strings.Index(response[idx:], "```json")
+		if start == -1 {
+			return response, nil, nil
+		}
+		start += idx
+
+		endMarker := strings.Index(response[start+7:], "```")
+		if endMarker == -1 {
+			return response, nil, nil
+		}
+
+		blockStart := start + 7
+		blockEnd := blockStart + endMarker
+		jsonText := strings.TrimSpace(response[blockStart:blockEnd])
+		if !strings.Contains(jsonText, "subagent_actions") {
+			idx = blockEnd + 3
+			continue
+		}
+
+		var wrapper struct {
+			SubagentActions ActionEnvelope `json:"subagent_actions"`
+		}
+		if err := json.Unmarshal([]byte(jsonText), &wrapper); err != nil {
+			return response, nil, fmt.Errorf("parse subagent_actions json: %w", err)
+		}
+
+		clean := strings.TrimSpace(response[:start] + response[blockEnd+3:])
+		return clean, &wrapper.SubagentActions, nil
+	}
+}
+
+// ParseCommand parses the body of a /fanout command: one "station: prompt" per line.
+func ParseCommand(body string) ([]Task, error) {
+	var tasks []Task
+	for i, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		station, prompt, ok := strings.Cut(line, ":")
+		station, prompt = strings.TrimSpace(station), strings.TrimSpace(prompt)
+		if !ok || station == "" || prompt == "" || strings.ContainsAny(station, " \t") {
+			return nil, fmt.Errorf("line %d: expected `station: prompt`", i+1)
+		}
+		tasks = append(tasks, Task{Station: station, Prompt: prompt})
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no tasks given")
+	}
+	return tasks, nil
+}
@@ -0,0 +1,279 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"visor/internal/agent"
+	"visor/internal/observability"
+)
+
+// BackendFactory builds the agent for one ranked station backend.
+type BackendFactory func(station string, rank int, backend StationBackend) (agent.Agent, error)
+
+type stationRuntime struct {
+	cfg      Station
+	registry *agent.Registry
+}
+
+// Orchestrator fans sub-prompts out to subagent stations and collects the results (M9).
+type Orchestrator struct {
+	stations    map[string]*stationRuntime
+	order       []string
+	maxParallel int
+	log         *observability.Logger
+}
+
+// Result is the outcome of one task.
+type Result struct {
+	Task     Task
+	Response string
+	Backend  string // station backend that answered
+	Err      error
+	Duration time.Duration
+	Usage    []agent.Usage // token usage reported by the station's backends
+}
+
+func New(cfg *StationsConfig, factory BackendFactory) (*Orchestrator, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("stations config is required")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	o := &Orchestrator{
+		stations:    make(map[string]*stationRuntime, len(cfg.Stations)),
+		maxParallel: cfg.MaxParallel,
+		log:         observability.Component("orchestrator"),
+	}
+	for _, st := range cfg.Stations {
+		reg := agent.NewRegistry()
+		for rank, b := range st.Backends {
+			a, err := factory(st.Name, rank, b)
+			if err != nil {
+				_ = o.Close()
+				_ = reg.Close()
+				return nil, fmt.Errorf("station %s backend %s: %w", st.Name, b.Backend, err)
+			}
+			reg.Register(stationBackendName(b), a, rank)
+		}
+		reg.HealthCheckAll(context.Background())
+		o.stations[st.Name] = &stationRuntime{cfg: st, registry: reg}
+		o.order = append(o.order, st.Name)
+	}
+	return o, nil
+}
+
+func stationBackendName(b StationBackend) string {
+	if b.Model == "" {
+		return b.Backend
+	}
+	return b.Backend + "/" + b.Model
+}
+
+// Stations returns station names in config order.
+func (o *Orchestrator) Stations() []string {
+	return append([]string(nil), o.order...)
+}
+
+// Describe returns agent-facing instructions listing the stations and the action format.
+func (o *Orchestrator) Describe() string {
+	var b strings.Builder
+	b.WriteString("subagent stations (fan out independent sub-tasks in parallel; results come back as a follow-up message):\n")
+	for _, name := range o.order {
+		st := o.stations[name].cfg
+		b.WriteString("- " + name)
+		if st.Description != "" {
+			b.WriteString(": " + st.Description)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("to dispatch, add:\n```json\n{\"subagent_actions\": {\"tasks\": [{\"station\": \"<name>\", \"prompt\": \"<self-contained sub-prompt>\"}]}}\n```")
+	return b.String()
+}
+
+// Status reports per-station backend health (active backend first).
+func (o *Orchestrator) Status() map[string][]agent.BackendStatus {
+	out := make(map[string][]agent.BackendStatus, len(o.stations))
+	for name, st := range o.stations {
+		out[name] = st.registry.Status()
+	}
+	return out
+}
+
+// Fanout runs tasks in parallel (bounded by max_parallel) and returns results in task order.
+// Each task gets its station's timeout; failover between ranked backends is handled by
+// the station registry.
+func (o *Orchestrator) Fanout(ctx context.Context, tasks []Task) []Result {
+	ctx, span := observability.StartSpan(ctx, "orchestrator.fanout", attribute.Int("task_count", len(tasks)), attribute.Int("max_parallel", o.maxParallel))
+	defer span.End()
+
+	results := make([]Result, len(tasks))
+	sem := make(chan struct{}, o.maxParallel)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task Task) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = Result{Task: task, Err: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+			results[i] = o.runTask(ctx, task)
+		}(i, task)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("failed_count", failed))
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d tasks failed", failed, len(tasks)))
+	}
+	o.log.Info(ctx, "fanout finished", "tasks", len(tasks), "failed", failed)
+	return results
+}
+
+func (o *Orchestrator) runTask(ctx context.Context, task Task) Result {
+	ctx, span := observability.StartSpan(ctx, "orchestrator.station", attribute.String("station", task.Station))
+	defer span.End()
+
+	st, ok := o.stations[task.Station]
+	if !ok {
+		err := fmt.Errorf("unknown station %q (available: %s)", task.Station, strings.Join(o.order, ", "))
+		span.SetStatus(codes.Error, err.Error())
+		return Result{Task: task, Err: err}
+	}
+
+	timeout := st.cfg.timeout()
+	taskCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// stations run outside any turn, so their usage is collected here for the caller to record
+	var usageMu sync.Mutex
+	var used []agent.Usage
+	taskCtx = agent.WithUsageSink(taskCtx, func(u agent.Usage) {
+		usageMu.Lock()
+		defer usageMu.Unlock()
+		used = append(used, u)
+	})
+
+	start := time.Now()
+	o.log.Info(ctx, "station task started", "station", task.Station, "timeout", timeout.String())
+	resp, backend, err := st.registry.SendPromptVia(taskCtx, task.Prompt)
+	res := Result{Task: task, Response: strings.TrimSpace(resp), Backend: backend, Err: err, Duration: time.Since(start)}
+	usageMu.Lock()
+	res.Usage = append([]agent.Usage(nil), used...)
+	usageMu.Unlock()
+	if err == nil && res.Response == "" {
+		res.Err = fmt.Errorf("empty response")
+	}
+	span.SetAttributes(attribute.String("backend", res.Backend), attribute.Int64("duration_ms", res.Duration.Milliseconds()))
+	if res.Err != nil {
+		if taskCtx.Err() == context.DeadlineExceeded {
+			res.Err = fmt.Errorf("timed out after %s: %w", timeout, res.Err)
+		}
+		span.RecordError(res.Err)
+		span.SetStatus(codes.Error, res.Err.Error())
+		o.log.Warn(ctx, "station task failed", "station", task.Station, "backend", res.Backend, "duration_ms", res.Duration.Milliseconds(), "error", res.Err.Error())
+	} else {
+		o.log.Info(ctx, "station task finished", "station", task.Station, "backend", res.Backend, "duration_ms", res.Duration.Milliseconds(), "response_chars", len(res.Response))
+	}
+	return res
+}
+
+// MergePrompt builds the follow-up prompt that feeds station results back to the main agent.
+func MergePrompt(original string, results []Result) string {
+	var b strings.Builder
+	b.WriteString("[subagent results]\n")
+	if strings.TrimSpace(original) != "" {
+		b.WriteString("original request: " + strings.TrimSpace(original) + "\n")
+	}
+	b.WriteString("the following sub-tasks ran in parallel on subagent stations. combine them into one answer for the user; mention failed tasks briefly.\n")
+	for i, r := range results {
+		fmt.Fprintf(&b, "\n### %d. %s\nprompt: %s\n", i+1, r.Task.Station, r.Task.Prompt)
+		if r.Err != nil {
+			fmt.Fprintf(&b, "status: failed (%v)\n", r.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "backend: %s\nresult:\n%s\n", r.Backend, r.Response)
+	}
+	return b.String()
+}
+
+// Summary renders a short telegram status message for a finished fan-out.
+func Summary(results []Result) string {
+	ok := 0
+	for _, r := range results {
+		if r.Err == nil {
+			ok++
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "🛰 fan-out done: %d/%d ok", ok, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(&b, "\n- ❌ %s: %s", r.Task.Station, truncate(r.Err.Error(), 120))
+			continue
+		}
+		fmt.Fprintf(&b, "\n- ✅ %s (%s, %s)", r.Task.Station, r.Backend, r.Duration.Round(100*time.Millisecond))
+	}
+	return b.String()
+}
+
+// FormatStations renders the station list with backend health for /fanout without arguments.
+func (o *Orchestrator) FormatStations() string {
+	status := o.Status()
+	var b strings.Builder
+	fmt.Fprintf(&b, "subagent stations (max %d parallel)", o.maxParallel)
+	for _, name := range o.order {
+		st := o.stations[name].cfg
+		fmt.Fprintf(&b, "\n- *%s* (timeout %s)", name, st.timeout())
+		backends := status[name]
+		sort.SliceStable(backends, func(i, j int) bool { return backends[i].Priority < backends[j].Priority })
+		for _, bs := range backends {
+			mark := "✅"
+			if !bs.Healthy {
+				mark = "❌"
+			}
+			fmt.Fprintf(&b, "\n  %s `%s`", mark, bs.Name)
+		}
+	}
+	b.WriteString("\n\nusage: `/fanout station: prompt` (one task per line)")
+	return b.String()
+}
+
+// Close shuts down all station backends.
+func (o *Orchestrator) Close() error {
+	var errs []string
+	for name, st := range o.stations {
+		if err := st.registry.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("close stations: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,210 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"visor/internal/agent"
+)
+
+type fakeAgent struct {
+	name    string
+	delay   time.Duration
+	err     error
+	running *atomic.Int64
+	peak    *atomic.Int64
+}
+
+func (f *fakeAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	if f.running != nil {
+		n := f.running.Add(1)
+		defer f.running.Add(-1)
+		for {
+			p := f.peak.Load()
+			if n <= p || f.peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+	}
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.name + ": " + prompt, nil
+}
+
+func (f *fakeAgent) Close() error { return nil }
+
+func newTestOrchestrator(t *testing.T, cfg *StationsConfig, agents map[string]agent.Agent) *Orchestrator {
+	t.Helper()
+	o, err := New(cfg, func(station string, rank int, b StationBackend) (agent.Agent, error) {
+		a, ok := agents[b.Backend]
+		if !ok {
+			return nil, fmt.Errorf("no fake for %s", b.Backend)
+		}
+		return a, nil
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return o
+}
+
+func TestFanout_RankedFallbackAndUnknownStation(t *testing.T) {
+	cfg := &StationsConfig{Stations: []Station{
+		{Name: "research", Backends: []StationBackend{{Backend: "primary"}, {Backend: "fallback", Model: "small"}}},
+	}}
+	o := newTestOrchestrator(t, cfg, map[string]agent.Agent{
+		"primary":  &fakeAgent{name: "primary", err: fmt.Errorf("rate limit exceeded (429)")},
+		"fallback": &fakeAgent{name: "fallback"},
+	})
+
+	results := o.Fanout(context.Background(), []Task{
+		{Station: "research", Prompt: "find x"},
+		{Station: "nope", Prompt: "y"},
+	})
+	if results[0].Err != nil || results[0].Response != "fallback: find x" || results[0].Backend != "fallback/small" {
+		t.Fatalf("result[0]=%+v", results[0])
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "unknown station") {
+		t.Fatalf("result[1]=%+v", results[1])
+	}
+
+	summary := Summary(results)
+	if !strings.Contains(summary, "1/2 ok") || !strings.Contains(summary, "❌ nope") {
+		t.Fatalf("summary=%q", summary)
+	}
+	merged := MergePrompt("compare x and y", results)
+	if !strings.Contains(merged, "original request: compare x and y") || !strings.Contains(merged, "fallback: find x") || !strings.Contains(merged, "status: failed") {
+		t.Fatalf("merged=%q", merged)
+	}
+}
+
+// blockingAgent holds prompts until release is closed and fails the prompt "fail".
+type blockingAgent struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingAgent) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	if prompt == "fail" {
+		return "", fmt.Errorf("rate limit exceeded (429)")
+	}
+	b.started <- struct{}{}
+	<-b.release
+	return "primary: " + prompt, nil
+}
+
+func (b *blockingAgent) Close() error { return nil }
+
+func TestRunTask_ReportsTheBackendThatAnswered(t *testing.T) {
+	cfg := &StationsConfig{Stations: []Station{
+		{Name: "research", Backends: []StationBackend{{Backend: "primary"}, {Backend: "fallback"}}},
+	}}
+	primary := &blockingAgent{started: make(chan struct{}, 1), release: make(chan struct{})}
+	o := newTestOrchestrator(t, cfg, map[string]agent.Agent{
+		"primary":  primary,
+		"fallback": &fakeAgent{name: "fallback"},
+	})
+
+	slow := make(chan Result, 1)
+	go func() { slow <- o.runTask(context.Background(), Task{Station: "research", Prompt: "slow"}) }()
+	<-primary.started
+
+	// fails over while the first task is still on primary
+	if r := o.runTask(context.Background(), Task{Station: "research", Prompt: "fail"}); r.Err != nil || r.Backend != "fallback" {
+		t.Fatalf("failed over task=%+v, want fallback", r)
+	}
+	close(primary.release)
+	if r := <-slow; r.Err != nil || r.Backend != "primary" {
+		t.Fatalf("slow task=%+v, want the primary that answered, not the active backend", r)
+	}
+}
+
+func TestFanout_StationTimeout(t *testing.T) {
+	cfg := &StationsConfig{Stations: []Station{
+		{Name: "slow", TimeoutSeconds: 1, Backends: []StationBackend{{Backend: "slow"}}},
+	}}
+	o := newTestOrchestrator(t, cfg, map[string]agent.Agent{"slow": &fakeAgent{name: "slow", delay: 5 * time.Second}})
+
+	start := time.Now()
+	results := o.Fanout(context.Background(), []Task{{Station: "slow", Prompt: "x"}})
+	if results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "timed out after 1s") {
+		t.Fatalf("err=%v want timeout", results[0].Err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("timeout not enforced")
+	}
+}
+
+func TestFanout_MaxParallel(t *testing.T) {
+	var running, peak atomic.Int64
+	cfg := &StationsConfig{MaxParallel: 2, Stations: []Station{
+		{Name: "work", Backends: []StationBackend{{Backend: "worker"}}},
+	}}
+	o := newTestOrchestrator(t, cfg, map[string]agent.Agent{
+		"worker": &fakeAgent{name: "w", delay: 30 * time.Millisecond, running: &running, peak: &peak},
+	})
+
+	tasks := make([]Task, 6)
+	for i := range tasks {
+		tasks[i] = Task{Station: "work", Prompt: fmt.Sprintf("t%d", i)}
+	}
+	results := o.Fanout(context.Background(), tasks)
+	for i, r := range results {
+		if r.Err != nil || r.Response != fmt.Sprintf("w: t%d", i) {
+			t.Fatalf("result[%d]=%+v (order must follow tasks)", i, r)
+		}
+	}
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("peak parallelism=%d want 2", got)
+	}
+}
+
+func TestLoadStations(t *testing.T) {
+	dir := t.TempDir()
+	if cfg, err := LoadStations(filepath.Join(dir, "missing.json")); err != nil || cfg != nil {
+		t.Fatalf("missing file: cfg=%v err=%v", cfg, err)
+	}
+
+	path := filepath.Join(dir, "subagent-stations.json")
+	_ = os.WriteFile(path, []byte(`{"stations":[{"name":"code","backends":[{"backend":"pi"},{"backend":"ollama","model":"qwen2.5-coder"}]}]}`), 0o644)
+	cfg, err := LoadStations(path)
+	if err != nil {
+		t.Fatalf("LoadStations: %v", err)
+	}
+	if cfg.MaxParallel != defaultMaxParallel || cfg.Stations[0].timeout() != defaultStationTimeout {
+		t.Fatalf("defaults not applied: %+v", cfg)
+	}
+
+	_ = os.WriteFile(path, []byte(`{"stations":[{"name":"code","backends":[]}]}`), 0o644)
+	if _, err := LoadStations(path); err == nil {
+		t.Fatal("expected error for station without backends")
+	}
+}
+
+func TestExtractActionsAndParseCommand(t *testing.T) {
+	resp := "on it\n\n```json\n{\"subagent_actions\": {\"tasks\": [{\"station\": \"research\", \"prompt\": \"find x\"}]}}\n```"
+	clean, actions, err := ExtractActions(resp)
+	if err != nil || actions == nil || len(actions.Tasks) != 1 || clean != "on it" {
+		t.Fatalf("clean=%q actions=%+v err=%v", clean, actions, err)
+	}
+
+	tasks, err := ParseCommand("research: find x\n\ncode: write y")
+	if err != nil || len(tasks) != 2 || tasks[1].Station != "code" || tasks[1].Prompt != "write y" {
+		t.Fatalf("tasks=%+v err=%v", tasks, err)
+	}
+	if _, err := ParseCommand("just text without station"); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
@@ -0,0 +1,90 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxParallel    = 3
+	defaultStationTimeout = 5 * time.Minute
+)
+
+// StationBackend is one ranked entry of a station's model fallback list.
+type StationBackend struct {
+	Backend string `json:"backend"`         // agent backend name (pi, openai, ollama, exec name, echo)
+	Model   string `json:"model,omitempty"` // optional model override for that backend
+}
+
+// Station is a named subagent domain (e.g. research, code) with its own backends.
+type Station struct {
+	Name           string           `json:"name"`
+	Description    string           `json:"description,omitempty"`
+	TimeoutSeconds int              `json:"timeout_seconds,omitempty"`
+	Backends       []StationBackend `json:"backends"` // ranked: first = preferred
+}
+
+// StationsConfig is the config/subagent-stations.json schema.
+type StationsConfig struct {
+	MaxParallel int       `json:"max_parallel,omitempty"`
+	Stations    []Station `json:"stations"`
+}
+
+// LoadStations reads the stations file. A missing file yields nil (orchestration disabled).
+func LoadStations(path string) (*StationsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read stations: %w", err)
+	}
+	var cfg StationsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decode stations: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *StationsConfig) validate() error {
+	if c.MaxParallel <= 0 {
+		c.MaxParallel = defaultMaxParallel
+	}
+	if len(c.Stations) == 0 {
+		return fmt.Errorf("stations: at least one station is required")
+	}
+	seen := map[string]bool{}
+	for i, st := range c.Stations {
+		name := strings.TrimSpace(st.Name)
+		if name == "" {
+			return fmt.Errorf("stations[%d]: name is required", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("stations: duplicate station %q", name)
+		}
+		seen[name] = true
+		if len(st.Backends) == 0 {
+			return fmt.Errorf("station %s: at least one backend is required", name)
+		}
+		for j, b := range st.Backends {
+			if strings.TrimSpace(b.Backend) == "" {
+				return fmt.Errorf("station %s: backends[%d].backend is required", name, j)
+			}
+		}
+		c.Stations[i].Name = name
+	}
+	return nil
+}
+
+func (s Station) timeout() time.Duration {
+	if s.TimeoutSeconds <= 0 {
+		return defaultStationTimeout
+	}
+	return time.Duration(s.TimeoutSeconds) * time.Second
+}
@@ -2,6 +2,7 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const defaultAPIBase = "https://api.telegram.org/bot"
@@ -38,21 +40,88 @@ func NewClientWithOptions(token, apiBase string, httpClient *http.Client) *Clien
 }
 
 func (c *Client) SendMessage(chatID int64, text string) error {
+	_, err := c.SendMessageWithID(chatID, text)
+	return err
+}
+
+// SendMessageWithID sends a message and returns its telegram message id,
+// so the caller can edit or delete it later.
+func (c *Client) SendMessageWithID(chatID int64, text string) (int, error) {
+	return c.SendMessageWithMarkup(chatID, text, nil)
+}
+
+// SendMessageWithMarkup sends a message with an inline keyboard below it and
+// returns its id. A nil markup sends a plain message.
+func (c *Client) SendMessageWithMarkup(chatID int64, text string, markup *InlineKeyboardMarkup) (int, error) {
 	payload := map[string]any{
 		"chat_id":    chatID,
 		"text":       text,
 		"parse_mode": "Markdown",
 	}
-	if err := c.sendJSON("sendMessage", payload); err != nil {
-		if strings.Contains(err.Error(), "can't parse entities") {
-			return c.sendJSON("sendMessage", map[string]any{
-				"chat_id": chatID,
-				"text":    text,
-			})
+	if markup != nil {
+		payload["reply_markup"] = markup
+	}
+	var sent Message
+	if err := c.callJSON("sendMessage", payload, &sent); err != nil {
+		if !isEntityParseError(err) {
+			return 0, err
+		}
+		delete(payload, "parse_mode")
+		if err := c.callJSON("sendMessage", payload, &sent); err != nil {
+			return 0, err
 		}
-		return err
 	}
-	return nil
+	return sent.MessageID, nil
+}
+
+// EditMessageText replaces the text of a previously sent message.
+// Edits that would not change the message are treated as success.
+func (c *Client) EditMessageText(chatID int64, messageID int, text string) error {
+	return c.EditMessageTextWithMarkup(chatID, messageID, text, nil)
+}
+
+// EditMessageTextWithMarkup replaces the text and inline keyboard of a
+// message. A nil markup removes the keyboard.
+func (c *Client) EditMessageTextWithMarkup(chatID int64, messageID int, text string, markup *InlineKeyboardMarkup) error {
+	payload := map[string]any{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+		"parse_mode": "Markdown",
+	}
+	if markup != nil {
+		payload["reply_markup"] = markup
+	}
+	err := c.sendJSON("editMessageText", payload)
+	if err != nil && isEntityParseError(err) {
+		delete(payload, "parse_mode")
+		err = c.sendJSON("editMessageText", payload)
+	}
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// AnswerCallbackQuery stops the loading indicator of a pressed button and
+// shows text as a short notification when it is not empty.
+func (c *Client) AnswerCallbackQuery(callbackID, text string) error {
+	payload := map[string]any{"callback_query_id": callbackID}
+	if text != "" {
+		payload["text"] = text
+	}
+	return c.sendJSON("answerCallbackQuery", payload)
+}
+
+func (c *Client) DeleteMessage(chatID int64, messageID int) error {
+	return c.sendJSON("deleteMessage", map[string]any{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	})
+}
+
+func isEntityParseError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't parse entities")
 }
 
 func (c *Client) SendVoice(chatID int64, audio io.Reader, filename string) error {
@@ -104,17 +173,59 @@ func (c *Client) GetFileURL(fileID string) (string, error) {
 	if !result.OK {
 		return "", fmt.Errorf("getFile: API returned ok=false")
 	}
-	return fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", c.token, result.Result.FilePath), nil
+	return fmt.Sprintf("%s%s/%s", c.fileBase(), c.token, result.Result.FilePath), nil
+}
+
+// fileBase is the download prefix matching apiBase: .../bot -> .../file/bot.
+func (c *Client) fileBase() string {
+	return strings.TrimSuffix(c.apiBase, "bot") + "file/bot"
+}
+
+// DownloadFile opens the file behind fileID. The caller closes the body;
+// name is the last element of the telegram file path, e.g. "file_3.jpg".
+func (c *Client) DownloadFile(ctx context.Context, fileID string) (body io.ReadCloser, name string, err error) {
+	fileURL, err := c.GetFileURL(fileID)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("download request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("download: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("download status %d: %s", resp.StatusCode, msg)
+	}
+	return resp.Body, fileURL[strings.LastIndex(fileURL, "/")+1:], nil
 }
 
 func (c *Client) sendJSON(method string, payload any) error {
+	return c.callJSON(method, payload, nil)
+}
+
+// callJSON posts payload to a bot api method and decodes the result field into out (if non-nil).
+func (c *Client) callJSON(method string, payload any, out any) error {
+	return c.callJSONContext(context.Background(), method, payload, out)
+}
+
+func (c *Client) callJSONContext(ctx context.Context, method string, payload any, out any) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal %s: %w", method, err)
 	}
 
 	url := fmt.Sprintf("%s%s/%s", c.apiBase, c.token, method)
-	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("%s request: %w", method, err)
 	}
@@ -122,11 +233,52 @@ func (c *Client) sendJSON(method string, payload any) error {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("%s: status %d: %s", method, resp.StatusCode, respBody)
+		return newAPIError(method, resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("%s decode: %w", method, err)
+	}
+	if len(envelope.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("%s decode result: %w", method, err)
 	}
 	return nil
 }
 
+// APIError is a bot api response with a non-200 status.
+type APIError struct {
+	Method     string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // parameters.retry_after of a 429 response
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", e.Method, e.StatusCode, e.Body)
+}
+
+func newAPIError(method string, status int, body []byte) *APIError {
+	e := &APIError{Method: method, StatusCode: status, Body: string(body)}
+	var parsed struct {
+		Parameters struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Parameters.RetryAfter > 0 {
+		e.RetryAfter = time.Duration(parsed.Parameters.RetryAfter) * time.Second
+	}
+	return e
+}
+
 func (c *Client) ValidateToken() error {
 	url := fmt.Sprintf("%s%s/getMe", c.apiBase, c.token)
 	resp, err := c.httpClient.Get(url)
@@ -151,10 +303,39 @@ func (c *Client) ValidateToken() error {
 	return nil
 }
 
-func (c *Client) SetWebhook(url, secret string) error {
+// SetWebhook registers url for updates. allowed lists the update types to
+// receive; nil keeps the bot api default, which excludes message_reaction.
+func (c *Client) SetWebhook(url, secret string, allowed []string) error {
 	payload := map[string]any{"url": url}
 	if secret != "" {
 		payload["secret_token"] = secret
 	}
+	if allowed != nil {
+		payload["allowed_updates"] = allowed
+	}
 	return c.sendJSON("setWebhook", payload)
 }
+
+// DeleteWebhook removes the webhook so updates can be fetched with
+// getUpdates; pending updates are kept unless dropPending is set.
+func (c *Client) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	return c.callJSONContext(ctx, "deleteWebhook", map[string]any{"drop_pending_updates": dropPending}, nil)
+}
+
+// GetUpdates long-polls for updates with an id of at least offset, waiting up
+// to timeout for one to arrive. allowed limits the update types (nil: the bot
+// api default).
+func (c *Client) GetUpdates(ctx context.Context, offset int, timeout time.Duration, allowed []string) ([]Update, error) {
+	payload := map[string]any{
+		"offset":  offset,
+		"timeout": int(timeout / time.Second),
+	}
+	if allowed != nil {
+		payload["allowed_updates"] = allowed
+	}
+	var updates []Update
+	if err := c.callJSONContext(ctx, "getUpdates", payload, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
@@ -1,6 +1,7 @@
 package telegram
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -97,3 +98,161 @@ func TestSendMessage_FallbackToPlainOnEntityParseError(t *testing.T) {
 		t.Fatalf("second text=%q", second.Text)
 	}
 }
+
+func TestSendMessageWithID_ReturnsMessageID(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":77,"chat":{"id":12345,"type":"private"}}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	id, err := c.SendMessageWithID(12345, "hello")
+	if err != nil {
+		t.Fatalf("send message: %v", err)
+	}
+	if id != 77 {
+		t.Fatalf("message_id=%d want=77", id)
+	}
+}
+
+func TestEditMessageText_IgnoresNotModified(t *testing.T) {
+	type editReq struct {
+		ChatID    int64  `json:"chat_id"`
+		MessageID int    `json:"message_id"`
+		Text      string `json:"text"`
+	}
+
+	gotPath := ""
+	var got editReq
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message is not modified"}`))
+	}))
+	defer ts.Close()
+
+	c := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	if err := c.EditMessageText(12345, 77, "same"); err != nil {
+		t.Fatalf("edit message: %v", err)
+	}
+	if gotPath != "/bottest-token/editMessageText" {
+		t.Fatalf("path=%q", gotPath)
+	}
+	if got.MessageID != 77 || got.Text != "same" {
+		t.Fatalf("payload=%+v", got)
+	}
+}
+
+func TestSendMessageWithMarkup_SendsInlineKeyboard(t *testing.T) {
+	var got struct {
+		ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":5,"chat":{"id":12345,"type":"private"}}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	markup := &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "Done", CallbackData: "qa:done"}}}}
+	if _, err := c.SendMessageWithMarkup(12345, "reminder", markup); err != nil {
+		t.Fatalf("send message: %v", err)
+	}
+	if got.ReplyMarkup == nil || got.ReplyMarkup.InlineKeyboard[0][0].CallbackData != "qa:done" {
+		t.Fatalf("reply_markup=%+v", got.ReplyMarkup)
+	}
+
+	got.ReplyMarkup = nil
+	if _, err := c.SendMessageWithID(12345, "plain"); err != nil {
+		t.Fatalf("send message: %v", err)
+	}
+	if got.ReplyMarkup != nil {
+		t.Fatalf("plain message must not carry a keyboard: %+v", got.ReplyMarkup)
+	}
+}
+
+func TestAnswerCallbackQuery(t *testing.T) {
+	gotPath := ""
+	var got map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer ts.Close()
+
+	c := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	if err := c.AnswerCallbackQuery("cb-1", "done ✓"); err != nil {
+		t.Fatalf("answer callback: %v", err)
+	}
+	if gotPath != "/bottest-token/answerCallbackQuery" || got["callback_query_id"] != "cb-1" || got["text"] != "done ✓" {
+		t.Fatalf("path=%q payload=%v", gotPath, got)
+	}
+}
+
+func TestSetWebhook_AllowedUpdates(t *testing.T) {
+	var got map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer ts.Close()
+
+	c := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	if err := c.SetWebhook("https://example.com/webhook", "s3cret", []string{"message", "message_reaction"}); err != nil {
+		t.Fatalf("set webhook: %v", err)
+	}
+	allowed, _ := got["allowed_updates"].([]any)
+	if got["secret_token"] != "s3cret" || len(allowed) != 2 || allowed[1] != "message_reaction" {
+		t.Fatalf("payload=%v", got)
+	}
+}
+
+func TestMessageReactionAdded(t *testing.T) {
+	r := MessageReaction{
+		OldReaction: []Reaction{{Type: "emoji", Emoji: "👍"}},
+		NewReaction: []Reaction{{Type: "emoji", Emoji: "👍"}, {Type: "custom_emoji", CustomEmojiID: "42"}},
+	}
+	added := r.Added()
+	if len(added) != 1 || added[0].CustomEmojiID != "42" {
+		t.Fatalf("added=%+v", added)
+	}
+}
+
+func TestDownloadFile_UsesConfiguredAPIBase(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottest-token/getFile":
+			if r.URL.Query().Get("file_id") != "large" {
+				t.Fatalf("file_id=%q", r.URL.Query().Get("file_id"))
+			}
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"file_path":"photos/file_3.jpg"}}`))
+		case "/file/bottest-token/photos/file_3.jpg":
+			_, _ = w.Write([]byte("jpeg bytes"))
+		default:
+			t.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	body, name, err := c.DownloadFile(context.Background(), "large")
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if name != "file_3.jpg" || string(data) != "jpeg bytes" {
+		t.Fatalf("name=%q data=%q", name, data)
+	}
+}
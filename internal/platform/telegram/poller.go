@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"visor/internal/observability"
+)
+
+// PollerConfig configures long polling with getUpdates.
+type PollerConfig struct {
+	Timeout        time.Duration // long-poll wait per getUpdates call (default 30s)
+	MinBackoff     time.Duration // first retry delay after an error, doubles per failure (default 1s)
+	MaxBackoff     time.Duration // upper bound of the retry delay (default 1m)
+	AllowedUpdates []string      // update types to receive; nil uses the bot api default
+	OffsetFile     string        // persists the next offset across restarts; empty keeps it in memory
+}
+
+// Poller fetches updates with getUpdates instead of receiving them on a
+// webhook. Updates are handed to the handler one at a time, in order; an
+// update is confirmed to telegram by the next getUpdates call once the
+// handler returned.
+type Poller struct {
+	client *Client
+	cfg    PollerConfig
+	offset int
+	log    *observability.Logger
+}
+
+func NewPoller(client *Client, cfg PollerConfig) *Poller {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = time.Minute
+	}
+	p := &Poller{client: client, cfg: cfg, log: observability.Component("telegram.poller")}
+	p.offset = p.loadOffset()
+	return p
+}
+
+// Run deletes any webhook and polls until ctx is done. It returns ctx.Err().
+func (p *Poller) Run(ctx context.Context, handle func(ctx context.Context, update Update)) error {
+	backoff := p.cfg.MinBackoff
+	for {
+		err := p.client.DeleteWebhook(ctx, false)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.log.Warn(ctx, "delete webhook failed", "error", err.Error(), "retry_in", backoff.String())
+		if !sleepContext(ctx, backoff) {
+			return ctx.Err()
+		}
+		backoff = p.nextBackoff(backoff)
+	}
+	p.log.Info(ctx, "telegram polling started", "offset", p.offset, "timeout_s", int(p.cfg.Timeout/time.Second))
+
+	backoff = p.cfg.MinBackoff
+	failures := 0
+	for {
+		updates, err := p.client.GetUpdates(ctx, p.offset, p.cfg.Timeout, p.cfg.AllowedUpdates)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			failures++
+			wait := backoff
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+				wait = apiErr.RetryAfter
+			}
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+				p.log.Warn(ctx, "getUpdates conflict: another poller or a webhook is active", "error", err.Error(), "retry_in", wait.String())
+			} else {
+				p.log.Warn(ctx, "getUpdates failed", "error", err.Error(), "failures", failures, "retry_in", wait.String())
+			}
+			if !sleepContext(ctx, wait) {
+				return ctx.Err()
+			}
+			backoff = p.nextBackoff(backoff)
+			continue
+		}
+		if failures > 0 {
+			p.log.Info(ctx, "getUpdates recovered", "failures", failures)
+			failures = 0
+		}
+		backoff = p.cfg.MinBackoff
+
+		for _, u := range updates {
+			if u.UpdateID < p.offset {
+				continue
+			}
+			handle(ctx, u)
+			p.offset = u.UpdateID + 1
+		}
+		if len(updates) > 0 {
+			p.saveOffset()
+		}
+	}
+}
+
+// Offset returns the id of the next update to fetch.
+func (p *Poller) Offset() int {
+	return p.offset
+}
+
+func (p *Poller) nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > p.cfg.MaxBackoff {
+		d = p.cfg.MaxBackoff
+	}
+	return d
+}
+
+func (p *Poller) loadOffset() int {
+	if p.cfg.OffsetFile == "" {
+		return 0
+	}
+	data, err := os.ReadFile(p.cfg.OffsetFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			p.log.Warn(nil, "poll offset read failed", "path", p.cfg.OffsetFile, "error", err.Error())
+		}
+		return 0
+	}
+	offset, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		p.log.Warn(nil, "poll offset invalid, starting from pending updates", "path", p.cfg.OffsetFile)
+		return 0
+	}
+	return offset
+}
+
+func (p *Poller) saveOffset() {
+	if p.cfg.OffsetFile == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p.cfg.OffsetFile), 0o755); err != nil {
+		p.log.Warn(nil, "poll offset write failed", "path", p.cfg.OffsetFile, "error", err.Error())
+		return
+	}
+	tmp := p.cfg.OffsetFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(p.offset)+"\n"), 0o644); err != nil {
+		p.log.Warn(nil, "poll offset write failed", "path", p.cfg.OffsetFile, "error", err.Error())
+		return
+	}
+	if err := os.Rename(tmp, p.cfg.OffsetFile); err != nil {
+		p.log.Warn(nil, "poll offset write failed", "path", p.cfg.OffsetFile, "error", err.Error())
+	}
+}
+
+// sleepContext waits for d and reports false when ctx ended first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
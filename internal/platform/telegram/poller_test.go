@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBotAPI serves deleteWebhook and scripted getUpdates responses; once the
+// script is used up getUpdates blocks like a long poll until the request ends.
+type fakeBotAPI struct {
+	mu      sync.Mutex
+	methods []string
+	offsets []int
+	script  []func(w http.ResponseWriter)
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	var req struct {
+		Offset int `json:"offset"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	f.mu.Lock()
+	f.methods = append(f.methods, method)
+	var step func(w http.ResponseWriter)
+	if method == "getUpdates" {
+		f.offsets = append(f.offsets, req.Offset)
+		if len(f.script) > 0 {
+			step, f.script = f.script[0], f.script[1:]
+		}
+	}
+	f.mu.Unlock()
+
+	switch {
+	case method == "deleteWebhook":
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	case step != nil:
+		step(w)
+	default:
+		<-r.Context().Done()
+	}
+}
+
+func (f *fakeBotAPI) calls() ([]string, []int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.methods...), append([]int(nil), f.offsets...)
+}
+
+func updatesResponse(ids ...int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		var updates []Update
+		for _, id := range ids {
+			updates = append(updates, Update{UpdateID: id, Message: &Message{MessageID: id, Chat: Chat{ID: 1}, Text: "hi"}})
+		}
+		body, _ := json.Marshal(map[string]any{"ok": true, "result": updates})
+		_, _ = w.Write(body)
+	}
+}
+
+func TestPollerHandlesUpdatesInOrderAndRetries(t *testing.T) {
+	api := &fakeBotAPI{script: []func(w http.ResponseWriter){
+		updatesResponse(7, 8),
+		func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Bad Gateway"}`))
+		},
+		func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Too Many Requests","parameters":{"retry_after":0}}`))
+		},
+		updatesResponse(8, 9), // 8 was confirmed already and must be skipped
+	}}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	offsetFile := filepath.Join(t.TempDir(), "telegram", "poll-offset")
+	client := NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	poller := NewPoller(client, PollerConfig{Timeout: time.Second, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, OffsetFile: offsetFile})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var handled []int
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.Run(ctx, func(ctx context.Context, u Update) {
+			mu.Lock()
+			handled = append(handled, u.UpdateID)
+			mu.Unlock()
+		})
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		_, offsets := api.calls()
+		if len(offsets) >= 5 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("getUpdates offsets=%v", offsets)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	methods, offsets := api.calls()
+	if methods[0] != "deleteWebhook" {
+		t.Fatalf("methods=%v, the webhook must be deleted first", methods)
+	}
+	if got := offsets[:5]; got[0] != 0 || got[1] != 9 || got[2] != 9 || got[3] != 9 || got[4] != 10 {
+		t.Fatalf("offsets=%v want [0 9 9 9 10]", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 3 || handled[0] != 7 || handled[1] != 8 || handled[2] != 9 {
+		t.Fatalf("handled=%v", handled)
+	}
+
+	data, err := os.ReadFile(offsetFile)
+	if err != nil || strings.TrimSpace(string(data)) != "10" {
+		t.Fatalf("offset file=%q err=%v", data, err)
+	}
+	if restarted := NewPoller(client, PollerConfig{OffsetFile: offsetFile}); restarted.Offset() != 10 {
+		t.Fatalf("restarted offset=%d want 10", restarted.Offset())
+	}
+}
+
+func TestAPIErrorRetryAfter(t *testing.T) {
+	err := newAPIError("getUpdates", http.StatusTooManyRequests, []byte(`{"ok":false,"parameters":{"retry_after":3}}`))
+	if err.RetryAfter != 3*time.Second {
+		t.Fatalf("retry_after=%v", err.RetryAfter)
+	}
+	if err.Error() != `getUpdates: status 429: {"ok":false,"parameters":{"retry_after":3}}` {
+		t.Fatalf("error=%q", err.Error())
+	}
+}
@@ -6,17 +6,21 @@ type Update struct {
 	UpdateID        int              `json:"update_id"`
 	Message         *Message         `json:"message,omitempty"`
 	MessageReaction *MessageReaction `json:"message_reaction,omitempty"`
+	CallbackQuery   *CallbackQuery   `json:"callback_query,omitempty"`
 }
 
 type Message struct {
-	MessageID int         `json:"message_id"`
-	From      *User       `json:"from,omitempty"`
-	Chat      Chat        `json:"chat"`
-	Date      int         `json:"date"`
-	Text      string      `json:"text,omitempty"`
-	Voice     *Voice      `json:"voice,omitempty"`
-	Photo     []PhotoSize `json:"photo,omitempty"`
-	Caption   string      `json:"caption,omitempty"`
+	MessageID      int                   `json:"message_id"`
+	From           *User                 `json:"from,omitempty"`
+	Chat           Chat                  `json:"chat"`
+	Date           int                   `json:"date"`
+	Text           string                `json:"text,omitempty"`
+	Voice          *Voice                `json:"voice,omitempty"`
+	Photo          []PhotoSize           `json:"photo,omitempty"`
+	Document       *Document             `json:"document,omitempty"`
+	Caption        string                `json:"caption,omitempty"`
+	ReplyToMessage *Message              `json:"reply_to_message,omitempty"`
+	ReplyMarkup    *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
 }
 
 type User struct {
@@ -42,14 +46,59 @@ type PhotoSize struct {
 	FileSize int    `json:"file_size,omitempty"`
 }
 
+// Document is a general file sent as a document (pdf, text, csv, ...).
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int    `json:"file_size,omitempty"`
+}
+
 type MessageReaction struct {
 	Chat        Chat       `json:"chat"`
 	MessageID   int        `json:"message_id"`
 	User        *User      `json:"user,omitempty"`
+	OldReaction []Reaction `json:"old_reaction,omitempty"`
 	NewReaction []Reaction `json:"new_reaction,omitempty"`
 }
 
+// Added returns the reactions in NewReaction that were not in OldReaction.
+func (r *MessageReaction) Added() []Reaction {
+	var added []Reaction
+	for _, n := range r.NewReaction {
+		found := false
+		for _, o := range r.OldReaction {
+			if o == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, n)
+		}
+	}
+	return added
+}
+
 type Reaction struct {
-	Type  string `json:"type"`
-	Emoji string `json:"emoji,omitempty"`
+	Type          string `json:"type"`                      // "emoji", "custom_emoji" or "paid"
+	Emoji         string `json:"emoji,omitempty"`           // set for "emoji"
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"` // set for "custom_emoji"
+}
+
+// CallbackQuery is sent when a user presses an inline keyboard button.
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    *User    `json:"from,omitempty"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data,omitempty"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
 }
@@ -10,6 +10,7 @@ type CreateAction struct {
 	Prompt          string `json:"prompt"`
 	RunAt           string `json:"run_at"`
 	IntervalSeconds int64  `json:"interval_seconds,omitempty"`
+	Critical        bool   `json:"critical,omitempty"`
 }
 
 type UpdateAction struct {
@@ -18,6 +19,7 @@ type UpdateAction struct {
 	RunAt           string `json:"run_at,omitempty"`
 	Recurring       *bool  `json:"recurring,omitempty"`
 	IntervalSeconds *int64 `json:"interval_seconds,omitempty"`
+	Critical        *bool  `json:"critical,omitempty"`
 }
 
 type DeleteAction struct {
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -58,16 +59,37 @@ type TriggerRecord struct {
 	TaskID    string
 	Prompt    string
 	Recurring bool
+	Critical  bool // snoozed and rescheduled copies keep the budget exemption
 	FiredAt   time.Time
 }
 
-const quickActionWindow = 5 * time.Minute
+const (
+	quickActionWindow = 5 * time.Minute // typed replies act on the last trigger within this window
+	buttonWindow      = 24 * time.Hour  // buttons of a fired task stay usable this long
+	callbackPrefix    = "qa:"           // callback data: qa:<action>:<taskID>:<firedAt base36 nanos>
+)
+
+// QuickActionButton is an inline keyboard button under a fired task's reply.
+type QuickActionButton struct {
+	Label string
+	Data  string // callback data, at most 64 bytes
+}
+
+var buttonActions = []struct {
+	code, label string
+}{
+	{"done", "✅ Done"},
+	{"s15", "⏰ 15m"},
+	{"s60", "⏰ 1h"},
+	{"tmr", "📅 Tomorrow"},
+}
 
 // QuickActionHandler manages quick action state and execution.
 type QuickActionHandler struct {
 	mu          sync.Mutex
 	lastTrigger *TriggerRecord
-	processed   map[string]time.Time // "taskID_firedAt" -> processed time
+	fired       map[string]*TriggerRecord // "taskID_firedAt" -> trigger, for buttons
+	processed   map[string]time.Time      // "taskID_firedAt" -> processed time
 	scheduler   *Scheduler
 	loc         *time.Location
 	log         interface {
@@ -79,6 +101,7 @@ func NewQuickActionHandler(s *Scheduler, loc *time.Location, log interface {
 	Info(ctx context.Context, msg string, args ...any)
 }) *QuickActionHandler {
 	return &QuickActionHandler{
+		fired:     make(map[string]*TriggerRecord),
 		processed: make(map[string]time.Time),
 		scheduler: s,
 		loc:       loc,
@@ -94,8 +117,121 @@ func (h *QuickActionHandler) RecordTrigger(task Task) {
 		TaskID:    task.ID,
 		Prompt:    task.Prompt,
 		Recurring: task.Recurring,
+		Critical:  task.Critical,
 		FiredAt:   time.Now().UTC(),
 	}
+	h.fired[triggerKey(h.lastTrigger)] = h.lastTrigger
+	for k, t := range h.fired {
+		if h.lastTrigger.FiredAt.Sub(t.FiredAt) > buttonWindow {
+			delete(h.fired, k)
+		}
+	}
+}
+
+func triggerKey(t *TriggerRecord) string {
+	return fmt.Sprintf("%s_%d", t.TaskID, t.FiredAt.UnixNano())
+}
+
+// Buttons returns the quick action buttons for the latest trigger of taskID,
+// or nil when the task has not fired recently.
+func (h *QuickActionHandler) Buttons(taskID string) []QuickActionButton {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	latest := h.latestTriggerLocked(taskID)
+	if latest == nil {
+		return nil
+	}
+	fired := strconv.FormatInt(latest.FiredAt.UnixNano(), 36)
+	buttons := make([]QuickActionButton, 0, len(buttonActions))
+	for _, a := range buttonActions {
+		buttons = append(buttons, QuickActionButton{Label: a.label, Data: callbackPrefix + a.code + ":" + taskID + ":" + fired})
+	}
+	return buttons
+}
+
+func (h *QuickActionHandler) latestTriggerLocked(taskID string) *TriggerRecord {
+	var latest *TriggerRecord
+	for _, t := range h.fired {
+		if t.TaskID == taskID && (latest == nil || t.FiredAt.After(latest.FiredAt)) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// HandleCallback runs the quick action of a pressed button. ok is false when
+// data is not quick action callback data.
+func (h *QuickActionHandler) HandleCallback(ctx context.Context, data string) (string, bool) {
+	if !strings.HasPrefix(data, callbackPrefix) {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(data, callbackPrefix), ":")
+	if len(parts) != 3 {
+		return "", false
+	}
+	code, taskID := parts[0], parts[1]
+	firedNanos, err := strconv.ParseInt(parts[2], 36, 64)
+	if err != nil {
+		return "", false
+	}
+
+	return h.apply(ctx, fmt.Sprintf("%s_%d", taskID, firedNanos), code)
+}
+
+// MarkDone acknowledges the latest trigger of taskID like the Done button;
+// ok is false when the task has not fired recently.
+func (h *QuickActionHandler) MarkDone(ctx context.Context, taskID string) (string, bool) {
+	h.mu.Lock()
+	latest := h.latestTriggerLocked(taskID)
+	h.mu.Unlock()
+	if latest == nil {
+		return "", false
+	}
+	return h.apply(ctx, triggerKey(latest), "done")
+}
+
+// apply runs a button action on the trigger stored under key.
+func (h *QuickActionHandler) apply(ctx context.Context, key, code string) (string, bool) {
+	h.mu.Lock()
+	trigger := h.fired[key]
+	h.mu.Unlock()
+	now := time.Now().UTC()
+	if trigger == nil || now.Sub(trigger.FiredAt) > buttonWindow {
+		return "this reminder has expired", true
+	}
+	if !h.claim(trigger, now) {
+		return "already handled 👍", true
+	}
+
+	switch code {
+	case "done":
+		return h.handleDone(ctx, trigger)
+	case "s15":
+		return h.handleSnooze(ctx, trigger, "in 15m", now)
+	case "s60":
+		return h.handleSnooze(ctx, trigger, "in 1h", now)
+	case "tmr":
+		return h.snoozeUntil(ctx, trigger, trigger.FiredAt.In(h.loc).AddDate(0, 0, 1), now)
+	}
+	return "unknown action", true
+}
+
+// claim marks a trigger as handled; it reports false when it already was.
+func (h *QuickActionHandler) claim(trigger *TriggerRecord, now time.Time) bool {
+	key := triggerKey(trigger)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, done := h.processed[key]; done {
+		return false
+	}
+	h.processed[key] = now
+	// clean old entries
+	for k, t := range h.processed {
+		if now.Sub(t) > buttonWindow {
+			delete(h.processed, k)
+		}
+	}
+	return true
 }
 
 // TryHandle checks if the message is a quick action for a recently triggered task.
@@ -120,20 +256,9 @@ func (h *QuickActionHandler) TryHandle(ctx context.Context, text string) (string
 	}
 
 	// idempotency check
-	key := fmt.Sprintf("%s_%d", trigger.TaskID, trigger.FiredAt.UnixNano())
-	h.mu.Lock()
-	if _, done := h.processed[key]; done {
-		h.mu.Unlock()
+	if !h.claim(trigger, now) {
 		return "already handled 👍", true
 	}
-	h.processed[key] = now
-	// clean old entries
-	for k, t := range h.processed {
-		if now.Sub(t) > 10*time.Minute {
-			delete(h.processed, k)
-		}
-	}
-	h.mu.Unlock()
 
 	switch action.Type {
 	case ActionDone:
@@ -159,18 +284,42 @@ func (h *QuickActionHandler) handleSnooze(ctx context.Context, trigger *TriggerR
 	if err != nil {
 		return fmt.Sprintf("couldn't parse snooze time: %s", err), true
 	}
+	return h.snoozeUntil(ctx, trigger, t, now)
+}
+
+func (h *QuickActionHandler) snoozeUntil(ctx context.Context, trigger *TriggerRecord, t, now time.Time) (string, bool) {
 	if !t.After(now) {
 		return "snooze time must be in the future", true
 	}
 
 	// always create a new one-shot for snooze (preserves recurring series)
-	id, err := h.scheduler.AddOneShot(trigger.Prompt, t)
+	id, err := h.addOneShot(trigger, t)
 	if err != nil {
 		return fmt.Sprintf("snooze failed: %s", err), true
 	}
 
 	h.log.Info(ctx, "quick action: snooze", "task_id", trigger.TaskID, "new_id", id, "snooze_until", t)
-	return fmt.Sprintf("snoozed until %s ⏰", t.In(h.loc).Format("15:04")), true
+	return fmt.Sprintf("snoozed until %s ⏰", h.formatWhen(t, now)), true
+}
+
+// addOneShot schedules the prompt of trigger again at t, keeping its critical flag.
+func (h *QuickActionHandler) addOneShot(trigger *TriggerRecord, t time.Time) (string, error) {
+	id, err := h.scheduler.AddOneShot(trigger.Prompt, t)
+	if err != nil || !trigger.Critical {
+		return id, err
+	}
+	critical := true
+	return id, h.scheduler.Update(id, UpdateTaskInput{Critical: &critical})
+}
+
+// formatWhen renders t for a confirmation: the time alone when it is today,
+// with the date otherwise.
+func (h *QuickActionHandler) formatWhen(t, now time.Time) string {
+	t, now = t.In(h.loc), now.In(h.loc)
+	if t.YearDay() == now.YearDay() && t.Year() == now.Year() {
+		return t.Format("15:04")
+	}
+	return t.Format("2006-01-02 15:04")
 }
 
 func (h *QuickActionHandler) handleReschedule(ctx context.Context, trigger *TriggerRecord, rawTime string, now time.Time) (string, bool) {
@@ -189,14 +338,14 @@ func (h *QuickActionHandler) handleReschedule(ctx context.Context, trigger *Trig
 			return fmt.Sprintf("reschedule failed: %s", err), true
 		}
 		h.log.Info(ctx, "quick action: reschedule recurring", "task_id", trigger.TaskID, "new_time", t)
-		return fmt.Sprintf("rescheduled to %s ⏰", t.In(h.loc).Format("15:04")), true
+		return fmt.Sprintf("rescheduled to %s ⏰", h.formatWhen(t, now)), true
 	}
 
 	// one-shot was already deleted, create new one
-	id, err := h.scheduler.AddOneShot(trigger.Prompt, t)
+	id, err := h.addOneShot(trigger, t)
 	if err != nil {
 		return fmt.Sprintf("reschedule failed: %s", err), true
 	}
 	h.log.Info(ctx, "quick action: reschedule one-shot", "old_id", trigger.TaskID, "new_id", id, "new_time", t)
-	return fmt.Sprintf("rescheduled to %s ⏰", t.In(h.loc).Format("15:04")), true
+	return fmt.Sprintf("rescheduled to %s ⏰", h.formatWhen(t, now)), true
 }
@@ -281,3 +281,105 @@ func TestQuickActionHandler_DefaultSnooze(t *testing.T) {
 		t.Fatalf("snoozed task at %s, expected ~15m from now", list[0].NextRunAt)
 	}
 }
+
+func TestQuickActionHandler_Buttons(t *testing.T) {
+	tmp := t.TempDir()
+	s, err := New(filepath.Join(tmp, "scheduler"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewQuickActionHandler(s, time.UTC, testLogger{})
+	if buttons := h.Buttons("abc"); buttons != nil {
+		t.Fatalf("buttons before trigger: %+v", buttons)
+	}
+	taskID := "0b6f8e2c-8a3e-4d4b-9c55-1f2e3d4c5b6a"
+	h.RecordTrigger(Task{ID: taskID, Prompt: "stretch", Recurring: true, NextRunAt: time.Now().UTC()})
+
+	buttons := h.Buttons(taskID)
+	if len(buttons) != 4 {
+		t.Fatalf("buttons=%+v", buttons)
+	}
+	for _, b := range buttons {
+		if len(b.Data) > 64 {
+			t.Fatalf("callback data %q exceeds 64 bytes", b.Data)
+		}
+	}
+
+	// a later, unrelated trigger must not hijack the buttons of the first one
+	h.RecordTrigger(Task{ID: "other", Prompt: "water plants", NextRunAt: time.Now().UTC()})
+
+	reply, ok := h.HandleCallback(context.Background(), buttons[1].Data) // snooze 15m
+	if !ok || reply == "" {
+		t.Fatalf("reply=%q ok=%v", reply, ok)
+	}
+	list := s.List()
+	if len(list) != 1 || list[0].Prompt != "stretch" || list[0].Recurring {
+		t.Fatalf("snoozed tasks=%+v", list)
+	}
+	if until := time.Until(list[0].NextRunAt); until < 14*time.Minute || until > 16*time.Minute {
+		t.Fatalf("snoozed for %v, want 15m", until)
+	}
+
+	// pressing another button of the same reminder is a no-op
+	if reply, _ := h.HandleCallback(context.Background(), buttons[0].Data); reply != "already handled 👍" {
+		t.Fatalf("second press reply=%q", reply)
+	}
+}
+
+func TestQuickActionHandler_CallbackTomorrowAndUnknown(t *testing.T) {
+	tmp := t.TempDir()
+	s, err := New(filepath.Join(tmp, "scheduler"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewQuickActionHandler(s, time.UTC, testLogger{})
+	h.RecordTrigger(Task{ID: "abc", Prompt: "call mom", NextRunAt: time.Now().UTC(), Critical: true})
+	buttons := h.Buttons("abc")
+
+	if _, ok := h.HandleCallback(context.Background(), "something else"); ok {
+		t.Fatal("foreign callback data must not be handled")
+	}
+	if reply, ok := h.HandleCallback(context.Background(), "qa:done:abc:1"); !ok || reply != "this reminder has expired" {
+		t.Fatalf("unknown trigger reply=%q ok=%v", reply, ok)
+	}
+
+	reply, ok := h.HandleCallback(context.Background(), buttons[3].Data)
+	if !ok {
+		t.Fatal("expected handled")
+	}
+	list := s.List()
+	if len(list) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(list))
+	}
+	if until := time.Until(list[0].NextRunAt); until < 23*time.Hour || until > 25*time.Hour {
+		t.Fatalf("tomorrow snooze in %v", until)
+	}
+	if !list[0].Critical {
+		t.Fatal("the snoozed copy of a critical task must stay critical")
+	}
+	if want := "snoozed until " + list[0].NextRunAt.UTC().Format("2006-01-02 15:04") + " ⏰"; reply != want {
+		t.Fatalf("reply=%q want %q", reply, want)
+	}
+}
+
+func TestQuickActionHandler_MarkDone(t *testing.T) {
+	tmp := t.TempDir()
+	s, err := New(filepath.Join(tmp, "scheduler"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewQuickActionHandler(s, time.UTC, testLogger{})
+	if _, ok := h.MarkDone(context.Background(), "abc"); ok {
+		t.Fatal("task that never fired must not be handled")
+	}
+	h.RecordTrigger(Task{ID: "abc", Prompt: "stretch", NextRunAt: time.Now().UTC()})
+	if reply, ok := h.MarkDone(context.Background(), "abc"); !ok || reply != "done ✓" {
+		t.Fatalf("reply=%q ok=%v", reply, ok)
+	}
+	if reply, _ := h.TryHandle(context.Background(), "done"); reply != "already handled 👍" {
+		t.Fatalf("typed done after reaction: %q", reply)
+	}
+}
@@ -24,6 +24,7 @@ type Task struct {
 	NextRunAt       time.Time `json:"next_run_at"`
 	Recurring       bool      `json:"recurring"`
 	IntervalSeconds int64     `json:"interval_seconds,omitempty"`
+	Critical        bool      `json:"critical,omitempty"` // still runs when the daily usage budget is exhausted
 	CreatedAt       time.Time `json:"created_at"`
 }
 
@@ -59,6 +60,7 @@ type UpdateTaskInput struct {
 	RunAt           *time.Time
 	Recurring       *bool
 	IntervalSeconds *int64
+	Critical        *bool
 }
 
 func New(dataDir string, onTrigger func(context.Context, Task)) (*Scheduler, error) {
@@ -187,6 +189,9 @@ func (s *Scheduler) Update(taskID string, in UpdateTaskInput) error {
 			task.IntervalSeconds = 0
 		}
 	}
+	if in.Critical != nil {
+		task.Critical = *in.Critical
+	}
 	if task.Recurring && task.IntervalSeconds <= 0 {
 		return fmt.Errorf("recurring task requires interval_seconds > 0")
 	}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"visor/internal/agent"
+	"visor/internal/attachments"
+	"visor/internal/platform/telegram"
+)
+
+// downloadPhoto stores the photo size in the attachment store. It returns nil
+// without error when no store is configured.
+func (s *Server) downloadPhoto(ctx context.Context, msg *telegram.Message, photo telegram.PhotoSize) (*agent.Attachment, error) {
+	if s.attachments == nil {
+		return nil, nil
+	}
+	body, name, err := s.tg.DownloadFile(ctx, photo.FileID)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	ext := filepath.Ext(name)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	path, err := s.attachments.Save(msg.Chat.ID, msg.MessageID, "photo"+ext, body)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info(ctx, "photo stored", "chat_id", msg.Chat.ID, "message_id", msg.MessageID, "path", path, "width", photo.Width, "height", photo.Height)
+	return &agent.Attachment{Kind: "image", Path: path}, nil
+}
+
+// rememberCommand at the start of a document caption saves the document to memory.
+const rememberCommand = "/remember"
+
+// receiveDocument stores a document, extracts its text and, when the caption
+// starts with /remember, saves the text to memory. It returns the message
+// content for the agent: the stored path, the caption and an excerpt.
+func (s *Server) receiveDocument(ctx context.Context, msg *telegram.Message) (string, *agent.Attachment) {
+	doc := msg.Document
+	caption := strings.TrimSpace(msg.Caption)
+	remember := false
+	if fields := strings.Fields(caption); len(fields) > 0 && strings.EqualFold(fields[0], rememberCommand) {
+		remember = true
+		caption = strings.TrimSpace(caption[len(fields[0]):])
+	}
+	label := doc.FileName
+	if label == "" {
+		label = doc.FileID
+	}
+
+	path, err := s.downloadDocument(ctx, msg)
+	if err != nil || path == "" {
+		if err != nil {
+			s.log.Warn(ctx, "document download failed, passing file id", "chat_id", msg.Chat.ID, "error", err.Error())
+		}
+		return strings.TrimSpace(fmt.Sprintf("[document:%s] %s %s", doc.FileID, doc.FileName, caption)), nil
+	}
+	att := &agent.Attachment{Kind: "document", Path: path, MIMEType: doc.MimeType}
+
+	lines := []string{strings.TrimSpace(fmt.Sprintf("[document: %s] %s", path, caption))}
+	x, err := attachments.Extractor{PDFToText: s.cfg.PDFToTextBin}.Extract(ctx, path, doc.MimeType)
+	switch {
+	case err != nil:
+		s.log.Warn(ctx, "document text extraction failed", "chat_id", msg.Chat.ID, "path", path, "error", err.Error())
+		lines = append(lines, fmt.Sprintf("[no text extracted: %s]", err))
+	case x.Format == "pdf":
+		textPath, saveErr := s.attachments.Save(msg.Chat.ID, msg.MessageID, filepath.Base(path)+".txt", strings.NewReader(x.Text))
+		if saveErr != nil {
+			s.log.Warn(ctx, "extracted text not stored", "path", path, "error", saveErr.Error())
+			lines = append(lines, fmt.Sprintf("[extracted text: %d chars]", len(x.Text)))
+		} else {
+			lines = append(lines, fmt.Sprintf("[extracted text: %s, %d chars]", textPath, len(x.Text)))
+		}
+	case x.Format == "csv":
+		lines = append(lines, fmt.Sprintf("[csv: %d rows, %d columns]", x.Rows, x.Columns))
+	default:
+		lines = append(lines, fmt.Sprintf("[text: %d chars]", len(x.Text)))
+	}
+	if x.Preview != "" {
+		lines = append(lines, x.Preview)
+	}
+
+	if remember {
+		lines = append(lines, s.rememberDocument(ctx, label, x.Text, err))
+	}
+	s.log.Info(ctx, "document stored", "chat_id", msg.Chat.ID, "message_id", msg.MessageID, "path", path, "mime_type", doc.MimeType, "format", x.Format, "remember", remember)
+	return strings.Join(lines, "\n"), att
+}
+
+// downloadDocument stores the document in the attachment store under its
+// file name. It returns "" without error when no store is configured.
+func (s *Server) downloadDocument(ctx context.Context, msg *telegram.Message) (string, error) {
+	if s.attachments == nil {
+		return "", nil
+	}
+	doc := msg.Document
+	if doc.FileSize > attachments.MaxFileBytes {
+		return "", fmt.Errorf("document of %d bytes exceeds the bot api download limit of %d bytes", doc.FileSize, attachments.MaxFileBytes)
+	}
+	body, name, err := s.tg.DownloadFile(ctx, doc.FileID)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	if doc.FileName != "" {
+		name = doc.FileName
+	}
+	if name == "" {
+		name = "document"
+	}
+	return s.attachments.Save(msg.Chat.ID, msg.MessageID, name, body)
+}
+
+// rememberDocument saves extracted text to memory and returns a line telling
+// the agent how it went.
+func (s *Server) rememberDocument(ctx context.Context, source, text string, extractErr error) string {
+	switch {
+	case extractErr != nil || strings.TrimSpace(text) == "":
+		return "[not remembered: no text to save]"
+	case s.memory == nil:
+		return "[not remembered: memory needs OPENAI_API_KEY]"
+	}
+	n, err := s.memory.SaveDocument(source, text)
+	if err != nil {
+		s.log.Error(ctx, "document memory save failed", "source", source, "error", err.Error())
+		return "[not remembered: saving to memory failed]"
+	}
+	return fmt.Sprintf("[remembered: %d chunks of %s saved to memory]", n, source)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"visor/internal/agent"
+	"visor/internal/platform/telegram"
+	"visor/internal/setup"
+)
+
+// replayServer wires a server to a recorded cassette and a fake telegram api
+// that collects every sent message.
+func replayServer(t *testing.T, cassette string) (*Server, <-chan string) {
+	t.Helper()
+	texts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			t.Errorf("unexpected telegram call %s", r.URL.Path)
+		}
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	replay, err := agent.NewCassetteAgent(agent.CassetteConfig{Path: cassette, Mode: agent.CassetteReplay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig("")
+	cfg.AgentBackend = "cassette"
+	cfg.DataDir = t.TempDir()
+	// runs before the temp dir is removed: the queue journal is cleared only
+	// after the reply was sent
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, replay)
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{} // the sandbox has no .env; keep setup hints out of the prompt
+	return srv, texts
+}
+
+func waitJournalDrained(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var pending []json.RawMessage
+		data, err := os.ReadFile(path)
+		if err == nil && json.Unmarshal(data, &pending) == nil && len(pending) == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("queue journal %s not drained", path)
+}
+
+func nextText(t *testing.T, texts <-chan string) string {
+	t.Helper()
+	select {
+	case got := <-texts:
+		return got
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for telegram sendMessage call")
+		return ""
+	}
+}
+
+func TestWebhook_CassetteReplay_ExecutesScheduleActions(t *testing.T) {
+	srv, texts := replayServer(t, "testdata/cassettes/webhook_e2e.jsonl")
+
+	if w := postWebhook(srv, makeUpdate(3001, 12345, "remind me to stretch tomorrow at 9"), nil); w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	got := nextText(t, texts)
+	for _, want := range []string{"sure, i'll remind you tomorrow at 9.", "scheduled ✅ id=", "· cassette"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("reply=%q want %q", got, want)
+		}
+	}
+	if strings.Contains(got, "schedule_actions") {
+		t.Fatalf("reply leaked the action block: %q", got)
+	}
+	tasks := srv.scheduler.List()
+	if len(tasks) != 1 || tasks[0].Prompt != "stretch reminder" {
+		t.Fatalf("scheduled tasks=%+v", tasks)
+	}
+}
+
+func TestWebhook_CassetteReplay_VoiceFallsBackToText(t *testing.T) {
+	srv, texts := replayServer(t, "testdata/cassettes/webhook_e2e.jsonl")
+
+	// send_voice is requested but tts is not configured: the reply goes out as
+	// text and the contract metadata is stripped
+	if w := postWebhook(srv, makeUpdate(3003, 12345, "say good night"), nil); w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	got := nextText(t, texts)
+	if !strings.HasPrefix(got, "good night, sleep well!") {
+		t.Fatalf("reply=%q", got)
+	}
+	for _, leaked := range []string{"send_voice", "memories_to_save", "---"} {
+		if strings.Contains(got, leaked) {
+			t.Fatalf("reply leaked %q: %q", leaked, got)
+		}
+	}
+}
+
+func TestWebhook_CassetteReplay_NormalizedPromptMatch(t *testing.T) {
+	srv, texts := replayServer(t, "testdata/cassettes/webhook_e2e.jsonl")
+
+	// recorded for another date; dates and case are normalized away
+	if w := postWebhook(srv, makeUpdate(3002, 12345, "What is on my calendar for 2026-10-17?"), nil); w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	if got := nextText(t, texts); !strings.HasPrefix(got, "nothing scheduled for that day.") {
+		t.Fatalf("reply=%q", got)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+
+	"visor/internal/agent"
+	"visor/internal/orchestrator"
+)
+
+const (
+	// fanoutMessageType marks the follow-up prompt carrying merged subagent results.
+	fanoutMessageType = "fanout"
+	// subagentUsageType marks ledger entries of the station calls themselves.
+	subagentUsageType = "subagent"
+)
+
+// runFanout dispatches tasks to subagent stations, reports a summary, and feeds
+// the merged results back to the main agent as a follow-up prompt. ctx must not
+// carry the turn that requested the fan-out (see observability.Detach):
+// stations get a self-contained prompt without the chat's history or tools.
+func (s *Server) runFanout(ctx context.Context, chatID int64, original string, tasks []orchestrator.Task) {
+	s.log.Info(ctx, "subagent fan-out started", "chat_id", chatID, "tasks", len(tasks))
+	results := s.orchestrator.Fanout(ctx, tasks)
+	var used []agent.Usage
+	for _, r := range results {
+		used = append(used, r.Usage...)
+	}
+	s.recordUsageEntries(ctx, chatID, subagentUsageType, used)
+
+	if err := s.tg.SendMessage(chatID, orchestrator.Summary(results)); err != nil {
+		s.log.Warn(ctx, "fan-out summary failed", "chat_id", chatID, "error", err.Error())
+	}
+
+	s.agent.Enqueue(ctx, agent.Message{
+		ChatID:  chatID,
+		Content: orchestrator.MergePrompt(original, results),
+		Type:    fanoutMessageType,
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"visor/internal/agent"
+	"visor/internal/platform/telegram"
+)
+
+// quickActionMarkup returns the inline keyboard for the reply of a scheduled
+// turn, or nil for every other reply.
+func (s *Server) quickActionMarkup(ctx context.Context) *telegram.InlineKeyboardMarkup {
+	turn := agent.TurnFromContext(ctx)
+	if s.quickActions == nil || turn == nil || turn.Message.Type != "scheduled" || turn.Message.TaskID == "" {
+		return nil
+	}
+	buttons := s.quickActions.Buttons(turn.Message.TaskID)
+	if len(buttons) == 0 {
+		return nil
+	}
+	markup := &telegram.InlineKeyboardMarkup{}
+	for i, b := range buttons {
+		if i%2 == 0 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, nil)
+		}
+		row := &markup.InlineKeyboard[len(markup.InlineKeyboard)-1]
+		*row = append(*row, telegram.InlineKeyboardButton{Text: b.Label, CallbackData: b.Data})
+	}
+	return markup
+}
+
+// handleCallbackQuery runs the quick action of a pressed reminder button,
+// appends the outcome to the reminder and removes its keyboard.
+func (s *Server) handleCallbackQuery(ctx context.Context, cq *telegram.CallbackQuery) {
+	var chatID int64
+	switch {
+	case cq.Message != nil:
+		chatID = cq.Message.Chat.ID
+	case cq.From != nil:
+		chatID = cq.From.ID
+	}
+	if strconv.FormatInt(chatID, 10) != s.cfg.UserChatID {
+		s.log.Warn(ctx, "callback query from unauthorized chat", "chat_id", chatID)
+		_ = s.tg.AnswerCallbackQuery(cq.ID, "")
+		return
+	}
+
+	reply, handled := "", false
+	if s.quickActions != nil {
+		reply, handled = s.quickActions.HandleCallback(ctx, cq.Data)
+	}
+	if !handled {
+		s.log.Warn(ctx, "callback query not handled", "chat_id", chatID, "data", cq.Data)
+		if err := s.tg.AnswerCallbackQuery(cq.ID, "unknown button"); err != nil {
+			s.log.Warn(ctx, "answer callback query failed", "chat_id", chatID, "error", err.Error())
+		}
+		return
+	}
+	s.log.Info(ctx, "quick action handled", "chat_id", chatID, "reply", reply, "source", "button")
+
+	if cq.Message != nil {
+		text := strings.TrimSpace(cq.Message.Text + "\n\n" + reply)
+		if err := s.tg.EditMessageTextWithMarkup(chatID, cq.Message.MessageID, text, nil); err != nil {
+			s.log.Warn(ctx, "quick action message edit failed", "chat_id", chatID, "message_id", cq.Message.MessageID, "error", err.Error())
+		}
+	}
+	if err := s.tg.AnswerCallbackQuery(cq.ID, reply); err != nil {
+		s.log.Warn(ctx, "answer callback query failed", "chat_id", chatID, "error", err.Error())
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"visor/internal/agent"
+	"visor/internal/observability"
+	"visor/internal/platform/telegram"
+)
+
+// maxTrackedReplies bounds how many sent replies can still be reacted to.
+const maxTrackedReplies = 500
+
+// reactionMessageType is the message type reaction skills run with.
+const reactionMessageType = "reaction"
+
+// telegramAllowedUpdates are the update types visor asks telegram for, on the
+// webhook and in polling mode. message_reaction is not sent by default.
+var telegramAllowedUpdates = []string{"message", "callback_query", "message_reaction"}
+
+// sentReply is what visor sent as a telegram message, so that reactions on
+// that message can be acted on.
+type sentReply struct {
+	taskID string // scheduler task the reply belongs to, empty for answers
+	prompt string // the message that was answered
+	answer string // the reply without the metrics footer
+	text   string // the message text as sent
+}
+
+type replyKey struct {
+	chatID    int64
+	messageID int
+}
+
+// replyTracker maps telegram message ids to the replies they carry. It keeps
+// the most recent maxTrackedReplies in memory only: after a restart, reactions
+// to replies sent before it are ignored.
+type replyTracker struct {
+	mu      sync.Mutex
+	replies map[replyKey]sentReply
+	order   []replyKey
+}
+
+func newReplyTracker() *replyTracker {
+	return &replyTracker{replies: make(map[replyKey]sentReply)}
+}
+
+func (t *replyTracker) record(chatID int64, messageID int, r sentReply) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := replyKey{chatID: chatID, messageID: messageID}
+	if _, ok := t.replies[key]; !ok {
+		t.order = append(t.order, key)
+	}
+	t.replies[key] = r
+	for len(t.order) > maxTrackedReplies {
+		delete(t.replies, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+func (t *replyTracker) lookup(chatID int64, messageID int) (sentReply, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.replies[replyKey{chatID: chatID, messageID: messageID}]
+	return r, ok
+}
+
+// trackReply remembers the reply of the turn in ctx under its message id.
+func (s *Server) trackReply(ctx context.Context, chatID int64, messageID int, answer, text string) {
+	if messageID == 0 {
+		return
+	}
+	r := sentReply{answer: answer, text: text}
+	if turn := agent.TurnFromContext(ctx); turn != nil {
+		r.prompt = turn.Message.Content
+		if turn.Message.Type == "scheduled" {
+			r.taskID = turn.Message.TaskID
+		}
+	}
+	s.replies.record(chatID, messageID, r)
+}
+
+// handleReaction acts on reactions the user adds to visor's replies: a
+// mapped emoji runs its skill on the reply, 👍 on a reminder marks it done
+// and 👎 on an answer asks the agent to retry.
+func (s *Server) handleReaction(ctx context.Context, r *telegram.MessageReaction) {
+	chatID := strconv.FormatInt(r.Chat.ID, 10)
+	if chatID != s.cfg.UserChatID {
+		s.log.Warn(ctx, "reaction from unauthorized chat", "chat_id", chatID)
+		return
+	}
+	reply, ok := s.replies.lookup(r.Chat.ID, r.MessageID)
+	if !ok {
+		s.log.Debug(ctx, "reaction on untracked message", "chat_id", chatID, "message_id", r.MessageID)
+		return
+	}
+
+	for _, reaction := range r.Added() {
+		emoji := reaction.Emoji
+		if reaction.Type == "custom_emoji" {
+			emoji = reaction.CustomEmojiID
+		}
+		if skill, ok := s.cfg.TelegramReactionSkills[emoji]; ok {
+			// skills may run for a while; the webhook is answered right away
+			go s.runReactionSkill(observability.Detach(ctx), r.Chat.ID, skill, reply)
+			continue
+		}
+		switch {
+		case emoji == "👍" && reply.taskID != "" && s.quickActions != nil:
+			note, ok := s.quickActions.MarkDone(ctx, reply.taskID)
+			if !ok {
+				s.log.Debug(ctx, "reaction on expired reminder", "chat_id", chatID, "task_id", reply.taskID)
+				continue
+			}
+			s.log.Info(ctx, "quick action handled", "chat_id", chatID, "reply", note, "source", "reaction")
+			text := strings.TrimSpace(reply.text + "\n\n" + note)
+			if err := s.tg.EditMessageTextWithMarkup(r.Chat.ID, r.MessageID, text, nil); err != nil {
+				s.log.Warn(ctx, "quick action message edit failed", "chat_id", chatID, "message_id", r.MessageID, "error", err.Error())
+			}
+		case emoji == "👎" && reply.taskID == "":
+			s.log.Info(ctx, "negative reaction, retrying answer", "chat_id", chatID, "message_id", r.MessageID)
+			// detached: the retry must outlive the webhook request
+			s.agent.Enqueue(observability.Detach(ctx), agent.Message{
+				ChatID:  r.Chat.ID,
+				Content: "[feedback] the user reacted 👎 to your answer: that was wrong, retry.\n\n[original message]\n" + reply.prompt,
+				Type:    "text",
+				ReplyTo: reply.answer,
+			})
+		default:
+			s.log.Debug(ctx, "reaction ignored", "chat_id", chatID, "emoji", emoji)
+		}
+	}
+}
+
+// runReactionSkill runs skill with the reacted-to reply as input and sends
+// its output.
+func (s *Server) runReactionSkill(ctx context.Context, chatID int64, skill string, reply sentReply) {
+	out, err := s.runSkill(ctx, skill, reply.answer, strconv.FormatInt(chatID, 10), reactionMessageType)
+	if err != nil {
+		s.log.Error(ctx, "reaction skill failed", "skill", skill, "error", err.Error())
+		out = "skill " + skill + " failed: " + err.Error()
+	} else {
+		s.log.Info(ctx, "reaction skill ran", "skill", skill, "output_len", len(out))
+	}
+	if strings.TrimSpace(out) == "" {
+		return
+	}
+	if err := s.tg.SendMessage(chatID, out); err != nil {
+		s.log.Error(ctx, "reaction skill reply failed", "chat_id", chatID, "error", err.Error())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/hmac"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,20 +12,24 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"visor/internal/agent"
 	"visor/internal/agent/contract"
+	"visor/internal/attachments"
 	"visor/internal/config"
 	"visor/internal/forgejo"
 	"visor/internal/memory"
 	"visor/internal/observability"
+	"visor/internal/orchestrator"
 	"visor/internal/platform/telegram"
 	"visor/internal/scheduler"
 	"visor/internal/selfevolve"
 	"visor/internal/setup"
 	"visor/internal/skills"
+	"visor/internal/usage"
 	"visor/internal/voice"
 )
 
@@ -40,12 +45,21 @@ type Server struct {
 	quickActions              *scheduler.QuickActionHandler
 	skills                    *skills.Manager
 	selfevolver               *selfevolve.Manager
+	orchestrator              *orchestrator.Orchestrator
+	usage                     *usage.Ledger
+	budgetMu                  sync.Mutex
+	budgetSwitched            bool // registry pinned to UsageBudgetBackend for the day
+	location                  *time.Location
 	setupState                setup.State
 	log                       *observability.Logger
 	memoryLookupFailureStreak atomic.Int64
 	responseValidationPass    atomic.Int64
 	responseValidationFail    atomic.Int64
 	responseAutofixApplied    atomic.Int64
+	liveMu                    sync.Mutex
+	liveReplies               map[string]*liveReply // turn id -> streamed message
+	replies                   *replyTracker         // sent replies reactions can refer to
+	attachments               *attachments.Store    // downloaded photos and documents, nil without DATA_DIR
 }
 
 var voiceTagPattern = regexp.MustCompile(`\[(excited|curious|thoughtful|laughs|sighs|whispers)\]`)
@@ -54,11 +68,13 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 	tg := telegram.NewClient(cfg.TelegramBotToken)
 
 	s := &Server{
-		cfg:   cfg,
-		mux:   http.NewServeMux(),
-		tg:    tg,
-		dedup: telegram.NewDedup(5 * time.Minute),
-		log:   observability.Component("server"),
+		cfg:         cfg,
+		mux:         http.NewServeMux(),
+		tg:          tg,
+		dedup:       telegram.NewDedup(5 * time.Minute),
+		log:         observability.Component("server"),
+		liveReplies: make(map[string]*liveReply),
+		replies:     newReplyTracker(),
 	}
 
 	if cfg.OpenAIAPIKey != "" {
@@ -80,6 +96,15 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 		}
 	}
 
+	if cfg.DataDir != "" {
+		store, err := attachments.Open(cfg.DataDir+"/attachments", cfg.AttachmentsRetention)
+		if err != nil {
+			s.log.Warn(context.Background(), "attachment store init failed, photos and documents are passed by file id", "error", err.Error())
+		} else {
+			s.attachments = store
+		}
+	}
+
 	// skill manager
 	sm := skills.NewManager(cfg.DataDir + "/skills")
 	if loadErr := sm.Reload(); loadErr != nil {
@@ -105,6 +130,15 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 	}
 
 	s.agent = agent.NewQueuedAgent(a, cfg.AgentBackend, func(ctx context.Context, chatID int64, response string, err error, duration time.Duration) {
+		s.recordUsage(ctx)
+		if errors.Is(err, context.Canceled) {
+			// the /cancel reply already told the user; just close a streamed preview.
+			s.log.Info(ctx, "agent prompt canceled", "chat_id", chatID)
+			if live := s.takeLiveReply(ctx); live != nil {
+				_ = s.tg.EditMessageText(chatID, live.messageID, strings.TrimSuffix(live.lastText, " ▍")+"\n\n🛑 canceled")
+			}
+			return
+		}
 		if err != nil {
 			s.log.Error(ctx, "agent processing failed", "chat_id", chatID, "backend", cfg.AgentBackend, "error", err.Error())
 			response = fmt.Sprintf("error: %v", err)
@@ -135,6 +169,26 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 			}
 		}
 
+		// subagent fan-out requested by the agent; follow-ups never fan out again
+		if s.orchestrator != nil {
+			clean, subagentActions, parseErr := orchestrator.ExtractActions(response)
+			if parseErr != nil {
+				s.log.Error(ctx, "subagent action parse failed", "chat_id", chatID, "error", parseErr.Error())
+			} else if subagentActions != nil {
+				response = clean
+				turn := agent.TurnFromContext(ctx)
+				if turn != nil && turn.Message.Type == fanoutMessageType {
+					s.log.Warn(ctx, "nested subagent fan-out ignored", "chat_id", chatID)
+				} else if len(subagentActions.Tasks) > 0 {
+					original := ""
+					if turn != nil {
+						original = messagePreview(turn.Message)
+					}
+					go s.runFanout(observability.Detach(ctx), chatID, original, subagentActions.Tasks)
+				}
+			}
+		}
+
 		clean, setupActions, parseErr := setup.ExtractActions(response)
 		if parseErr != nil {
 			s.log.Error(ctx, "setup action parse failed", "chat_id", chatID, "error", parseErr.Error())
@@ -167,27 +221,37 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 		}
 
 		plainText := stripVoiceTags(text)
+		if turn := agent.TurnFromContext(ctx); turn != nil {
+			turn.SetReply(plainText)
+		}
 		if plainText == "" {
 			plainText = "ok"
 		}
-		textWithMetrics := strings.TrimSpace(plainText + "\n\n⏱ " + formatDuration(duration) + " · " + s.agent.CurrentBackend())
+		textWithMetrics := strings.TrimSpace(plainText + "\n\n⏱ " + formatDuration(duration) + " · " + s.replyBackendLabel(ctx))
+		live := s.takeLiveReply(ctx)
+		markup := s.quickActionMarkup(ctx)
 
 		sendAsVoice := shouldSendVoice(meta, text) && s.voice != nil && s.voice.TTSEnabled()
 		if sendAsVoice {
 			if err := s.voice.SynthesizeAndSend(chatID, plainText); err != nil {
 				s.log.Error(ctx, "voice synth failed, fallback to text", "chat_id", chatID, "error", err.Error())
-				if sendErr := s.tg.SendMessage(chatID, textWithMetrics); sendErr != nil {
+				if msgID, sendErr := s.sendFinalReply(ctx, chatID, live, textWithMetrics, markup); sendErr != nil {
 					s.log.Error(ctx, "send reply failed", "chat_id", chatID, "error", sendErr.Error())
 				} else {
+					s.trackReply(ctx, chatID, msgID, plainText, textWithMetrics)
 					s.log.Info(ctx, "webhook reply sent", "chat_id", chatID, "mode", "text-fallback")
 				}
 			} else {
+				if live != nil {
+					_ = s.tg.DeleteMessage(chatID, live.messageID)
+				}
 				s.log.Info(ctx, "webhook reply sent", "chat_id", chatID, "mode", "voice")
 			}
 		} else {
-			if sendErr := s.tg.SendMessage(chatID, textWithMetrics); sendErr != nil {
+			if msgID, sendErr := s.sendFinalReply(ctx, chatID, live, textWithMetrics, markup); sendErr != nil {
 				s.log.Error(ctx, "send reply failed", "chat_id", chatID, "error", sendErr.Error())
 			} else {
+				s.trackReply(ctx, chatID, msgID, plainText, textWithMetrics)
 				s.log.Info(ctx, "webhook reply sent", "chat_id", chatID, "mode", "text")
 			}
 		}
@@ -206,6 +270,44 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 			}
 		}
 	})
+	s.agent.SetMaxConcurrency(cfg.AgentMaxConcurrency)
+	if cfg.DataDir != "" {
+		journal, err := agent.NewJournal(cfg.DataDir+"/agent-queue", cfg.AgentQueueMaxAttempts)
+		if err != nil {
+			s.log.Warn(context.Background(), "agent queue journal init failed, queue is memory-only", "error", err.Error())
+		} else {
+			s.agent.SetJournal(journal)
+		}
+	}
+	if cfg.AgentHistoryTurns > 0 {
+		historyDir := ""
+		if cfg.DataDir != "" {
+			historyDir = cfg.DataDir + "/agent-history"
+		}
+		history, err := agent.NewHistory(historyDir, cfg.AgentHistoryTurns, cfg.AgentHistoryTokens)
+		if err != nil {
+			s.log.Warn(context.Background(), "conversation history load failed, history is memory-only", "error", err.Error())
+			history, _ = agent.NewHistory("", cfg.AgentHistoryTurns, cfg.AgentHistoryTokens)
+		}
+		s.agent.SetHistory(history)
+	}
+	s.agent.SetToolbox(&visorTools{s: s})
+	s.agent.SetPromptHook(s.buildPrompt)
+	s.agent.SetPromptBudget(cfg.AgentPromptTokens, cfg.AgentPromptSections)
+	s.agent.SetCoalesceWindow(cfg.AgentCoalesceWindow)
+	s.agent.SetSteering(agent.SteerMode(cfg.AgentSteering), func(ctx context.Context, msg agent.Message, mode agent.SteerMode) {
+		note := "↪ added to the running turn"
+		if mode == agent.SteerFollowUp {
+			note = "↪ added to the running turn as a follow-up"
+		}
+		if err := s.tg.SendMessage(msg.ChatID, note); err != nil {
+			s.log.Warn(ctx, "steering notification failed", "chat_id", msg.ChatID, "error", err.Error())
+		}
+	})
+	if cfg.StreamReplies {
+		s.agent.SetStreamInterval(cfg.StreamEditInterval)
+		s.agent.SetStreamHandler(s.streamReply)
+	}
 	s.agent.SetLongRunningHandler(func(ctx context.Context, chatID int64, elapsed time.Duration, preview string) {
 		note := fmt.Sprintf("⏳ request läuft seit %s\n\naktueller rpc output:\n`%s`", formatDuration(elapsed), escapeTelegramCode(preview))
 		if err := s.tg.SendMessage(chatID, note); err != nil {
@@ -219,11 +321,15 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 		if s.quickActions != nil {
 			s.quickActions.RecordTrigger(task)
 		}
+		if !s.allowScheduled(ctx, task) {
+			return
+		}
 		content := buildScheduledTaskContent(task, s.cfg.Timezone, time.Now())
 		s.agent.Enqueue(ctx, agent.Message{
 			ChatID:  mustParseChatID(cfg.UserChatID),
 			Content: content,
 			Type:    "scheduled",
+			TaskID:  task.ID,
 		})
 	})
 	if err != nil {
@@ -236,8 +342,27 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 		s.log.Warn(context.Background(), "invalid timezone, defaulting to UTC", "tz", cfg.Timezone, "error", locErr.Error())
 		loc = time.UTC
 	}
+	s.location = loc
 	s.quickActions = scheduler.NewQuickActionHandler(schedulerInstance, loc, s.log)
 
+	if cfg.DataDir != "" {
+		prices, pricesErr := usage.LoadPrices(cfg.UsagePricesFile)
+		if pricesErr != nil {
+			s.log.Warn(context.Background(), "usage price table load failed, costs are not estimated", "path", cfg.UsagePricesFile, "error", pricesErr.Error())
+			prices = usage.PriceTable{}
+		}
+		ledger, ledgerErr := usage.Open(cfg.DataDir+"/usage", prices, usage.Budget{
+			WarnUSD:   cfg.UsageDailyWarnUSD,
+			SwitchUSD: cfg.UsageDailySwitchUSD,
+			LimitUSD:  cfg.UsageDailyLimitUSD,
+		})
+		if ledgerErr != nil {
+			s.log.Warn(context.Background(), "usage ledger init failed", "error", ledgerErr.Error())
+		} else {
+			s.usage = ledger
+		}
+	}
+
 	projectRoot := cfg.SelfEvolutionRepoDir
 	if strings.TrimSpace(projectRoot) == "" {
 		projectRoot = "."
@@ -256,28 +381,85 @@ func New(cfg *config.Config, a agent.Agent) *Server {
 	s.mux.HandleFunc("GET /health/scheduler", s.handleSchedulerHealth)
 	s.mux.HandleFunc("POST /webhook", s.handleWebhook)
 	s.mux.HandleFunc("POST /forgejo/webhook", s.handleForgejoWebhook)
+	if cfg.DebugPromptDump {
+		// the dump carries memory and history, so it is only served to callers knowing the webhook secret
+		if cfg.TelegramWebhookSecret == "" {
+			s.log.Warn(context.Background(), "prompt dump disabled, it needs TELEGRAM_WEBHOOK_SECRET to authenticate requests")
+		} else {
+			s.mux.HandleFunc("GET /debug/prompt", s.handlePromptDump)
+		}
+	}
 	return s
 }
 
+// SetOrchestrator enables subagent fan-out (/fanout and agent subagent_actions).
+func (s *Server) SetOrchestrator(o *orchestrator.Orchestrator) {
+	s.orchestrator = o
+}
+
 func (s *Server) ListenAndServe() error {
 	addr := fmt.Sprintf(":%d", s.cfg.Port)
-	s.log.Info(context.Background(), "server starting", "addr", addr, "log_level", s.cfg.LogLevel, "log_verbose", s.cfg.LogVerbose)
+	s.log.Info(context.Background(), "server starting", "addr", addr, "telegram_mode", s.cfg.TelegramMode, "log_level", s.cfg.LogLevel, "log_verbose", s.cfg.LogVerbose)
+
+	// replay before starting the scheduler and accepting webhooks so
+	// journaled messages keep their order
+	replayed, deadLettered := s.agent.Replay(context.Background())
+	if replayed > 0 || deadLettered > 0 {
+		s.log.Info(context.Background(), "agent queue replayed", "replayed", replayed, "dead_lettered", deadLettered)
+	}
 
 	if s.scheduler != nil {
 		go s.scheduler.Start(context.Background())
 		s.log.Info(context.Background(), "scheduler started")
 	}
 
-	s.notifyStartup(context.Background())
+	s.notifyStartup(context.Background(), replayed, deadLettered)
+
+	if s.cfg.TelegramMode == "polling" {
+		go s.poll(context.Background())
+	}
 
 	handler := observability.RequestIDMiddleware(observability.RecoverMiddleware("http", s.mux))
 	return http.ListenAndServe(addr, handler)
 }
 
-func (s *Server) notifyStartup(ctx context.Context) {
+// poll receives telegram updates with getUpdates instead of the webhook. The
+// http server keeps running for health checks and the forgejo webhook.
+func (s *Server) poll(ctx context.Context) {
+	var offsetFile string
+	if s.cfg.DataDir != "" {
+		offsetFile = s.cfg.DataDir + "/telegram/poll-offset"
+	}
+	poller := telegram.NewPoller(s.tg, telegram.PollerConfig{
+		Timeout:        s.cfg.TelegramPollTimeout,
+		AllowedUpdates: telegramAllowedUpdates,
+		OffsetFile:     offsetFile,
+	})
+	_ = poller.Run(ctx, s.handlePolledUpdate)
+}
+
+func (s *Server) handlePolledUpdate(ctx context.Context, update telegram.Update) {
+	ctx, span := observability.StartSpan(ctx, "telegram.poll_update")
+	defer span.End()
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.log.Error(ctx, "panic recovered", "panic", fmt.Sprintf("%v", rec), "update_id", update.UpdateID)
+		}
+	}()
+	s.log.Debug(ctx, "webhook lifecycle", "stage", "polled", "update_id", update.UpdateID)
+	s.handleUpdate(ctx, update)
+}
+
+func (s *Server) notifyStartup(ctx context.Context, replayed, deadLettered int) {
 	chatID := mustParseChatID(s.cfg.UserChatID)
 	rev := currentShortRevision(s.cfg.SelfEvolutionRepoDir)
 	msg := fmt.Sprintf("🎺 visor restarted — rev `%s`", rev)
+	if replayed > 0 {
+		msg += fmt.Sprintf("\n↻ %d queued message(s) resumed", replayed)
+	}
+	if deadLettered > 0 {
+		msg += fmt.Sprintf("\n☠️ %d message(s) moved to dead-letter after repeated failures", deadLettered)
+	}
 	if err := s.tg.SendMessage(chatID, msg); err != nil {
 		s.log.Warn(ctx, "startup notification failed", "chat_id", chatID, "error", err.Error())
 		return
@@ -324,6 +506,36 @@ func (s *Server) handleSchedulerHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handlePromptDump returns the last prompt sent for ?chat_id= (default: the
+// user chat), section by section. Requests must carry the webhook secret in the
+// X-Telegram-Bot-Api-Secret-Token header.
+func (s *Server) handlePromptDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !verifySignature(r.Header.Get("X-Telegram-Bot-Api-Secret-Token"), s.cfg.TelegramWebhookSecret) {
+		s.log.Warn(r.Context(), "prompt dump request unauthorized", "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return
+	}
+	chatID := s.cfg.UserChatID
+	if v := r.URL.Query().Get("chat_id"); v != "" {
+		chatID = v
+	}
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid chat_id"})
+		return
+	}
+	dump, ok := s.agent.LastPrompt(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "no prompt sent for this chat yet"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(dump)
+}
+
 func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	ctx, span := observability.StartSpan(r.Context(), "webhook.handle")
 	defer span.End()
@@ -354,37 +566,51 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 	s.log.Debug(r.Context(), "webhook lifecycle", "stage", "parsed", "update_id", update.UpdateID)
 
+	s.handleUpdate(r.Context(), update)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUpdate runs one telegram update, from the webhook or the poller,
+// through dedup, authorization, quick actions, commands and the agent queue.
+func (s *Server) handleUpdate(ctx context.Context, update telegram.Update) {
 	if s.dedup.IsDuplicate(update.UpdateID) {
-		s.log.Debug(r.Context(), "webhook lifecycle", "stage", "deduped", "result", "duplicate", "update_id", update.UpdateID)
-		w.WriteHeader(http.StatusOK)
+		s.log.Debug(ctx, "webhook lifecycle", "stage", "deduped", "result", "duplicate", "update_id", update.UpdateID)
+		return
+	}
+	s.log.Debug(ctx, "webhook lifecycle", "stage", "deduped", "result", "accepted", "update_id", update.UpdateID)
+
+	if update.CallbackQuery != nil {
+		s.handleCallbackQuery(ctx, update.CallbackQuery)
+		return
+	}
+	if update.MessageReaction != nil {
+		s.handleReaction(ctx, update.MessageReaction)
 		return
 	}
-	s.log.Debug(r.Context(), "webhook lifecycle", "stage", "deduped", "result", "accepted", "update_id", update.UpdateID)
 
 	msg := update.Message
 	if msg == nil {
-		s.log.Debug(r.Context(), "webhook has no message payload", "update_id", update.UpdateID)
-		w.WriteHeader(http.StatusOK)
+		s.log.Debug(ctx, "webhook has no message payload", "update_id", update.UpdateID)
 		return
 	}
 
 	chatID := strconv.FormatInt(msg.Chat.ID, 10)
 	if chatID != s.cfg.UserChatID {
-		s.log.Warn(r.Context(), "webhook unauthorized chat", "chat_id", chatID)
-		w.WriteHeader(http.StatusOK)
+		s.log.Warn(ctx, "webhook unauthorized chat", "chat_id", chatID)
 		return
 	}
-	s.log.Debug(r.Context(), "webhook lifecycle", "stage", "authorized", "chat_id", chatID)
+	s.log.Debug(ctx, "webhook lifecycle", "stage", "authorized", "chat_id", chatID)
 
 	var content string
 	var msgType string
+	var files []agent.Attachment
 	switch {
 	case msg.Voice != nil:
 		msgType = "voice"
 		if s.voice != nil {
 			text, err := s.voice.Transcribe(msg.Voice.FileID)
 			if err != nil {
-				s.log.Error(r.Context(), "voice transcription failed", "chat_id", chatID, "error", err.Error())
+				s.log.Error(ctx, "voice transcription failed", "chat_id", chatID, "error", err.Error())
 				content = "[Voice message - transcription failed]"
 			} else {
 				content = fmt.Sprintf("[Voice message] %s", text)
@@ -396,28 +622,39 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		msgType = "photo"
 		best := msg.Photo[len(msg.Photo)-1]
 		content = fmt.Sprintf("[photo:%s]", best.FileID)
+		if att, err := s.downloadPhoto(ctx, msg, best); err != nil {
+			s.log.Warn(ctx, "photo download failed, passing file id", "chat_id", chatID, "error", err.Error())
+		} else if att != nil {
+			files = append(files, *att)
+			content = fmt.Sprintf("[photo: %s]", att.Path)
+		}
 		if msg.Caption != "" {
 			content += " " + msg.Caption
 		}
+	case msg.Document != nil:
+		msgType = "document"
+		var att *agent.Attachment
+		content, att = s.receiveDocument(ctx, msg)
+		if att != nil {
+			files = append(files, *att)
+		}
 	case msg.Text != "":
 		msgType = "text"
 		content = msg.Text
 	default:
-		s.log.Warn(r.Context(), "webhook unsupported message type", "chat_id", chatID)
-		w.WriteHeader(http.StatusOK)
+		s.log.Warn(ctx, "webhook unsupported message type", "chat_id", chatID)
 		return
 	}
 
-	s.log.Info(r.Context(), "webhook message accepted", "message_type", msgType, "chat_id", chatID, "preview", truncate(content, 80))
+	s.log.Info(ctx, "webhook message accepted", "message_type", msgType, "chat_id", chatID, "preview", truncate(content, 80))
 
 	// quick action intercept: check if this is a reply to a recently triggered reminder
 	if msgType == "text" && s.quickActions != nil {
-		if reply, handled := s.quickActions.TryHandle(r.Context(), content); handled {
-			s.log.Info(r.Context(), "quick action handled", "chat_id", chatID, "reply", reply)
+		if reply, handled := s.quickActions.TryHandle(ctx, content); handled {
+			s.log.Info(ctx, "quick action handled", "chat_id", chatID, "reply", reply)
 			if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
-				s.log.Error(r.Context(), "quick action reply failed", "chat_id", chatID, "error", sendErr.Error())
+				s.log.Error(ctx, "quick action reply failed", "chat_id", chatID, "error", sendErr.Error())
 			}
-			w.WriteHeader(http.StatusOK)
 			return
 		}
 	}
@@ -427,11 +664,10 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		trimmed := strings.TrimSpace(content)
 		if trimmed == "/schedule" {
 			reply := formatSchedulerStatus(s.scheduler.Diagnostics(), s.scheduler.List())
-			s.log.Info(r.Context(), "scheduler status command", "chat_id", chatID)
+			s.log.Info(ctx, "scheduler status command", "chat_id", chatID)
 			if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
-				s.log.Error(r.Context(), "scheduler status reply failed", "chat_id", chatID, "error", sendErr.Error())
+				s.log.Error(ctx, "scheduler status reply failed", "chat_id", chatID, "error", sendErr.Error())
 			}
-			w.WriteHeader(http.StatusOK)
 			return
 		}
 	}
@@ -444,6 +680,13 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 			var reply string
 			if len(parts) == 1 {
 				reply = formatModelStatus(s.agent.ModelStatus(), s.agent.CurrentBackend())
+			} else if len(parts) == 2 && parts[1] == "list" {
+				models, err := s.agent.ListModels(ctx)
+				if err != nil {
+					reply = fmt.Sprintf("❌ %v", err)
+				} else {
+					reply = formatModelStatus(s.agent.ModelStatus(), s.agent.CurrentBackend()) + "\n\n" + formatModelList(models, s.agent.CurrentModel())
+				}
 			} else {
 				model := strings.TrimSpace(strings.Join(parts[1:], " "))
 				if err := s.agent.SwitchModel(model); err != nil {
@@ -452,15 +695,74 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 					reply = "✅ " + formatModelStatus(s.agent.ModelStatus(), s.agent.CurrentBackend())
 				}
 			}
-			s.log.Info(r.Context(), "model switch command", "chat_id", chatID, "command", trimmed)
+			s.log.Info(ctx, "model switch command", "chat_id", chatID, "command", trimmed)
+			if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
+				s.log.Error(ctx, "model switch reply failed", "chat_id", chatID, "error", sendErr.Error())
+			}
+			return
+		}
+	}
+
+	// cancel command: /cancel [all]
+	if msgType == "text" {
+		trimmed := strings.TrimSpace(content)
+		if trimmed == "/cancel" || trimmed == "/cancel all" {
+			res := s.agent.Cancel(msg.Chat.ID, trimmed == "/cancel all")
+			reply := formatCancelResult(res)
+			s.log.Info(ctx, "cancel command", "chat_id", chatID, "command", trimmed, "canceled", len(res.Canceled), "dropped", len(res.Dropped))
+			if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
+				s.log.Error(ctx, "cancel reply failed", "chat_id", chatID, "error", sendErr.Error())
+			}
+			return
+		}
+	}
+
+	// subagent fan-out command: /fanout [station: prompt ...]
+	if msgType == "text" {
+		trimmed := strings.TrimSpace(content)
+		if trimmed == "/fanout" || strings.HasPrefix(trimmed, "/fanout ") || strings.HasPrefix(trimmed, "/fanout\n") {
+			var reply string
+			var tasks []orchestrator.Task
+			body := strings.TrimSpace(strings.TrimPrefix(trimmed, "/fanout"))
+			switch {
+			case s.orchestrator == nil:
+				reply = "subagent stations are not configured (`" + s.cfg.SubagentStationsFile + "`)"
+			case body == "":
+				reply = s.orchestrator.FormatStations()
+			default:
+				parsed, err := orchestrator.ParseCommand(body)
+				if err != nil {
+					reply = fmt.Sprintf("❌ %v\n\nusage: `/fanout station: prompt` (one task per line)", err)
+				} else {
+					tasks = parsed
+					reply = fmt.Sprintf("🛰 dispatching %d task(s)…", len(tasks))
+				}
+			}
+			s.log.Info(ctx, "fanout command", "chat_id", chatID)
 			if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
-				s.log.Error(r.Context(), "model switch reply failed", "chat_id", chatID, "error", sendErr.Error())
+				s.log.Error(ctx, "fanout reply failed", "chat_id", chatID, "error", sendErr.Error())
+			}
+			// start after the ack so the summary can't overtake it
+			if len(tasks) > 0 {
+				go s.runFanout(observability.Detach(ctx), msg.Chat.ID, "", tasks)
 			}
-			w.WriteHeader(http.StatusOK)
 			return
 		}
 	}
 
+	// usage report: /usage
+	if msgType == "text" && strings.TrimSpace(content) == "/usage" {
+		reply := "usage ledger is not available (needs `DATA_DIR`)"
+		if s.usage != nil {
+			reply = s.usage.Report(s.now())
+		}
+		s.log.Info(ctx, "usage command", "chat_id", chatID)
+		if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
+			s.log.Error(ctx, "usage reply failed", "chat_id", chatID, "error", sendErr.Error())
+		}
+		return
+	}
+
 	// agent switch command: /agent [name]
 	if msgType == "text" {
 		trimmed := strings.TrimSpace(content)
@@ -468,7 +770,7 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 			parts := strings.Fields(trimmed)
 			var reply string
 			if len(parts) == 1 {
-				reply = fmt.Sprintf("current agent: *%s*", s.agent.CurrentBackend())
+				reply = formatAgentStatus(s.agent.CurrentBackend(), s.agent.BackendStatus(), time.Now())
 			} else {
 				name := parts[1]
 				if err := s.agent.SwitchBackend(name); err != nil {
@@ -477,63 +779,125 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 					reply = fmt.Sprintf("✅ switched to *%s*", s.agent.CurrentBackend())
 				}
 			}
-			s.log.Info(r.Context(), "agent switch command", "chat_id", chatID, "command", trimmed)
+			s.log.Info(ctx, "agent switch command", "chat_id", chatID, "command", trimmed)
 			if sendErr := s.tg.SendMessage(msg.Chat.ID, reply); sendErr != nil {
-				s.log.Error(r.Context(), "agent switch reply failed", "chat_id", chatID, "error", sendErr.Error())
+				s.log.Error(ctx, "agent switch reply failed", "chat_id", chatID, "error", sendErr.Error())
 			}
-			w.WriteHeader(http.StatusOK)
 			return
 		}
 	}
 
-	originalContent := content
-
-	if s.memory != nil && shouldPersistMemory(originalContent) {
-		if err := s.memory.Save([]string{"user: " + originalContent}); err != nil {
-			s.log.Warn(r.Context(), "memory save failed", "source", "user", "error", err.Error())
+	if s.memory != nil && shouldPersistMemory(content) {
+		if err := s.memory.Save([]string{"user: " + content}); err != nil {
+			s.log.Warn(ctx, "memory save failed", "source", "user", "error", err.Error())
 		}
 	}
 
-	if s.memory != nil && strings.TrimSpace(originalContent) != "" {
-		memoryCtx, lookupErr := s.memory.Lookup(originalContent, 5)
+	// detach from request context so agent processing isn't canceled as soon as webhook returns 200.
+	agentCtx := context.Background()
+	s.agent.Enqueue(agentCtx, agent.Message{
+		ChatID:  msg.Chat.ID,
+		Content: content,
+		Type:    msgType,
+		ReplyTo: replyContext(msg.ReplyToMessage),
+
+		Attachments: files,
+	})
+	s.log.Debug(ctx, "webhook lifecycle", "stage", "queued", "chat_id", chatID, "message_type", msgType, "queue_len", s.agent.QueueLen())
+}
+
+// section budgets of the prompt contributors; AGENT_PROMPT_SECTION_TOKENS
+// overrides them by name.
+const (
+	replyPromptTokens        = 500
+	memoryPromptTokens       = 1500
+	skillOutputPromptTokens  = 2000
+	skillsPromptTokens       = 800
+	orchestratorPromptTokens = 800
+	setupPromptTokens        = 1500
+)
+
+// buildPrompt adds reply, memory, skill, orchestrator and setup context to a
+// chat message. The queue calls it once per turn, so coalesced messages share
+// one memory lookup and one skill pass.
+func (s *Server) buildPrompt(ctx context.Context, msg agent.Message, b *agent.PromptBuilder) {
+	switch msg.Type {
+	case "text", "voice", "photo", "document":
+	default:
+		return // scheduled and fan-out prompts are built by their producers
+	}
+	if msg.ReplyTo != "" {
+		b.Add(agent.PromptSection{Name: "reply", Priority: agent.PromptPriorityReply, MaxTokens: replyPromptTokens, Content: "[replying to]\n" + msg.ReplyTo})
+	}
+	if s.memory != nil && strings.TrimSpace(msg.Content) != "" {
+		memoryCtx, lookupErr := s.memory.Lookup(msg.Content, 5)
 		if lookupErr != nil {
 			streak := s.memoryLookupFailureStreak.Add(1)
-			s.log.Warn(r.Context(), "memory_lookup_failed", "error", lookupErr.Error(), "failure_streak", streak, "hint", "run `go run ./cmd/memorylookup -self-check` and verify OPENAI_API_KEY")
+			s.log.Warn(ctx, "memory_lookup_failed", "error", lookupErr.Error(), "failure_streak", streak, "hint", "run `go run ./cmd/memorylookup -self-check` and verify OPENAI_API_KEY")
 			if streak >= 3 && streak%3 == 0 {
-				s.log.Warn(r.Context(), "memory_lookup_repeated_failures", "failure_streak", streak)
+				s.log.Warn(ctx, "memory_lookup_repeated_failures", "failure_streak", streak)
 			}
 		} else {
 			previousStreak := s.memoryLookupFailureStreak.Load()
 			if previousStreak > 0 {
-				s.log.Info(r.Context(), "memory_lookup_recovered", "previous_failure_streak", previousStreak)
+				s.log.Info(ctx, "memory_lookup_recovered", "previous_failure_streak", previousStreak)
 			}
 			s.memoryLookupFailureStreak.Store(0)
 			if strings.TrimSpace(memoryCtx) != "" {
-				content = content + "\n\n[memory context]\n" + memoryCtx
+				b.Add(agent.PromptSection{Name: "memory", Priority: agent.PromptPriorityMemory, MaxTokens: memoryPromptTokens, Content: "[memory context]\n" + memoryCtx})
 			}
 		}
 	}
 
-	// auto-trigger: run matching skills and prepend output to agent context
+	// auto-trigger: run matching skills and add their output to agent context
 	if s.skills != nil {
-		content = s.enrichWithSkills(r.Context(), content, chatID, msgType)
+		s.enrichWithSkills(ctx, b, msg.Content, strconv.FormatInt(msg.ChatID, 10), msg.Type)
+	}
+	if s.orchestrator != nil {
+		b.Add(agent.PromptSection{Name: "orchestrator", Priority: agent.PromptPrioritySystem, MaxTokens: orchestratorPromptTokens, Content: "[system context]\n" + s.orchestrator.Describe()})
 	}
 	if s.setupState.FirstRun {
-		if setupCtx := setup.BuildContext(s.setupState); setupCtx != "" {
-			content = content + "\n\n" + setupCtx
-		}
+		b.Add(agent.PromptSection{Name: "setup", Priority: agent.PromptPrioritySetup, MaxTokens: setupPromptTokens, Content: setup.BuildContext(s.setupState)})
 	}
+}
 
-	// detach from request context so agent processing isn't canceled as soon as webhook returns 200.
-	agentCtx := context.Background()
-	s.agent.Enqueue(agentCtx, agent.Message{
-		ChatID:  msg.Chat.ID,
-		Content: content,
-		Type:    msgType,
-	})
-	s.log.Debug(r.Context(), "webhook lifecycle", "stage", "queued", "chat_id", chatID, "message_type", msgType, "queue_len", s.agent.QueueLen())
+// replyContext describes the message a chat message replies to, or "".
+func replyContext(m *telegram.Message) string {
+	if m == nil {
+		return ""
+	}
+	switch {
+	case m.Text != "":
+		return m.Text
+	case m.Voice != nil:
+		return "[voice message]"
+	case len(m.Photo) > 0:
+		return strings.TrimSpace("[photo] " + m.Caption)
+	case m.Document != nil:
+		return strings.TrimSpace(fmt.Sprintf("[document: %s] %s", m.Document.FileName, m.Caption))
+	}
+	return m.Caption
+}
 
-	w.WriteHeader(http.StatusOK)
+// replyBackendLabel names the backend for the reply footer: the backend that
+// answered plus the routing rule or hedge that picked it, else the active backend.
+func (s *Server) replyBackendLabel(ctx context.Context) string {
+	if turn := agent.TurnFromContext(ctx); turn != nil {
+		if route, ok := turn.Route(); ok {
+			label := route.Backend
+			if route.Rule != "" {
+				label += " · route " + route.Rule
+			}
+			if route.Fallback {
+				label += " (fallback)"
+			}
+			if route.Hedged {
+				label += " · hedged"
+			}
+			return label
+		}
+	}
+	return s.agent.CurrentBackend()
 }
 
 func verifySignature(got, secret string) bool {
@@ -591,19 +955,19 @@ func escapeTelegramCode(s string) string {
 	return truncate(s, 220)
 }
 
-// enrichWithSkills checks for auto-trigger matches and injects skill context.
-func (s *Server) enrichWithSkills(ctx context.Context, content, chatID, msgType string) string {
+// enrichWithSkills runs the auto-trigger skills matching content and adds
+// their output as "skill:NAME" sections; without a match it adds the skill
+// catalog so the agent can discover them.
+func (s *Server) enrichWithSkills(ctx context.Context, b *agent.PromptBuilder, content, chatID, msgType string) {
 	matched := s.skills.Match(content)
 	if len(matched) == 0 {
 		// no trigger matches, but still inject skill discovery
-		desc := s.skills.Describe()
-		if desc != "" {
-			return content + "\n\n[system context]\n" + desc
+		if desc := s.skills.Describe(); desc != "" {
+			b.Add(agent.PromptSection{Name: "skills", Priority: agent.PromptPrioritySystem, MaxTokens: skillsPromptTokens, Content: "[system context]\n" + desc})
 		}
-		return content
+		return
 	}
 
-	var enrichments []string
 	for _, skill := range matched {
 		result, err := s.skills.Exec().Run(ctx, skill, skills.Context{
 			UserMessage: content,
@@ -625,15 +989,15 @@ func (s *Server) enrichWithSkills(ctx context.Context, content, chatID, msgType
 
 		output := strings.TrimSpace(result.Stdout)
 		if output != "" {
-			enrichments = append(enrichments, fmt.Sprintf("[skill:%s output]\n%s", skill.Manifest.Name, output))
+			b.Add(agent.PromptSection{
+				Name:      "skill:" + skill.Manifest.Name,
+				Priority:  agent.PromptPrioritySkill,
+				MaxTokens: skillOutputPromptTokens,
+				Content:   fmt.Sprintf("[skill:%s output]\n%s", skill.Manifest.Name, output),
+			})
 			s.log.Info(ctx, "auto-trigger skill ran", "skill", skill.Manifest.Name, "output_len", len(output))
 		}
 	}
-
-	if len(enrichments) > 0 {
-		return content + "\n\n" + strings.Join(enrichments, "\n\n")
-	}
-	return content
 }
 
 // executeSkillActions processes create/edit/delete actions from agent response.
@@ -661,6 +1025,16 @@ func (s *Server) executeSkillActions(ctx context.Context, chatID int64, actions
 	}
 }
 
+// markScheduleCritical exempts a new task from the daily budget limit.
+func (s *Server) markScheduleCritical(ctx context.Context, id string, critical bool) {
+	if !critical {
+		return
+	}
+	if err := s.scheduler.Update(id, scheduler.UpdateTaskInput{Critical: &critical}); err != nil {
+		s.log.Error(ctx, "schedule mark critical failed", "task_id", id, "error", err.Error())
+	}
+}
+
 func (s *Server) executeScheduleActions(ctx context.Context, actions *scheduler.ActionEnvelope) string {
 	messages := make([]string, 0)
 
@@ -681,6 +1055,7 @@ func (s *Server) executeScheduleActions(ctx context.Context, actions *scheduler.
 				s.log.Error(ctx, "schedule create recurring failed", "prompt", a.Prompt, "error", err.Error())
 				continue
 			}
+			s.markScheduleCritical(ctx, id, a.Critical)
 			messages = append(messages, fmt.Sprintf("scheduled recurring ✅ id=%s", id))
 			continue
 		}
@@ -692,6 +1067,7 @@ func (s *Server) executeScheduleActions(ctx context.Context, actions *scheduler.
 			s.log.Error(ctx, "schedule create one-shot failed", "prompt", a.Prompt, "error", err.Error())
 			continue
 		}
+		s.markScheduleCritical(ctx, id, a.Critical)
 		messages = append(messages, fmt.Sprintf("scheduled ✅ id=%s", id))
 	}
 
@@ -714,6 +1090,7 @@ func (s *Server) executeScheduleActions(ctx context.Context, actions *scheduler.
 		}
 		in.Recurring = a.Recurring
 		in.IntervalSeconds = a.IntervalSeconds
+		in.Critical = a.Critical
 
 		if err := s.scheduler.Update(a.ID, in); err != nil {
 			msg := fmt.Sprintf("schedule update failed (%s): %s", a.ID, err.Error())
@@ -808,11 +1185,13 @@ func (s *Server) executeSetupActions(ctx context.Context, actions *setup.ActionE
 	}
 
 	if strings.TrimSpace(actions.WebhookURL) != "" {
-		if token == "" {
+		if s.cfg.TelegramMode == "polling" {
+			messages = append(messages, "webhook not set: TELEGRAM_MODE=polling fetches updates without one")
+		} else if token == "" {
 			messages = append(messages, "set webhook failed: TELEGRAM_BOT_TOKEN missing")
 		} else {
 			tg := telegram.NewClient(token)
-			if err := tg.SetWebhook(strings.TrimSpace(actions.WebhookURL), strings.TrimSpace(actions.WebhookSecret)); err != nil {
+			if err := tg.SetWebhook(strings.TrimSpace(actions.WebhookURL), strings.TrimSpace(actions.WebhookSecret), telegramAllowedUpdates); err != nil {
 				messages = append(messages, "set webhook failed: "+err.Error())
 			} else {
 				messages = append(messages, "webhook set ✅")
@@ -1086,6 +1465,114 @@ func formatModelStatus(ms agent.ModelStatus, backendLabel string) string {
 	return reply
 }
 
+func formatModelList(models []string, current string) string {
+	if len(models) == 0 {
+		return "available models: _(none)_"
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("available models (%d)", len(models)))
+	for _, m := range models {
+		if m == current {
+			b.WriteString(fmt.Sprintf("\n- *%s* ← active", m))
+			continue
+		}
+		b.WriteString("\n- `" + m + "`")
+	}
+	return b.String()
+}
+
+// formatAgentStatus renders /agent: the current backend plus, for a registry,
+// each backend's breaker state, last probe latency and last error.
+func formatAgentStatus(current string, backends []agent.BackendStatus, now time.Time) string {
+	reply := fmt.Sprintf("current agent: *%s*", current)
+	for _, bs := range backends {
+		mark := "🟢"
+		switch bs.State {
+		case agent.BreakerOpen:
+			mark = "🔴"
+		case agent.BreakerHalfOpen:
+			mark = "🟡"
+		}
+		line := fmt.Sprintf("\n%s `%s` %s", mark, bs.Name, bs.State)
+		if bs.State == agent.BreakerOpen && bs.OpenUntil.After(now) {
+			line += fmt.Sprintf(" (retry in %s)", formatDuration(bs.OpenUntil.Sub(now)))
+		}
+		if bs.LastLatency > 0 {
+			line += fmt.Sprintf(" · %dms", bs.LastLatency.Milliseconds())
+		}
+		if bs.FirstTokenSamples > 0 {
+			line += fmt.Sprintf(" · first token p50 %s p95 %s", formatDuration(bs.FirstTokenP50), formatDuration(bs.FirstTokenP95))
+		}
+		if bs.Active {
+			line += " ← active"
+		}
+		if bs.LastErr != "" {
+			line += fmt.Sprintf("\n   last error: `%s`", escapeTelegramCode(truncate(bs.LastErr, 120)))
+		}
+		if ps := bs.Process; ps != nil {
+			line += "\n   " + formatProcessStatus(*ps)
+		}
+		reply += line
+	}
+	return reply
+}
+
+// formatProcessStatus renders the supervised process of a backend for /agent.
+func formatProcessStatus(ps agent.ProcessStatus) string {
+	line := "process down"
+	if ps.Running {
+		line = fmt.Sprintf("pid %d", ps.PID)
+	}
+	if ps.Restarts > 0 {
+		line += fmt.Sprintf(" · %d restart(s)", ps.Restarts)
+	}
+	if ps.CrashLoop {
+		line = "🔁 crash loop · " + line
+	}
+	if ps.LastExit != "" && (ps.CrashLoop || !ps.Running) {
+		line += fmt.Sprintf("\n   last exit: `%s`", escapeTelegramCode(truncate(ps.LastExit, 160)))
+	}
+	if stderr := lastStderrLine(ps.Stderr); stderr != "" {
+		line += fmt.Sprintf("\n   stderr: `%s`", escapeTelegramCode(truncate(stderr, 160)))
+	}
+	return line
+}
+
+func lastStderrLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func formatCancelResult(res agent.CancelResult) string {
+	if len(res.Canceled) == 0 && len(res.Dropped) == 0 {
+		if res.Kept > 0 {
+			return fmt.Sprintf("nothing running — %d queued message(s) kept (use /cancel all to drop them)", res.Kept)
+		}
+		return "nothing to cancel"
+	}
+
+	var lines []string
+	for _, m := range res.Canceled {
+		lines = append(lines, fmt.Sprintf("🛑 canceled: `%s`", escapeTelegramCode(truncate(messagePreview(m), 60))))
+	}
+	if len(res.Dropped) > 0 {
+		lines = append(lines, fmt.Sprintf("🗑 dropped %d queued message(s):", len(res.Dropped)))
+		for _, m := range res.Dropped {
+			lines = append(lines, fmt.Sprintf("- `%s`", escapeTelegramCode(truncate(messagePreview(m), 60))))
+		}
+	}
+	if res.Kept > 0 {
+		lines = append(lines, fmt.Sprintf("%d queued message(s) kept (use /cancel all to drop them)", res.Kept))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// messagePreview returns the first line of a message, without enrichment blocks.
+func messagePreview(m agent.Message) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(m.Content), "\n")
+	return strings.TrimSpace(first)
+}
+
 func sanitizeUserReply(s string) string {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -2,16 +2,25 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"visor/internal/agent"
 	"visor/internal/config"
+	"visor/internal/orchestrator"
 	"visor/internal/platform/telegram"
+	"visor/internal/scheduler"
+	"visor/internal/setup"
 )
 
 func testConfig(secret string) *config.Config {
@@ -407,3 +416,821 @@ func TestWebhook_E2E_TelegramDelivery(t *testing.T) {
 		t.Fatal("timeout waiting for telegram sendMessage call")
 	}
 }
+
+func TestWebhook_CoalescedMessagesGetOneReply(t *testing.T) {
+	texts := make(chan string, 4)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.AgentCoalesceWindow = 50 * time.Millisecond
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{FirstRun: true, Missing: []string{".env"}}
+
+	for i, text := range []string{"hey", "quick question", "what time is it"} {
+		if w := postWebhook(srv, makeUpdate(4001+i, 12345, text), nil); w.Code != http.StatusOK {
+			t.Fatalf("status=%d", w.Code)
+		}
+	}
+
+	var got string
+	select {
+	case got = <-texts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for telegram sendMessage call")
+	}
+	if !strings.HasPrefix(got, "echo: [message 1/3]\nhey\n\n[message 2/3]\nquick question\n\n[message 3/3]\nwhat time is it") {
+		t.Fatalf("text=%q", got)
+	}
+	// prompt enrichment runs once for the merged turn
+	if n := strings.Count(got, "[first-run setup mode]"); n != 1 {
+		t.Fatalf("setup context appended %d times: %q", n, got)
+	}
+	select {
+	case extra := <-texts:
+		t.Fatalf("unexpected second reply %q", extra)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhook_RoutedReplyFooterNamesRoute(t *testing.T) {
+	texts := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	reg := agent.NewRegistry()
+	reg.Register("primary", &agent.EchoAgent{}, 0)
+	reg.Register("strong", &agent.EchoAgent{}, 1)
+	reg.HealthCheckAll(context.Background())
+	if err := reg.SetRoutes([]agent.RouteRule{{Name: "deep", Prefix: "/deep", Backend: "strong"}}); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(testConfig(""), reg)
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	postWebhook(srv, makeUpdate(5001, 12345, "/deep why"), nil)
+	select {
+	case got := <-texts:
+		if !strings.HasPrefix(got, "echo: why") || !strings.HasSuffix(got, "· strong · route deep") {
+			t.Fatalf("text=%q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for telegram sendMessage call")
+	}
+}
+
+func TestWebhook_PromptDumpShowsSections(t *testing.T) {
+	texts := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	secret := map[string]string{"X-Telegram-Bot-Api-Secret-Token": "s3cret"}
+	getDumpWith := func(srv *Server, query string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/debug/prompt"+query, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, req)
+		return w
+	}
+	getDump := func(srv *Server, query string) *httptest.ResponseRecorder {
+		return getDumpWith(srv, query, secret)
+	}
+	if w := getDump(New(testConfig("s3cret"), &agent.EchoAgent{}), ""); w.Code != http.StatusNotFound {
+		t.Fatalf("dump endpoint must be off by default, status=%d", w.Code)
+	}
+	unauthenticated := testConfig("")
+	unauthenticated.DebugPromptDump = true
+	if w := getDumpWith(New(unauthenticated, &agent.EchoAgent{}), "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("dump endpoint must stay off without a webhook secret, status=%d", w.Code)
+	}
+
+	cfg := testConfig("s3cret")
+	cfg.DebugPromptDump = true
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{FirstRun: true, Missing: []string{".env"}}
+	if w := getDump(srv, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("status=%d before the first prompt", w.Code)
+	}
+
+	update := makeUpdate(6001, 12345, "done?")
+	update.Message.ReplyToMessage = &telegram.Message{MessageID: 1, Chat: update.Message.Chat, Text: "remember to water the plants"}
+	postWebhook(srv, update, secret)
+	select {
+	case got := <-texts:
+		if !strings.HasPrefix(got, "echo: done?\n\n[replying to]\nremember to water the plants\n\n") {
+			t.Fatalf("text=%q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for telegram sendMessage call")
+	}
+
+	for _, headers := range []map[string]string{nil, {"X-Telegram-Bot-Api-Secret-Token": "guess"}} {
+		if w := getDumpWith(srv, "?chat_id=12345", headers); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status=%d without the secret, want 401", w.Code)
+		}
+	}
+	w := getDump(srv, "?chat_id=12345")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var dump agent.PromptDump
+	if err := json.Unmarshal(w.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range dump.Sections {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "message,reply,setup" {
+		t.Fatalf("sections=%v", names)
+	}
+	if !strings.HasPrefix(dump.Prompt, "done?\n\n[replying to]") || dump.Tokens == 0 || dump.Backend != "echo" {
+		t.Fatalf("dump=%+v", dump)
+	}
+	if w := getDump(srv, "?chat_id=abc"); w.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d for an invalid chat id", w.Code)
+	}
+}
+
+func TestPolling_FeedsUpdatesThroughWebhookPipeline(t *testing.T) {
+	texts := make(chan string, 4)
+	var served sync.Once
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/deleteWebhook"):
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+			first := false
+			served.Do(func() { first = true })
+			if !first {
+				_, _ = io.Copy(io.Discard, r.Body) // lets the server notice the canceled long poll
+				<-r.Context().Done()
+				return
+			}
+			updates := []telegram.Update{
+				makeUpdate(7001, 999, "not my chat"),
+				makeUpdate(7002, 12345, "hello by polling"),
+				makeUpdate(7002, 12345, "hello by polling"),
+			}
+			body, _ := json.Marshal(map[string]any{"ok": true, "result": updates})
+			_, _ = w.Write(body)
+		case strings.HasSuffix(r.URL.Path, "/sendMessage"):
+			var payload struct {
+				Text string `json:"text"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			texts <- payload.Text
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		default:
+			t.Errorf("unexpected bot api call %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.TelegramMode = "polling"
+	cfg.TelegramPollTimeout = time.Second
+	cfg.DataDir = t.TempDir()
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.poll(ctx)
+
+	select {
+	case got := <-texts:
+		if !strings.HasPrefix(got, "echo: hello by polling") {
+			t.Fatalf("text=%q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the polled message to be answered")
+	}
+	select {
+	case extra := <-texts:
+		t.Fatalf("unexpected reply %q: duplicates and foreign chats must be ignored", extra)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFormatCancelResult(t *testing.T) {
+	if got := formatCancelResult(agent.CancelResult{}); got != "nothing to cancel" {
+		t.Fatalf("empty=%q", got)
+	}
+
+	got := formatCancelResult(agent.CancelResult{
+		Canceled: []agent.Message{{Content: "check the server\n\n[memory context]\n..."}},
+		Kept:     2,
+	})
+	if !strings.Contains(got, "canceled: `check the server`") {
+		t.Fatalf("missing canceled preview: %q", got)
+	}
+	if !strings.Contains(got, "2 queued message(s) kept") {
+		t.Fatalf("missing kept note: %q", got)
+	}
+
+	got = formatCancelResult(agent.CancelResult{Dropped: []agent.Message{{Content: "a"}, {Content: "b"}}})
+	if !strings.Contains(got, "dropped 2 queued message(s)") {
+		t.Fatalf("missing dropped note: %q", got)
+	}
+}
+
+func TestFormatModelList(t *testing.T) {
+	got := formatModelList([]string{"llama3.2:latest", "qwen2.5:7b"}, "qwen2.5:7b")
+	if !strings.Contains(got, "available models (2)") || !strings.Contains(got, "`llama3.2:latest`") {
+		t.Fatalf("list=%q", got)
+	}
+	if !strings.Contains(got, "*qwen2.5:7b* ← active") {
+		t.Fatalf("active model not marked: %q", got)
+	}
+	if got := formatModelList(nil, ""); !strings.Contains(got, "(none)") {
+		t.Fatalf("empty=%q", got)
+	}
+}
+
+func TestFormatAgentStatus(t *testing.T) {
+	now := time.Now()
+	got := formatAgentStatus("ollama", []agent.BackendStatus{
+		{Name: "ollama", State: agent.BreakerHalfOpen, Active: true, LastLatency: 42 * time.Millisecond,
+			FirstTokenP50: 500 * time.Millisecond, FirstTokenP95: 2 * time.Second, FirstTokenSamples: 30},
+		{Name: "openai", State: agent.BreakerOpen, OpenUntil: now.Add(90 * time.Second), LastErr: "openai: status 429: slow `down`"},
+		{Name: "pi", State: agent.BreakerOpen, OpenUntil: now.Add(time.Minute), LastErr: "crash loop: exit status 1",
+			Process: &agent.ProcessStatus{PID: 4242, Running: true, Restarts: 6, CrashLoop: true, LastExit: "exit status 1: auth failed", Stderr: "booting\nError: auth failed\n"}},
+	}, now)
+	for _, want := range []string{
+		"current agent: *ollama*",
+		"🟡 `ollama` half-open · 42ms · first token p50 500ms p95 2.0s ← active",
+		"🔴 `openai` open (retry in 1m30s)",
+		"last error: `openai: status 429: slow 'down'`",
+		"🔁 crash loop · pid 4242 · 6 restart(s)",
+		"last exit: `exit status 1: auth failed`",
+		"stderr: `Error: auth failed`",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("status missing %q:\n%s", want, got)
+		}
+	}
+	if got := formatAgentStatus("pi", nil, now); got != "current agent: *pi*" {
+		t.Fatalf("single backend=%q", got)
+	}
+}
+
+func TestWebhook_FanoutCommandFeedsResultsBack(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "test-token")
+	t.Setenv("USER_PHONE_NUMBER", "12345")
+
+	texts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+
+	srv := New(testConfig(""), &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	orch, err := orchestrator.New(&orchestrator.StationsConfig{Stations: []orchestrator.Station{
+		{Name: "research", Backends: []orchestrator.StationBackend{{Backend: "echo"}}},
+	}}, func(string, int, orchestrator.StationBackend) (agent.Agent, error) { return &agent.EchoAgent{}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOrchestrator(orch)
+
+	if w := postWebhook(srv, makeUpdate(2001, 12345, "/fanout research: find x"), nil); w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+
+	want := []string{"🛰 dispatching 1 task(s)", "fan-out done: 1/1 ok", "echo: [subagent results]"}
+	for _, prefix := range want {
+		select {
+		case got := <-texts:
+			if !strings.Contains(got, prefix) {
+				t.Fatalf("message=%q want %q", got, prefix)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", prefix)
+		}
+	}
+}
+
+// promptFunc is an agent answering with a function.
+type promptFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f promptFunc) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+func (f promptFunc) Close() error { return nil }
+
+func TestAgentFanoutStationsRunWithoutTheParentTurn(t *testing.T) {
+	texts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+
+	main := promptFunc(func(ctx context.Context, prompt string) (string, error) {
+		if strings.Contains(prompt, "[subagent results]") {
+			return "merged", nil
+		}
+		return "on it\n\n```json\n{\"subagent_actions\": {\"tasks\": [{\"station\": \"research\", \"prompt\": \"find x\"}]}}\n```", nil
+	})
+	stationTurn := make(chan *agent.Turn, 1)
+	station := promptFunc(func(ctx context.Context, prompt string) (string, error) {
+		stationTurn <- agent.TurnFromContext(ctx)
+		return "found x", nil
+	})
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, main)
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+	orch, err := orchestrator.New(&orchestrator.StationsConfig{Stations: []orchestrator.Station{
+		{Name: "research", Backends: []orchestrator.StationBackend{{Backend: "fake"}}},
+	}}, func(string, int, orchestrator.StationBackend) (agent.Agent, error) { return station, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOrchestrator(orch)
+
+	postWebhook(srv, makeUpdate(2101, 12345, "plan the trip"), nil)
+
+	select {
+	case turn := <-stationTurn:
+		if turn != nil {
+			t.Fatalf("station ran inside turn %q (%q): it would get the chat history and visor tools", turn.ID, turn.Message.Content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the station")
+	}
+	// the reply and the fan-out summary race each other
+	var got []string
+	for len(got) < 3 {
+		select {
+		case text := <-texts:
+			got = append(got, text)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout, messages=%q", got)
+		}
+	}
+	joined := strings.Join(got, "\n---\n")
+	for _, want := range []string{"on it", "fan-out done: 1/1 ok", "merged"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("messages=%q want %q", got, want)
+		}
+	}
+}
+
+func TestScheduledReplyButtonsRunQuickActions(t *testing.T) {
+	type call struct {
+		method  string
+		payload map[string]any
+	}
+	calls := make(chan call, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		calls <- call{method: r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], payload: payload}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":42,"chat":{"id":12345,"type":"private"}}}`))
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	next := func() call {
+		t.Helper()
+		select {
+		case c := <-calls:
+			return c
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for telegram call")
+			return call{}
+		}
+	}
+
+	// what the scheduler callback does when a task fires
+	srv.quickActions.RecordTrigger(scheduler.Task{ID: "task-1", Prompt: "drink water", NextRunAt: time.Now().UTC()})
+	srv.agent.Enqueue(context.Background(), agent.Message{ChatID: 12345, Content: "drink water", Type: "scheduled", TaskID: "task-1"})
+
+	sent := next()
+	if sent.method != "sendMessage" {
+		t.Fatalf("method=%q payload=%v", sent.method, sent.payload)
+	}
+	markup, _ := sent.payload["reply_markup"].(map[string]any)
+	rows, _ := markup["inline_keyboard"].([]any)
+	if len(rows) != 2 {
+		t.Fatalf("reply_markup=%v", sent.payload["reply_markup"])
+	}
+	done := rows[0].([]any)[0].(map[string]any)["callback_data"].(string)
+
+	w := postWebhook(srv, telegram.Update{UpdateID: 2001, CallbackQuery: &telegram.CallbackQuery{
+		ID:      "cb-1",
+		From:    &telegram.User{ID: 12345},
+		Message: &telegram.Message{MessageID: 42, Chat: telegram.Chat{ID: 12345, Type: "private"}, Text: "echo: drink water"},
+		Data:    done,
+	}}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+
+	edit := next()
+	if edit.method != "editMessageText" || edit.payload["text"] != "echo: drink water\n\ndone ✓" || edit.payload["reply_markup"] != nil {
+		t.Fatalf("edit=%+v", edit)
+	}
+	answer := next()
+	if answer.method != "answerCallbackQuery" || answer.payload["callback_query_id"] != "cb-1" || answer.payload["text"] != "done ✓" {
+		t.Fatalf("answer=%+v", answer)
+	}
+
+	// a button press in a foreign chat is acknowledged but not acted on
+	postWebhook(srv, telegram.Update{UpdateID: 2002, CallbackQuery: &telegram.CallbackQuery{
+		ID:      "cb-2",
+		From:    &telegram.User{ID: 999},
+		Message: &telegram.Message{MessageID: 7, Chat: telegram.Chat{ID: 999, Type: "private"}},
+		Data:    done,
+	}}, nil)
+	if c := next(); c.method != "answerCallbackQuery" || c.payload["text"] != nil {
+		t.Fatalf("foreign press=%+v", c)
+	}
+}
+
+func TestReactionsOnRepliesActAsSignals(t *testing.T) {
+	type call struct {
+		method  string
+		payload map[string]any
+	}
+	calls := make(chan call, 10)
+	var mu sync.Mutex
+	nextID := 100
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		calls <- call{method: method, payload: payload}
+		mu.Lock()
+		if method == "sendMessage" {
+			nextID++
+		}
+		id := nextID
+		mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"chat":{"id":12345,"type":"private"}}}`, id)
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	next := func() call {
+		t.Helper()
+		select {
+		case c := <-calls:
+			return c
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for telegram call")
+			return call{}
+		}
+	}
+	react := func(updateID, messageID int, emoji string) {
+		t.Helper()
+		// the reply is tracked right after telegram confirmed it
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if _, ok := srv.replies.lookup(12345, messageID); ok {
+				break
+			}
+		}
+		w := postWebhook(srv, telegram.Update{UpdateID: updateID, MessageReaction: &telegram.MessageReaction{
+			Chat:        telegram.Chat{ID: 12345, Type: "private"},
+			MessageID:   messageID,
+			NewReaction: []telegram.Reaction{{Type: "emoji", Emoji: emoji}},
+		}}, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status=%d", w.Code)
+		}
+	}
+
+	// 👍 on a reminder marks it done
+	srv.quickActions.RecordTrigger(scheduler.Task{ID: "task-1", Prompt: "drink water", NextRunAt: time.Now().UTC()})
+	srv.agent.Enqueue(context.Background(), agent.Message{ChatID: 12345, Content: "drink water", Type: "scheduled", TaskID: "task-1"})
+	if c := next(); c.method != "sendMessage" {
+		t.Fatalf("reminder=%+v", c)
+	}
+	react(3001, 101, "👍")
+	edit := next()
+	if edit.method != "editMessageText" || !strings.HasSuffix(edit.payload["text"].(string), "\n\ndone ✓") || edit.payload["message_id"] != float64(101) {
+		t.Fatalf("edit=%+v", edit)
+	}
+
+	// 👎 on an answer asks the agent to retry with the original message
+	postWebhook(srv, makeUpdate(3002, 12345, "capital of australia?"), nil)
+	if c := next(); c.method != "sendMessage" {
+		t.Fatalf("answer=%+v", c)
+	}
+	react(3003, 102, "👎")
+	retry := next()
+	text, _ := retry.payload["text"].(string)
+	if retry.method != "sendMessage" || !strings.Contains(text, "that was wrong, retry") || !strings.Contains(text, "[original message]\ncapital of australia?") {
+		t.Fatalf("retry=%+v", retry)
+	}
+
+	// reactions on messages visor does not know are ignored
+	react(3004, 9999, "👎")
+	select {
+	case c := <-calls:
+		t.Fatalf("unexpected call %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhook_PhotoIsStoredAndAttached(t *testing.T) {
+	sent := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottest-token/getFile":
+			if id := r.URL.Query().Get("file_id"); id != "large" {
+				t.Errorf("file_id=%q, the largest size must be downloaded", id)
+			}
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"file_path":"photos/file_9.jpg"}}`))
+		case "/file/bottest-token/photos/file_9.jpg":
+			_, _ = w.Write([]byte("jpeg bytes"))
+		case "/bottest-token/sendMessage":
+			var payload struct {
+				Text string `json:"text"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			sent <- payload.Text
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":2,"chat":{"id":12345,"type":"private"}}}`))
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	postWebhook(srv, telegram.Update{UpdateID: 4001, Message: &telegram.Message{
+		MessageID: 9,
+		Chat:      telegram.Chat{ID: 12345, Type: "private"},
+		Photo:     []telegram.PhotoSize{{FileID: "small", Width: 90, Height: 90}, {FileID: "large", Width: 1280, Height: 960}},
+		Caption:   "what is this?",
+	}}, nil)
+
+	path := filepath.Join(srv.attachments.Dir(), "12345", "9", "photo.jpg")
+	select {
+	case text := <-sent:
+		if !strings.HasPrefix(text, "echo: [photo: "+path+"] what is this?") {
+			t.Fatalf("text=%q", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for reply")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "jpeg bytes" {
+		t.Fatalf("stored photo=%q err=%v", data, err)
+	}
+}
+
+func TestWebhook_DocumentIsStoredAndExtracted(t *testing.T) {
+	sent := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottest-token/getFile":
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"file_path":"documents/file_3.csv"}}`))
+		case "/file/bottest-token/documents/file_3.csv":
+			_, _ = w.Write([]byte("month,total\njan,120\nfeb,95\n"))
+		case "/bottest-token/sendMessage":
+			var payload struct {
+				Text string `json:"text"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			sent <- payload.Text
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":2,"chat":{"id":12345,"type":"private"}}}`))
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	postWebhook(srv, telegram.Update{UpdateID: 4002, Message: &telegram.Message{
+		MessageID: 11,
+		Chat:      telegram.Chat{ID: 12345, Type: "private"},
+		Document:  &telegram.Document{FileID: "doc", FileName: "budget.csv", MimeType: "text/csv", FileSize: 28},
+		Caption:   "/remember which month was higher?",
+	}}, nil)
+
+	path := filepath.Join(srv.attachments.Dir(), "12345", "11", "budget.csv")
+	select {
+	case text := <-sent:
+		want := "echo: [document: " + path + "] which month was higher?\n[csv: 2 rows, 2 columns]\nmonth,total\njan,120\nfeb,95\n[not remembered: memory needs OPENAI_API_KEY]"
+		if !strings.HasPrefix(text, want) {
+			t.Fatalf("text=%q\nwant prefix %q", text, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for reply")
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.HasPrefix(string(data), "month,total") {
+		t.Fatalf("stored document=%q err=%v", data, err)
+	}
+}
+
+func TestHistoryKeepsTheReplyTheUserGot(t *testing.T) {
+	texts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+
+	main := promptFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "noted, see you at ten\n\n```json\n{\"schedule_actions\": {\"list\": true}}\n```\n---\nsend_voice: false\ncode_changes: false\nconversation_finished: false", nil
+	})
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	cfg.AgentHistoryTurns = 5
+	cfg.AgentHistoryTokens = 4000
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, main)
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+
+	postWebhook(srv, makeUpdate(2201, 12345, "remind me at ten"), nil)
+	select {
+	case <-texts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the reply")
+	}
+
+	path := cfg.DataDir + "/agent-history/history.json"
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		stored := string(data)
+		if strings.Contains(stored, "noted, see you at ten") {
+			for _, leak := range []string{"send_voice", "schedule_actions", "---"} {
+				if strings.Contains(stored, leak) {
+					t.Fatalf("history keeps %q of the raw output: %s", leak, stored)
+				}
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("history lacks the reply: %s", stored)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReactionSkillRunsInTheBackgroundForTheChat(t *testing.T) {
+	sent := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		sent <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	cfg.TelegramReactionSkills = map[string]string{"🔥": "echoer"}
+	skillDir := filepath.Join(cfg.DataDir, "skills", "echoer")
+	if err := os.MkdirAll(skillDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(skillDir, "skill.toml"), []byte("name = \"echoer\"\nrun = \"sh run.sh\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := "sleep 0.5\necho \"$VISOR_CHAT_ID $VISOR_MESSAGE_TYPE: $VISOR_USER_MESSAGE\"\n"
+	if err := os.WriteFile(filepath.Join(skillDir, "run.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+	srv.replies.record(12345, 42, sentReply{answer: "the answer"})
+
+	start := time.Now()
+	w := postWebhook(srv, telegram.Update{UpdateID: 3101, MessageReaction: &telegram.MessageReaction{
+		Chat:        telegram.Chat{ID: 12345, Type: "private"},
+		MessageID:   42,
+		NewReaction: []telegram.Reaction{{Type: "emoji", Emoji: "🔥"}},
+	}}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d", w.Code)
+	}
+	if took := time.Since(start); took > 400*time.Millisecond {
+		t.Fatalf("webhook took %v, the skill must not block it", took)
+	}
+	select {
+	case got := <-sent:
+		if got != "12345 reaction: the answer" {
+			t.Fatalf("skill output=%q", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for the skill output")
+	}
+}
+
+func TestNegativeReactionRetryOutlivesTheRequest(t *testing.T) {
+	sent := make(chan string, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		sent <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+
+	main := promptFunc(func(ctx context.Context, prompt string) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "retried", nil
+	})
+	srv := New(testConfig(""), main)
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	srv.setupState = setup.State{}
+	srv.replies.record(12345, 42, sentReply{prompt: "capital of australia?", answer: "sydney"})
+
+	// in webhook mode the request context is canceled once the handler returns
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv.handleReaction(ctx, &telegram.MessageReaction{
+		Chat:        telegram.Chat{ID: 12345, Type: "private"},
+		MessageID:   42,
+		NewReaction: []telegram.Reaction{{Type: "emoji", Emoji: "👎"}},
+	})
+
+	select {
+	case got := <-sent:
+		if !strings.HasPrefix(got, "retried") {
+			t.Fatalf("reply=%q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the retry was dropped with the request context")
+	}
+}
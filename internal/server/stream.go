@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"visor/internal/agent"
+	"visor/internal/platform/telegram"
+)
+
+// telegram rejects messages above 4096 chars; keep previews well below that.
+const maxStreamPreviewChars = 3500
+
+// liveReply is a telegram message that is edited while a turn streams.
+type liveReply struct {
+	chatID    int64
+	messageID int
+	lastText  string
+}
+
+// streamReply creates or updates the live message for the current turn.
+func (s *Server) streamReply(ctx context.Context, chatID int64, partial string) {
+	turn := agent.TurnFromContext(ctx)
+	if turn == nil {
+		return
+	}
+	preview := streamPreview(partial)
+	if preview == "" {
+		return
+	}
+	text := preview + " ▍"
+
+	s.liveMu.Lock()
+	live := s.liveReplies[turn.ID]
+	s.liveMu.Unlock()
+
+	if live == nil {
+		messageID, err := s.tg.SendMessageWithID(chatID, text)
+		if err != nil {
+			s.log.Warn(ctx, "stream reply send failed", "chat_id", chatID, "error", err.Error())
+			return
+		}
+		s.liveMu.Lock()
+		s.liveReplies[turn.ID] = &liveReply{chatID: chatID, messageID: messageID, lastText: text}
+		s.liveMu.Unlock()
+		s.log.Debug(ctx, "stream reply started", "chat_id", chatID, "message_id", messageID, "turn_id", turn.ID)
+		return
+	}
+
+	if live.lastText == text {
+		return
+	}
+	if err := s.tg.EditMessageText(chatID, live.messageID, text); err != nil {
+		s.log.Warn(ctx, "stream reply edit failed", "chat_id", chatID, "message_id", live.messageID, "error", err.Error())
+		return
+	}
+	live.lastText = text
+}
+
+// takeLiveReply removes and returns the live message of the current turn, if any.
+func (s *Server) takeLiveReply(ctx context.Context) *liveReply {
+	turn := agent.TurnFromContext(ctx)
+	if turn == nil {
+		return nil
+	}
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	live := s.liveReplies[turn.ID]
+	delete(s.liveReplies, turn.ID)
+	return live
+}
+
+// sendFinalReply replaces the live message with the final text, or sends a new message
+// when nothing was streamed (or the edit fails, e.g. because the text got too long).
+// markup, when set, attaches an inline keyboard to the reply. It returns the
+// id of the message that carries the reply.
+func (s *Server) sendFinalReply(ctx context.Context, chatID int64, live *liveReply, text string, markup *telegram.InlineKeyboardMarkup) (int, error) {
+	if live != nil {
+		err := s.tg.EditMessageTextWithMarkup(chatID, live.messageID, text, markup)
+		if err == nil {
+			return live.messageID, nil
+		}
+		s.log.Warn(ctx, "final stream edit failed, sending new message", "chat_id", chatID, "message_id", live.messageID, "error", err.Error())
+		_ = s.tg.DeleteMessage(chatID, live.messageID)
+	}
+	return s.tg.SendMessageWithMarkup(chatID, text, markup)
+}
+
+// streamPreview turns raw partial model output into user-visible text:
+// the contract metadata block and fenced action blocks are cut off, voice tags removed.
+func streamPreview(partial string) string {
+	text := partial
+	if idx := strings.Index(text, "\n---"); idx >= 0 {
+		text = text[:idx]
+	}
+	if strings.HasPrefix(text, "---") {
+		return ""
+	}
+	if idx := strings.Index(text, "```json"); idx >= 0 {
+		text = text[:idx]
+	}
+	text = stripVoiceTags(text)
+	if runes := []rune(text); len(runes) > maxStreamPreviewChars {
+		text = "…" + string(runes[len(runes)-maxStreamPreviewChars:])
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,38 @@
+package server
+
+import "testing"
+
+func TestStreamPreview_CutsMetadataAndActions(t *testing.T) {
+	cases := []struct {
+		name    string
+		partial string
+		want    string
+	}{
+		{name: "plain", partial: "hello there", want: "hello there"},
+		{name: "metadata", partial: "answer text\n---\nsend_voice: true", want: "answer text"},
+		{name: "metadata only", partial: "---\nsend_voice: true", want: ""},
+		{name: "action block", partial: "scheduled it\n```json\n{\"schedule_actions\":", want: "scheduled it"},
+		{name: "voice tags", partial: "[excited] nice", want: "nice"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := streamPreview(tc.partial); got != tc.want {
+				t.Fatalf("streamPreview(%q)=%q want %q", tc.partial, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStreamPreview_KeepsTailOfLongOutput(t *testing.T) {
+	long := make([]rune, maxStreamPreviewChars+50)
+	for i := range long {
+		long[i] = 'ä'
+	}
+	got := []rune(streamPreview(string(long) + "end"))
+	if len(got) != maxStreamPreviewChars+1 {
+		t.Fatalf("len=%d want %d", len(got), maxStreamPreviewChars+1)
+	}
+	if string(got[len(got)-3:]) != "end" {
+		t.Fatalf("tail=%q want end", string(got[len(got)-3:]))
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"visor/internal/agent"
+	"visor/internal/scheduler"
+	"visor/internal/skills"
+)
+
+// visorTools exposes schedule, skill and memory actions as tools for backends
+// with function calling. Results go back to the model within the same turn;
+// the fenced action blocks keep working for the other backends.
+type visorTools struct {
+	s *Server
+}
+
+var (
+	scheduleCreateSchema = json.RawMessage(`{"type":"object","properties":{"prompt":{"type":"string","description":"prompt sent to the agent when the task runs"},"run_at":{"type":"string","description":"first run, RFC3339 with timezone offset"},"interval_seconds":{"type":"integer","description":"repeat interval; omit for a one-shot task"},"critical":{"type":"boolean","description":"keep running when the daily usage budget is exhausted"}},"required":["prompt","run_at"]}`)
+	scheduleListSchema   = json.RawMessage(`{"type":"object","properties":{}}`)
+	scheduleDeleteSchema = json.RawMessage(`{"type":"object","properties":{"id":{"type":"string","description":"task id from schedule_list"}},"required":["id"]}`)
+	runSkillSchema       = json.RawMessage(`{"type":"object","properties":{"name":{"type":"string","description":"skill name"},"input":{"type":"string","description":"text passed to the skill as the user message"}},"required":["name"]}`)
+	memorySaveSchema     = json.RawMessage(`{"type":"object","properties":{"text":{"type":"string","description":"fact to remember, self-contained"}},"required":["text"]}`)
+	memorySearchSchema   = json.RawMessage(`{"type":"object","properties":{"query":{"type":"string"}},"required":["query"]}`)
+)
+
+func (t *visorTools) Tools() []agent.Tool {
+	var tools []agent.Tool
+	if t.s.scheduler != nil {
+		tools = append(tools,
+			agent.Tool{Name: "schedule_create", Description: "schedule a one-shot or recurring prompt", Parameters: scheduleCreateSchema},
+			agent.Tool{Name: "schedule_list", Description: "list scheduled tasks with their ids", Parameters: scheduleListSchema},
+			agent.Tool{Name: "schedule_delete", Description: "delete a scheduled task", Parameters: scheduleDeleteSchema},
+		)
+	}
+	if t.s.skills != nil && len(t.s.skills.All()) > 0 {
+		tools = append(tools, agent.Tool{Name: "run_skill", Description: "run an installed skill and return its output", Parameters: runSkillSchema})
+	}
+	if t.s.memory != nil {
+		tools = append(tools,
+			agent.Tool{Name: "memory_save", Description: "store a long-term memory", Parameters: memorySaveSchema},
+			agent.Tool{Name: "memory_search", Description: "search long-term memories", Parameters: memorySearchSchema},
+		)
+	}
+	return tools
+}
+
+func (t *visorTools) Call(ctx context.Context, call agent.ToolCall) (string, error) {
+	s := t.s
+	switch call.Name {
+	case "schedule_create":
+		var a scheduler.CreateAction
+		if err := decodeToolArgs(call, &a); err != nil {
+			return "", err
+		}
+		return s.executeScheduleActions(ctx, &scheduler.ActionEnvelope{Create: []scheduler.CreateAction{a}}), nil
+	case "schedule_list":
+		return s.executeScheduleActions(ctx, &scheduler.ActionEnvelope{List: true}), nil
+	case "schedule_delete":
+		var a scheduler.DeleteAction
+		if err := decodeToolArgs(call, &a); err != nil {
+			return "", err
+		}
+		return s.executeScheduleActions(ctx, &scheduler.ActionEnvelope{Delete: []scheduler.DeleteAction{a}}), nil
+	case "run_skill":
+		var a struct {
+			Name  string `json:"name"`
+			Input string `json:"input"`
+		}
+		if err := decodeToolArgs(call, &a); err != nil {
+			return "", err
+		}
+		return s.runSkillTool(ctx, a.Name, a.Input)
+	case "memory_save":
+		var a struct {
+			Text string `json:"text"`
+		}
+		if err := decodeToolArgs(call, &a); err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(a.Text) == "" {
+			return "", fmt.Errorf("text is required")
+		}
+		if err := s.memory.Save([]string{a.Text}); err != nil {
+			return "", err
+		}
+		return "saved", nil
+	case "memory_search":
+		var a struct {
+			Query string `json:"query"`
+		}
+		if err := decodeToolArgs(call, &a); err != nil {
+			return "", err
+		}
+		found, err := s.memory.Lookup(a.Query, 5)
+		if err != nil {
+			return "", err
+		}
+		if found == "" {
+			return "no matching memories", nil
+		}
+		return found, nil
+	default:
+		return "", fmt.Errorf("unknown tool %q", call.Name)
+	}
+}
+
+func (s *Server) runSkillTool(ctx context.Context, name, input string) (string, error) {
+	chatID, msgType := "", "text"
+	if turn := agent.TurnFromContext(ctx); turn != nil {
+		chatID, msgType = strconv.FormatInt(turn.Message.ChatID, 10), turn.Message.Type
+	}
+	return s.runSkill(ctx, name, input, chatID, msgType)
+}
+
+// runSkill runs the named skill on input for chatID and returns its output.
+func (s *Server) runSkill(ctx context.Context, name, input, chatID, msgType string) (string, error) {
+	skill := s.skills.Get(name)
+	if skill == nil {
+		return "", fmt.Errorf("skill %q not found", name)
+	}
+	result, err := s.skills.Exec().Run(ctx, skill, skills.Context{
+		UserMessage: input,
+		ChatID:      chatID,
+		MessageType: msgType,
+		Platform:    "telegram",
+		DataDir:     s.cfg.DataDir,
+		SkillDir:    skill.Dir,
+	})
+	if err != nil {
+		return "", err
+	}
+	s.log.Info(ctx, "skill ran", "skill", name, "message_type", msgType, "exit_code", result.ExitCode)
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("skill exited with %d: %s", result.ExitCode, truncate(strings.TrimSpace(result.Stderr), 500))
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+func decodeToolArgs(call agent.ToolCall, v any) error {
+	if len(call.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(call.Arguments, v); err != nil {
+		return fmt.Errorf("invalid %s arguments: %w", call.Name, err)
+	}
+	return nil
+}
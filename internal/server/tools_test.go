@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"visor/internal/agent"
+	"visor/internal/observability"
+	"visor/internal/scheduler"
+)
+
+func TestVisorTools_ScheduleCreateListDelete(t *testing.T) {
+	sched, err := scheduler.New(filepath.Join(t.TempDir(), "scheduler"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{scheduler: sched, log: observability.Component("server_test")}
+	tools := &visorTools{s: srv}
+	ctx := context.Background()
+
+	var names []string
+	for _, tool := range tools.Tools() {
+		names = append(names, tool.Name)
+		if !json.Valid(tool.Parameters) {
+			t.Fatalf("tool %s: invalid schema", tool.Name)
+		}
+	}
+	if strings.Join(names, ",") != "schedule_create,schedule_list,schedule_delete" {
+		t.Fatalf("tools=%v (skills and memory are not configured)", names)
+	}
+
+	args, _ := json.Marshal(scheduler.CreateAction{Prompt: "ping", RunAt: time.Now().UTC().Add(time.Hour).Format(time.RFC3339)})
+	out, err := tools.Call(ctx, agent.ToolCall{Name: "schedule_create", Arguments: args})
+	if err != nil || !strings.Contains(out, "scheduled ✅") {
+		t.Fatalf("create out=%q err=%v", out, err)
+	}
+	out, err = tools.Call(ctx, agent.ToolCall{Name: "schedule_list"})
+	if err != nil || !strings.Contains(out, "- ping @") {
+		t.Fatalf("list out=%q err=%v", out, err)
+	}
+	id := sched.List()[0].ID
+	out, err = tools.Call(ctx, agent.ToolCall{Name: "schedule_delete", Arguments: json.RawMessage(`{"id":"` + id + `"}`)})
+	if err != nil || !strings.Contains(out, "schedule deleted ✅") {
+		t.Fatalf("delete out=%q err=%v", out, err)
+	}
+
+	if _, err := tools.Call(ctx, agent.ToolCall{Name: "schedule_create", Arguments: json.RawMessage(`{"prompt":1}`)}); err == nil {
+		t.Fatal("expected error for invalid arguments")
+	}
+	if _, err := tools.Call(ctx, agent.ToolCall{Name: "rm_rf"}); err == nil {
+		t.Fatal("expected error for unknown tool")
+	}
+}
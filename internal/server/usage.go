@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"visor/internal/agent"
+	"visor/internal/scheduler"
+	"visor/internal/usage"
+)
+
+// recordUsage writes the token usage of the finished turn in ctx to the ledger
+// and applies the daily budget.
+func (s *Server) recordUsage(ctx context.Context) {
+	if s.usage == nil {
+		return
+	}
+	turn := agent.TurnFromContext(ctx)
+	if turn == nil {
+		return
+	}
+	s.recordUsageEntries(ctx, turn.Message.ChatID, turn.Message.Type, turn.Usage())
+}
+
+// recordUsageEntries writes usage entries for chatID to the ledger and applies
+// the daily budget.
+func (s *Server) recordUsageEntries(ctx context.Context, chatID int64, msgType string, entries []agent.Usage) {
+	if s.usage == nil || len(entries) == 0 {
+		return
+	}
+	for _, u := range entries {
+		e, err := s.usage.Record(usage.Entry{
+			ChatID:       chatID,
+			Type:         msgType,
+			Backend:      u.Backend,
+			Provider:     u.Provider,
+			Model:        u.Model,
+			InputTokens:  u.InputTokens,
+			OutputTokens: u.OutputTokens,
+		})
+		if err != nil {
+			s.log.Warn(ctx, "usage record failed", "backend", u.Backend, "error", err.Error())
+			continue
+		}
+		s.log.Debug(ctx, "usage recorded", "backend", e.Backend, "model", e.Model, "cost_usd", e.CostUSD, "priced", e.Priced)
+	}
+	s.applyBudget(ctx, s.now())
+}
+
+// applyBudget notifies the user when today's spend crosses a threshold, pins the
+// registry to the budget backend at the switch threshold, and unpins it again
+// once a new day starts below it.
+func (s *Server) applyBudget(ctx context.Context, now time.Time) {
+	budget := s.usage.Budget()
+	if !budget.Enabled() {
+		return
+	}
+	level, raised := s.usage.Escalate(now)
+
+	s.budgetMu.Lock()
+	defer s.budgetMu.Unlock()
+	if level < usage.LevelSwitch && s.budgetSwitched {
+		s.budgetSwitched = false
+		s.agent.ResetBackend()
+		s.log.Info(ctx, "budget backend switch reverted", "backend", s.agent.CurrentBackend())
+		s.notifyOwner(ctx, fmt.Sprintf("💸 new budget day — back to *%s*", s.agent.CurrentBackend()))
+	}
+	if !raised {
+		return
+	}
+
+	spent := s.usage.SpentToday(now)
+	s.log.Warn(ctx, "daily usage budget level reached", "level", level.String(), "spent_usd", spent)
+	switch level {
+	case usage.LevelWarn:
+		s.notifyOwner(ctx, fmt.Sprintf("💸 usage today: $%.2f (warn threshold $%.2f)", spent, budget.WarnUSD))
+	case usage.LevelSwitch, usage.LevelLimit:
+		note := fmt.Sprintf("💸 usage today: $%.2f", spent)
+		if !s.budgetSwitched && s.cfg.UsageBudgetBackend != "" {
+			if err := s.agent.SwitchBackend(s.cfg.UsageBudgetBackend); err != nil {
+				s.log.Warn(ctx, "budget backend switch failed", "backend", s.cfg.UsageBudgetBackend, "error", err.Error())
+			} else {
+				s.budgetSwitched = true
+				note += fmt.Sprintf(" — switched to *%s* for the rest of the day", s.cfg.UsageBudgetBackend)
+			}
+		}
+		if level == usage.LevelLimit {
+			note += fmt.Sprintf("\n⛔ daily limit $%.2f reached: non-critical scheduled tasks are skipped until tomorrow", budget.LimitUSD)
+		}
+		s.notifyOwner(ctx, note)
+	}
+}
+
+// allowScheduled reports whether a scheduled task may run under today's budget.
+func (s *Server) allowScheduled(ctx context.Context, task scheduler.Task) bool {
+	if s.usage == nil || task.Critical || s.usage.Level(s.now()) < usage.LevelLimit {
+		return true
+	}
+	s.log.Warn(ctx, "scheduled task skipped, daily budget exhausted", "task_id", task.ID)
+	s.notifyOwner(ctx, fmt.Sprintf("⛔ skipped scheduled task `%s` (daily budget reached): %s", task.ID, truncate(task.Prompt, 80)))
+	return false
+}
+
+func (s *Server) notifyOwner(ctx context.Context, text string) {
+	if s.cfg.UserChatID == "" {
+		return
+	}
+	if err := s.tg.SendMessage(mustParseChatID(s.cfg.UserChatID), text); err != nil {
+		s.log.Warn(ctx, "owner notification failed", "error", err.Error())
+	}
+}
+
+// now returns the current time in the configured timezone, so budget days and
+// /usage periods start at local midnight.
+func (s *Server) now() time.Time {
+	if s.location == nil {
+		return time.Now()
+	}
+	return time.Now().In(s.location)
+}
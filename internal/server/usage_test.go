@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"visor/internal/agent"
+	"visor/internal/orchestrator"
+	"visor/internal/platform/telegram"
+	"visor/internal/scheduler"
+	"visor/internal/usage"
+)
+
+func TestApplyBudget_SwitchesBackendAndSkipsScheduledTasks(t *testing.T) {
+	texts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+
+	reg := agent.NewRegistry()
+	reg.Register("premium", &agent.EchoAgent{}, 0)
+	reg.Register("cheap", &agent.EchoAgent{}, 1)
+	cfg := testConfig("")
+	cfg.UsageBudgetBackend = "cheap"
+	srv := New(cfg, reg)
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	ledger, err := usage.Open(t.TempDir(), usage.PriceTable{"premium": {InputPerMTok: 1}}, usage.Budget{SwitchUSD: 1, LimitUSD: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.usage = ledger
+
+	now := time.Now()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-texts:
+			if !strings.Contains(got, want) {
+				t.Fatalf("message=%q want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+
+	if _, err := ledger.Record(usage.Entry{Time: now, Backend: "premium", InputTokens: 2_500_000}); err != nil {
+		t.Fatal(err)
+	}
+	srv.applyBudget(context.Background(), now)
+	expect("switched to *cheap*")
+	if got := srv.agent.CurrentBackend(); got != "cheap" {
+		t.Fatalf("backend=%q want cheap", got)
+	}
+
+	task := scheduler.Task{ID: "t1", Prompt: "daily digest"}
+	if srv.allowScheduled(context.Background(), task) {
+		t.Fatal("non-critical task allowed over the daily limit")
+	}
+	expect("skipped scheduled task `t1`")
+	task.Critical = true
+	if !srv.allowScheduled(context.Background(), task) {
+		t.Fatal("critical task refused")
+	}
+
+	srv.applyBudget(context.Background(), now.AddDate(0, 0, 1))
+	expect("back to *premium*")
+	if got := srv.agent.CurrentBackend(); got != "premium" {
+		t.Fatalf("backend=%q want premium", got)
+	}
+}
+
+func TestRunFanout_RecordsStationUsage(t *testing.T) {
+	texts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer ts.Close()
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"found x"},"done":true,"prompt_eval_count":1500000,"eval_count":10}`+"\n")
+	}))
+	defer ollama.Close()
+
+	cfg := testConfig("")
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { waitJournalDrained(t, cfg.DataDir+"/agent-queue/pending.json") })
+	srv := New(cfg, &agent.EchoAgent{})
+	srv.tg = telegram.NewClientWithOptions("test-token", ts.URL+"/bot", ts.Client())
+	ledger, err := usage.Open(t.TempDir(), usage.PriceTable{"ollama": {InputPerMTok: 1}}, usage.Budget{WarnUSD: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.usage = ledger
+	orch, err := orchestrator.New(&orchestrator.StationsConfig{Stations: []orchestrator.Station{
+		{Name: "research", Backends: []orchestrator.StationBackend{{Backend: "ollama"}}},
+	}}, func(string, int, orchestrator.StationBackend) (agent.Agent, error) {
+		return agent.NewOllamaAgent(agent.OllamaConfig{BaseURL: ollama.URL, Model: "llama3.2"}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOrchestrator(orch)
+
+	srv.runFanout(context.Background(), 12345, "plan the trip", []orchestrator.Task{{Station: "research", Prompt: "find x"}})
+
+	today := srv.usage.Since(time.Now().Add(-time.Hour))
+	if today.Calls != 1 || today.InputTokens != 1_500_000 || today.OutputTokens != 10 {
+		t.Fatalf("ledger totals=%+v, want the station call", today.Group)
+	}
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case text := <-texts:
+			if strings.Contains(text, "warn threshold") {
+				return
+			}
+		case <-deadline:
+			t.Fatal("timeout waiting for the budget warning")
+		}
+	}
+}
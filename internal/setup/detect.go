@@ -59,8 +59,8 @@ project is not fully initialized yet (` + missing + `).
 
 you must guide the user through setup in small steps:
 0) prerequisites first: verify required tools (go, git, docker, docker compose, curl; plus caddy if used) and install missing ones before continuing
-1) ingress: choose cloudflare tunnel OR direct dns+caddy, confirm public base url + dns routing works
-2) core setup: .env (without overwriting existing), telegram validate, openai validate, webhook, /health
+1) ingress: choose TELEGRAM_MODE=polling (no public url needed), cloudflare tunnel OR direct dns+caddy; for tunnel/dns confirm public base url + dns routing works
+2) core setup: .env (without overwriting existing), telegram validate, openai validate, webhook (skip in polling mode), /health
 3) finish: personality keep/custom, send test message, write setup summary, cleanup setup hints
 
 if you need to execute setup actions, include one dedicated setup action json block only in your final response.
@@ -16,7 +16,7 @@ import (
 type Context struct {
 	UserMessage string `json:"user_message"`
 	ChatID      string `json:"chat_id"`
-	MessageType string `json:"message_type"` // "text", "voice", "photo", etc.
+	MessageType string `json:"message_type"` // "text", "voice", "photo", "document", etc.
 	Platform    string `json:"platform"`     // "telegram"
 	DataDir     string `json:"data_dir"`
 	SkillDir    string `json:"skill_dir"` // absolute path to this skill's directory
@@ -0,0 +1,50 @@
+package usage
+
+// Budget holds the daily spend thresholds in USD. A zero threshold is disabled.
+type Budget struct {
+	WarnUSD   float64 // notify the user
+	SwitchUSD float64 // move the registry to the cheaper backend
+	LimitUSD  float64 // refuse non-critical scheduled prompts
+}
+
+// Level is how far today's spend has progressed through the budget.
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelWarn
+	LevelSwitch
+	LevelLimit
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelWarn:
+		return "warn"
+	case LevelSwitch:
+		return "switch"
+	case LevelLimit:
+		return "limit"
+	default:
+		return "ok"
+	}
+}
+
+// Enabled reports whether any threshold is set.
+func (b Budget) Enabled() bool {
+	return b.WarnUSD > 0 || b.SwitchUSD > 0 || b.LimitUSD > 0
+}
+
+// Level returns the highest threshold reached by spent.
+func (b Budget) Level(spent float64) Level {
+	switch {
+	case b.LimitUSD > 0 && spent >= b.LimitUSD:
+		return LevelLimit
+	case b.SwitchUSD > 0 && spent >= b.SwitchUSD:
+		return LevelSwitch
+	case b.WarnUSD > 0 && spent >= b.WarnUSD:
+		return LevelWarn
+	default:
+		return LevelOK
+	}
+}
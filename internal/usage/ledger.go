@@ -0,0 +1,299 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"visor/internal/observability"
+)
+
+// retention is how far back entries are kept in memory; enough for a calendar month.
+const retention = 32 * 24 * time.Hour
+
+// Entry is one model call in the ledger.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	ChatID       int64     `json:"chat_id"`
+	Type         string    `json:"type,omitempty"` // queue message type: text, voice, scheduled, fanout, subagent...
+	Backend      string    `json:"backend"`
+	Provider     string    `json:"provider,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+	Priced       bool      `json:"priced"`
+}
+
+// Ledger is an append-only jsonl record of token usage with cost estimates
+// and daily budget tracking.
+type Ledger struct {
+	path    string
+	prices  PriceTable
+	budget  Budget
+	mu      sync.Mutex
+	entries []Entry // last `retention` of entries, oldest first
+	day     string  // day of the last budget check
+	level   Level   // highest level reported for day
+	log     *observability.Logger
+}
+
+// Open loads the ledger from dir/ledger.jsonl, creating dir if needed.
+func Open(dir string, prices PriceTable, budget Budget) (*Ledger, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("data dir is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create usage dir: %w", err)
+	}
+	l := &Ledger{
+		path:   filepath.Join(dir, "ledger.jsonl"),
+		prices: prices,
+		budget: budget,
+		log:    observability.Component("usage"),
+	}
+	if err := l.load(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Ledger) load(now time.Time) error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open ledger: %w", err)
+	}
+	defer f.Close()
+
+	cutoff := now.Add(-retention)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	skipped := 0
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			skipped++
+			continue
+		}
+		if e.Time.Before(cutoff) {
+			continue
+		}
+		l.entries = append(l.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read ledger: %w", err)
+	}
+	if skipped > 0 {
+		l.log.Warn(nil, "usage ledger: skipped unparseable lines", "count", skipped)
+	}
+	sort.SliceStable(l.entries, func(i, j int) bool { return l.entries[i].Time.Before(l.entries[j].Time) })
+	l.log.Info(nil, "usage ledger loaded", "entries", len(l.entries), "path", l.path)
+	return nil
+}
+
+// Record prices e from the price table and appends it to the ledger.
+func (l *Ledger) Record(e Entry) (Entry, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if p, ok := l.prices.Lookup(e.Backend, e.Provider, e.Model); ok {
+		e.CostUSD = p.Cost(e.InputTokens, e.OutputTokens)
+		e.Priced = true
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, fmt.Errorf("encode usage entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return e, fmt.Errorf("open ledger: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return e, fmt.Errorf("append ledger: %w", err)
+	}
+
+	l.entries = append(l.entries, e)
+	cutoff := e.Time.Add(-retention)
+	drop := 0
+	for drop < len(l.entries) && l.entries[drop].Time.Before(cutoff) {
+		drop++
+	}
+	l.entries = l.entries[drop:]
+	return e, nil
+}
+
+// Group is the usage of one backend/model within a period.
+type Group struct {
+	Key          string // backend or backend/model
+	Calls        int
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+}
+
+// Totals is the usage within a period.
+type Totals struct {
+	Group
+	Unpriced int
+	Groups   []Group // most expensive first
+}
+
+// Since sums all entries at or after from.
+func (l *Ledger) Since(from time.Time) Totals {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var t Totals
+	byKey := map[string]*Group{}
+	for _, e := range l.entries {
+		if e.Time.Before(from) {
+			continue
+		}
+		key := e.Backend
+		if e.Model != "" {
+			key += "/" + e.Model
+		}
+		g := byKey[key]
+		if g == nil {
+			g = &Group{Key: key}
+			byKey[key] = g
+		}
+		for _, acc := range []*Group{g, &t.Group} {
+			acc.Calls++
+			acc.InputTokens += e.InputTokens
+			acc.OutputTokens += e.OutputTokens
+			acc.CostUSD += e.CostUSD
+		}
+		if !e.Priced {
+			t.Unpriced++
+		}
+	}
+	for _, g := range byKey {
+		t.Groups = append(t.Groups, *g)
+	}
+	sort.Slice(t.Groups, func(i, j int) bool {
+		if t.Groups[i].CostUSD != t.Groups[j].CostUSD {
+			return t.Groups[i].CostUSD > t.Groups[j].CostUSD
+		}
+		return t.Groups[i].Key < t.Groups[j].Key
+	})
+	return t
+}
+
+// Budget returns the configured daily budget.
+func (l *Ledger) Budget() Budget { return l.budget }
+
+// SpentToday returns today's estimated cost (days start at midnight in now's location).
+func (l *Ledger) SpentToday(now time.Time) float64 {
+	return l.Since(startOfDay(now)).CostUSD
+}
+
+// Level returns today's budget level.
+func (l *Ledger) Level(now time.Time) Level {
+	return l.budget.Level(l.SpentToday(now))
+}
+
+// Escalate returns today's budget level and whether it rose since the last
+// call. Each level is reported once per day.
+func (l *Ledger) Escalate(now time.Time) (Level, bool) {
+	level := l.Level(now)
+	day := now.Format("2006-01-02")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if day != l.day {
+		l.day, l.level = day, LevelOK
+	}
+	if level <= l.level {
+		return level, false
+	}
+	l.level = level
+	return level, true
+}
+
+// Report renders the /usage reply with today, week and month breakdowns.
+func (l *Ledger) Report(now time.Time) string {
+	var b strings.Builder
+	b.WriteString("📊 usage")
+	periods := []struct {
+		name string
+		from time.Time
+	}{
+		{"today", startOfDay(now)},
+		{"this week", startOfWeek(now)},
+		{"this month", startOfMonth(now)},
+	}
+	for _, p := range periods {
+		t := l.Since(p.from)
+		fmt.Fprintf(&b, "\n\n*%s*: %s", p.name, formatGroup(t.Group))
+		if t.Calls == 0 {
+			continue
+		}
+		for _, g := range t.Groups {
+			fmt.Fprintf(&b, "\n- `%s`: %s", g.Key, formatGroup(g))
+		}
+		if t.Unpriced > 0 {
+			fmt.Fprintf(&b, "\n_%d call(s) without a price_", t.Unpriced)
+		}
+	}
+	if l.budget.Enabled() {
+		fmt.Fprintf(&b, "\n\nbudget today: $%.2f spent", l.SpentToday(now))
+		if l.budget.WarnUSD > 0 {
+			fmt.Fprintf(&b, " · warn $%.2f", l.budget.WarnUSD)
+		}
+		if l.budget.SwitchUSD > 0 {
+			fmt.Fprintf(&b, " · switch $%.2f", l.budget.SwitchUSD)
+		}
+		if l.budget.LimitUSD > 0 {
+			fmt.Fprintf(&b, " · limit $%.2f", l.budget.LimitUSD)
+		}
+	}
+	return b.String()
+}
+
+func formatGroup(g Group) string {
+	if g.Calls == 0 {
+		return "no calls"
+	}
+	return fmt.Sprintf("%d call(s) · %s in / %s out · $%.2f", g.Calls, formatTokens(g.InputTokens), formatTokens(g.OutputTokens), g.CostUSD)
+}
+
+func formatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the most recent monday at midnight.
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceTableLookup(t *testing.T) {
+	table := PriceTable{
+		"gpt-4o-mini":               {InputPerMTok: 0.15, OutputPerMTok: 0.6},
+		"gpt-4o":                    {InputPerMTok: 2.5, OutputPerMTok: 10},
+		"anthropic/claude-sonnet-4": {InputPerMTok: 3, OutputPerMTok: 15},
+		"ollama":                    {},
+	}
+	tests := []struct {
+		backend, provider, model string
+		want                     float64
+		ok                       bool
+	}{
+		{"openai", "", "gpt-4o-mini-2024-07-18", 0.15, true},
+		{"openai", "", "gpt-4o", 2.5, true},
+		{"pi", "anthropic", "claude-sonnet-4", 3, true},
+		{"ollama", "", "llama3.2", 0, true},
+		{"exec", "", "", 0, false},
+	}
+	for _, tc := range tests {
+		p, ok := table.Lookup(tc.backend, tc.provider, tc.model)
+		if ok != tc.ok || p.InputPerMTok != tc.want {
+			t.Errorf("Lookup(%s,%s,%s) = %+v,%v want input %v,%v", tc.backend, tc.provider, tc.model, p, ok, tc.want, tc.ok)
+		}
+	}
+	if got := (Price{InputPerMTok: 3, OutputPerMTok: 15}).Cost(1_000_000, 100_000); got != 4.5 {
+		t.Fatalf("cost=%v want 4.5", got)
+	}
+}
+
+func TestLoadPricesMissingFile(t *testing.T) {
+	table, err := LoadPrices(filepath.Join(t.TempDir(), "nope.json"))
+	if err != nil || len(table) != 0 {
+		t.Fatalf("table=%v err=%v", table, err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	_ = os.WriteFile(bad, []byte(`{"m":{"input_per_mtok":-1}}`), 0o644)
+	if _, err := LoadPrices(bad); err == nil {
+		t.Fatal("expected error for negative price")
+	}
+}
+
+func TestLedgerRecordPersistsAndReports(t *testing.T) {
+	dir := t.TempDir()
+	prices := PriceTable{"gpt-4o-mini": {InputPerMTok: 1, OutputPerMTok: 2}}
+	l, err := Open(dir, prices, Budget{WarnUSD: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 11, 15, 0, 0, 0, time.UTC) // wednesday
+	for _, e := range []Entry{
+		{Time: now.Add(-time.Hour), ChatID: 1, Backend: "openai", Model: "gpt-4o-mini", InputTokens: 500_000, OutputTokens: 100_000},
+		{Time: now.AddDate(0, 0, -1), ChatID: 1, Backend: "ollama", Model: "llama3.2", InputTokens: 2000, OutputTokens: 300},
+		{Time: now.AddDate(0, 0, -9), ChatID: 1, Backend: "openai", Model: "gpt-4o-mini", InputTokens: 1_000_000},
+	} {
+		if _, err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := l.SpentToday(now); got != 0.7 {
+		t.Fatalf("spent today=%v want 0.7", got)
+	}
+	week := l.Since(startOfWeek(now))
+	if week.Calls != 2 || week.Unpriced != 1 || week.Groups[0].Key != "openai/gpt-4o-mini" {
+		t.Fatalf("week=%+v", week)
+	}
+	if month := l.Since(startOfMonth(now)); month.Calls != 3 || math.Abs(month.CostUSD-1.7) > 1e-9 {
+		t.Fatalf("month=%+v", month)
+	}
+
+	report := l.Report(now)
+	for _, want := range []string{"*today*: 1 call(s) · 500.0k in / 100.0k out · $0.70", "*this week*: 2 call(s)", "`ollama/llama3.2`", "without a price", "budget today: $0.70 spent · warn $1.00"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report missing %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestLedgerReloadKeepsRecentEntries(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, PriceTable{}, Budget{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, at := range []time.Time{now.AddDate(0, 0, -40), now.Add(-time.Hour), now} {
+		if _, err := l.Record(Entry{Time: at, Backend: "pi", InputTokens: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reopened, err := Open(dir, PriceTable{}, Budget{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Since(time.Time{}); got.Calls != 2 || got.Unpriced != 2 {
+		t.Fatalf("reloaded=%+v want 2 recent unpriced calls", got)
+	}
+}
+
+func TestLedgerEscalateOncePerLevelPerDay(t *testing.T) {
+	l, err := Open(t.TempDir(), PriceTable{"m": {InputPerMTok: 1}}, Budget{WarnUSD: 1, SwitchUSD: 2, LimitUSD: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)
+	record := func(at time.Time, usd float64) {
+		if _, err := l.Record(Entry{Time: at, Backend: "x", Model: "m", InputTokens: int(usd * 1e6)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record(day, 1.5)
+	if level, raised := l.Escalate(day); level != LevelWarn || !raised {
+		t.Fatalf("level=%s raised=%v want warn/true", level, raised)
+	}
+	if _, raised := l.Escalate(day); raised {
+		t.Fatal("warn reported twice")
+	}
+	record(day.Add(time.Hour), 2)
+	if level, raised := l.Escalate(day.Add(time.Hour)); level != LevelLimit || !raised {
+		t.Fatalf("level=%s raised=%v want limit/true", level, raised)
+	}
+	next := day.AddDate(0, 0, 1)
+	if level, raised := l.Escalate(next); level != LevelOK || raised {
+		t.Fatalf("next day level=%s raised=%v", level, raised)
+	}
+}
@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	InputPerMTok  float64 `json:"input_per_mtok"`
+	OutputPerMTok float64 `json:"output_per_mtok"`
+}
+
+// PriceTable maps "provider/model", "model" or "backend" to a price. Model keys
+// also match as a prefix, so "gpt-4o-mini" covers "gpt-4o-mini-2024-07-18".
+type PriceTable map[string]Price
+
+// LoadPrices reads a json price table. A missing file yields an empty table:
+// every call is then recorded unpriced at zero cost.
+func LoadPrices(path string) (PriceTable, error) {
+	if path == "" {
+		return PriceTable{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return PriceTable{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read prices: %w", err)
+	}
+	var table PriceTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for key, p := range table {
+		if p.InputPerMTok < 0 || p.OutputPerMTok < 0 {
+			return nil, fmt.Errorf("price %q: negative price", key)
+		}
+	}
+	return table, nil
+}
+
+// Lookup finds the price for a call: exact "provider/model", exact model, the
+// longest key prefixing the model, then the backend name.
+func (t PriceTable) Lookup(backend, provider, model string) (Price, bool) {
+	if provider != "" && model != "" {
+		if p, ok := t[provider+"/"+model]; ok {
+			return p, true
+		}
+	}
+	if model != "" {
+		if p, ok := t[model]; ok {
+			return p, true
+		}
+		best := ""
+		for key := range t {
+			if strings.HasPrefix(model, key) && len(key) > len(best) {
+				best = key
+			}
+		}
+		if best != "" {
+			return t[best], true
+		}
+	}
+	p, ok := t[backend]
+	return p, ok
+}
+
+// Cost returns the estimated USD cost of the given token counts.
+func (p Price) Cost(input, output int) float64 {
+	return (float64(input)*p.InputPerMTok + float64(output)*p.OutputPerMTok) / 1e6
+}
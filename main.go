@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"visor/internal/agent"
 	"visor/internal/branding"
 	"visor/internal/config"
 	"visor/internal/observability"
+	"visor/internal/orchestrator"
 	"visor/internal/server"
 )
 
@@ -47,6 +50,18 @@ func main() {
 	defer a.Close()
 
 	srv := server.New(cfg, a)
+
+	orch, err := createOrchestrator(cfg)
+	if err != nil {
+		log.Error(context.Background(), "subagent stations init failed", "error", err.Error())
+		os.Exit(1)
+	}
+	if orch != nil {
+		defer orch.Close()
+		srv.SetOrchestrator(orch)
+		log.Info(context.Background(), "subagent stations loaded", "stations", strings.Join(orch.Stations(), ","))
+	}
+
 	if err := srv.ListenAndServe(); err != nil {
 		log.Error(context.Background(), "server failed", "error", err.Error())
 		os.Exit(1)
@@ -54,8 +69,16 @@ func main() {
 }
 
 func createAgents(cfg *config.Config) (agent.Agent, error) {
+	routes, err := agent.LoadRoutes(cfg.AgentRoutesFile)
+	if err != nil {
+		return nil, fmt.Errorf("agent routes: %w", err)
+	}
+
 	// single backend (backward compat)
 	if len(cfg.AgentBackends) <= 1 {
+		if len(routes) > 0 {
+			return nil, fmt.Errorf("agent routes in %s need several AGENT_BACKENDS", cfg.AgentRoutesFile)
+		}
 		return createSingleAgent(cfg, cfg.AgentBackend)
 	}
 
@@ -68,23 +91,154 @@ func createAgents(cfg *config.Config) (agent.Agent, error) {
 		}
 		registry.Register(name, a, i)
 	}
+	registry.SetBackoff(cfg.AgentBreakerBackoff, cfg.AgentBreakerMaxBackoff)
+	registry.SetHedging(agent.HedgePolicy{Delay: cfg.AgentHedgeDelay, Chats: cfg.AgentHedgeChats})
+	if err := registry.SetRoutes(routes); err != nil {
+		return nil, fmt.Errorf("agent routes: %w", err)
+	}
 	registry.HealthCheckAll(context.Background())
+	registry.StartProber(cfg.AgentProbeInterval)
 	return registry, nil
 }
 
 func createSingleAgent(cfg *config.Config, name string) (agent.Agent, error) {
+	return createBackend(cfg, name, cfg.DataDir)
+}
+
+// createBackend builds one backend; stateDir holds its persisted model choice so
+// subagent stations don't overwrite the main agent's model.
+func createBackend(cfg *config.Config, name, stateDir string) (agent.Agent, error) {
 	switch name {
 	case "pi":
 		pi := agent.NewPiAgentWithModelState(agent.ProcessConfig{
-			RestartDelay: 3 * time.Second,
-		}, filepath.Join(cfg.DataDir, "current-model.json"))
+			RestartDelay:    3 * time.Second,
+			MaxRestartDelay: cfg.PiMaxRestartDelay,
+			Limits: agent.ResourceLimits{
+				MemoryMB:   cfg.PiLimitMemoryMB,
+				CPUSeconds: cfg.PiLimitCPUSeconds,
+				OpenFiles:  cfg.PiLimitOpenFiles,
+			},
+		}, filepath.Join(stateDir, "current-model.json"))
 		if err := pi.Start(); err != nil {
 			return nil, err
 		}
 		return pi, nil
+	case "openai":
+		systemPrompt, err := readSystemPrompt(cfg.OpenAIChatSystemPromptFile)
+		if err != nil {
+			return nil, err
+		}
+		return agent.NewOpenAIAgent(agent.OpenAIConfig{
+			BaseURL:        cfg.OpenAIChatBaseURL,
+			APIKey:         cfg.OpenAIChatAPIKey,
+			Model:          cfg.OpenAIChatModel,
+			SystemPrompt:   systemPrompt,
+			Tools:          cfg.OpenAIChatTools,
+			Vision:         cfg.OpenAIChatVision,
+			ModelStatePath: filepath.Join(stateDir, "openai-model.json"),
+		}), nil
+	case "ollama":
+		systemPrompt, err := readSystemPrompt(cfg.OllamaSystemPromptFile)
+		if err != nil {
+			return nil, err
+		}
+		return agent.NewOllamaAgent(agent.OllamaConfig{
+			BaseURL:        cfg.OllamaBaseURL,
+			Model:          cfg.OllamaModel,
+			SystemPrompt:   systemPrompt,
+			Tools:          cfg.OllamaTools,
+			Vision:         cfg.OllamaVision,
+			ModelStatePath: filepath.Join(stateDir, "ollama-model.json"),
+		}), nil
 	case "echo":
 		return &agent.EchoAgent{}, nil
+	case "cassette":
+		return createCassetteAgent(cfg, stateDir)
 	default:
+		return createExecAgent(cfg, name)
+	}
+}
+
+// createOrchestrator loads SUBAGENT_STATIONS_FILE; nil when the file does not exist.
+func createOrchestrator(cfg *config.Config) (*orchestrator.Orchestrator, error) {
+	stations, err := orchestrator.LoadStations(cfg.SubagentStationsFile)
+	if err != nil || stations == nil {
+		return nil, err
+	}
+	return orchestrator.New(stations, func(station string, rank int, b orchestrator.StationBackend) (agent.Agent, error) {
+		stateDir := filepath.Join(cfg.DataDir, "stations", station, strconv.Itoa(rank))
+		a, err := createBackend(cfg, b.Backend, stateDir)
+		if err != nil {
+			return nil, err
+		}
+		if b.Model != "" {
+			ms, ok := a.(agent.ModelSwitcher)
+			if !ok {
+				return nil, fmt.Errorf("backend %s does not support a model override", b.Backend)
+			}
+			if err := ms.SetModel(b.Model); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	})
+}
+
+// createCassetteAgent replays CASSETTE_FILE, or records CASSETTE_BACKEND into it.
+func createCassetteAgent(cfg *config.Config, stateDir string) (agent.Agent, error) {
+	c := agent.CassetteConfig{Path: cfg.CassetteFile, Mode: agent.CassetteMode(cfg.CassetteMode), Exact: cfg.CassetteExact}
+	if c.Mode == agent.CassetteRecord {
+		if cfg.CassetteBackend == "" {
+			return nil, fmt.Errorf("CASSETTE_BACKEND is required in record mode")
+		}
+		inner, err := createBackend(cfg, cfg.CassetteBackend, stateDir)
+		if err != nil {
+			return nil, fmt.Errorf("cassette backend %s: %w", cfg.CassetteBackend, err)
+		}
+		c.Inner = inner
+	}
+	return agent.NewCassetteAgent(c)
+}
+
+// createExecAgent builds a generic cli backend from EXEC_BACKENDS_FILE or, for
+// the name "exec", from EXEC_* env variables.
+func createExecAgent(cfg *config.Config, name string) (agent.Agent, error) {
+	backends, err := agent.LoadExecBackends(cfg.ExecBackendsFile)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := backends[name]
+	if !ok && name == "exec" {
+		def, ok, err = agent.ExecBackendFromEnv()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		if len(backends) > 0 {
+			return nil, fmt.Errorf("unknown agent backend: %s (exec backends in %s: %s)", name, cfg.ExecBackendsFile, strings.Join(agent.ExecBackendNames(backends), ", "))
+		}
 		return nil, fmt.Errorf("unknown agent backend: %s", name)
 	}
+
+	a, err := agent.NewExecAgent(def)
+	if err != nil {
+		return nil, fmt.Errorf("exec backend %s: %w", name, err)
+	}
+	if err := a.Start(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// readSystemPrompt loads a backend system prompt; a missing file means none.
+func readSystemPrompt(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("read system prompt %s: %w", path, err)
+	}
+	return string(data), nil
 }